@@ -0,0 +1,515 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Lifetimes of the one-time tokens emailed to users
+const (
+	passwordResetTTL     = time.Hour
+	emailVerificationTTL = 24 * time.Hour
+)
+
+// Account email settings, initialized in setup
+var (
+	// appURL is the frontend that links in account emails point to
+	appURL string
+
+	// accountMailLimiter caps the account emails sent to each address
+	accountMailLimiter *RateLimiter
+)
+
+var (
+	errNoAccount            = errors.New("account not found")
+	errInvalidAuthToken     = errors.New("token is invalid or has expired")
+	errEmailAlreadyVerified = errors.New("email is already verified")
+)
+
+// ForgotPasswordRequest asks for a password reset link
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+// ResetPasswordRequest sets a new password with the token from a reset link
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// VerifyEmailRequest confirms an email address with the token from a verification link
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+// ResendVerificationRequest asks for a new verification link
+type ResendVerificationRequest struct {
+	Email string `json:"email"`
+}
+
+// appURLFromEnv reads APP_URL, defaulting to the local frontend
+func appURLFromEnv() string {
+	url := strings.TrimRight(os.Getenv("APP_URL"), "/")
+	if url == "" {
+		return "http://localhost:3000"
+	}
+	return url
+}
+
+// mailAllowed reports whether another account email may go to an address
+func mailAllowed(kind, email string) bool {
+	return accountMailLimiter.IsAllowed(kind + ":" + strings.ToLower(email))
+}
+
+// sendPasswordResetEmail emails a reset link if the account exists.
+// Unknown addresses are not an error, so callers cannot reveal which
+// emails have accounts.
+func sendPasswordResetEmail(email string) error {
+	if !mailAllowed("reset", email) {
+		fmt.Printf("Password reset email to %s skipped: rate limited\n", email)
+		return nil
+	}
+
+	token, err := accountStore.CreatePasswordResetToken(email)
+	if err == errNoAccount {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return mailer.Send(MailMessage{
+		To:      email,
+		Subject: "Reset your GoTicket password",
+		Body: fmt.Sprintf("Someone asked to reset the password of your GoTicket account.\n\n"+
+			"Choose a new password within the next hour:\n%s/reset-password?token=%s\n\n"+
+			"If it wasn't you, ignore this email and your password will stay the same.\n", appURL, token),
+	})
+}
+
+// sendVerificationEmail emails a link confirming the address, unless it is
+// unknown or already confirmed
+func sendVerificationEmail(email string) error {
+	if !mailAllowed("verify", email) {
+		fmt.Printf("Verification email to %s skipped: rate limited\n", email)
+		return nil
+	}
+
+	token, err := accountStore.CreateEmailVerificationToken(email)
+	if err == errNoAccount || err == errEmailAlreadyVerified {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return mailer.Send(MailMessage{
+		To:      email,
+		Subject: "Confirm your GoTicket email address",
+		Body: fmt.Sprintf("Welcome to GoTicket!\n\n"+
+			"Confirm your email address within 24 hours:\n%s/verify-email?token=%s\n\n"+
+			"If you didn't create an account, ignore this email.\n", appURL, token),
+	})
+}
+
+// =====================================================
+// Account Email Handlers
+// =====================================================
+
+func handleForgotPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "Only POST method is allowed")
+		return
+	}
+
+	var req ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, "Invalid request", "Invalid JSON format")
+		return
+	}
+
+	req.Email = strings.TrimSpace(req.Email)
+	if !isValidEmail(req.Email) {
+		sendError(w, http.StatusBadRequest, "Validation error", "A valid email is required")
+		return
+	}
+
+	if err := sendPasswordResetEmail(req.Email); err != nil {
+		fmt.Printf("Error sending password reset email: %v\n", err)
+	}
+
+	// The same answer whether or not the account exists
+	sendJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "If an account exists for this email, a password reset link has been sent",
+	})
+}
+
+func handleResetPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "Only POST method is allowed")
+		return
+	}
+
+	var req ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, "Invalid request", "Invalid JSON format")
+		return
+	}
+
+	if req.Token == "" {
+		sendError(w, http.StatusBadRequest, "Validation error", "token is required")
+		return
+	}
+	if err := validatePassword(req.Password); err != nil {
+		sendError(w, http.StatusBadRequest, "Validation error", err.Error())
+		return
+	}
+
+	userID, err := accountStore.ResetPassword(req.Token, req.Password)
+	if err == errInvalidAuthToken {
+		sendError(w, http.StatusBadRequest, "Invalid token", "This reset link is invalid or has expired")
+		return
+	}
+	if err != nil {
+		fmt.Printf("Error resetting password: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to reset password")
+		return
+	}
+
+	fmt.Printf("Password reset for user %s\n", userID)
+
+	// Whoever knew the old password may still be signed in
+	if _, err := sessionStore.RevokeUserSessions(userID, "", sessionRevokedOnPassword); err != nil {
+		fmt.Printf("Error signing out sessions after password reset: %v\n", err)
+	}
+
+	if user, err := userStore.GetUserByID(userID); err == nil {
+		// Resetting the password is how owners unlock their account early
+		clearLoginFailures(user.Email)
+
+		err = mailer.Send(MailMessage{
+			To:      user.Email,
+			Subject: "Your GoTicket password was changed",
+			Body:    "The password of your GoTicket account was just reset. If it wasn't you, reset it again right away and contact support.\n",
+		})
+		if err != nil {
+			fmt.Printf("Error sending password change notice: %v\n", err)
+		}
+	}
+
+	sendJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Password reset successfully; sign in with your new password",
+	})
+}
+
+func handleVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "Only POST method is allowed")
+		return
+	}
+
+	var req VerifyEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, "Invalid request", "Invalid JSON format")
+		return
+	}
+
+	if req.Token == "" {
+		sendError(w, http.StatusBadRequest, "Validation error", "token is required")
+		return
+	}
+
+	userID, err := accountStore.VerifyEmail(req.Token)
+	if err == errInvalidAuthToken {
+		sendError(w, http.StatusBadRequest, "Invalid token", "This verification link is invalid or has expired")
+		return
+	}
+	if err != nil {
+		fmt.Printf("Error verifying email: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to verify email")
+		return
+	}
+
+	fmt.Printf("Email verified for user %s\n", userID)
+
+	sendJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Email verified successfully",
+	})
+}
+
+func handleResendVerification(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "Only POST method is allowed")
+		return
+	}
+
+	var req ResendVerificationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, "Invalid request", "Invalid JSON format")
+		return
+	}
+
+	req.Email = strings.TrimSpace(req.Email)
+	if !isValidEmail(req.Email) {
+		sendError(w, http.StatusBadRequest, "Validation error", "A valid email is required")
+		return
+	}
+
+	if err := sendVerificationEmail(req.Email); err != nil {
+		fmt.Printf("Error sending verification email: %v\n", err)
+	}
+
+	// The same answer whether or not the account exists or is verified
+	sendJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "If this email has an unverified account, a new verification link has been sent",
+	})
+}
+
+// =====================================================
+// Supabase Account Email Functions
+// =====================================================
+
+// authLink is the part of a Supabase Auth generate_link response we use
+type authLink struct {
+	ID               string `json:"id"`
+	EmailConfirmedAt string `json:"email_confirmed_at"`
+	HashedToken      string `json:"hashed_token"`
+}
+
+// doAuth calls a Supabase Auth endpoint and decodes a successful response
+// into out. It returns the status code, so callers can tell a rejected
+// request from a failed one. An empty token runs with the service role.
+func (c *SupabaseClient) doAuth(method, path, token string, payload, out interface{}) (int, error) {
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequest(method, c.URL+path, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("apikey", c.AnonKey)
+	req.Header.Set("Authorization", "Bearer "+c.bearer(token))
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("supabase auth %s %s failed: %s", method, path, string(body))
+	}
+
+	if out != nil && len(body) > 0 {
+		return resp.StatusCode, json.Unmarshal(body, out)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// generateAuthLink has Supabase Auth create a one-time token of the given
+// type without sending its own email, so the API can mail it instead
+func (c *SupabaseClient) generateAuthLink(linkType, email string) (*authLink, error) {
+	var link authLink
+	status, err := c.doAuth("POST", "/auth/v1/admin/generate_link", "", map[string]interface{}{
+		"type":  linkType,
+		"email": email,
+	}, &link)
+	if status == http.StatusNotFound {
+		return nil, errNoAccount
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &link, nil
+}
+
+// verifyAuthToken redeems a one-time token, returning the session it opens
+func (c *SupabaseClient) verifyAuthToken(tokenType, token string) (accessToken, userID string, err error) {
+	var session struct {
+		AccessToken string `json:"access_token"`
+		User        struct {
+			ID string `json:"id"`
+		} `json:"user"`
+	}
+	status, err := c.doAuth("POST", "/auth/v1/verify", c.AnonKey, map[string]interface{}{
+		"type":       tokenType,
+		"token_hash": token,
+	}, &session)
+	if status >= 400 && status < 500 {
+		return "", "", errInvalidAuthToken
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	return session.AccessToken, session.User.ID, nil
+}
+
+// CreatePasswordResetToken returns a recovery token for an account
+func (c *SupabaseClient) CreatePasswordResetToken(email string) (string, error) {
+	link, err := c.generateAuthLink("recovery", email)
+	if err != nil {
+		return "", err
+	}
+
+	return link.HashedToken, nil
+}
+
+// ResetPassword redeems a recovery token and sets the account's new password
+func (c *SupabaseClient) ResetPassword(token, password string) (string, error) {
+	accessToken, userID, err := c.verifyAuthToken("recovery", token)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := c.doAuth("PUT", "/auth/v1/user", accessToken, map[string]interface{}{"password": password}, nil); err != nil {
+		return "", err
+	}
+
+	return userID, nil
+}
+
+// CreateEmailVerificationToken returns a token confirming an account's
+// email address. Supabase confirms the address when a magic link token is
+// redeemed, which works for accounts that have not signed in yet.
+func (c *SupabaseClient) CreateEmailVerificationToken(email string) (string, error) {
+	link, err := c.generateAuthLink("magiclink", email)
+	if err != nil {
+		return "", err
+	}
+
+	if link.EmailConfirmedAt != "" {
+		return "", errEmailAlreadyVerified
+	}
+
+	return link.HashedToken, nil
+}
+
+// VerifyEmail redeems an email verification token
+func (c *SupabaseClient) VerifyEmail(token string) (string, error) {
+	_, userID, err := c.verifyAuthToken("email", token)
+	return userID, err
+}
+
+// =====================================================
+// In-memory Account Email Functions
+// =====================================================
+
+// memoryAuthToken is a one-time token emailed to a user
+type memoryAuthToken struct {
+	userID  string
+	purpose string
+	expires time.Time
+}
+
+// createAuthTokenLocked issues a one-time token for the account with an
+// email address, replacing earlier tokens with the same purpose
+func (m *MemoryStore) createAuthTokenLocked(email, purpose string, ttl time.Duration) (string, *memoryUser, error) {
+	u := m.findUserByEmail(email)
+	if u == nil {
+		return "", nil, errNoAccount
+	}
+
+	for token, issued := range m.authTokens {
+		if issued.userID == u.ID && issued.purpose == purpose {
+			delete(m.authTokens, token)
+		}
+	}
+
+	token := newToken()
+	m.authTokens[token] = memoryAuthToken{userID: u.ID, purpose: purpose, expires: time.Now().Add(ttl)}
+
+	return token, u, nil
+}
+
+// redeemAuthTokenLocked consumes a one-time token, returning its account
+func (m *MemoryStore) redeemAuthTokenLocked(token, purpose string) (*memoryUser, error) {
+	issued, exists := m.authTokens[token]
+	if !exists || issued.purpose != purpose {
+		return nil, errInvalidAuthToken
+	}
+	delete(m.authTokens, token)
+
+	u, exists := m.users[issued.userID]
+	if !exists || time.Now().After(issued.expires) {
+		return nil, errInvalidAuthToken
+	}
+
+	return u, nil
+}
+
+// CreatePasswordResetToken returns a recovery token for an account
+func (m *MemoryStore) CreatePasswordResetToken(email string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token, _, err := m.createAuthTokenLocked(email, "recovery", passwordResetTTL)
+	return token, err
+}
+
+// ResetPassword redeems a recovery token and sets the account's new
+// password, signing the account out of its existing sessions
+func (m *MemoryStore) ResetPassword(token, password string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, err := m.redeemAuthTokenLocked(token, "recovery")
+	if err != nil {
+		return "", err
+	}
+
+	u.passwordSalt = newToken()
+	u.passwordHash = hashPassword(u.passwordSalt, password)
+	for accessToken, userID := range m.tokens {
+		if userID == u.ID {
+			delete(m.tokens, accessToken)
+		}
+	}
+
+	return u.ID, nil
+}
+
+// CreateEmailVerificationToken returns a token confirming an account's email address
+func (m *MemoryStore) CreateEmailVerificationToken(email string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if u := m.findUserByEmail(email); u != nil && u.emailVerified {
+		return "", errEmailAlreadyVerified
+	}
+
+	token, _, err := m.createAuthTokenLocked(email, "verify", emailVerificationTTL)
+	return token, err
+}
+
+// VerifyEmail redeems an email verification token
+func (m *MemoryStore) VerifyEmail(token string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, err := m.redeemAuthTokenLocked(token, "verify")
+	if err != nil {
+		return "", err
+	}
+
+	u.emailVerified = true
+	return u.ID, nil
+}
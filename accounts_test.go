@@ -0,0 +1,204 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mailbox is a Mailer that keeps every message for the test to read
+type mailbox struct {
+	mu       sync.Mutex
+	messages []MailMessage
+}
+
+// Send stores the message
+func (m *mailbox) Send(msg MailMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// to returns the messages sent to an address, oldest first
+func (m *mailbox) to(email string) []MailMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var sent []MailMessage
+	for _, msg := range m.messages {
+		if msg.To == email {
+			sent = append(sent, msg)
+		}
+	}
+	return sent
+}
+
+// linkTokenPattern finds the token in an emailed link
+var linkTokenPattern = regexp.MustCompile(`token=([A-Za-z0-9_-]+)`)
+
+// lastToken returns the token from the latest link sent to an address
+func (m *mailbox) lastToken(t *testing.T, email string) string {
+	t.Helper()
+
+	sent := m.to(email)
+	if len(sent) == 0 {
+		t.Fatalf("expected mail to %s", email)
+	}
+	match := linkTokenPattern.FindStringSubmatch(sent[len(sent)-1].Body)
+	if match == nil {
+		t.Fatalf("expected a link in %q", sent[len(sent)-1].Body)
+	}
+	return match[1]
+}
+
+// captureMail sends account emails to a mailbox for the rest of the test
+func captureMail(t *testing.T) *mailbox {
+	previous := mailer
+	box := &mailbox{}
+	mailer = box
+	t.Cleanup(func() { mailer = previous })
+	return box
+}
+
+// signUp registers an account through the API and returns its access token
+func signUp(t *testing.T, email string) string {
+	t.Helper()
+
+	rec := servePublic(handleRegister, http.MethodPost, "/api/register", RegisterRequest{Email: email, Password: testPassword, FullName: "New User", PhoneNumber: "+91 98765 43210"})
+	expectStatus(t, rec, http.StatusOK)
+
+	var resp struct {
+		Token string `json:"token"`
+	}
+	decodeBody(t, rec, &resp)
+	return resp.Token
+}
+
+// login signs in through the API and returns the response
+func login(email, password string) *httptest.ResponseRecorder {
+	return servePublic(handleLogin, http.MethodPost, "/api/login", map[string]string{"email": email, "password": password})
+}
+
+func TestPasswordReset(t *testing.T) {
+	store := newTestStore(t)
+	box := captureMail(t)
+
+	const email = "reset@example.com"
+	const newPassword = "Changed123"
+	accessToken := signUp(t, email)
+
+	forgot := func(address string) {
+		t.Helper()
+		rec := servePublic(handleForgotPassword, http.MethodPost, "/api/forgot-password", ForgotPasswordRequest{Email: address})
+		expectStatus(t, rec, http.StatusOK)
+	}
+	reset := func(token, password string) *httptest.ResponseRecorder {
+		return servePublic(handleResetPassword, http.MethodPost, "/api/reset-password", ResetPasswordRequest{Token: token, Password: password})
+	}
+
+	t.Run("unknown accounts get the same answer and no mail", func(t *testing.T) {
+		forgot("nobody@example.com")
+		if sent := box.to("nobody@example.com"); len(sent) != 0 {
+			t.Fatalf("expected no mail, got %+v", sent)
+		}
+
+		rec := servePublic(handleForgotPassword, http.MethodPost, "/api/forgot-password", ForgotPasswordRequest{Email: "not an email"})
+		expectStatus(t, rec, http.StatusBadRequest)
+	})
+
+	t.Run("a newer link replaces the older one", func(t *testing.T) {
+		forgot(email)
+		first := box.lastToken(t, email)
+		forgot(email)
+		second := box.lastToken(t, email)
+
+		expectStatus(t, reset(first, newPassword), http.StatusBadRequest)
+
+		// A weak password is refused without using up the link
+		expectStatus(t, reset(second, "weak"), http.StatusBadRequest)
+		expectStatus(t, reset(second, newPassword), http.StatusOK)
+		expectStatus(t, reset(second, newPassword), http.StatusBadRequest)
+	})
+
+	t.Run("resetting signs out and notifies", func(t *testing.T) {
+		sent := box.to(email)
+		if notice := sent[len(sent)-1]; notice.Subject != "Your GoTicket password was changed" {
+			t.Fatalf("expected a password change notice, got %q", notice.Subject)
+		}
+
+		expectStatus(t, serveAuthenticated(handleProfile, http.MethodGet, "/api/profile", accessToken, nil), http.StatusUnauthorized)
+		expectStatus(t, login(email, testPassword), http.StatusUnauthorized)
+		expectStatus(t, login(email, newPassword), http.StatusOK)
+	})
+
+	t.Run("expired link", func(t *testing.T) {
+		forgot(email)
+		token := box.lastToken(t, email)
+
+		store.mu.Lock()
+		issued := store.authTokens[token]
+		issued.expires = time.Now().Add(-time.Second)
+		store.authTokens[token] = issued
+		store.mu.Unlock()
+
+		expectStatus(t, reset(token, newPassword), http.StatusBadRequest)
+	})
+
+	t.Run("mail is rate limited per address", func(t *testing.T) {
+		const limited = "limited@example.com"
+		signUp(t, limited)
+		for i := 0; i < 10; i++ {
+			forgot(limited)
+		}
+
+		resets := 0
+		for _, msg := range box.to(limited) {
+			if msg.Subject == "Reset your GoTicket password" {
+				resets++
+			}
+		}
+		if resets != 5 {
+			t.Fatalf("expected 5 reset emails an hour, got %d", resets)
+		}
+	})
+}
+
+func TestEmailVerification(t *testing.T) {
+	newTestStore(t)
+	box := captureMail(t)
+
+	const email = "verify@example.com"
+	signUp(t, email)
+
+	verify := func(token string) *httptest.ResponseRecorder {
+		return servePublic(handleVerifyEmail, http.MethodPost, "/api/verify-email", VerifyEmailRequest{Token: token})
+	}
+	resend := func() {
+		t.Helper()
+		rec := servePublic(handleResendVerification, http.MethodPost, "/api/resend-verification", ResendVerificationRequest{Email: email})
+		expectStatus(t, rec, http.StatusOK)
+	}
+
+	first := box.lastToken(t, email)
+	resend()
+	second := box.lastToken(t, email)
+
+	// A reset link is not a verification link
+	servePublic(handleForgotPassword, http.MethodPost, "/api/forgot-password", ForgotPasswordRequest{Email: email})
+	expectStatus(t, verify(box.lastToken(t, email)), http.StatusBadRequest)
+
+	expectStatus(t, verify(first), http.StatusBadRequest)
+	expectStatus(t, verify(second), http.StatusOK)
+	expectStatus(t, verify(second), http.StatusBadRequest)
+
+	sent := len(box.to(email))
+	resend()
+	if len(box.to(email)) != sent {
+		t.Fatal("expected no verification email once the address is confirmed")
+	}
+}
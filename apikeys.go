@@ -0,0 +1,474 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// API key scopes, each covering a group of endpoints an organizer's own
+// systems may call
+const (
+	scopeEventsWrite       = "events:write"
+	scopeRegistrationsRead = "registrations:read"
+	scopeCheckinWrite      = "checkin:write"
+)
+
+// apiKeyScopes lists every scope a key may be granted
+var apiKeyScopes = []string{scopeEventsWrite, scopeRegistrationsRead, scopeCheckinWrite}
+
+const (
+	// apiKeyPrefix starts every key, so authenticate can tell keys from tokens
+	apiKeyPrefix = "gtk_"
+
+	// apiKeyDisplayLength is how much of a key is kept to recognise it by
+	apiKeyDisplayLength = len(apiKeyPrefix) + 8
+
+	// maxAPIKeysPerOrganizer caps an organizer's unrevoked keys
+	maxAPIKeysPerOrganizer = 20
+
+	// apiKeyTouchInterval limits how often last_used_at is written for a key
+	apiKeyTouchInterval = time.Minute
+)
+
+// errNoAPIKey is returned when an API key does not exist or is not the caller's
+var errNoAPIKey = errors.New("api key not found")
+
+// APIKey lets an organizer's back-office systems call the API without a
+// user login. Only a hash of the key is stored; the key itself is shown
+// once, when it is created.
+type APIKey struct {
+	ID          string   `json:"id"`
+	OrganizerID string   `json:"organizer_id"`
+	Name        string   `json:"name"`
+	Prefix      string   `json:"prefix"`
+	KeyHash     string   `json:"-"`
+	Scopes      []string `json:"scopes"`
+	CreatedAt   string   `json:"created_at"`
+	LastUsedAt  string   `json:"last_used_at,omitempty"`
+	RevokedAt   string   `json:"revoked_at,omitempty"`
+}
+
+// CreateAPIKeyRequest names a new key and the scopes it is granted
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// HasScope reports whether the key was granted scope
+func (k *APIKey) HasScope(scope string) bool {
+	for _, granted := range k.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// generateAPIKey returns a new random key
+func generateAPIKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return apiKeyPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashAPIKey returns the stored form of a key. Keys carry 256 random bits,
+// so a plain SHA-256 is enough to make a leaked table useless.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizeScopes validates and de-duplicates requested scopes
+func normalizeScopes(scopes []string) ([]string, error) {
+	requested := make(map[string]bool)
+	for _, scope := range scopes {
+		requested[strings.TrimSpace(scope)] = true
+	}
+
+	var normalized []string
+	for _, scope := range apiKeyScopes {
+		if requested[scope] {
+			normalized = append(normalized, scope)
+			delete(requested, scope)
+		}
+	}
+
+	// Anything left over was not a known scope
+	for _, scope := range scopes {
+		if requested[strings.TrimSpace(scope)] {
+			return nil, fmt.Errorf("unknown scope %q; scopes are %s", scope, strings.Join(apiKeyScopes, ", "))
+		}
+	}
+	if len(normalized) == 0 {
+		return nil, fmt.Errorf("at least one scope is required: %s", strings.Join(apiKeyScopes, ", "))
+	}
+
+	return normalized, nil
+}
+
+// resolveAPIKey turns an API key into the identity of the organizer who
+// created it, recording when it was last used
+func resolveAPIKey(key string) (*AuthInfo, error) {
+	apiKey, err := apiKeyStore.GetAPIKeyByHash(hashAPIKey(key))
+	if err != nil {
+		return nil, err
+	}
+	if apiKey.RevokedAt != "" {
+		return nil, errNoAPIKey
+	}
+
+	now := time.Now().UTC()
+	lastUsed, err := time.Parse(time.RFC3339, apiKey.LastUsedAt)
+	if err != nil || now.Sub(lastUsed) >= apiKeyTouchInterval {
+		if err := apiKeyStore.TouchAPIKey(apiKey.ID, now.Format(time.RFC3339)); err != nil {
+			fmt.Printf("Error recording use of API key %s: %v\n", apiKey.ID, err)
+		}
+	}
+
+	return &AuthInfo{UserID: apiKey.OrganizerID, APIKey: apiKey}, nil
+}
+
+// apiKeyScope returns the scope an API key needs for a request, or "" if
+// the endpoint only accepts user logins
+func apiKeyScope(r *http.Request) string {
+	path := strings.TrimSuffix(r.URL.Path, "/")
+
+	if path == "/api/events" {
+		if r.Method == http.MethodPost {
+			return scopeEventsWrite
+		}
+		return ""
+	}
+
+	if !strings.HasPrefix(path, "/api/events/") {
+		return ""
+	}
+
+	_, resource, _ := strings.Cut(strings.TrimPrefix(path, "/api/events/"), "/")
+	switch resource {
+	case "":
+		if r.Method == http.MethodPut || r.Method == http.MethodDelete {
+			return scopeEventsWrite
+		}
+	case "tiers", "promo-codes":
+		return scopeEventsWrite
+	case "waitlist":
+		if r.Method == http.MethodGet {
+			return scopeRegistrationsRead
+		}
+		return scopeEventsWrite
+	case "registrations":
+		return scopeRegistrationsRead
+	case "checkin", "manifest", "sync":
+		return scopeCheckinWrite
+	}
+
+	return ""
+}
+
+// authorizeAPIKey checks an API key's scopes cover the request, writing the
+// error response when they do not
+func authorizeAPIKey(w http.ResponseWriter, r *http.Request, key *APIKey) bool {
+	scope := apiKeyScope(r)
+	if scope == "" {
+		sendError(w, http.StatusForbidden, "Forbidden", "API keys cannot be used for this endpoint")
+		return false
+	}
+
+	if !key.HasScope(scope) {
+		sendError(w, http.StatusForbidden, "Forbidden", fmt.Sprintf("This API key does not have the %s scope", scope))
+		return false
+	}
+
+	return true
+}
+
+// =====================================================
+// API Key Handlers
+// =====================================================
+
+// handleAPIKeys lists an organizer's API keys and creates new ones
+func handleAPIKeys(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		handleListAPIKeys(w, r)
+	case http.MethodPost:
+		handleCreateAPIKey(w, r)
+	default:
+		sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "Only GET and POST methods are allowed")
+	}
+}
+
+func handleListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	auth := authFromRequest(r)
+
+	keys, err := apiKeyStore.GetOrganizerAPIKeys(auth.UserID)
+	if err != nil {
+		fmt.Printf("Error fetching API keys: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to fetch API keys")
+		return
+	}
+
+	sendJSON(w, http.StatusOK, map[string]interface{}{
+		"api_keys": keys,
+		"count":    len(keys),
+	})
+}
+
+func handleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	auth := authFromRequest(r)
+
+	var req CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, "Invalid request", "Invalid JSON format")
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 100 {
+		sendError(w, http.StatusBadRequest, "Validation error", "name is required and must be at most 100 characters")
+		return
+	}
+
+	scopes, err := normalizeScopes(req.Scopes)
+	if err != nil {
+		sendError(w, http.StatusBadRequest, "Validation error", err.Error())
+		return
+	}
+
+	existing, err := apiKeyStore.GetOrganizerAPIKeys(auth.UserID)
+	if err != nil {
+		fmt.Printf("Error fetching API keys: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to create API key")
+		return
+	}
+	active := 0
+	for _, key := range existing {
+		if key.RevokedAt == "" {
+			active++
+		}
+	}
+	if active >= maxAPIKeysPerOrganizer {
+		sendError(w, http.StatusConflict, "Too many API keys", fmt.Sprintf("Revoke an API key first; at most %d can be active", maxAPIKeysPerOrganizer))
+		return
+	}
+
+	secret, err := generateAPIKey()
+	if err != nil {
+		fmt.Printf("Error generating API key: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to create API key")
+		return
+	}
+
+	key, err := apiKeyStore.CreateAPIKey(APIKey{
+		OrganizerID: auth.UserID,
+		Name:        req.Name,
+		Prefix:      secret[:apiKeyDisplayLength],
+		KeyHash:     hashAPIKey(secret),
+		Scopes:      scopes,
+	})
+	if err != nil {
+		fmt.Printf("Error creating API key: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to create API key")
+		return
+	}
+
+	sendJSON(w, http.StatusCreated, map[string]interface{}{
+		"api_key": key,
+		"key":     secret,
+		"message": "Store this key now; it will not be shown again",
+	})
+}
+
+// handleAPIKeyDetail serves /api/organizer/api-keys/{id}, where organizers
+// revoke a key
+func handleAPIKeyDetail(w http.ResponseWriter, r *http.Request) {
+	auth := authFromRequest(r)
+
+	keyID := strings.TrimSpace(strings.TrimPrefix(r.URL.Path, "/api/organizer/api-keys/"))
+	if keyID == "" || strings.Contains(keyID, "/") {
+		sendError(w, http.StatusBadRequest, "Invalid request", "API key ID is required")
+		return
+	}
+
+	if r.Method != http.MethodDelete {
+		sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "Only DELETE method is allowed")
+		return
+	}
+
+	err := apiKeyStore.RevokeAPIKey(auth.UserID, keyID)
+	if err == errNoAPIKey {
+		sendError(w, http.StatusNotFound, "Not found", "API key not found or already revoked")
+		return
+	}
+	if err != nil {
+		fmt.Printf("Error revoking API key: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to revoke API key")
+		return
+	}
+
+	fmt.Printf("Organizer %s revoked API key %s\n", auth.UserID, keyID)
+
+	sendJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "API key revoked successfully",
+	})
+}
+
+// =====================================================
+// Supabase API Key Functions
+// =====================================================
+
+// CreateAPIKey stores a new API key by its hash
+func (c *SupabaseClient) CreateAPIKey(key APIKey) (*APIKey, error) {
+	payload := map[string]interface{}{
+		"organizer_id": key.OrganizerID,
+		"name":         key.Name,
+		"prefix":       key.Prefix,
+		"key_hash":     key.KeyHash,
+		"scopes":       key.Scopes,
+	}
+
+	var created []APIKey
+	if err := c.doREST("POST", "/rest/v1/api_keys", "", payload, &created); err != nil {
+		return nil, err
+	}
+
+	if len(created) == 0 {
+		return nil, fmt.Errorf("api key created but no data returned")
+	}
+
+	return &created[0], nil
+}
+
+// GetAPIKeyByHash finds the key with the given hash
+func (c *SupabaseClient) GetAPIKeyByHash(keyHash string) (*APIKey, error) {
+	var keys []APIKey
+	if err := c.doREST("GET", fmt.Sprintf("/rest/v1/api_keys?key_hash=eq.%s", keyHash), "", nil, &keys); err != nil {
+		return nil, err
+	}
+
+	if len(keys) == 0 {
+		return nil, errNoAPIKey
+	}
+
+	return &keys[0], nil
+}
+
+// GetOrganizerAPIKeys lists an organizer's keys, newest first
+func (c *SupabaseClient) GetOrganizerAPIKeys(organizerID string) ([]APIKey, error) {
+	var keys []APIKey
+	path := fmt.Sprintf("/rest/v1/api_keys?organizer_id=eq.%s&order=created_at.desc", organizerID)
+	if err := c.doREST("GET", path, "", nil, &keys); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// RevokeAPIKey stops one of an organizer's keys from authenticating
+func (c *SupabaseClient) RevokeAPIKey(organizerID, keyID string) error {
+	var revoked []APIKey
+	path := fmt.Sprintf("/rest/v1/api_keys?id=eq.%s&organizer_id=eq.%s&revoked_at=is.null", keyID, organizerID)
+	if err := c.doREST("PATCH", path, "", map[string]interface{}{"revoked_at": nowTimestamp()}, &revoked); err != nil {
+		return err
+	}
+
+	if len(revoked) == 0 {
+		return errNoAPIKey
+	}
+
+	return nil
+}
+
+// TouchAPIKey records when a key was last used
+func (c *SupabaseClient) TouchAPIKey(keyID, usedAt string) error {
+	return c.doREST("PATCH", fmt.Sprintf("/rest/v1/api_keys?id=eq.%s", keyID), "", map[string]interface{}{"last_used_at": usedAt}, nil)
+}
+
+// =====================================================
+// In-memory API Key Functions
+// =====================================================
+
+// CreateAPIKey stores a new API key by its hash
+func (m *MemoryStore) CreateAPIKey(key APIKey) (*APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key.ID = newID()
+	key.CreatedAt = nowTimestamp()
+	key.Scopes = append([]string(nil), key.Scopes...)
+	m.apiKeys[key.ID] = &key
+
+	created := key
+	return &created, nil
+}
+
+// GetAPIKeyByHash finds the key with the given hash
+func (m *MemoryStore) GetAPIKeyByHash(keyHash string) (*APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, key := range m.apiKeys {
+		if key.KeyHash == keyHash {
+			found := *key
+			return &found, nil
+		}
+	}
+
+	return nil, errNoAPIKey
+}
+
+// GetOrganizerAPIKeys lists an organizer's keys, newest first
+func (m *MemoryStore) GetOrganizerAPIKeys(organizerID string) ([]APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	keys := []APIKey{}
+	for _, key := range m.apiKeys {
+		if key.OrganizerID == organizerID {
+			keys = append(keys, *key)
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt > keys[j].CreatedAt
+	})
+
+	return keys, nil
+}
+
+// RevokeAPIKey stops one of an organizer's keys from authenticating
+func (m *MemoryStore) RevokeAPIKey(organizerID, keyID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key, exists := m.apiKeys[keyID]
+	if !exists || key.OrganizerID != organizerID || key.RevokedAt != "" {
+		return errNoAPIKey
+	}
+
+	key.RevokedAt = nowTimestamp()
+	return nil
+}
+
+// TouchAPIKey records when a key was last used
+func (m *MemoryStore) TouchAPIKey(keyID, usedAt string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if key, exists := m.apiKeys[keyID]; exists {
+		key.LastUsedAt = usedAt
+	}
+	return nil
+}
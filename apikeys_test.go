@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// createAPIKey creates an API key for the holder of token and returns it
+// along with its secret
+func createAPIKey(t *testing.T, token string, scopes ...string) (APIKey, string) {
+	t.Helper()
+
+	rec := serveAuthenticated(requirePermission(permOrganizerTools, handleAPIKeys), http.MethodPost, "/api/organizer/api-keys", token, CreateAPIKeyRequest{Name: "Box office", Scopes: scopes})
+	expectStatus(t, rec, http.StatusCreated)
+
+	var resp struct {
+		APIKey APIKey `json:"api_key"`
+		Key    string `json:"key"`
+	}
+	decodeBody(t, rec, &resp)
+	return resp.APIKey, resp.Key
+}
+
+func TestNormalizeScopes(t *testing.T) {
+	scopes, err := normalizeScopes([]string{" checkin:write", "events:write", "checkin:write"})
+	if err != nil || strings.Join(scopes, ",") != "events:write,checkin:write" {
+		t.Fatalf("expected de-duplicated scopes in canonical order, got %v (%v)", scopes, err)
+	}
+
+	for _, requested := range [][]string{nil, {""}, {"events:write", "admin"}} {
+		if _, err := normalizeScopes(requested); err == nil {
+			t.Errorf("%q: expected the scopes to be refused", requested)
+		}
+	}
+}
+
+func TestAPIKeyScope(t *testing.T) {
+	tests := []struct {
+		method, path, scope string
+	}{
+		{http.MethodPost, "/api/events", scopeEventsWrite},
+		{http.MethodGet, "/api/events", ""},
+		{http.MethodPut, "/api/events/e1", scopeEventsWrite},
+		{http.MethodDelete, "/api/events/e1/", scopeEventsWrite},
+		{http.MethodGet, "/api/events/e1", ""},
+		{http.MethodPost, "/api/events/e1/tiers", scopeEventsWrite},
+		{http.MethodPost, "/api/events/e1/promo-codes", scopeEventsWrite},
+		{http.MethodGet, "/api/events/e1/waitlist", scopeRegistrationsRead},
+		{http.MethodPut, "/api/events/e1/waitlist", scopeEventsWrite},
+		{http.MethodGet, "/api/events/e1/registrations", scopeRegistrationsRead},
+		{http.MethodPost, "/api/events/e1/checkin", scopeCheckinWrite},
+		{http.MethodGet, "/api/events/e1/manifest", scopeCheckinWrite},
+		{http.MethodPost, "/api/events/e1/sync", scopeCheckinWrite},
+		{http.MethodPost, "/api/events/e1/members", ""},
+		{http.MethodPost, "/api/registrations", ""},
+		{http.MethodGet, "/api/organizer/api-keys", ""},
+	}
+	for _, tt := range tests {
+		req := newTestRequest(tt.method, tt.path, nil)
+		if scope := apiKeyScope(req); scope != tt.scope {
+			t.Errorf("%s %s: expected %q, got %q", tt.method, tt.path, tt.scope, scope)
+		}
+	}
+}
+
+func TestAPIKeyAccess(t *testing.T) {
+	store := newTestStore(t)
+	organizerID, organizerToken := newTestUser(t, store, "organizer@example.com", roleOrganizer)
+	otherID, otherToken := newTestUser(t, store, "other@example.com", roleOrganizer)
+	_, adminToken := newTestUser(t, store, "admin@example.com", roleAdmin)
+
+	event := newTestEvent(t, store, organizerID, CreateEventRequest{})
+	othersEvent := newTestEvent(t, store, otherID, CreateEventRequest{})
+
+	readKey, readSecret := createAPIKey(t, organizerToken, scopeRegistrationsRead)
+	_, writeSecret := createAPIKey(t, organizerToken, scopeEventsWrite)
+
+	t.Run("secret", func(t *testing.T) {
+		if !strings.HasPrefix(readSecret, apiKeyPrefix) || readKey.Prefix != readSecret[:apiKeyDisplayLength] {
+			t.Fatalf("expected a %s key recognisable by its prefix, got %s and %s", apiKeyPrefix, readSecret, readKey.Prefix)
+		}
+
+		rec := serveAuthenticated(handleAPIKeys, http.MethodGet, "/api/organizer/api-keys", organizerToken, nil)
+		expectStatus(t, rec, http.StatusOK)
+		if strings.Contains(rec.Body.String(), readSecret) || strings.Contains(rec.Body.String(), hashAPIKey(readSecret)) {
+			t.Fatal("expected listed keys to leave out the secret and its hash")
+		}
+	})
+
+	t.Run("scopes", func(t *testing.T) {
+		update := map[string]interface{}{"description": "Updated"}
+		tests := []struct {
+			name   string
+			key    string
+			method string
+			target string
+			body   interface{}
+			status int
+		}{
+			{"read with a read key", readSecret, http.MethodGet, "/api/events/" + event.ID + "/registrations", nil, http.StatusOK},
+			{"write with a read key", readSecret, http.MethodPut, "/api/events/" + event.ID, update, http.StatusForbidden},
+			{"write with a write key", writeSecret, http.MethodPut, "/api/events/" + event.ID, update, http.StatusOK},
+			{"read with a write key", writeSecret, http.MethodGet, "/api/events/" + event.ID + "/registrations", nil, http.StatusForbidden},
+			{"create an event", writeSecret, http.MethodPost, "/api/events", CreateEventRequest{Title: "Via API", EventDate: "2030-06-01T18:00:00Z"}, http.StatusCreated},
+			{"another organizer's event", readSecret, http.MethodGet, "/api/events/" + othersEvent.ID + "/registrations", nil, http.StatusForbidden},
+			{"team management", writeSecret, http.MethodPost, "/api/events/" + event.ID + "/members", InviteMemberRequest{UserID: otherID, Role: memberViewer}, http.StatusForbidden},
+			{"booking tickets", readSecret, http.MethodPost, "/api/registrations", EventRegistrationRequest{EventID: othersEvent.ID}, http.StatusForbidden},
+		}
+		for _, tt := range tests {
+			handler := handleEventDetail
+			switch tt.target {
+			case "/api/events":
+				handler = handleEvents
+			case "/api/registrations":
+				handler = handleRegistrations
+			}
+			if rec := serveAuthenticated(handler, tt.method, tt.target, tt.key, tt.body); rec.Code != tt.status {
+				t.Errorf("%s: expected %d, got %d: %s", tt.name, tt.status, rec.Code, rec.Body.String())
+			}
+		}
+
+		used, _ := store.GetAPIKeyByHash(hashAPIKey(readSecret))
+		if used.LastUsedAt == "" {
+			t.Fatal("expected the key's last use to be recorded")
+		}
+	})
+
+	t.Run("admin keys reach only the admin's events", func(t *testing.T) {
+		_, adminSecret := createAPIKey(t, adminToken, scopeRegistrationsRead)
+		target := "/api/events/" + othersEvent.ID + "/registrations"
+
+		expectStatus(t, serveAuthenticated(handleEventDetail, http.MethodGet, target, adminToken, nil), http.StatusOK)
+		expectStatus(t, serveAuthenticated(handleEventDetail, http.MethodGet, target, adminSecret, nil), http.StatusForbidden)
+	})
+
+	t.Run("revoking", func(t *testing.T) {
+		detail := requirePermission(permOrganizerTools, handleAPIKeyDetail)
+		target := "/api/organizer/api-keys/" + readKey.ID
+
+		expectStatus(t, serveAuthenticated(detail, http.MethodDelete, target, otherToken, nil), http.StatusNotFound)
+		expectStatus(t, serveAuthenticated(detail, http.MethodDelete, target, organizerToken, nil), http.StatusOK)
+		expectStatus(t, serveAuthenticated(detail, http.MethodDelete, target, organizerToken, nil), http.StatusNotFound)
+
+		rec := serveAuthenticated(handleEventDetail, http.MethodGet, "/api/events/"+event.ID+"/registrations", readSecret, nil)
+		expectStatus(t, rec, http.StatusUnauthorized)
+	})
+
+	t.Run("limit", func(t *testing.T) {
+		// One of the organizer's keys was revoked and no longer counts
+		for i := 1; i < maxAPIKeysPerOrganizer; i++ {
+			createAPIKey(t, organizerToken, scopeCheckinWrite)
+		}
+
+		rec := serveAuthenticated(handleAPIKeys, http.MethodPost, "/api/organizer/api-keys", organizerToken, CreateAPIKeyRequest{Name: fmt.Sprintf("Key %d", maxAPIKeysPerOrganizer+1), Scopes: []string{scopeCheckinWrite}})
+		expectStatus(t, rec, http.StatusConflict)
+	})
+}
@@ -116,6 +116,7 @@ export default function EventDetailPage({ params }: { params: Promise<{ id: stri
             await registerForEvent({
                 event_id: event.id,
                 notes: bookingNotes,
+                quantity: ticketCount,
             });
 
             setBookingSuccess(true);
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"net/http"
+)
+
+// AuthInfo describes the authenticated caller of a request
+type AuthInfo struct {
+	UserID string
+	Role   string
+	// SupabaseToken is set when the caller presented a Supabase access
+	// token, so store calls can run under the caller's RLS policies.
+	// It is empty for tokens issued by this API.
+	SupabaseToken string
+	// APIKey is set when the caller authenticated with an organizer's API
+	// key instead of logging in; its scopes limit what the request may do.
+	APIKey *APIKey
+	// SessionID is set for access tokens issued at sign-in, which stop
+	// working once their session is signed out.
+	SessionID string
+	// SecondFactor is set when a Supabase access token shows an MFA
+	// factor was verified (aal2).
+	SecondFactor bool
+}
+
+type contextKey string
+
+const authContextKey contextKey = "auth"
+
+// withAuth returns a copy of r carrying the caller's identity
+func withAuth(r *http.Request, info *AuthInfo) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), authContextKey, info))
+}
+
+// authFromRequest returns the identity placed on the request by authenticate
+func authFromRequest(r *http.Request) *AuthInfo {
+	info, _ := r.Context().Value(authContextKey).(*AuthInfo)
+	if info == nil {
+		return &AuthInfo{}
+	}
+	return info
+}
+
+// resolveToken turns a bearer token into the caller's identity. Tokens
+// issued by this API are verified locally; anything else is treated as a
+// Supabase access token, verified locally when a project secret or JWKS is
+// configured and looked up through the user store otherwise (or as a
+// fallback when SUPABASE_AUTH_REMOTE_FALLBACK is enabled).
+func resolveToken(token string) (*AuthInfo, error) {
+	claims, err := jwtIssuer.Verify(token)
+	if err == nil {
+		return &AuthInfo{UserID: claims.Subject, Role: claims.Role, SessionID: claims.SessionID}, nil
+	}
+	if err == errTokenExpired {
+		return nil, err
+	}
+
+	if supabaseVerifier != nil {
+		supabaseClaims, err := supabaseVerifier.Verify(token)
+		if err == nil {
+			return &AuthInfo{
+				UserID:        supabaseClaims.Subject,
+				Role:          accountTypeOrDefault(supabaseClaims.UserMetadata.AccountType),
+				SupabaseToken: token,
+				SecondFactor:  supabaseClaims.AAL == "aal2",
+			}, nil
+		}
+		if !authRemoteFallback {
+			return nil, err
+		}
+	}
+
+	userID, err := userStore.UserIDFromToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuthInfo{UserID: userID, Role: "attendee", SupabaseToken: token}, nil
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// CheckinRequest identifies the ticket being scanned, either by its signed
+// QR payload or by the ticket number read out at the door
+type CheckinRequest struct {
+	Payload      string `json:"payload"`
+	TicketNumber string `json:"ticket_number"`
+}
+
+// errTicketNotActive is returned when checking in a ticket that is used, cancelled or refunded
+var errTicketNotActive = errors.New("ticket is not active")
+
+// =====================================================
+// Check-in Handlers
+// =====================================================
+
+func handleEventCheckin(w http.ResponseWriter, r *http.Request, eventID string) {
+	if r.Method != http.MethodPost {
+		sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "Only POST method is allowed")
+		return
+	}
+
+	auth := authFromRequest(r)
+
+	event, err := eventStore.GetEventByID(eventID)
+	if err != nil {
+		sendError(w, http.StatusNotFound, "Not found", "Event not found")
+		return
+	}
+
+	allowed, err := canCheckIn(event, auth)
+	if err != nil {
+		fmt.Printf("Error checking event membership: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to verify permissions")
+		return
+	}
+	if !allowed {
+		sendError(w, http.StatusForbidden, "Forbidden", "Only the event organizer or check-in staff can check tickets in")
+		return
+	}
+
+	var req CheckinRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, "Invalid request", "Invalid JSON format")
+		return
+	}
+
+	req.Payload = strings.TrimSpace(req.Payload)
+	req.TicketNumber = strings.ToUpper(strings.TrimSpace(req.TicketNumber))
+	if req.Payload == "" && req.TicketNumber == "" {
+		sendError(w, http.StatusBadRequest, "Validation error", "payload or ticket_number is required")
+		return
+	}
+
+	ticket, err := resolveScannedTicket(eventID, req)
+	if err != nil {
+		sendError(w, http.StatusBadRequest, "Invalid ticket", err.Error())
+		return
+	}
+
+	checkedIn, err := ticketStore.CheckInTicket(ticket.ID, auth.UserID)
+	if errors.Is(err, errTicketNotActive) {
+		sendTicketNotActive(w, checkedIn)
+		return
+	}
+	if err != nil {
+		fmt.Printf("Error checking in ticket: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to check in ticket")
+		return
+	}
+
+	response := map[string]interface{}{
+		"ticket":  checkedIn,
+		"message": "Checked in successfully",
+	}
+	if attendee, err := userStore.GetUserByID(checkedIn.UserID); err == nil {
+		response["attendee"] = map[string]string{
+			"id":        attendee.ID,
+			"full_name": attendee.FullName,
+		}
+	}
+
+	sendJSON(w, http.StatusOK, response)
+}
+
+// resolveScannedTicket finds the ticket identified by a check-in request and
+// makes sure it belongs to the event being scanned
+func resolveScannedTicket(eventID string, req CheckinRequest) (*Ticket, error) {
+	var ticket *Ticket
+
+	if req.Payload != "" {
+		payload, err := ticketVerifier.Verify(req.Payload)
+		if err != nil {
+			return nil, fmt.Errorf("ticket signature is not valid")
+		}
+		if payload.EventID != eventID {
+			return nil, fmt.Errorf("ticket is for a different event")
+		}
+
+		ticket, err = ticketStore.GetTicketByID(payload.TicketID)
+		if err != nil {
+			return nil, fmt.Errorf("ticket not found")
+		}
+		if ticket.UserID != payload.Holder {
+			return nil, fmt.Errorf("ticket holder does not match")
+		}
+	} else {
+		var err error
+		ticket, err = ticketStore.GetTicketByNumber(req.TicketNumber)
+		if err != nil {
+			return nil, fmt.Errorf("ticket not found")
+		}
+	}
+
+	if ticket.EventID != eventID {
+		return nil, fmt.Errorf("ticket is for a different event")
+	}
+
+	return ticket, nil
+}
+
+// sendTicketNotActive reports a rejected scan; for double scans it says when
+// and by whom the ticket was first checked in
+func sendTicketNotActive(w http.ResponseWriter, ticket *Ticket) {
+	if ticket.Status != "used" {
+		sendJSON(w, http.StatusConflict, map[string]interface{}{
+			"error":   "Ticket not valid",
+			"message": fmt.Sprintf("Ticket %s is %s", ticket.TicketNumber, ticket.Status),
+			"code":    http.StatusConflict,
+			"status":  ticket.Status,
+		})
+		return
+	}
+
+	scannedBy := ticket.CheckedInBy
+	if staff, err := userStore.GetUserByID(ticket.CheckedInBy); err == nil && staff.FullName != "" {
+		scannedBy = staff.FullName
+	}
+
+	sendJSON(w, http.StatusConflict, map[string]interface{}{
+		"error":              "Already checked in",
+		"message":            fmt.Sprintf("Ticket %s was already scanned at %s by %s", ticket.TicketNumber, ticket.CheckedInAt, scannedBy),
+		"code":               http.StatusConflict,
+		"status":             ticket.Status,
+		"checked_in_at":      ticket.CheckedInAt,
+		"checked_in_by":      ticket.CheckedInBy,
+		"checked_in_by_name": scannedBy,
+	})
+}
+
+// canCheckIn reports whether a user may scan tickets for an event: its
+// owner, co-organizers and check-in staff
+func canCheckIn(event *Event, auth *AuthInfo) (bool, error) {
+	role, err := eventMemberRole(event, auth)
+	if err != nil {
+		return false, err
+	}
+	return memberCan(role, eventCheckIn), nil
+}
+
+// =====================================================
+// Supabase Check-in Functions
+// =====================================================
+
+// GetTicketByNumber fetches a ticket by its human-readable number
+func (c *SupabaseClient) GetTicketByNumber(ticketNumber string) (*Ticket, error) {
+	var tickets []Ticket
+	if err := c.doREST("GET", fmt.Sprintf("/rest/v1/tickets?ticket_number=eq.%s", url.QueryEscape(ticketNumber)), "", nil, &tickets); err != nil {
+		return nil, err
+	}
+
+	if len(tickets) == 0 {
+		return nil, fmt.Errorf("ticket not found")
+	}
+
+	return &tickets[0], nil
+}
+
+// CheckInTicket marks an active ticket as used. The status filter makes the
+// update conditional, so only one of two concurrent scans can succeed; the
+// loser gets errTicketNotActive with the ticket as it now stands.
+func (c *SupabaseClient) CheckInTicket(ticketID, staffID string) (*Ticket, error) {
+	path := fmt.Sprintf("/rest/v1/tickets?id=eq.%s&status=eq.active", ticketID)
+	payload := map[string]interface{}{
+		"status":        "used",
+		"checked_in_at": nowTimestamp(),
+		"checked_in_by": staffID,
+	}
+
+	var tickets []Ticket
+	if err := c.doREST("PATCH", path, "", payload, &tickets); err != nil {
+		return nil, err
+	}
+
+	if len(tickets) == 0 {
+		current, err := c.GetTicketByID(ticketID)
+		if err != nil {
+			return nil, err
+		}
+		return current, errTicketNotActive
+	}
+
+	return &tickets[0], nil
+}
+
+// =====================================================
+// In-memory Check-in Functions
+// =====================================================
+
+// GetTicketByNumber returns a ticket by its human-readable number
+func (m *MemoryStore) GetTicketByNumber(ticketNumber string) (*Ticket, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, ticket := range m.tickets {
+		if ticket.TicketNumber == ticketNumber {
+			found := *ticket
+			return &found, nil
+		}
+	}
+
+	return nil, fmt.Errorf("ticket not found")
+}
+
+// CheckInTicket marks an active ticket as used
+func (m *MemoryStore) CheckInTicket(ticketID, staffID string) (*Ticket, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ticket, exists := m.tickets[ticketID]
+	if !exists {
+		return nil, fmt.Errorf("ticket not found")
+	}
+
+	if ticket.Status != "active" {
+		current := *ticket
+		return &current, errTicketNotActive
+	}
+
+	ticket.Status = "used"
+	ticket.CheckedInAt = nowTimestamp()
+	ticket.CheckedInBy = staffID
+	m.touchTicketLocked(ticket)
+
+	checkedIn := *ticket
+	return &checkedIn, nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// checkIn scans a ticket at an event
+func checkIn(token, eventID string, req CheckinRequest) *httptest.ResponseRecorder {
+	return serveAuthenticated(handleEventDetail, http.MethodPost, "/api/events/"+eventID+"/checkin", token, req)
+}
+
+func TestCheckIn(t *testing.T) {
+	store := newTestStore(t)
+	organizerID, organizerToken := newTestUser(t, store, "organizer@example.com", roleOrganizer)
+	_, attendeeToken := newTestUser(t, store, "attendee@example.com", roleAttendee)
+	staffID, staffToken := newTestUser(t, store, "staff@example.com", roleAttendee)
+	viewerID, viewerToken := newTestUser(t, store, "viewer@example.com", roleAttendee)
+
+	event := newTestEvent(t, store, organizerID, CreateEventRequest{})
+	otherEvent := newTestEvent(t, store, organizerID, CreateEventRequest{Title: "Other event"})
+
+	tickets := registerForEvent(t, attendeeToken, EventRegistrationRequest{EventID: event.ID, Quantity: 4}).Tickets
+	otherTicket := registerForEvent(t, attendeeToken, EventRegistrationRequest{EventID: otherEvent.ID}).Tickets[0]
+
+	addTestMember(t, store, event.ID, viewerID, memberViewer)
+
+	t.Run("staff are added by the organizer", func(t *testing.T) {
+		rec := serveAuthenticated(handleEventDetail, http.MethodPost, "/api/events/"+event.ID+"/staff", organizerToken, InviteMemberRequest{UserID: staffID})
+		if rec.Code != http.StatusOK && rec.Code != http.StatusCreated {
+			t.Fatalf("expected staff to be added, got %d: %s", rec.Code, rec.Body.String())
+		}
+
+		rec = serveAuthenticated(handleEventDetail, http.MethodPost, "/api/events/"+event.ID+"/staff", staffToken, InviteMemberRequest{UserID: viewerID})
+		expectStatus(t, rec, http.StatusForbidden)
+	})
+
+	t.Run("by signed payload", func(t *testing.T) {
+		rec := checkIn(organizerToken, event.ID, CheckinRequest{Payload: tickets[0].QRCode})
+		expectStatus(t, rec, http.StatusOK)
+
+		var resp struct {
+			Ticket Ticket `json:"ticket"`
+		}
+		decodeBody(t, rec, &resp)
+		if resp.Ticket.Status != "used" || resp.Ticket.CheckedInBy != organizerID || resp.Ticket.CheckedInAt == "" {
+			t.Fatalf("expected the ticket to be used, got %+v", resp.Ticket)
+		}
+	})
+
+	t.Run("by ticket number as read out", func(t *testing.T) {
+		number := " " + strings.ToLower(tickets[1].TicketNumber) + " "
+		rec := checkIn(staffToken, event.ID, CheckinRequest{TicketNumber: number})
+		expectStatus(t, rec, http.StatusOK)
+	})
+
+	t.Run("a second scan is refused", func(t *testing.T) {
+		rec := checkIn(staffToken, event.ID, CheckinRequest{Payload: tickets[0].QRCode})
+		expectStatus(t, rec, http.StatusConflict)
+
+		var resp struct {
+			Error       string `json:"error"`
+			CheckedInBy string `json:"checked_in_by"`
+		}
+		decodeBody(t, rec, &resp)
+		if resp.Error != "Already checked in" || resp.CheckedInBy != organizerID {
+			t.Fatalf("expected the first scan to be reported, got %+v", resp)
+		}
+	})
+
+	t.Run("tampered payloads are refused", func(t *testing.T) {
+		// Point a valid payload at another seat of the same order
+		parts := strings.Split(tickets[2].QRCode, ".")
+		claims, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		forged := strings.Replace(string(claims), tickets[2].ID, tickets[3].ID, 1)
+		parts[2] = base64.RawURLEncoding.EncodeToString([]byte(forged))
+
+		rec := checkIn(organizerToken, event.ID, CheckinRequest{Payload: strings.Join(parts, ".")})
+		expectStatus(t, rec, http.StatusBadRequest)
+
+		if ticket, _ := store.GetTicketByID(tickets[3].ID); ticket.Status != "active" {
+			t.Fatalf("expected the targeted ticket to stay active, got %s", ticket.Status)
+		}
+	})
+
+	t.Run("tickets for another event are refused", func(t *testing.T) {
+		rec := checkIn(organizerToken, event.ID, CheckinRequest{Payload: otherTicket.QRCode})
+		expectStatus(t, rec, http.StatusBadRequest)
+
+		rec = checkIn(organizerToken, event.ID, CheckinRequest{TicketNumber: otherTicket.TicketNumber})
+		expectStatus(t, rec, http.StatusBadRequest)
+	})
+
+	t.Run("only the team's scanners may check in", func(t *testing.T) {
+		for name, token := range map[string]string{"viewer": viewerToken, "attendee": attendeeToken} {
+			rec := checkIn(token, event.ID, CheckinRequest{Payload: tickets[2].QRCode})
+			if rec.Code != http.StatusForbidden {
+				t.Fatalf("%s: expected 403, got %d", name, rec.Code)
+			}
+		}
+	})
+
+	t.Run("cancelled tickets are refused", func(t *testing.T) {
+		if err := store.CancelRegistrationTickets(tickets[2].RegistrationID); err != nil {
+			t.Fatal(err)
+		}
+
+		rec := checkIn(organizerToken, event.ID, CheckinRequest{Payload: tickets[2].QRCode})
+		expectStatus(t, rec, http.StatusConflict)
+
+		var resp struct {
+			Status string `json:"status"`
+		}
+		decodeBody(t, rec, &resp)
+		if resp.Status != "cancelled" {
+			t.Fatalf("expected the ticket to be reported cancelled, got %q", resp.Status)
+		}
+	})
+}
+
+func TestGetTicketByNumberEscapesFilter(t *testing.T) {
+	var filter string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		filter = r.URL.Query().Get("ticket_number")
+		w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+
+	client := NewSupabaseClient(server.URL, "anon", "service")
+
+	// A typed number cannot add filters of its own
+	if _, err := client.GetTicketByNumber("GT-1&status=eq.used"); err == nil {
+		t.Fatal("expected an unknown ticket number not to be found")
+	}
+	if filter != "eq.GT-1&status=eq.used" {
+		t.Fatalf("expected the whole number in one filter, got %q", filter)
+	}
+}
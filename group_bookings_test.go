@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestOrderSeats(t *testing.T) {
+	ada := Attendee{Name: "Ada Lovelace", Email: "ada@example.com"}
+	grace := Attendee{Name: "Grace Hopper"}
+
+	tests := []struct {
+		name      string
+		quantity  int
+		attendees []Attendee
+		want      int
+		valid     bool
+	}{
+		{"default", 0, nil, 1, true},
+		{"quantity", 4, nil, 4, true},
+		{"one per attendee", 0, []Attendee{ada, grace}, 2, true},
+		{"quantity matching attendees", 2, []Attendee{ada, grace}, 2, true},
+		{"largest order", maxSeatsPerOrder, nil, maxSeatsPerOrder, true},
+		{"too many seats", maxSeatsPerOrder + 1, nil, 0, false},
+		{"negative quantity", -1, nil, 0, false},
+		{"attendees short of quantity", 3, []Attendee{ada, grace}, 0, false},
+		{"attendee without a name", 0, []Attendee{ada, {Name: "  "}}, 0, false},
+		{"attendee with a bad email", 0, []Attendee{{Name: "Ada", Email: "not-an-email"}}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seats, err := orderSeats(tt.quantity, tt.attendees)
+			if (err == nil) != tt.valid || seats != tt.want {
+				t.Fatalf("expected %d seats (valid %v), got %d, %v", tt.want, tt.valid, seats, err)
+			}
+		})
+	}
+
+	attendees := []Attendee{{Name: "  Ada Lovelace ", Email: " ada@example.com "}}
+	if _, err := orderSeats(0, attendees); err != nil || attendees[0].Name != "Ada Lovelace" || attendees[0].Email != "ada@example.com" {
+		t.Fatalf("expected attendee details to be trimmed, got %+v (%v)", attendees[0], err)
+	}
+}
+
+func TestGroupBooking(t *testing.T) {
+	store := newTestStore(t)
+	organizerID, _ := newTestUser(t, store, "organizer@example.com", roleOrganizer)
+	buyerID, buyerToken := newTestUser(t, store, "buyer@example.com", roleAttendee)
+	_, otherToken := newTestUser(t, store, "other@example.com", roleAttendee)
+
+	capacity := 4
+	event := newTestEvent(t, store, organizerID, CreateEventRequest{Capacity: &capacity})
+
+	attendees := []Attendee{
+		{Name: "Ada Lovelace", Email: "ada@example.com"},
+		{Name: "Grace Hopper"},
+		{Name: "Katherine Johnson", Email: "katherine@example.com"},
+	}
+	resp := registerForEvent(t, buyerToken, EventRegistrationRequest{EventID: event.ID, Attendees: attendees})
+
+	if resp.Registration.Quantity != 3 || len(resp.Registration.Attendees) != 3 {
+		t.Fatalf("expected one registration for 3 seats, got %+v", resp.Registration)
+	}
+	if len(resp.Tickets) != 3 {
+		t.Fatalf("expected 3 tickets, got %d", len(resp.Tickets))
+	}
+	numbers := make(map[string]bool)
+	for i, ticket := range resp.Tickets {
+		if ticket.UserID != buyerID || ticket.RegistrationID != resp.Registration.ID {
+			t.Fatalf("ticket %d: expected the buyer to hold it, got %+v", i, ticket)
+		}
+		if ticket.AttendeeName != attendees[i].Name || ticket.AttendeeEmail != attendees[i].Email {
+			t.Fatalf("ticket %d: expected it to name %+v, got %q <%s>", i, attendees[i], ticket.AttendeeName, ticket.AttendeeEmail)
+		}
+		numbers[ticket.TicketNumber] = true
+	}
+	if len(numbers) != 3 {
+		t.Fatalf("expected every seat to get its own ticket number, got %v", numbers)
+	}
+
+	t.Run("a group is booked in full or not at all", func(t *testing.T) {
+		rec := serveAuthenticated(handleRegistrations, http.MethodPost, "/api/registrations", otherToken, EventRegistrationRequest{EventID: event.ID, Quantity: 2})
+		expectStatus(t, rec, http.StatusConflict)
+
+		if count, _ := store.GetEventRegistrationCount(event.ID); count != 3 {
+			t.Fatalf("expected the failed group to take no seats, got %d taken", count)
+		}
+
+		registerForEvent(t, otherToken, EventRegistrationRequest{EventID: event.ID, Quantity: 1})
+	})
+
+	t.Run("cancelling frees every seat", func(t *testing.T) {
+		cancelRegistration(t, buyerToken, resp.Registration.ID)
+
+		if count, _ := store.GetEventRegistrationCount(event.ID); count != 1 {
+			t.Fatalf("expected only the single seat to remain, got %d", count)
+		}
+		active, _ := store.GetUserTickets(buyerID, "active")
+		if len(active) != 0 {
+			t.Fatalf("expected all 3 tickets to be cancelled, got %d active", len(active))
+		}
+	})
+}
@@ -0,0 +1,855 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Seat hold settings
+const (
+	defaultSeatHoldTTL = 10 * time.Minute
+	holdSweepInterval  = 30 * time.Second
+)
+
+// seatHoldTTL is how long a hold keeps its seats, set from SEAT_HOLD_TTL in setup
+var seatHoldTTL = defaultSeatHoldTTL
+
+// SeatHold reserves seats for a user while they complete checkout. Active
+// holds count against event and tier capacity until they are confirmed
+// into a registration, released, or expire.
+type SeatHold struct {
+	ID             string `json:"id"`
+	EventID        string `json:"event_id"`
+	UserID         string `json:"user_id"`
+	TierID         string `json:"tier_id,omitempty"`
+	Quantity       int    `json:"quantity"`
+	Status         string `json:"status"`
+	ExpiresAt      string `json:"expires_at"`
+	RegistrationID string `json:"registration_id,omitempty"`
+	CreatedAt      string `json:"created_at"`
+
+	// Booking details carried over to the registration on confirmation
+	Notes     string     `json:"notes,omitempty"`
+	Attendees []Attendee `json:"attendees,omitempty"`
+
+	// Promo code applied to the order and the amount it took off
+	PromoCodeID string  `json:"promo_code_id,omitempty"`
+	Discount    float64 `json:"discount,omitempty"`
+
+	// Billing holds the buyer's invoicing details for paid orders
+	Billing *BillingDetails `json:"billing,omitempty"`
+}
+
+// CreateHoldRequest represents seat hold input
+type CreateHoldRequest struct {
+	EventID   string     `json:"event_id"`
+	TierID    string     `json:"tier_id"`
+	Quantity  int        `json:"quantity"`
+	Notes     string     `json:"notes"`
+	Attendees []Attendee `json:"attendees"`
+	PromoCode string     `json:"promo_code"`
+
+	// Billing optionally names the buyer on the invoice of a paid order
+	Billing *BillingDetails `json:"billing"`
+}
+
+// ConfirmHoldRequest represents the details added when a hold is confirmed
+type ConfirmHoldRequest struct {
+	Notes     string     `json:"notes"`
+	Attendees []Attendee `json:"attendees"`
+}
+
+// errHoldExpired is returned when confirming a hold that is no longer active
+var errHoldExpired = errors.New("hold expired")
+
+// seatHoldTTLFromEnv reads SEAT_HOLD_TTL as a Go duration (default 10m)
+func seatHoldTTLFromEnv() (time.Duration, error) {
+	value := os.Getenv("SEAT_HOLD_TTL")
+	if value == "" {
+		return defaultSeatHoldTTL, nil
+	}
+
+	ttl, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid SEAT_HOLD_TTL: %v", err)
+	}
+	if ttl <= 0 {
+		return 0, fmt.Errorf("invalid SEAT_HOLD_TTL: must be positive")
+	}
+
+	return ttl, nil
+}
+
+// holdIsActive reports whether a hold still keeps its seats at now
+func holdIsActive(hold *SeatHold, now time.Time) bool {
+	if hold.Status != "active" {
+		return false
+	}
+
+	expiresAt, err := time.Parse(time.RFC3339, hold.ExpiresAt)
+	if err != nil {
+		return false
+	}
+
+	return now.Before(expiresAt)
+}
+
+// reloadHold re-reads a hold once its event's reservation lock is held.
+// The copy loaded before locking may be stale: a payment webhook or another
+// confirmation can have completed the order in the meantime. A confirmed
+// hold returns its registration; any other inactive hold is errHoldExpired.
+func reloadHold(holdID string) (*SeatHold, *Registration, error) {
+	hold, err := holdStore.GetHold(holdID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if hold.Status == "confirmed" && hold.RegistrationID != "" {
+		registration, err := registrationStore.GetRegistrationByID("", hold.RegistrationID)
+		if err != nil {
+			return nil, nil, err
+		}
+		return hold, registration, nil
+	}
+
+	if !holdIsActive(hold, time.Now()) {
+		return nil, nil, errHoldExpired
+	}
+
+	return hold, nil, nil
+}
+
+// runHoldSweeper expires lapsed holds every interval and hands the freed
+// seats to the waitlist. It runs for the lifetime of the server.
+func runHoldSweeper(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		sweepExpiredHolds()
+	}
+}
+
+// sweepExpiredHolds marks lapsed holds as expired. Capacity checks already
+// ignore them, so this only tidies up and lets waitlisted registrations in.
+func sweepExpiredHolds() {
+	expired, err := holdStore.ExpireHolds()
+	if err != nil {
+		fmt.Printf("Error expiring seat holds: %v\n", err)
+		return
+	}
+
+	events := make(map[string]bool)
+	for _, hold := range expired {
+		events[hold.EventID] = true
+		cancelHoldPayment(hold.ID)
+	}
+
+	for eventID := range events {
+		eventID := eventID
+		err := reservationLedger.WithEvent(eventID, func() error {
+			return fillFromWaitlist(eventID)
+		})
+		if err != nil {
+			fmt.Printf("Error promoting from waitlist: %v\n", err)
+		}
+	}
+}
+
+// ensureNotRegistered rejects a hold for a user who already has a
+// registration for the event, before any seats are held or money taken
+func ensureNotRegistered(token, userID, eventID string) error {
+	registrations, err := registrationStore.GetUserRegistrations(token, userID, "")
+	if err != nil {
+		return err
+	}
+
+	for _, reg := range registrations {
+		if reg.EventID == eventID && reg.Status != "cancelled" {
+			return errAlreadyRegistered
+		}
+	}
+
+	return nil
+}
+
+// placeHold stores newHold in place of the user's previous hold for the
+// event, if the event and tier have room for its seats and its promo code
+// has redemptions left
+func placeHold(newHold SeatHold, event *Event, tier *TicketTier, promo *PromoCode) (*SeatHold, error) {
+	newHold.ExpiresAt = time.Now().Add(seatHoldTTL).UTC().Format(time.RFC3339)
+	if tier != nil {
+		newHold.TierID = tier.ID
+	}
+
+	var hold *SeatHold
+	err := reservationLedger.WithEvent(event.ID, func() error {
+		if err := holdStore.ReleaseUserHolds(event.ID, newHold.UserID); err != nil {
+			return err
+		}
+
+		hasRoom, err := eventHasRoom(event.ID, event.Capacity, newHold.Quantity)
+		if err != nil {
+			return err
+		}
+		if !hasRoom {
+			return errEventFull
+		}
+		if err := ensureTierHasRoom(tier, newHold.Quantity); err != nil {
+			return err
+		}
+		if err := ensurePromoAvailable(promo, newHold.UserID); err != nil {
+			return err
+		}
+
+		hold, err = holdStore.CreateHold(newHold)
+		return err
+	})
+
+	return hold, err
+}
+
+// sendHoldError reports why placeHold failed
+func sendHoldError(w http.ResponseWriter, err error, tier *TicketTier) {
+	if sendPromoError(w, err) {
+		return
+	}
+	if err == errEventFull || strings.Contains(err.Error(), "event_full") {
+		sendError(w, http.StatusConflict, "Event full", "Not enough seats are left for this order")
+		return
+	}
+	if err == errTierSoldOut || strings.Contains(err.Error(), "tier_sold_out") {
+		sendError(w, http.StatusConflict, "Tier sold out", fmt.Sprintf("Not enough %s tickets are left for this order", tier.Name))
+		return
+	}
+	fmt.Printf("Error creating hold: %v\n", err)
+	sendError(w, http.StatusInternalServerError, "Server error", "Unable to hold seats")
+}
+
+// =====================================================
+// Seat Hold Handlers
+// =====================================================
+
+func handleHolds(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		handleGetHolds(w, r)
+	case http.MethodPost:
+		handleCreateHold(w, r)
+	default:
+		sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "Only GET and POST methods are allowed")
+	}
+}
+
+// handleGetHolds lists the caller's active holds
+func handleGetHolds(w http.ResponseWriter, r *http.Request) {
+	auth := authFromRequest(r)
+
+	holds, err := holdStore.GetUserHolds(auth.UserID)
+	if err != nil {
+		fmt.Printf("Error fetching holds: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to fetch holds")
+		return
+	}
+
+	now := time.Now()
+	active := []SeatHold{}
+	for i := range holds {
+		if holdIsActive(&holds[i], now) {
+			active = append(active, holds[i])
+		}
+	}
+
+	sendJSON(w, http.StatusOK, map[string]interface{}{
+		"holds": active,
+		"count": len(active),
+	})
+}
+
+// handleCreateHold reserves seats for seatHoldTTL. A new hold replaces any
+// hold the caller already has for the same event.
+func handleCreateHold(w http.ResponseWriter, r *http.Request) {
+	auth := authFromRequest(r)
+
+	var req CreateHoldRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, "Invalid request", "Invalid JSON format")
+		return
+	}
+
+	if req.EventID == "" {
+		sendError(w, http.StatusBadRequest, "Validation error", "Event ID is required")
+		return
+	}
+
+	seats, err := orderSeats(req.Quantity, req.Attendees)
+	if err != nil {
+		sendError(w, http.StatusBadRequest, "Validation error", err.Error())
+		return
+	}
+	if err := validateBilling(req.Billing); err != nil {
+		sendError(w, http.StatusBadRequest, "Validation error", err.Error())
+		return
+	}
+
+	event, err := eventStore.GetEventByID(req.EventID)
+	if err != nil {
+		sendError(w, http.StatusNotFound, "Not found", "Event not found")
+		return
+	}
+
+	if event.Status != "active" {
+		sendError(w, http.StatusBadRequest, "Event unavailable", "This event is no longer accepting registrations")
+		return
+	}
+
+	tiers, err := tierStore.GetEventTiers(req.EventID)
+	if err != nil {
+		fmt.Printf("Error fetching tiers: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to fetch ticket tiers")
+		return
+	}
+
+	tier, err := selectTier(tiers, req.TierID)
+	if err != nil {
+		sendError(w, http.StatusBadRequest, "Validation error", err.Error())
+		return
+	}
+	if tier != nil {
+		if err := checkTierOrder(tier, seats, time.Now()); err != nil {
+			sendError(w, http.StatusConflict, "Tier unavailable", err.Error())
+			return
+		}
+	}
+
+	newHold := SeatHold{
+		EventID:   req.EventID,
+		UserID:    auth.UserID,
+		Quantity:  seats,
+		Notes:     req.Notes,
+		Attendees: req.Attendees,
+		Billing:   req.Billing,
+	}
+	if tier != nil {
+		newHold.TierID = tier.ID
+	}
+
+	var promo *PromoCode
+	if req.PromoCode != "" {
+		if promo, err = orderPromoCode(req.EventID, req.PromoCode, tier, time.Now()); err != nil {
+			sendPromoError(w, err)
+			return
+		}
+		newHold.PromoCodeID = promo.ID
+		newHold.Discount = promoDiscount(promo, orderAmount(event, newHold.TierID, seats))
+	}
+
+	if err := ensureNotRegistered(auth.SupabaseToken, auth.UserID, req.EventID); err != nil {
+		if err == errAlreadyRegistered {
+			sendError(w, http.StatusConflict, "Already registered", "You are already registered for this event")
+			return
+		}
+		fmt.Printf("Error checking registrations: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to hold seats")
+		return
+	}
+
+	hold, err := placeHold(newHold, event, tier, promo)
+	if err != nil {
+		sendHoldError(w, err, tier)
+		return
+	}
+
+	sendJSON(w, http.StatusCreated, map[string]interface{}{
+		"hold":       hold,
+		"amount_due": orderTotal(event, hold.TierID, hold.Quantity, hold.Discount),
+		"expires_in": int(seatHoldTTL.Seconds()),
+		"message":    fmt.Sprintf("%d seat(s) held until %s", hold.Quantity, hold.ExpiresAt),
+	})
+}
+
+func handleHoldDetail(w http.ResponseWriter, r *http.Request) {
+	// Extract hold ID from URL path: /api/holds/{id} or /api/holds/{id}/{resource}
+	path := strings.TrimPrefix(r.URL.Path, "/api/holds/")
+	holdID, resource, _ := strings.Cut(strings.TrimSpace(path), "/")
+
+	if holdID == "" {
+		sendError(w, http.StatusBadRequest, "Invalid request", "Hold ID is required")
+		return
+	}
+
+	auth := authFromRequest(r)
+
+	hold, err := holdStore.GetHold(holdID)
+	if err != nil || hold.UserID != auth.UserID {
+		sendError(w, http.StatusNotFound, "Not found", "Hold not found")
+		return
+	}
+
+	switch resource {
+	case "":
+		switch r.Method {
+		case http.MethodGet:
+			sendJSON(w, http.StatusOK, map[string]interface{}{
+				"hold":   hold,
+				"active": holdIsActive(hold, time.Now()),
+			})
+		case http.MethodDelete:
+			handleReleaseHold(w, hold)
+		default:
+			sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "Only GET and DELETE methods are allowed")
+		}
+	case "confirm":
+		if r.Method != http.MethodPost {
+			sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "Only POST method is allowed")
+			return
+		}
+		handleConfirmHold(w, r, hold)
+	case "payment":
+		if r.Method != http.MethodPost {
+			sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "Only POST method is allowed")
+			return
+		}
+		handleHoldPayment(w, hold)
+	default:
+		sendError(w, http.StatusNotFound, "Not found", "Unknown hold resource")
+	}
+}
+
+// handleReleaseHold gives a hold's seats back before it expires
+func handleReleaseHold(w http.ResponseWriter, hold *SeatHold) {
+	if !holdIsActive(hold, time.Now()) {
+		sendError(w, http.StatusGone, "Hold expired", "This hold is no longer active")
+		return
+	}
+
+	err := reservationLedger.WithEvent(hold.EventID, func() error {
+		if err := holdStore.ReleaseHold(hold.ID); err != nil {
+			return err
+		}
+		cancelHoldPayment(hold.ID)
+		if err := fillFromWaitlist(hold.EventID); err != nil {
+			// The release stands; the sweeper retries the promotion
+			fmt.Printf("Error promoting from waitlist: %v\n", err)
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("Error releasing hold: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to release hold")
+		return
+	}
+
+	sendJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Hold released successfully",
+	})
+}
+
+// handleConfirmHold turns an active hold into a confirmed registration
+// and issues one ticket per held seat. Paid holds are captured first and
+// only confirmed once the payment succeeds.
+func handleConfirmHold(w http.ResponseWriter, r *http.Request, hold *SeatHold) {
+	var req ConfirmHoldRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			sendError(w, http.StatusBadRequest, "Invalid request", "Invalid JSON format")
+			return
+		}
+	}
+
+	if req.Notes == "" {
+		req.Notes = hold.Notes
+	}
+	if len(req.Attendees) == 0 {
+		req.Attendees = hold.Attendees
+	}
+	if err := validateAttendees(req.Attendees, hold.Quantity); err != nil {
+		sendError(w, http.StatusBadRequest, "Validation error", err.Error())
+		return
+	}
+
+	// A payment webhook may already have completed the order
+	if hold.Status == "confirmed" && hold.RegistrationID != "" {
+		registration, err := registrationStore.GetRegistrationByID("", hold.RegistrationID)
+		if err != nil {
+			fmt.Printf("Error fetching registration for hold: %v\n", err)
+			sendError(w, http.StatusInternalServerError, "Server error", "Unable to fetch registration")
+			return
+		}
+		sendConfirmedHold(w, registration)
+		return
+	}
+
+	if !holdIsActive(hold, time.Now()) {
+		sendError(w, http.StatusGone, "Hold expired", "This hold is no longer active")
+		return
+	}
+
+	event, err := eventStore.GetEventByID(hold.EventID)
+	if err != nil {
+		sendError(w, http.StatusNotFound, "Not found", "Event not found")
+		return
+	}
+
+	paid := orderTotal(event, hold.TierID, hold.Quantity, hold.Discount) > 0
+
+	var registration, confirmed *Registration
+	var payment *Payment
+	err = reservationLedger.WithEvent(hold.EventID, func() error {
+		current, existing, err := reloadHold(hold.ID)
+		if err != nil || existing != nil {
+			confirmed = existing
+			return err
+		}
+
+		if paid {
+			registration, payment, err = capturePaidHold(current, req.Notes, req.Attendees)
+		} else {
+			registration, err = holdStore.ConfirmHold(current.ID, req.Notes, req.Attendees)
+		}
+		return err
+	})
+	if err != nil {
+		if err == errPaymentRequired {
+			sendError(w, http.StatusPaymentRequired, "Payment required", "Start a payment with POST /api/holds/{id}/payment before confirming")
+			return
+		}
+		if err == errPaymentNotCompleted {
+			message := "The payment has not been authorized yet"
+			if payment.FailureReason != "" {
+				message = payment.FailureReason
+			}
+			sendError(w, http.StatusPaymentRequired, "Payment not completed", message)
+			return
+		}
+		if err == errHoldExpired || strings.Contains(err.Error(), "hold_expired") {
+			sendError(w, http.StatusGone, "Hold expired", "This hold is no longer active")
+			return
+		}
+		if err == errAlreadyRegistered || strings.Contains(err.Error(), "duplicate") || strings.Contains(err.Error(), "unique") || strings.Contains(err.Error(), "23505") {
+			sendError(w, http.StatusConflict, "Already registered", "You are already registered for this event")
+			return
+		}
+		fmt.Printf("Error confirming hold: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to confirm hold")
+		return
+	}
+
+	if confirmed != nil {
+		sendConfirmedHold(w, confirmed)
+		return
+	}
+
+	tickets := issueTicketsForRegistration(registration, event)
+
+	response := map[string]interface{}{
+		"registration": registration,
+		"tickets":      tickets,
+		"message":      "Registration successful",
+	}
+	if payment != nil {
+		response["payment"] = payment
+
+		invoice, err := issueInvoice(registration, event, payment)
+		if err != nil {
+			fmt.Printf("Error issuing invoice for registration %s: %v\n", registration.ID, err)
+		} else {
+			response["invoice"] = invoice
+		}
+	}
+
+	sendJSON(w, http.StatusCreated, response)
+}
+
+// sendConfirmedHold answers a repeated confirmation with the order the hold
+// was already turned into
+func sendConfirmedHold(w http.ResponseWriter, registration *Registration) {
+	sendJSON(w, http.StatusOK, map[string]interface{}{
+		"registration": registration,
+		"tickets":      registrationTickets(registration),
+		"message":      "Registration successful",
+	})
+}
+
+// =====================================================
+// Supabase Seat Hold Functions
+// =====================================================
+
+// CreateHold stores an active hold
+func (c *SupabaseClient) CreateHold(hold SeatHold) (*SeatHold, error) {
+	payload := map[string]interface{}{
+		"event_id":   hold.EventID,
+		"user_id":    hold.UserID,
+		"tier_id":    nullIfEmpty(hold.TierID),
+		"quantity":   hold.Quantity,
+		"status":     "active",
+		"expires_at": hold.ExpiresAt,
+		"notes":      hold.Notes,
+		"attendees":  attendeesOrEmpty(hold.Attendees),
+
+		"promo_code_id": nullIfEmpty(hold.PromoCodeID),
+		"discount":      hold.Discount,
+		"billing":       hold.Billing,
+	}
+
+	var holds []SeatHold
+	if err := c.doREST("POST", "/rest/v1/seat_holds", "", payload, &holds); err != nil {
+		return nil, err
+	}
+
+	if len(holds) == 0 {
+		return nil, fmt.Errorf("hold created but no data returned")
+	}
+
+	return &holds[0], nil
+}
+
+// GetHold returns a single hold
+func (c *SupabaseClient) GetHold(holdID string) (*SeatHold, error) {
+	var holds []SeatHold
+	if err := c.doREST("GET", fmt.Sprintf("/rest/v1/seat_holds?id=eq.%s&select=*", holdID), "", nil, &holds); err != nil {
+		return nil, err
+	}
+
+	if len(holds) == 0 {
+		return nil, fmt.Errorf("hold not found")
+	}
+
+	return &holds[0], nil
+}
+
+// GetUserHolds returns a user's active holds, newest first
+func (c *SupabaseClient) GetUserHolds(userID string) ([]SeatHold, error) {
+	path := fmt.Sprintf("/rest/v1/seat_holds?user_id=eq.%s&status=eq.active&select=*&order=created_at.desc", userID)
+
+	var holds []SeatHold
+	if err := c.doREST("GET", path, "", nil, &holds); err != nil {
+		return nil, err
+	}
+
+	return holds, nil
+}
+
+// ReleaseHold gives an active hold's seats back
+func (c *SupabaseClient) ReleaseHold(holdID string) error {
+	path := fmt.Sprintf("/rest/v1/seat_holds?id=eq.%s&status=eq.active", holdID)
+	return c.doREST("PATCH", path, "", map[string]interface{}{"status": "released"}, nil)
+}
+
+// ReleaseUserHolds releases every active hold a user has for an event
+func (c *SupabaseClient) ReleaseUserHolds(eventID, userID string) error {
+	path := fmt.Sprintf("/rest/v1/seat_holds?event_id=eq.%s&user_id=eq.%s&status=eq.active", eventID, userID)
+	return c.doREST("PATCH", path, "", map[string]interface{}{"status": "released"}, nil)
+}
+
+// ConfirmHold converts an active hold into a confirmed registration in one
+// transaction, so the seats are never counted twice or lost in between
+func (c *SupabaseClient) ConfirmHold(holdID, notes string, attendees []Attendee) (*Registration, error) {
+	payload := map[string]interface{}{
+		"p_hold_id":   holdID,
+		"p_notes":     notes,
+		"p_attendees": attendeesOrEmpty(attendees),
+	}
+
+	var registrations []Registration
+	if err := c.doREST("POST", "/rest/v1/rpc/confirm_seat_hold", "", payload, &registrations); err != nil {
+		return nil, err
+	}
+
+	if len(registrations) == 0 {
+		return nil, errHoldExpired
+	}
+
+	return &registrations[0], nil
+}
+
+// ExpireHolds marks lapsed active holds as expired and returns them
+func (c *SupabaseClient) ExpireHolds() ([]SeatHold, error) {
+	path := fmt.Sprintf("/rest/v1/seat_holds?status=eq.active&expires_at=lte.%s", url.QueryEscape(nowTimestamp()))
+
+	var holds []SeatHold
+	if err := c.doREST("PATCH", path, "", map[string]interface{}{"status": "expired"}, &holds); err != nil {
+		return nil, err
+	}
+
+	return holds, nil
+}
+
+// heldSeats returns the seats in active holds for an event, in total and per tier
+func (c *SupabaseClient) heldSeats(eventID string) (int, map[string]int, error) {
+	path := fmt.Sprintf("/rest/v1/seat_holds?event_id=eq.%s&status=eq.active&expires_at=gt.%s&select=tier_id,quantity",
+		eventID, url.QueryEscape(nowTimestamp()))
+
+	var rows []struct {
+		TierID   *string `json:"tier_id"`
+		Quantity int     `json:"quantity"`
+	}
+	if err := c.doREST("GET", path, "", nil, &rows); err != nil {
+		return 0, nil, err
+	}
+
+	total := 0
+	byTier := make(map[string]int)
+	for _, row := range rows {
+		total += row.Quantity
+		if row.TierID != nil {
+			byTier[*row.TierID] += row.Quantity
+		}
+	}
+
+	return total, byTier, nil
+}
+
+// =====================================================
+// In-memory Seat Hold Functions
+// =====================================================
+
+// CreateHold stores an active hold
+func (m *MemoryStore) CreateHold(hold SeatHold) (*SeatHold, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.events[hold.EventID]; !exists {
+		return nil, fmt.Errorf("failed to create hold: event not found")
+	}
+
+	hold.ID = newID()
+	hold.Status = "active"
+	hold.CreatedAt = nowTimestamp()
+	m.holds[hold.ID] = &hold
+
+	created := hold
+	return &created, nil
+}
+
+// GetHold returns a single hold
+func (m *MemoryStore) GetHold(holdID string) (*SeatHold, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	hold, exists := m.holds[holdID]
+	if !exists {
+		return nil, fmt.Errorf("hold not found")
+	}
+
+	found := *hold
+	return &found, nil
+}
+
+// GetUserHolds returns a user's active holds, newest first
+func (m *MemoryStore) GetUserHolds(userID string) ([]SeatHold, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	holds := []SeatHold{}
+	for _, hold := range m.holds {
+		if hold.UserID == userID && hold.Status == "active" {
+			holds = append(holds, *hold)
+		}
+	}
+
+	sort.Slice(holds, func(i, j int) bool {
+		return holds[i].CreatedAt > holds[j].CreatedAt
+	})
+
+	return holds, nil
+}
+
+// ReleaseHold gives an active hold's seats back
+func (m *MemoryStore) ReleaseHold(holdID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if hold, exists := m.holds[holdID]; exists && hold.Status == "active" {
+		hold.Status = "released"
+	}
+
+	return nil
+}
+
+// ReleaseUserHolds releases every active hold a user has for an event
+func (m *MemoryStore) ReleaseUserHolds(eventID, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, hold := range m.holds {
+		if hold.EventID == eventID && hold.UserID == userID && hold.Status == "active" {
+			hold.Status = "released"
+		}
+	}
+
+	return nil
+}
+
+// ConfirmHold converts an active hold into a confirmed registration
+func (m *MemoryStore) ConfirmHold(holdID, notes string, attendees []Attendee) (*Registration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	hold, exists := m.holds[holdID]
+	if !exists || !holdIsActive(hold, time.Now()) {
+		return nil, errHoldExpired
+	}
+
+	registration, err := m.createRegistrationLocked(Registration{
+		EventID:   hold.EventID,
+		UserID:    hold.UserID,
+		Notes:     notes,
+		TierID:    hold.TierID,
+		Quantity:  hold.Quantity,
+		Attendees: attendees,
+
+		PromoCodeID: hold.PromoCodeID,
+		Discount:    hold.Discount,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	hold.Status = "confirmed"
+	hold.RegistrationID = registration.ID
+
+	return registration, nil
+}
+
+// ExpireHolds marks lapsed active holds as expired and returns them
+func (m *MemoryStore) ExpireHolds() ([]SeatHold, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	expired := []SeatHold{}
+	for _, hold := range m.holds {
+		if hold.Status == "active" && !holdIsActive(hold, now) {
+			hold.Status = "expired"
+			expired = append(expired, *hold)
+		}
+	}
+
+	return expired, nil
+}
+
+// heldSeatsLocked returns the seats in active holds for an event, in total
+// and per tier. Callers must hold m.mu.
+func (m *MemoryStore) heldSeatsLocked(eventID string) (int, map[string]int) {
+	now := time.Now()
+	total := 0
+	byTier := make(map[string]int)
+	for _, hold := range m.holds {
+		if hold.EventID == eventID && holdIsActive(hold, now) {
+			total += hold.Quantity
+			if hold.TierID != "" {
+				byTier[hold.TierID] += hold.Quantity
+			}
+		}
+	}
+
+	return total, byTier
+}
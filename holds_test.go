@@ -0,0 +1,189 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// holdResponse is the body of a created hold
+type holdResponse struct {
+	Hold      SeatHold `json:"hold"`
+	ExpiresIn int      `json:"expires_in"`
+}
+
+// createHold holds seats for the holder of token and expects 201 Created
+func createHold(t *testing.T, token string, req CreateHoldRequest) SeatHold {
+	t.Helper()
+
+	rec := serveAuthenticated(handleHolds, http.MethodPost, "/api/holds", token, req)
+	expectStatus(t, rec, http.StatusCreated)
+
+	var resp holdResponse
+	decodeBody(t, rec, &resp)
+	return resp.Hold
+}
+
+// lapseHold moves a hold's expiry into the past
+func lapseHold(store *MemoryStore, holdID string) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.holds[holdID].ExpiresAt = time.Now().Add(-time.Second).UTC().Format(time.RFC3339)
+}
+
+func TestHoldIsActive(t *testing.T) {
+	now := time.Date(2030, 1, 1, 10, 0, 0, 0, time.UTC)
+	hold := &SeatHold{Status: "active", ExpiresAt: now.Format(time.RFC3339)}
+
+	if !holdIsActive(hold, now.Add(-time.Second)) {
+		t.Fatal("expected the hold to be active before it expires")
+	}
+	if holdIsActive(hold, now) {
+		t.Fatal("expected the hold to lapse at its expiry time")
+	}
+
+	hold.Status = "released"
+	if holdIsActive(hold, now.Add(-time.Second)) {
+		t.Fatal("expected a released hold to be inactive")
+	}
+}
+
+func TestSeatHoldTTLFromEnv(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+		valid bool
+	}{
+		{"", defaultSeatHoldTTL, true},
+		{"90s", 90 * time.Second, true},
+		{"0s", 0, false},
+		{"-1m", 0, false},
+		{"ten minutes", 0, false},
+	}
+	for _, tt := range tests {
+		t.Setenv("SEAT_HOLD_TTL", tt.value)
+		ttl, err := seatHoldTTLFromEnv()
+		if (err == nil) != tt.valid || ttl != tt.want {
+			t.Fatalf("SEAT_HOLD_TTL=%q: expected %v (valid %v), got %v, %v", tt.value, tt.want, tt.valid, ttl, err)
+		}
+	}
+}
+
+func TestSeatHolds(t *testing.T) {
+	store := newTestStore(t)
+	organizerID, _ := newTestUser(t, store, "organizer@example.com", roleOrganizer)
+	_, buyerToken := newTestUser(t, store, "buyer@example.com", roleAttendee)
+	_, otherToken := newTestUser(t, store, "other@example.com", roleAttendee)
+
+	capacity := 3
+	event := newTestEvent(t, store, organizerID, CreateEventRequest{Capacity: &capacity})
+
+	hold := createHold(t, buyerToken, CreateHoldRequest{EventID: event.ID, Quantity: 2})
+	if hold.Status != "active" || hold.Quantity != 2 {
+		t.Fatalf("unexpected hold %+v", hold)
+	}
+
+	t.Run("held seats count against capacity", func(t *testing.T) {
+		rec := serveAuthenticated(handleRegistrations, http.MethodPost, "/api/registrations", otherToken, EventRegistrationRequest{EventID: event.ID, Quantity: 2})
+		expectStatus(t, rec, http.StatusConflict)
+
+		rec = serveAuthenticated(handleHolds, http.MethodPost, "/api/holds", otherToken, CreateHoldRequest{EventID: event.ID, Quantity: 2})
+		expectStatus(t, rec, http.StatusConflict)
+	})
+
+	t.Run("a new hold replaces the previous one", func(t *testing.T) {
+		hold = createHold(t, buyerToken, CreateHoldRequest{EventID: event.ID, Quantity: 3})
+
+		rec := serveAuthenticated(handleHolds, http.MethodGet, "/api/holds", buyerToken, nil)
+		var resp struct {
+			Holds []SeatHold `json:"holds"`
+		}
+		decodeBody(t, rec, &resp)
+		if len(resp.Holds) != 1 || resp.Holds[0].ID != hold.ID {
+			t.Fatalf("expected only the newest hold to be active, got %+v", resp.Holds)
+		}
+	})
+
+	t.Run("holds are private", func(t *testing.T) {
+		rec := serveAuthenticated(handleHoldDetail, http.MethodGet, "/api/holds/"+hold.ID, otherToken, nil)
+		expectStatus(t, rec, http.StatusNotFound)
+
+		rec = serveAuthenticated(handleHoldDetail, http.MethodPost, "/api/holds/"+hold.ID+"/confirm", otherToken, nil)
+		expectStatus(t, rec, http.StatusNotFound)
+	})
+
+	t.Run("releasing frees the seats", func(t *testing.T) {
+		rec := serveAuthenticated(handleHoldDetail, http.MethodDelete, "/api/holds/"+hold.ID, buyerToken, nil)
+		expectStatus(t, rec, http.StatusOK)
+
+		rec = serveAuthenticated(handleHoldDetail, http.MethodDelete, "/api/holds/"+hold.ID, buyerToken, nil)
+		expectStatus(t, rec, http.StatusGone)
+
+		createHold(t, otherToken, CreateHoldRequest{EventID: event.ID, Quantity: 1})
+	})
+
+	t.Run("confirming issues the tickets once", func(t *testing.T) {
+		hold = createHold(t, buyerToken, CreateHoldRequest{EventID: event.ID, Quantity: 2, Notes: "Aisle seats"})
+
+		rec := serveAuthenticated(handleHoldDetail, http.MethodPost, "/api/holds/"+hold.ID+"/confirm", buyerToken, nil)
+		expectStatus(t, rec, http.StatusCreated)
+		var resp registrationResponse
+		decodeBody(t, rec, &resp)
+		if resp.Registration.Status != "confirmed" || resp.Registration.Notes != "Aisle seats" || len(resp.Tickets) != 2 {
+			t.Fatalf("expected a confirmed registration with 2 tickets, got %+v", resp)
+		}
+
+		// A retried confirmation returns the same order
+		rec = serveAuthenticated(handleHoldDetail, http.MethodPost, "/api/holds/"+hold.ID+"/confirm", buyerToken, nil)
+		expectStatus(t, rec, http.StatusOK)
+		var retried registrationResponse
+		decodeBody(t, rec, &retried)
+		if retried.Registration.ID != resp.Registration.ID || len(retried.Tickets) != 2 {
+			t.Fatalf("expected the retry to return the same registration, got %+v", retried)
+		}
+
+		rec = serveAuthenticated(handleHolds, http.MethodPost, "/api/holds", buyerToken, CreateHoldRequest{EventID: event.ID})
+		expectStatus(t, rec, http.StatusConflict)
+	})
+}
+
+func TestExpiredHolds(t *testing.T) {
+	store := newTestStore(t)
+	organizerID, _ := newTestUser(t, store, "organizer@example.com", roleOrganizer)
+	_, buyerToken := newTestUser(t, store, "buyer@example.com", roleAttendee)
+	_, waitingToken := newTestUser(t, store, "waiting@example.com", roleAttendee)
+
+	capacity := 1
+	event := newTestEvent(t, store, organizerID, CreateEventRequest{Capacity: &capacity, WaitlistEnabled: true})
+
+	hold := createHold(t, buyerToken, CreateHoldRequest{EventID: event.ID})
+
+	waiting := registerForEvent(t, waitingToken, EventRegistrationRequest{EventID: event.ID}).Registration
+	if waiting.Status != "waitlisted" {
+		t.Fatalf("expected the held seat to push the next buyer onto the waitlist, got %s", waiting.Status)
+	}
+
+	lapseHold(store, hold.ID)
+
+	rec := serveAuthenticated(handleHoldDetail, http.MethodPost, "/api/holds/"+hold.ID+"/confirm", buyerToken, nil)
+	expectStatus(t, rec, http.StatusGone)
+
+	sweepExpiredHolds()
+
+	expired, err := store.GetHold(hold.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expired.Status != "expired" {
+		t.Fatalf("expected the sweeper to expire the hold, got %s", expired.Status)
+	}
+
+	promoted, err := store.GetRegistrationByID("", waiting.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if promoted.Status != "confirmed" {
+		t.Fatalf("expected the freed seat to go to the waitlist, got %s", promoted.Status)
+	}
+}
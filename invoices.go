@@ -0,0 +1,905 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/your-username/go-ticket-api/pdf"
+)
+
+// Invoice settings
+const (
+	defaultGSTRate = 18.0
+
+	// invoiceSAC is the services accounting code for admission to events
+	invoiceSAC = "999692"
+)
+
+// Invoice document types. Only organizers registered for GST may issue a
+// tax invoice; everyone else issues a bill of supply, which charges no GST.
+const (
+	invoiceTypeTax          = "tax_invoice"
+	invoiceTypeBillOfSupply = "bill_of_supply"
+)
+
+// gstRate is the GST percentage included in ticket prices, set from GST_RATE in setup
+var gstRate = defaultGSTRate
+
+// istZone is Indian Standard Time, which dates invoices and financial years
+var istZone = time.FixedZone("IST", 5*60*60+30*60)
+
+// gstinPattern is the shape of a GST identification number; its first two
+// digits are the state code
+var gstinPattern = regexp.MustCompile(`^[0-9]{2}[A-Z]{5}[0-9]{4}[A-Z][1-9A-Z]Z[0-9A-Z]$`)
+
+// gstStates maps GST state codes to state and union territory names
+var gstStates = map[string]string{
+	"01": "Jammu and Kashmir", "02": "Himachal Pradesh", "03": "Punjab", "04": "Chandigarh",
+	"05": "Uttarakhand", "06": "Haryana", "07": "Delhi", "08": "Rajasthan", "09": "Uttar Pradesh",
+	"10": "Bihar", "11": "Sikkim", "12": "Arunachal Pradesh", "13": "Nagaland", "14": "Manipur",
+	"15": "Mizoram", "16": "Tripura", "17": "Meghalaya", "18": "Assam", "19": "West Bengal",
+	"20": "Jharkhand", "21": "Odisha", "22": "Chhattisgarh", "23": "Madhya Pradesh", "24": "Gujarat",
+	"26": "Dadra and Nagar Haveli and Daman and Diu", "27": "Maharashtra", "29": "Karnataka",
+	"30": "Goa", "31": "Lakshadweep", "32": "Kerala", "33": "Tamil Nadu", "34": "Puducherry",
+	"35": "Andaman and Nicobar Islands", "36": "Telangana", "37": "Andhra Pradesh", "38": "Ladakh",
+	"97": "Other Territory",
+}
+
+// TaxProfile is the GST registration an organizer invoices under
+type TaxProfile struct {
+	OrganizerID string `json:"organizer_id"`
+	LegalName   string `json:"legal_name"`
+	GSTIN       string `json:"gstin,omitempty"`
+	StateCode   string `json:"state_code"`
+	Address     string `json:"address"`
+	UpdatedAt   string `json:"updated_at"`
+}
+
+// BillingDetails are the buyer's invoicing details given with an order.
+// Registered businesses pass their GSTIN; everyone else may pass a state.
+type BillingDetails struct {
+	Name      string `json:"name,omitempty"`
+	GSTIN     string `json:"gstin,omitempty"`
+	StateCode string `json:"state_code,omitempty"`
+	Address   string `json:"address,omitempty"`
+}
+
+// InvoiceParty is the seller or buyer named on an invoice
+type InvoiceParty struct {
+	Name      string `json:"name"`
+	Email     string `json:"email,omitempty"`
+	GSTIN     string `json:"gstin,omitempty"`
+	StateCode string `json:"state_code,omitempty"`
+	State     string `json:"state,omitempty"`
+	Address   string `json:"address,omitempty"`
+}
+
+// InvoiceLine is one line of an invoice. Ticket prices include GST, so
+// Total is what was charged and TaxableValue plus the taxes add up to it.
+type InvoiceLine struct {
+	Description  string  `json:"description"`
+	SAC          string  `json:"sac"`
+	Quantity     int     `json:"quantity"`
+	UnitPrice    float64 `json:"unit_price"`
+	Discount     float64 `json:"discount"`
+	TaxableValue float64 `json:"taxable_value"`
+	CGST         float64 `json:"cgst"`
+	SGST         float64 `json:"sgst"`
+	IGST         float64 `json:"igst"`
+	Total        float64 `json:"total"`
+}
+
+// Invoice is the GST tax invoice, or bill of supply, for one paid order.
+// Numbers run without gaps per organizer and financial year, e.g.
+// 2026-27/000042.
+type Invoice struct {
+	ID             string        `json:"id"`
+	DocumentType   string        `json:"document_type"`
+	InvoiceNumber  string        `json:"invoice_number"`
+	Sequence       int           `json:"sequence"`
+	FinancialYear  string        `json:"financial_year"`
+	OrganizerID    string        `json:"organizer_id"`
+	EventID        string        `json:"event_id"`
+	RegistrationID string        `json:"registration_id"`
+	PaymentID      string        `json:"payment_id"`
+	UserID         string        `json:"user_id"`
+	Seller         InvoiceParty  `json:"seller"`
+	Buyer          InvoiceParty  `json:"buyer"`
+	PlaceOfSupply  string        `json:"place_of_supply"`
+	Lines          []InvoiceLine `json:"lines"`
+	GSTRate        float64       `json:"gst_rate"`
+	TaxableValue   float64       `json:"taxable_value"`
+	CGST           float64       `json:"cgst"`
+	SGST           float64       `json:"sgst"`
+	IGST           float64       `json:"igst"`
+	Total          float64       `json:"total"`
+	Currency       string        `json:"currency"`
+	IssuedAt       string        `json:"issued_at"`
+}
+
+// errNoInvoice is returned for orders that were not paid for
+var errNoInvoice = errors.New("order has no invoice")
+
+// gstRateFromEnv reads GST_RATE as a percentage (default 18)
+func gstRateFromEnv() (float64, error) {
+	value := os.Getenv("GST_RATE")
+	if value == "" {
+		return defaultGSTRate, nil
+	}
+
+	rate, err := strconv.ParseFloat(value, 64)
+	if err != nil || rate < 0 || rate > 100 {
+		return 0, fmt.Errorf("invalid GST_RATE: must be a percentage between 0 and 100")
+	}
+
+	return rate, nil
+}
+
+// financialYear returns the Indian financial year (April to March) that t
+// falls in, e.g. "2026-27"
+func financialYear(t time.Time) string {
+	t = t.In(istZone)
+	start := t.Year()
+	if t.Month() < time.April {
+		start--
+	}
+	return fmt.Sprintf("%d-%02d", start, (start+1)%100)
+}
+
+// formatInvoiceNumber builds the printed invoice number
+func formatInvoiceNumber(financialYear string, sequence int) string {
+	return fmt.Sprintf("%s/%06d", financialYear, sequence)
+}
+
+// validateTaxProfile checks an organizer's GST registration details
+func validateTaxProfile(profile *TaxProfile) error {
+	profile.GSTIN = strings.ToUpper(strings.TrimSpace(profile.GSTIN))
+	if strings.TrimSpace(profile.LegalName) == "" {
+		return fmt.Errorf("legal_name is required")
+	}
+	if profile.GSTIN != "" {
+		if !gstinPattern.MatchString(profile.GSTIN) {
+			return fmt.Errorf("gstin is not a valid GSTIN")
+		}
+		if profile.StateCode == "" {
+			profile.StateCode = profile.GSTIN[:2]
+		}
+		if profile.GSTIN[:2] != profile.StateCode {
+			return fmt.Errorf("gstin does not match state_code")
+		}
+	}
+	if _, known := gstStates[profile.StateCode]; !known {
+		return fmt.Errorf("state_code must be a two-digit GST state code")
+	}
+	return nil
+}
+
+// validateBilling checks the billing details given with an order
+func validateBilling(billing *BillingDetails) error {
+	if billing == nil {
+		return nil
+	}
+
+	billing.GSTIN = strings.ToUpper(strings.TrimSpace(billing.GSTIN))
+	if billing.GSTIN != "" {
+		if !gstinPattern.MatchString(billing.GSTIN) {
+			return fmt.Errorf("billing gstin is not a valid GSTIN")
+		}
+		if billing.StateCode == "" {
+			billing.StateCode = billing.GSTIN[:2]
+		}
+		if billing.GSTIN[:2] != billing.StateCode {
+			return fmt.Errorf("billing gstin does not match state_code")
+		}
+	}
+	if billing.StateCode != "" {
+		if _, known := gstStates[billing.StateCode]; !known {
+			return fmt.Errorf("billing state_code must be a two-digit GST state code")
+		}
+	}
+	return nil
+}
+
+// splitGST works out the tax included in gross minor units. Supplies within
+// one state split the tax evenly into CGST and SGST; supplies across states
+// charge it all as IGST.
+func splitGST(gross int64, rate float64, interState bool) (taxable, cgst, sgst, igst int64) {
+	taxable = toMinorUnits(fromMinorUnits(gross) * 100 / (100 + rate))
+	tax := gross - taxable
+	if interState {
+		return taxable, 0, 0, tax
+	}
+	cgst = tax / 2
+	return taxable, cgst, tax - cgst, 0
+}
+
+// buildInvoice prepares the invoice for a paid registration, without its
+// number, which the store assigns
+func buildInvoice(registration *Registration, event *Event, payment *Payment, now time.Time) (*Invoice, error) {
+	profile, err := invoiceStore.GetTaxProfile(event.OrganizerID)
+	if err != nil {
+		return nil, err
+	}
+
+	seller := InvoiceParty{}
+	if profile != nil {
+		seller = InvoiceParty{
+			Name:      profile.LegalName,
+			GSTIN:     profile.GSTIN,
+			StateCode: profile.StateCode,
+			Address:   profile.Address,
+		}
+	} else if organizer, err := userStore.GetUserByID(event.OrganizerID); err == nil {
+		seller.Name = organizer.FullName
+	}
+
+	buyer := InvoiceParty{}
+	if user, err := userStore.GetUserByID(registration.UserID); err == nil {
+		buyer.Name, buyer.Email = user.FullName, user.Email
+	}
+	if payment.HoldID != "" {
+		if hold, err := holdStore.GetHold(payment.HoldID); err == nil && hold.Billing != nil {
+			if hold.Billing.Name != "" {
+				buyer.Name = hold.Billing.Name
+			}
+			buyer.GSTIN = hold.Billing.GSTIN
+			buyer.StateCode = hold.Billing.StateCode
+			buyer.Address = hold.Billing.Address
+		}
+	}
+
+	// Buyers who give no state are treated as being in the seller's state
+	if buyer.StateCode == "" {
+		buyer.StateCode = seller.StateCode
+	}
+	seller.State = gstStates[seller.StateCode]
+	buyer.State = gstStates[buyer.StateCode]
+	interState := buyer.StateCode != seller.StateCode
+
+	// Without a GSTIN and state the seller cannot charge GST, so the order
+	// gets a bill of supply instead of a tax invoice
+	documentType, rate := invoiceTypeTax, gstRate
+	if seller.GSTIN == "" || seller.StateCode == "" {
+		documentType, rate = invoiceTypeBillOfSupply, 0
+	}
+
+	description := "Admission: " + event.Title
+	if registration.TierID != "" {
+		if tier, err := tierStore.GetTierByID(registration.TierID); err == nil {
+			description += " (" + tier.Name + ")"
+		}
+	}
+	if start, err := time.Parse(time.RFC3339, event.EventDate); err == nil {
+		description += " on " + start.In(istZone).Format("2 Jan 2006")
+	}
+
+	gross := toMinorUnits(payment.Amount)
+	taxable, cgst, sgst, igst := splitGST(gross, rate, interState)
+	line := InvoiceLine{
+		Description:  description,
+		SAC:          invoiceSAC,
+		Quantity:     registration.Seats(),
+		UnitPrice:    registrationPrice(registration, event),
+		Discount:     registration.Discount,
+		TaxableValue: fromMinorUnits(taxable),
+		CGST:         fromMinorUnits(cgst),
+		SGST:         fromMinorUnits(sgst),
+		IGST:         fromMinorUnits(igst),
+		Total:        fromMinorUnits(gross),
+	}
+
+	return &Invoice{
+		DocumentType:   documentType,
+		FinancialYear:  financialYear(now),
+		OrganizerID:    event.OrganizerID,
+		EventID:        event.ID,
+		RegistrationID: registration.ID,
+		PaymentID:      payment.ID,
+		UserID:         registration.UserID,
+		Seller:         seller,
+		Buyer:          buyer,
+		PlaceOfSupply:  buyer.State,
+		Lines:          []InvoiceLine{line},
+		GSTRate:        rate,
+		TaxableValue:   line.TaxableValue,
+		CGST:           line.CGST,
+		SGST:           line.SGST,
+		IGST:           line.IGST,
+		Total:          line.Total,
+		Currency:       paymentCurrency,
+		IssuedAt:       now.UTC().Format(time.RFC3339),
+	}, nil
+}
+
+// issueInvoice returns the invoice for a paid registration, creating it
+// if the order has none yet
+func issueInvoice(registration *Registration, event *Event, payment *Payment) (*Invoice, error) {
+	existing, err := invoiceStore.GetRegistrationInvoice(registration.ID)
+	if err != nil || existing != nil {
+		return existing, err
+	}
+
+	if payment == nil || payment.Amount <= 0 {
+		return nil, errNoInvoice
+	}
+
+	invoice, err := buildInvoice(registration, event, payment, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	return invoiceStore.CreateInvoice(*invoice)
+}
+
+// invoicePaidOrder issues the invoice for an order whose payment was just
+// captured, logging instead of failing because the order is already complete
+func invoicePaidOrder(registration *Registration, event *Event, payment *Payment) {
+	if _, err := issueInvoice(registration, event, payment); err != nil {
+		fmt.Printf("Error issuing invoice for registration %s: %v\n", registration.ID, err)
+	}
+}
+
+// canViewInvoice reports whether a user may see an invoice: its buyer or
+// the organizer who issued it
+func canViewInvoice(invoice *Invoice, userID string) bool {
+	return invoice.UserID == userID || invoice.OrganizerID == userID
+}
+
+// formatRupees formats an amount for printing on an invoice
+func formatRupees(amount float64) string {
+	return "Rs. " + strconv.FormatFloat(amount, 'f', 2, 64)
+}
+
+// renderInvoicePDF lays an invoice out on an A4 page
+func renderInvoicePDF(invoice *Invoice) []byte {
+	title, footer := "Tax Invoice", "Ticket prices are inclusive of GST."
+	if invoice.DocumentType == invoiceTypeBillOfSupply {
+		title, footer = "Bill of Supply", "The seller is not registered for GST, so no GST is charged."
+	}
+
+	doc := pdf.New(title + " " + invoice.InvoiceNumber)
+	doc.AddPage()
+
+	const left, right = 40.0, pdf.PageWidth - 40
+	y := 60.0
+
+	doc.BoldText(left, y, 18, strings.ToUpper(title))
+	doc.RightText(right, y, 10, "Invoice No: "+invoice.InvoiceNumber)
+	y += 16
+	issued, _ := time.Parse(time.RFC3339, invoice.IssuedAt)
+	doc.RightText(right, y, 10, "Date: "+issued.In(istZone).Format("02 Jan 2006"))
+	y += 14
+	doc.RightText(right, y, 10, "Place of supply: "+invoice.PlaceOfSupply)
+
+	party := func(x, y float64, heading string, p InvoiceParty) {
+		doc.BoldText(x, y, 10, heading)
+		lines := []string{p.Name, p.Address}
+		if p.GSTIN != "" {
+			lines = append(lines, "GSTIN: "+p.GSTIN)
+		}
+		if p.State != "" {
+			lines = append(lines, fmt.Sprintf("State: %s (%s)", p.State, p.StateCode))
+		}
+		if p.Email != "" {
+			lines = append(lines, p.Email)
+		}
+		for _, line := range lines {
+			if line == "" {
+				continue
+			}
+			y += 13
+			doc.Text(x, y, 9, line)
+		}
+	}
+
+	y += 30
+	party(left, y, "Sold by", invoice.Seller)
+	party(320, y, "Billed to", invoice.Buyer)
+
+	y += 100
+	doc.Line(left, y, right, y)
+	y += 14
+	doc.BoldText(left, y, 9, "Description")
+	doc.BoldText(290, y, 9, "SAC")
+	doc.BoldText(335, y, 9, "Qty")
+	doc.RightText(430, y, 9, "Taxable value")
+	doc.RightText(500, y, 9, "Tax")
+	doc.RightText(right, y, 9, "Amount")
+	y += 8
+	doc.Line(left, y, right, y)
+
+	for _, line := range invoice.Lines {
+		y += 14
+		description := line.Description
+		if len(description) > 48 {
+			description = description[:45] + "..."
+		}
+		doc.Text(left, y, 9, description)
+		doc.Text(290, y, 9, line.SAC)
+		doc.Text(335, y, 9, strconv.Itoa(line.Quantity))
+		doc.RightText(430, y, 9, formatRupees(line.TaxableValue))
+		doc.RightText(500, y, 9, formatRupees(line.CGST+line.SGST+line.IGST))
+		doc.RightText(right, y, 9, formatRupees(line.Total))
+		if line.Discount > 0 {
+			y += 12
+			doc.Text(left+10, y, 8, fmt.Sprintf("%d x %s, less discount %s", line.Quantity, formatRupees(line.UnitPrice), formatRupees(line.Discount)))
+		}
+	}
+
+	y += 10
+	doc.Line(left, y, right, y)
+
+	total := func(label, amount string) {
+		y += 16
+		doc.Text(330, y, 10, label)
+		doc.RightText(right, y, 10, amount)
+	}
+	total("Taxable value", formatRupees(invoice.TaxableValue))
+	switch {
+	case invoice.DocumentType == invoiceTypeBillOfSupply:
+	case invoice.IGST > 0:
+		total(fmt.Sprintf("IGST @ %g%%", invoice.GSTRate), formatRupees(invoice.IGST))
+	default:
+		total(fmt.Sprintf("CGST @ %g%%", invoice.GSTRate/2), formatRupees(invoice.CGST))
+		total(fmt.Sprintf("SGST @ %g%%", invoice.GSTRate/2), formatRupees(invoice.SGST))
+	}
+	y += 6
+	doc.Line(330, y, right, y)
+	y += 16
+	doc.BoldText(330, y, 11, "Total ("+invoice.Currency+")")
+	doc.RightText(right, y, 11, formatRupees(invoice.Total))
+
+	y += 40
+	doc.Text(left, y, 8, footer+" This is a computer-generated invoice and needs no signature.")
+
+	return doc.Bytes()
+}
+
+// =====================================================
+// Invoice Handlers
+// =====================================================
+
+// handleInvoices lists the caller's invoices. Organizers pass
+// role=organizer (and optionally event_id) to list the invoices they issued;
+// registration_id returns the invoice for one order.
+func handleInvoices(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "Only GET method is allowed")
+		return
+	}
+
+	auth := authFromRequest(r)
+	query := r.URL.Query()
+
+	if registrationID := query.Get("registration_id"); registrationID != "" {
+		handleRegistrationInvoice(w, auth, registrationID)
+		return
+	}
+
+	var invoices []Invoice
+	var err error
+	if query.Get("role") == "organizer" {
+		invoices, err = invoiceStore.GetOrganizerInvoices(auth.UserID, query.Get("event_id"))
+	} else {
+		invoices, err = invoiceStore.GetUserInvoices(auth.UserID)
+	}
+	if err != nil {
+		fmt.Printf("Error fetching invoices: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to fetch invoices")
+		return
+	}
+
+	sendJSON(w, http.StatusOK, map[string]interface{}{
+		"invoices": invoices,
+		"count":    len(invoices),
+	})
+}
+
+// handleRegistrationInvoice returns the invoice for a paid registration,
+// issuing it if the order completed without one
+func handleRegistrationInvoice(w http.ResponseWriter, auth *AuthInfo, registrationID string) {
+	registration, err := registrationStore.GetRegistrationByID("", registrationID)
+	if err != nil {
+		sendError(w, http.StatusNotFound, "Not found", "Registration not found")
+		return
+	}
+
+	event, err := eventStore.GetEventByID(registration.EventID)
+	if err != nil {
+		sendError(w, http.StatusNotFound, "Not found", "Event not found")
+		return
+	}
+
+	if registration.UserID != auth.UserID {
+		role, err := eventMemberRole(event, auth)
+		if err != nil {
+			fmt.Printf("Error checking event membership: %v\n", err)
+			sendError(w, http.StatusInternalServerError, "Server error", "Unable to verify permissions")
+			return
+		}
+		if !memberCan(role, eventView) {
+			sendError(w, http.StatusNotFound, "Not found", "Registration not found")
+			return
+		}
+	}
+
+	payment, err := paymentStore.GetRegistrationPayment(registration.ID)
+	if err != nil {
+		fmt.Printf("Error fetching payment: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to fetch invoice")
+		return
+	}
+	if payment != nil && payment.Status != "captured" && payment.Status != "refunded" && payment.Status != "partially_refunded" {
+		payment = nil
+	}
+
+	invoice, err := issueInvoice(registration, event, payment)
+	if err == errNoInvoice {
+		sendError(w, http.StatusNotFound, "Not found", "This registration was not paid for and has no invoice")
+		return
+	}
+	if err != nil {
+		fmt.Printf("Error issuing invoice: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to fetch invoice")
+		return
+	}
+
+	sendJSON(w, http.StatusOK, map[string]interface{}{
+		"invoice": invoice,
+	})
+}
+
+// handleInvoiceDetail serves one invoice as JSON, or as a PDF at
+// /api/invoices/{id}/pdf
+func handleInvoiceDetail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "Only GET method is allowed")
+		return
+	}
+
+	// Extract invoice ID from URL path: /api/invoices/{id} or /api/invoices/{id}/pdf
+	path := strings.TrimPrefix(r.URL.Path, "/api/invoices/")
+	invoiceID, resource, _ := strings.Cut(strings.TrimSpace(path), "/")
+
+	if invoiceID == "" {
+		sendError(w, http.StatusBadRequest, "Invalid request", "Invoice ID is required")
+		return
+	}
+
+	auth := authFromRequest(r)
+
+	invoice, err := invoiceStore.GetInvoice(invoiceID)
+	if err != nil || !canViewInvoice(invoice, auth.UserID) {
+		sendError(w, http.StatusNotFound, "Not found", "Invoice not found")
+		return
+	}
+
+	switch resource {
+	case "":
+		sendJSON(w, http.StatusOK, map[string]interface{}{
+			"invoice": invoice,
+		})
+	case "pdf":
+		data := renderInvoicePDF(invoice)
+		filename := strings.ReplaceAll(invoice.InvoiceNumber, "/", "-") + ".pdf"
+
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "invoice-"+filename))
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.WriteHeader(http.StatusOK)
+		w.Write(data)
+	default:
+		sendError(w, http.StatusNotFound, "Not found", "Unknown invoice resource")
+	}
+}
+
+// handleTaxProfile lets organizers view and set the GST details their
+// invoices are issued under
+func handleTaxProfile(w http.ResponseWriter, r *http.Request) {
+	auth := authFromRequest(r)
+
+	switch r.Method {
+	case http.MethodGet:
+		profile, err := invoiceStore.GetTaxProfile(auth.UserID)
+		if err != nil {
+			fmt.Printf("Error fetching tax profile: %v\n", err)
+			sendError(w, http.StatusInternalServerError, "Server error", "Unable to fetch tax profile")
+			return
+		}
+		if profile == nil {
+			sendError(w, http.StatusNotFound, "Not found", "No tax profile has been set up")
+			return
+		}
+
+		sendJSON(w, http.StatusOK, map[string]interface{}{
+			"tax_profile": profile,
+		})
+	case http.MethodPut:
+		var profile TaxProfile
+		if err := json.NewDecoder(r.Body).Decode(&profile); err != nil {
+			sendError(w, http.StatusBadRequest, "Invalid request", "Invalid JSON format")
+			return
+		}
+
+		profile.OrganizerID = auth.UserID
+		if err := validateTaxProfile(&profile); err != nil {
+			sendError(w, http.StatusBadRequest, "Validation error", err.Error())
+			return
+		}
+
+		saved, err := invoiceStore.SaveTaxProfile(profile)
+		if err != nil {
+			fmt.Printf("Error saving tax profile: %v\n", err)
+			sendError(w, http.StatusInternalServerError, "Server error", "Unable to save tax profile")
+			return
+		}
+
+		sendJSON(w, http.StatusOK, map[string]interface{}{
+			"tax_profile": saved,
+			"message":     "Tax profile saved successfully",
+		})
+	default:
+		sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "Only GET and PUT methods are allowed")
+	}
+}
+
+// =====================================================
+// Supabase Invoice Functions
+// =====================================================
+
+// GetTaxProfile returns an organizer's tax profile, or nil if there is none
+func (c *SupabaseClient) GetTaxProfile(organizerID string) (*TaxProfile, error) {
+	var profiles []TaxProfile
+	path := fmt.Sprintf("/rest/v1/organizer_tax_profiles?organizer_id=eq.%s&select=*", organizerID)
+	if err := c.doREST("GET", path, "", nil, &profiles); err != nil {
+		return nil, err
+	}
+
+	if len(profiles) == 0 {
+		return nil, nil
+	}
+
+	return &profiles[0], nil
+}
+
+// SaveTaxProfile creates or replaces an organizer's tax profile
+func (c *SupabaseClient) SaveTaxProfile(profile TaxProfile) (*TaxProfile, error) {
+	payload := map[string]interface{}{
+		"legal_name": profile.LegalName,
+		"gstin":      nullIfEmpty(profile.GSTIN),
+		"state_code": profile.StateCode,
+		"address":    profile.Address,
+		"updated_at": nowTimestamp(),
+	}
+
+	var saved []TaxProfile
+	path := fmt.Sprintf("/rest/v1/organizer_tax_profiles?organizer_id=eq.%s", profile.OrganizerID)
+	if err := c.doREST("PATCH", path, "", payload, &saved); err != nil {
+		return nil, err
+	}
+
+	if len(saved) == 0 {
+		payload["organizer_id"] = profile.OrganizerID
+		if err := c.doREST("POST", "/rest/v1/organizer_tax_profiles", "", payload, &saved); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(saved) == 0 {
+		return nil, fmt.Errorf("tax profile saved but no data returned")
+	}
+
+	return &saved[0], nil
+}
+
+// CreateInvoice numbers and stores an invoice in one transaction, so
+// invoice numbers have no gaps even when orders complete concurrently.
+// An order that already has an invoice gets the existing one back.
+func (c *SupabaseClient) CreateInvoice(invoice Invoice) (*Invoice, error) {
+	var created []Invoice
+	if err := c.doREST("POST", "/rest/v1/rpc/create_invoice", "", map[string]interface{}{"p_invoice": invoice}, &created); err != nil {
+		return nil, err
+	}
+
+	if len(created) == 0 {
+		return nil, fmt.Errorf("invoice created but no data returned")
+	}
+
+	return &created[0], nil
+}
+
+// GetInvoice returns a single invoice
+func (c *SupabaseClient) GetInvoice(invoiceID string) (*Invoice, error) {
+	var invoices []Invoice
+	if err := c.doREST("GET", fmt.Sprintf("/rest/v1/invoices?id=eq.%s&select=*", invoiceID), "", nil, &invoices); err != nil {
+		return nil, err
+	}
+
+	if len(invoices) == 0 {
+		return nil, fmt.Errorf("invoice not found")
+	}
+
+	return &invoices[0], nil
+}
+
+// GetRegistrationInvoice returns the invoice for a registration, or nil if
+// it has none
+func (c *SupabaseClient) GetRegistrationInvoice(registrationID string) (*Invoice, error) {
+	var invoices []Invoice
+	path := fmt.Sprintf("/rest/v1/invoices?registration_id=eq.%s&select=*", registrationID)
+	if err := c.doREST("GET", path, "", nil, &invoices); err != nil {
+		return nil, err
+	}
+
+	if len(invoices) == 0 {
+		return nil, nil
+	}
+
+	return &invoices[0], nil
+}
+
+// GetUserInvoices returns the invoices billed to a user, newest first
+func (c *SupabaseClient) GetUserInvoices(userID string) ([]Invoice, error) {
+	var invoices []Invoice
+	path := fmt.Sprintf("/rest/v1/invoices?user_id=eq.%s&select=*&order=issued_at.desc", userID)
+	if err := c.doREST("GET", path, "", nil, &invoices); err != nil {
+		return nil, err
+	}
+
+	return invoices, nil
+}
+
+// GetOrganizerInvoices returns the invoices an organizer issued, optionally
+// for one event, in numbering order
+func (c *SupabaseClient) GetOrganizerInvoices(organizerID, eventID string) ([]Invoice, error) {
+	path := fmt.Sprintf("/rest/v1/invoices?organizer_id=eq.%s&select=*&order=financial_year.asc,sequence.asc", organizerID)
+	if eventID != "" {
+		path += "&event_id=eq." + eventID
+	}
+
+	var invoices []Invoice
+	if err := c.doREST("GET", path, "", nil, &invoices); err != nil {
+		return nil, err
+	}
+
+	return invoices, nil
+}
+
+// =====================================================
+// In-memory Invoice Functions
+// =====================================================
+
+// GetTaxProfile returns an organizer's tax profile, or nil if there is none
+func (m *MemoryStore) GetTaxProfile(organizerID string) (*TaxProfile, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	profile, exists := m.taxProfiles[organizerID]
+	if !exists {
+		return nil, nil
+	}
+
+	found := *profile
+	return &found, nil
+}
+
+// SaveTaxProfile creates or replaces an organizer's tax profile
+func (m *MemoryStore) SaveTaxProfile(profile TaxProfile) (*TaxProfile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	profile.UpdatedAt = nowTimestamp()
+	m.taxProfiles[profile.OrganizerID] = &profile
+
+	saved := profile
+	return &saved, nil
+}
+
+// CreateInvoice numbers and stores an invoice. Numbering and storing happen
+// under one lock, so numbers have no gaps. An order that already has an
+// invoice gets the existing one back.
+func (m *MemoryStore) CreateInvoice(invoice Invoice) (*Invoice, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.invoices {
+		if existing.RegistrationID == invoice.RegistrationID {
+			found := *existing
+			return &found, nil
+		}
+	}
+
+	key := invoice.OrganizerID + "|" + invoice.FinancialYear
+	m.invoiceSequences[key]++
+
+	invoice.ID = newID()
+	invoice.Sequence = m.invoiceSequences[key]
+	invoice.InvoiceNumber = formatInvoiceNumber(invoice.FinancialYear, invoice.Sequence)
+	m.invoices[invoice.ID] = &invoice
+
+	created := invoice
+	return &created, nil
+}
+
+// GetInvoice returns a single invoice
+func (m *MemoryStore) GetInvoice(invoiceID string) (*Invoice, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	invoice, exists := m.invoices[invoiceID]
+	if !exists {
+		return nil, fmt.Errorf("invoice not found")
+	}
+
+	found := *invoice
+	return &found, nil
+}
+
+// GetRegistrationInvoice returns the invoice for a registration, or nil if
+// it has none
+func (m *MemoryStore) GetRegistrationInvoice(registrationID string) (*Invoice, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, invoice := range m.invoices {
+		if invoice.RegistrationID == registrationID {
+			found := *invoice
+			return &found, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// GetUserInvoices returns the invoices billed to a user, newest first
+func (m *MemoryStore) GetUserInvoices(userID string) ([]Invoice, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	invoices := []Invoice{}
+	for _, invoice := range m.invoices {
+		if invoice.UserID == userID {
+			invoices = append(invoices, *invoice)
+		}
+	}
+
+	sort.Slice(invoices, func(i, j int) bool {
+		if invoices[i].IssuedAt != invoices[j].IssuedAt {
+			return invoices[i].IssuedAt > invoices[j].IssuedAt
+		}
+		return invoices[i].Sequence > invoices[j].Sequence
+	})
+
+	return invoices, nil
+}
+
+// GetOrganizerInvoices returns the invoices an organizer issued, optionally
+// for one event, in numbering order
+func (m *MemoryStore) GetOrganizerInvoices(organizerID, eventID string) ([]Invoice, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	invoices := []Invoice{}
+	for _, invoice := range m.invoices {
+		if invoice.OrganizerID == organizerID && (eventID == "" || invoice.EventID == eventID) {
+			invoices = append(invoices, *invoice)
+		}
+	}
+
+	sort.Slice(invoices, func(i, j int) bool {
+		if invoices[i].FinancialYear != invoices[j].FinancialYear {
+			return invoices[i].FinancialYear < invoices[j].FinancialYear
+		}
+		return invoices[i].Sequence < invoices[j].Sequence
+	})
+
+	return invoices, nil
+}
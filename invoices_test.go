@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fetchInvoice returns the invoice for a registration as seen by the
+// holder of token
+func fetchInvoice(t *testing.T, token, registrationID string) Invoice {
+	t.Helper()
+
+	rec := serveAuthenticated(handleInvoices, http.MethodGet, "/api/invoices?registration_id="+registrationID, token, nil)
+	expectStatus(t, rec, http.StatusOK)
+
+	var resp struct {
+		Invoice Invoice `json:"invoice"`
+	}
+	decodeBody(t, rec, &resp)
+	return resp.Invoice
+}
+
+func TestFinancialYear(t *testing.T) {
+	tests := []struct {
+		at     time.Time
+		wanted string
+	}{
+		{time.Date(2026, 3, 31, 18, 29, 59, 0, time.UTC), "2025-26"},
+		{time.Date(2026, 3, 31, 18, 30, 0, 0, time.UTC), "2026-27"},
+		{time.Date(2027, 1, 15, 0, 0, 0, 0, time.UTC), "2026-27"},
+		{time.Date(2099, 12, 31, 0, 0, 0, 0, time.UTC), "2099-00"},
+	}
+	for _, tt := range tests {
+		if year := financialYear(tt.at); year != tt.wanted {
+			t.Errorf("%s: expected %s, got %s", tt.at, tt.wanted, year)
+		}
+	}
+
+	if number := formatInvoiceNumber("2026-27", 42); number != "2026-27/000042" {
+		t.Fatalf("expected 2026-27/000042, got %s", number)
+	}
+}
+
+func TestSplitGST(t *testing.T) {
+	tests := []struct {
+		name                      string
+		gross                     int64
+		rate                      float64
+		interState                bool
+		taxable, cgst, sgst, igst int64
+	}{
+		{"within a state", 118000, 18, false, 100000, 9000, 9000, 0},
+		{"across states", 118000, 18, true, 100000, 0, 0, 18000},
+		{"odd paisa goes to SGST", 100, 18, false, 85, 7, 8, 0},
+		{"no GST", 49900, 0, false, 49900, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			taxable, cgst, sgst, igst := splitGST(tt.gross, tt.rate, tt.interState)
+			if taxable != tt.taxable || cgst != tt.cgst || sgst != tt.sgst || igst != tt.igst {
+				t.Fatalf("expected %d+%d+%d+%d, got %d+%d+%d+%d", tt.taxable, tt.cgst, tt.sgst, tt.igst, taxable, cgst, sgst, igst)
+			}
+			if taxable+cgst+sgst+igst != tt.gross {
+				t.Fatalf("expected the parts to add up to %d", tt.gross)
+			}
+		})
+	}
+}
+
+func TestValidateTaxDetails(t *testing.T) {
+	profiles := []struct {
+		name    string
+		profile TaxProfile
+		valid   bool
+	}{
+		{"registered", TaxProfile{LegalName: "Acme Events", GSTIN: "29abcde1234f1z5"}, true},
+		{"unregistered", TaxProfile{LegalName: "Acme Events", StateCode: "07"}, true},
+		{"no legal name", TaxProfile{GSTIN: "29ABCDE1234F1Z5"}, false},
+		{"malformed GSTIN", TaxProfile{LegalName: "Acme Events", GSTIN: "29ABCDE1234F1X5"}, false},
+		{"GSTIN from another state", TaxProfile{LegalName: "Acme Events", GSTIN: "29ABCDE1234F1Z5", StateCode: "27"}, false},
+		{"unknown state", TaxProfile{LegalName: "Acme Events", StateCode: "25"}, false},
+	}
+	for _, tt := range profiles {
+		t.Run("profile "+tt.name, func(t *testing.T) {
+			if err := validateTaxProfile(&tt.profile); (err == nil) != tt.valid {
+				t.Fatalf("expected valid=%v, got %v", tt.valid, err)
+			}
+		})
+	}
+
+	billing := BillingDetails{GSTIN: " 27abcde1234f1z5 "}
+	if err := validateBilling(&billing); err != nil || billing.GSTIN != "27ABCDE1234F1Z5" || billing.StateCode != "27" {
+		t.Fatalf("expected the GSTIN normalized and its state taken, got %+v (%v)", billing, err)
+	}
+	if err := validateBilling(&BillingDetails{StateCode: "99"}); err == nil {
+		t.Fatal("expected an unknown billing state to be refused")
+	}
+	if err := validateBilling(nil); err != nil {
+		t.Fatalf("expected no billing details to be accepted, got %v", err)
+	}
+}
+
+func TestInvoiceNumbering(t *testing.T) {
+	store := newTestStore(t)
+
+	const perOrganizer = 50
+	organizers := []string{"organizer-a", "organizer-b"}
+
+	var wg sync.WaitGroup
+	for _, organizerID := range organizers {
+		for i := 0; i < perOrganizer; i++ {
+			wg.Add(1)
+			go func(organizerID string, i int) {
+				defer wg.Done()
+
+				invoice := Invoice{OrganizerID: organizerID, FinancialYear: "2026-27", RegistrationID: fmt.Sprintf("%s-reg-%d", organizerID, i)}
+				if _, err := store.CreateInvoice(invoice); err != nil {
+					t.Error(err)
+				}
+
+				// Asking again for the same order must not use up a number
+				if _, err := store.CreateInvoice(invoice); err != nil {
+					t.Error(err)
+				}
+			}(organizerID, i)
+		}
+	}
+	wg.Wait()
+
+	for _, organizerID := range organizers {
+		invoices, _ := store.GetOrganizerInvoices(organizerID, "")
+		if len(invoices) != perOrganizer {
+			t.Fatalf("%s: expected %d invoices, got %d", organizerID, perOrganizer, len(invoices))
+		}
+		for i, invoice := range invoices {
+			if invoice.Sequence != i+1 || invoice.InvoiceNumber != formatInvoiceNumber("2026-27", i+1) {
+				t.Fatalf("%s: expected invoice %d to be numbered %d, got %s", organizerID, i, i+1, invoice.InvoiceNumber)
+			}
+		}
+	}
+
+	next, _ := store.CreateInvoice(Invoice{OrganizerID: "organizer-a", FinancialYear: "2027-28", RegistrationID: "new-year"})
+	if next.InvoiceNumber != "2027-28/000001" {
+		t.Fatalf("expected numbering to restart each financial year, got %s", next.InvoiceNumber)
+	}
+}
+
+func TestPaidOrderInvoices(t *testing.T) {
+	store := newTestStore(t)
+	organizerID, organizerToken := newTestUser(t, store, "organizer@example.com", roleOrganizer)
+	_, buyerToken := newTestUser(t, store, "buyer@example.com", roleAttendee)
+	_, otherToken := newTestUser(t, store, "other@example.com", roleAttendee)
+
+	rec := serveAuthenticated(handleTaxProfile, http.MethodPut, "/api/organizer/tax-profile", organizerToken, TaxProfile{LegalName: "Acme Events", GSTIN: "29ABCDE1234F1Z5", Address: "Bengaluru"})
+	expectStatus(t, rec, http.StatusOK)
+
+	event := newTestEvent(t, store, organizerID, CreateEventRequest{Title: "Launch", Price: 1180})
+
+	t.Run("within the seller's state", func(t *testing.T) {
+		order := buyTickets(t, buyerToken, EventRegistrationRequest{EventID: event.ID})
+		invoice := fetchInvoice(t, buyerToken, order.Registration.ID)
+
+		if invoice.DocumentType != invoiceTypeTax || invoice.PlaceOfSupply != "Karnataka" {
+			t.Fatalf("expected a Karnataka tax invoice, got %+v", invoice)
+		}
+		if invoice.TaxableValue != 1000 || invoice.CGST != 90 || invoice.SGST != 90 || invoice.IGST != 0 || invoice.Total != 1180 {
+			t.Fatalf("expected 1000 + 90 CGST + 90 SGST, got %+v", invoice)
+		}
+
+		// The organizer may see it; other buyers may not
+		if again := fetchInvoice(t, organizerToken, order.Registration.ID); again.ID != invoice.ID {
+			t.Fatalf("expected the organizer to get the same invoice, got %s", again.ID)
+		}
+		rec := serveAuthenticated(handleInvoiceDetail, http.MethodGet, "/api/invoices/"+invoice.ID, otherToken, nil)
+		expectStatus(t, rec, http.StatusNotFound)
+
+		rec = serveAuthenticated(handleInvoiceDetail, http.MethodGet, "/api/invoices/"+invoice.ID+"/pdf", buyerToken, nil)
+		expectStatus(t, rec, http.StatusOK)
+		if rec.Header().Get("Content-Type") != "application/pdf" || !bytes.HasPrefix(rec.Body.Bytes(), []byte("%PDF-")) {
+			t.Fatalf("expected a PDF, got %s", rec.Header().Get("Content-Type"))
+		}
+	})
+
+	t.Run("to a business in another state", func(t *testing.T) {
+		_, businessToken := newTestUser(t, store, "business@example.com", roleAttendee)
+		order := buyTickets(t, businessToken, EventRegistrationRequest{EventID: event.ID, Quantity: 2, Billing: &BillingDetails{Name: "Buyer Pvt Ltd", GSTIN: "27ABCDE1234F1Z5"}})
+		invoice := fetchInvoice(t, businessToken, order.Registration.ID)
+
+		if invoice.Buyer.Name != "Buyer Pvt Ltd" || invoice.Buyer.GSTIN != "27ABCDE1234F1Z5" || invoice.PlaceOfSupply != "Maharashtra" {
+			t.Fatalf("expected the business named as buyer in Maharashtra, got %+v", invoice.Buyer)
+		}
+		if invoice.TaxableValue != 2000 || invoice.IGST != 360 || invoice.CGST != 0 || invoice.SGST != 0 {
+			t.Fatalf("expected 2000 + 360 IGST, got %+v", invoice)
+		}
+		if invoice.Lines[0].Quantity != 2 || invoice.Lines[0].SAC != invoiceSAC {
+			t.Fatalf("expected one line for both seats, got %+v", invoice.Lines)
+		}
+	})
+
+	t.Run("organizer without a GSTIN", func(t *testing.T) {
+		unregisteredID, _ := newTestUser(t, store, "small@example.com", roleOrganizer)
+		small := newTestEvent(t, store, unregisteredID, CreateEventRequest{Price: 500})
+
+		order := buyTickets(t, buyerToken, EventRegistrationRequest{EventID: small.ID})
+		invoice := fetchInvoice(t, buyerToken, order.Registration.ID)
+
+		if invoice.DocumentType != invoiceTypeBillOfSupply || invoice.GSTRate != 0 {
+			t.Fatalf("expected a bill of supply, got %+v", invoice)
+		}
+		if invoice.TaxableValue != 500 || invoice.CGST+invoice.SGST+invoice.IGST != 0 {
+			t.Fatalf("expected no GST charged, got %+v", invoice)
+		}
+		if invoice.InvoiceNumber != formatInvoiceNumber(financialYear(time.Now()), 1) {
+			t.Fatalf("expected the organizer's first invoice number, got %s", invoice.InvoiceNumber)
+		}
+	})
+
+	t.Run("free orders have no invoice", func(t *testing.T) {
+		free := newTestEvent(t, store, organizerID, CreateEventRequest{})
+		order := registerForEvent(t, buyerToken, EventRegistrationRequest{EventID: free.ID})
+
+		rec := serveAuthenticated(handleInvoices, http.MethodGet, "/api/invoices?registration_id="+order.Registration.ID, buyerToken, nil)
+		expectStatus(t, rec, http.StatusNotFound)
+	})
+}
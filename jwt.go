@@ -0,0 +1,427 @@
+package main
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Token verification errors
+var (
+	errInvalidToken = errors.New("invalid token")
+	errTokenExpired = errors.New("token expired")
+	errUnknownKey   = errors.New("unknown signing key")
+)
+
+// clockSkew is the leeway allowed when checking exp, nbf and iat
+const clockSkew = 30 * time.Second
+
+// JWTKey is a signing or verification key identified by its kid header
+type JWTKey struct {
+	ID         string
+	Algorithm  string // HS256 or RS256
+	Secret     []byte
+	PrivateKey *rsa.PrivateKey
+	PublicKey  *rsa.PublicKey
+}
+
+// Claims are the JWT claims issued by the API
+type Claims struct {
+	Subject   string `json:"sub"`
+	Role      string `json:"role"`
+	Issuer    string `json:"iss"`
+	Audience  string `json:"aud"`
+	IssuedAt  int64  `json:"iat"`
+	NotBefore int64  `json:"nbf,omitempty"`
+	ExpiresAt int64  `json:"exp"`
+	ID        string `json:"jti"`
+	SessionID string `json:"sid,omitempty"`
+}
+
+type jwtHeader struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+	KeyID     string `json:"kid,omitempty"`
+}
+
+// JWTIssuer signs and verifies access tokens. Retired keys stay available
+// for verification so tokens issued before a rotation remain valid until
+// they expire.
+type JWTIssuer struct {
+	Issuer   string
+	Audience string
+	Expiry   time.Duration
+
+	mu        sync.RWMutex
+	keys      map[string]*JWTKey
+	activeKID string
+}
+
+// NewJWTIssuer creates an issuer that signs with the given key
+func NewJWTIssuer(issuer, audience string, expiry time.Duration, active *JWTKey) *JWTIssuer {
+	return &JWTIssuer{
+		Issuer:    issuer,
+		Audience:  audience,
+		Expiry:    expiry,
+		keys:      map[string]*JWTKey{active.ID: active},
+		activeKID: active.ID,
+	}
+}
+
+// AddKey registers a key that is accepted for verification only
+func (j *JWTIssuer) AddKey(key *JWTKey) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.keys[key.ID] = key
+}
+
+// Rotate makes key the signing key; the previous key keeps verifying
+func (j *JWTIssuer) Rotate(key *JWTKey) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.keys[key.ID] = key
+	j.activeKID = key.ID
+}
+
+// Issue creates a signed access token for a user
+func (j *JWTIssuer) Issue(userID, role string) (string, error) {
+	return j.IssueForSession(userID, role, "")
+}
+
+// IssueForSession issues an access token tied to a sign-in session, which
+// stops working once the session is signed out
+func (j *JWTIssuer) IssueForSession(userID, role, sessionID string) (string, error) {
+	now := time.Now()
+
+	return j.Sign(Claims{
+		Subject:   userID,
+		Role:      role,
+		Issuer:    j.Issuer,
+		Audience:  j.Audience,
+		IssuedAt:  now.Unix(),
+		NotBefore: now.Unix(),
+		ExpiresAt: now.Add(j.Expiry).Unix(),
+		ID:        newID(),
+		SessionID: sessionID,
+	})
+}
+
+// Sign encodes and signs arbitrary claims with the active key
+func (j *JWTIssuer) Sign(claims Claims) (string, error) {
+	j.mu.RLock()
+	key := j.keys[j.activeKID]
+	j.mu.RUnlock()
+
+	header, err := json.Marshal(jwtHeader{Algorithm: key.Algorithm, Type: "JWT", KeyID: key.ID})
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	signature, err := signJWT(key, signingInput)
+	if err != nil {
+		return "", err
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// Verify checks a token's signature, issuer, audience and validity window
+func (j *JWTIssuer) Verify(token string) (*Claims, error) {
+	return j.VerifyAudience(token, j.Audience)
+}
+
+// VerifyAudience checks a token issued for another audience, such as the
+// short-lived tokens of a login's two-factor step
+func (j *JWTIssuer) VerifyAudience(token, audience string) (*Claims, error) {
+	header, signingInput, signature, payload, err := splitJWT(token)
+	if err != nil {
+		return nil, err
+	}
+
+	j.mu.RLock()
+	kid := header.KeyID
+	if kid == "" {
+		kid = j.activeKID
+	}
+	key, exists := j.keys[kid]
+	j.mu.RUnlock()
+
+	if !exists {
+		return nil, errUnknownKey
+	}
+
+	// Never let the token pick the algorithm; it must match the key
+	if header.Algorithm != key.Algorithm {
+		return nil, errInvalidToken
+	}
+
+	if err := verifyJWT(key, signingInput, signature); err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, errInvalidToken
+	}
+
+	if claims.Issuer != j.Issuer || claims.Audience != audience || claims.Subject == "" {
+		return nil, errInvalidToken
+	}
+
+	if err := checkTokenTimes(claims.IssuedAt, claims.NotBefore, claims.ExpiresAt); err != nil {
+		return nil, err
+	}
+
+	return &claims, nil
+}
+
+// splitJWT decodes the three parts of a compact JWT
+func splitJWT(token string) (*jwtHeader, string, []byte, []byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, "", nil, nil, errInvalidToken
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, "", nil, nil, errInvalidToken
+	}
+
+	var header jwtHeader
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, "", nil, nil, errInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, "", nil, nil, errInvalidToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, "", nil, nil, errInvalidToken
+	}
+
+	return &header, parts[0] + "." + parts[1], signature, payload, nil
+}
+
+// checkTokenTimes validates the iat, nbf and exp claims
+func checkTokenTimes(issuedAt, notBefore, expiresAt int64) error {
+	now := time.Now()
+
+	if expiresAt == 0 || now.After(time.Unix(expiresAt, 0).Add(clockSkew)) {
+		return errTokenExpired
+	}
+	if notBefore != 0 && now.Add(clockSkew).Before(time.Unix(notBefore, 0)) {
+		return errInvalidToken
+	}
+	if issuedAt != 0 && now.Add(clockSkew).Before(time.Unix(issuedAt, 0)) {
+		return errInvalidToken
+	}
+
+	return nil
+}
+
+func signJWT(key *JWTKey, signingInput string) ([]byte, error) {
+	switch key.Algorithm {
+	case "HS256":
+		mac := hmac.New(sha256.New, key.Secret)
+		mac.Write([]byte(signingInput))
+		return mac.Sum(nil), nil
+	case "RS256":
+		if key.PrivateKey == nil {
+			return nil, fmt.Errorf("key %s has no private key", key.ID)
+		}
+		digest := sha256.Sum256([]byte(signingInput))
+		return rsa.SignPKCS1v15(rand.Reader, key.PrivateKey, crypto.SHA256, digest[:])
+	default:
+		return nil, fmt.Errorf("unsupported JWT algorithm %q", key.Algorithm)
+	}
+}
+
+func verifyJWT(key *JWTKey, signingInput string, signature []byte) error {
+	switch key.Algorithm {
+	case "HS256":
+		mac := hmac.New(sha256.New, key.Secret)
+		mac.Write([]byte(signingInput))
+		if subtle.ConstantTimeCompare(mac.Sum(nil), signature) != 1 {
+			return errInvalidToken
+		}
+		return nil
+	case "RS256":
+		publicKey := key.PublicKey
+		if publicKey == nil && key.PrivateKey != nil {
+			publicKey = &key.PrivateKey.PublicKey
+		}
+		if publicKey == nil {
+			return errUnknownKey
+		}
+		digest := sha256.Sum256([]byte(signingInput))
+		if err := rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], signature); err != nil {
+			return errInvalidToken
+		}
+		return nil
+	default:
+		return errInvalidToken
+	}
+}
+
+// =====================================================
+// Configuration
+// =====================================================
+
+// newJWTIssuerFromEnv builds the token issuer from environment variables:
+//
+//	JWT_ALGORITHM         HS256 (default) or RS256
+//	JWT_SECRET            HS256 signing secret
+//	JWT_PRIVATE_KEY_FILE  RS256 PEM private key (PKCS#1 or PKCS#8)
+//	JWT_KEY_ID            kid of the signing key (default "primary")
+//	JWT_RETIRED_KEYS      comma-separated kid=secret (HS256) or kid=public-key-path (RS256)
+//	JWT_ISSUER            iss claim (default "goticket")
+//	JWT_AUDIENCE          aud claim (default "goticket-api")
+//	JWT_EXPIRY            token lifetime as a Go duration (default 1h)
+func newJWTIssuerFromEnv() (*JWTIssuer, error) {
+	algorithm := envOrDefault("JWT_ALGORITHM", "HS256")
+	keyID := envOrDefault("JWT_KEY_ID", "primary")
+
+	expiry, err := time.ParseDuration(envOrDefault("JWT_EXPIRY", "1h"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWT_EXPIRY: %v", err)
+	}
+
+	active := &JWTKey{ID: keyID, Algorithm: algorithm}
+
+	switch algorithm {
+	case "HS256":
+		secret := os.Getenv("JWT_SECRET")
+		if secret == "" {
+			// Tokens signed with a random secret do not survive a restart
+			fmt.Println("Warning: JWT_SECRET is not set, using a random secret for this process")
+			secret = newToken()
+		}
+		active.Secret = []byte(secret)
+	case "RS256":
+		privateKey, err := loadRSAPrivateKey(os.Getenv("JWT_PRIVATE_KEY_FILE"))
+		if err != nil {
+			return nil, err
+		}
+		active.PrivateKey = privateKey
+	default:
+		return nil, fmt.Errorf("unsupported JWT_ALGORITHM %q (expected HS256 or RS256)", algorithm)
+	}
+
+	issuer := NewJWTIssuer(envOrDefault("JWT_ISSUER", "goticket"), envOrDefault("JWT_AUDIENCE", "goticket-api"), expiry, active)
+
+	for _, entry := range strings.Split(os.Getenv("JWT_RETIRED_KEYS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		kid, value, found := strings.Cut(entry, "=")
+		if !found || kid == "" || value == "" {
+			return nil, fmt.Errorf("invalid JWT_RETIRED_KEYS entry %q (expected kid=value)", entry)
+		}
+
+		retired := &JWTKey{ID: kid, Algorithm: algorithm}
+		if algorithm == "HS256" {
+			retired.Secret = []byte(value)
+		} else {
+			publicKey, err := loadRSAPublicKey(value)
+			if err != nil {
+				return nil, err
+			}
+			retired.PublicKey = publicKey
+		}
+		issuer.AddKey(retired)
+	}
+
+	return issuer, nil
+}
+
+func envOrDefault(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func loadRSAPrivateKey(path string) (*rsa.PrivateKey, error) {
+	if path == "" {
+		return nil, fmt.Errorf("JWT_PRIVATE_KEY_FILE must be set for RS256")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", path)
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key in %s: %v", path, err)
+	}
+
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key in %s is not an RSA key", path)
+	}
+	return key, nil
+}
+
+func loadRSAPublicKey(path string) (*rsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", path)
+	}
+
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key in %s: %v", path, err)
+	}
+
+	key, ok := parsed.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key in %s is not an RSA key", path)
+	}
+	return key, nil
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestRSAKey(t *testing.T, kid string) *JWTKey {
+	t.Helper()
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &JWTKey{ID: kid, Algorithm: "RS256", PrivateKey: privateKey, PublicKey: &privateKey.PublicKey}
+}
+
+// forgeJWT builds a token with any header and claims, signed with an
+// HMAC secret (or unsigned when secret is nil)
+func forgeJWT(t *testing.T, header jwtHeader, claims Claims, secret []byte) string {
+	t.Helper()
+
+	headerJSON, _ := json.Marshal(header)
+	payloadJSON, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(payloadJSON)
+
+	var signature []byte
+	if secret != nil {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(signingInput))
+		signature = mac.Sum(nil)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func validClaims(issuer *JWTIssuer) Claims {
+	now := time.Now()
+	return Claims{
+		Subject:   "user-1",
+		Role:      "organizer",
+		Issuer:    issuer.Issuer,
+		Audience:  issuer.Audience,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(time.Hour).Unix(),
+		ID:        "jti-1",
+	}
+}
+
+func TestJWTSignAndVerify(t *testing.T) {
+	keys := map[string]*JWTKey{
+		"HS256": {ID: "hs", Algorithm: "HS256", Secret: []byte("test-secret")},
+		"RS256": newTestRSAKey(t, "rs"),
+	}
+
+	for algorithm, key := range keys {
+		t.Run(algorithm, func(t *testing.T) {
+			issuer := NewJWTIssuer("goticket", "goticket-api", time.Hour, key)
+
+			token, err := issuer.IssueForSession("user-1", "organizer", "session-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			claims, err := issuer.Verify(token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.Subject != "user-1" || claims.Role != "organizer" || claims.SessionID != "session-1" {
+				t.Fatalf("unexpected claims %+v", claims)
+			}
+			if claims.ExpiresAt-claims.IssuedAt != int64(time.Hour.Seconds()) {
+				t.Errorf("expected a one hour lifetime, got %ds", claims.ExpiresAt-claims.IssuedAt)
+			}
+
+			// Any change to the payload breaks the signature
+			parts := strings.Split(token, ".")
+			tampered := validClaims(issuer)
+			tampered.Role = "admin"
+			payload, _ := json.Marshal(tampered)
+			parts[1] = base64.RawURLEncoding.EncodeToString(payload)
+			if _, err := issuer.Verify(strings.Join(parts, ".")); err == nil {
+				t.Fatal("expected a tampered payload to be rejected")
+			}
+		})
+	}
+}
+
+func TestJWTKeyRotation(t *testing.T) {
+	oldKey := &JWTKey{ID: "2024-01", Algorithm: "HS256", Secret: []byte("old-secret")}
+	newKey := &JWTKey{ID: "2024-02", Algorithm: "HS256", Secret: []byte("new-secret")}
+
+	issuer := NewJWTIssuer("goticket", "goticket-api", time.Hour, oldKey)
+	oldToken, err := issuer.Issue("user-1", "attendee")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issuer.Rotate(newKey)
+	newToken, err := issuer.Issue("user-1", "attendee")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header, _, _, _, _ := splitJWT(newToken)
+	if header.KeyID != "2024-02" {
+		t.Fatalf("expected new tokens to be signed with kid 2024-02, got %q", header.KeyID)
+	}
+	if _, err := issuer.Verify(oldToken); err != nil {
+		t.Fatalf("expected tokens signed before the rotation to verify: %v", err)
+	}
+
+	// After a restart the old key is only known if it was kept as retired
+	restarted := NewJWTIssuer("goticket", "goticket-api", time.Hour, newKey)
+	if _, err := restarted.Verify(oldToken); !errors.Is(err, errUnknownKey) {
+		t.Fatalf("expected errUnknownKey for a dropped key, got %v", err)
+	}
+	restarted.AddKey(oldKey)
+	if _, err := restarted.Verify(oldToken); err != nil {
+		t.Fatalf("expected a retired key to verify old tokens: %v", err)
+	}
+	if _, err := restarted.Verify(newToken); err != nil {
+		t.Fatalf("expected the active key to verify new tokens: %v", err)
+	}
+}
+
+func TestJWTRejectsAlgorithmConfusion(t *testing.T) {
+	key := newTestRSAKey(t, "rs")
+	issuer := NewJWTIssuer("goticket", "goticket-api", time.Hour, key)
+	claims := validClaims(issuer)
+	claims.Role = "admin"
+
+	// HS256 signed with the RSA public key, which is not secret
+	publicKey := x509.MarshalPKCS1PublicKey(key.PublicKey)
+	forged := forgeJWT(t, jwtHeader{Algorithm: "HS256", Type: "JWT", KeyID: "rs"}, claims, publicKey)
+	if _, err := issuer.Verify(forged); err == nil {
+		t.Fatal("expected an HS256 token for an RS256 key to be rejected")
+	}
+
+	unsigned := forgeJWT(t, jwtHeader{Algorithm: "none", Type: "JWT", KeyID: "rs"}, claims, nil)
+	if _, err := issuer.Verify(unsigned); err == nil {
+		t.Fatal("expected an unsigned token to be rejected")
+	}
+
+	hsIssuer := NewJWTIssuer("goticket", "goticket-api", time.Hour, &JWTKey{ID: "hs", Algorithm: "HS256", Secret: []byte("secret")})
+	unsigned = forgeJWT(t, jwtHeader{Algorithm: "none", Type: "JWT"}, validClaims(hsIssuer), nil)
+	if _, err := hsIssuer.Verify(unsigned); err == nil {
+		t.Fatal("expected alg none to be rejected for an HS256 key")
+	}
+}
+
+func TestJWTRejectsWrongClaims(t *testing.T) {
+	secret := []byte("shared-secret")
+	key := &JWTKey{ID: "primary", Algorithm: "HS256", Secret: secret}
+	issuer := NewJWTIssuer("goticket", "goticket-api", time.Hour, key)
+	header := jwtHeader{Algorithm: "HS256", Type: "JWT", KeyID: "primary"}
+
+	tests := []struct {
+		name   string
+		modify func(*Claims)
+		want   error
+	}{
+		{"wrong issuer", func(c *Claims) { c.Issuer = "someone-else" }, errInvalidToken},
+		{"wrong audience", func(c *Claims) { c.Audience = "another-api" }, errInvalidToken},
+		{"no subject", func(c *Claims) { c.Subject = "" }, errInvalidToken},
+		{"expired", func(c *Claims) { c.ExpiresAt = time.Now().Add(-time.Minute).Unix() }, errTokenExpired},
+		{"no expiry", func(c *Claims) { c.ExpiresAt = 0 }, errTokenExpired},
+		{"not yet valid", func(c *Claims) { c.NotBefore = time.Now().Add(time.Minute).Unix() }, errInvalidToken},
+		{"issued in the future", func(c *Claims) { c.IssuedAt = time.Now().Add(time.Minute).Unix() }, errInvalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := validClaims(issuer)
+			tt.modify(&claims)
+
+			_, err := issuer.Verify(forgeJWT(t, header, claims, secret))
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+
+	t.Run("within clock skew", func(t *testing.T) {
+		claims := validClaims(issuer)
+		claims.ExpiresAt = time.Now().Add(-clockSkew / 2).Unix()
+		if _, err := issuer.Verify(forgeJWT(t, header, claims, secret)); err != nil {
+			t.Fatalf("expected a token expired within the clock skew to verify: %v", err)
+		}
+	})
+
+	t.Run("other audience", func(t *testing.T) {
+		claims := validClaims(issuer)
+		claims.Audience = "goticket-api:2fa"
+		token := forgeJWT(t, header, claims, secret)
+		if _, err := issuer.Verify(token); err == nil {
+			t.Fatal("expected a token for another audience to be rejected as an access token")
+		}
+		if _, err := issuer.VerifyAudience(token, "goticket-api:2fa"); err != nil {
+			t.Fatalf("expected the token to verify for its own audience: %v", err)
+		}
+	})
+}
+
+func TestNewJWTIssuerFromEnv(t *testing.T) {
+	t.Setenv("JWT_ALGORITHM", "HS256")
+	t.Setenv("JWT_SECRET", "current")
+	t.Setenv("JWT_KEY_ID", "2024-02")
+	t.Setenv("JWT_RETIRED_KEYS", "2024-01=previous")
+
+	issuer, err := newJWTIssuerFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previous := NewJWTIssuer(issuer.Issuer, issuer.Audience, time.Hour, &JWTKey{ID: "2024-01", Algorithm: "HS256", Secret: []byte("previous")})
+	token, _ := previous.Issue("user-1", "attendee")
+	if _, err := issuer.Verify(token); err != nil {
+		t.Fatalf("expected JWT_RETIRED_KEYS to verify old tokens: %v", err)
+	}
+
+	t.Setenv("JWT_RETIRED_KEYS", "missing-secret")
+	if _, err := newJWTIssuerFromEnv(); err == nil {
+		t.Fatal("expected a malformed JWT_RETIRED_KEYS entry to be rejected")
+	}
+
+	t.Setenv("JWT_RETIRED_KEYS", "")
+	t.Setenv("JWT_ALGORITHM", "none")
+	if _, err := newJWTIssuerFromEnv(); err == nil {
+		t.Fatal("expected an unsupported JWT_ALGORITHM to be rejected")
+	}
+}
@@ -0,0 +1,848 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Ledger settings
+const (
+	defaultPlatformFeePercent = 5.0
+	defaultSettlementDelay    = 7 * 24 * time.Hour
+	defaultPayoutMinimum      = 100.0
+	settlementInterval        = time.Hour
+
+	defaultLedgerPageSize = 50
+	maxLedgerPageSize     = 200
+)
+
+// Ledger accounts. Cash is the money the platform holds for buyers'
+// payments, organizer_payable what it owes organizers, and platform_revenue
+// the fees it keeps. Every transaction debits and credits them equally.
+const (
+	ledgerCash             = "cash"
+	ledgerOrganizerPayable = "organizer_payable"
+	ledgerPlatformRevenue  = "platform_revenue"
+)
+
+// Ledger entry kinds
+const (
+	ledgerSale        = "sale"
+	ledgerPlatformFee = "platform_fee"
+	ledgerRefund      = "refund"
+	ledgerPayout      = "payout"
+)
+
+// Ledger configuration, set from the environment in setup
+var (
+	platformFeePercent = defaultPlatformFeePercent
+	settlementDelay    = defaultSettlementDelay
+	payoutMinimum      = defaultPayoutMinimum
+)
+
+// LedgerEntry is one side of a ledger transaction: a debit or a credit to
+// one account, on behalf of one organizer
+type LedgerEntry struct {
+	ID            string  `json:"id"`
+	TransactionID string  `json:"transaction_id"`
+	ReferenceID   string  `json:"reference_id"`
+	OrganizerID   string  `json:"organizer_id"`
+	EventID       string  `json:"event_id,omitempty"`
+	Account       string  `json:"account"`
+	Kind          string  `json:"kind"`
+	Debit         float64 `json:"debit"`
+	Credit        float64 `json:"credit"`
+	Description   string  `json:"description"`
+	CreatedAt     string  `json:"created_at"`
+}
+
+// LedgerTransaction is a balanced set of entries posted together.
+// ReferenceID names what caused it, so the same sale, refund or payout is
+// never posted twice.
+type LedgerTransaction struct {
+	ReferenceID string
+	OrganizerID string
+	EventID     string
+	Entries     []LedgerEntry
+}
+
+// LedgerFilter selects an organizer's ledger entries, newest first
+type LedgerFilter struct {
+	OrganizerID string
+	EventID     string
+	Account     string
+	From        string
+	To          string
+	Limit       int
+	Offset      int
+}
+
+// LedgerBalance summarizes what the platform owes an organizer. Available
+// is the part old enough to be settled into the next payout.
+type LedgerBalance struct {
+	OrganizerID  string  `json:"organizer_id"`
+	Sales        float64 `json:"sales"`
+	PlatformFees float64 `json:"platform_fees"`
+	Refunds      float64 `json:"refunds"`
+	PaidOut      float64 `json:"paid_out"`
+	Balance      float64 `json:"balance"`
+	Available    float64 `json:"available"`
+	Pending      float64 `json:"pending"`
+	Currency     string  `json:"currency"`
+}
+
+// Payout is a settlement of an organizer's available balance, recorded for
+// the finance team to transfer
+type Payout struct {
+	ID          string  `json:"id"`
+	OrganizerID string  `json:"organizer_id"`
+	Amount      float64 `json:"amount"`
+	Currency    string  `json:"currency"`
+	Status      string  `json:"status"`
+	SettledUpTo string  `json:"settled_up_to"`
+	CreatedAt   string  `json:"created_at"`
+}
+
+// errUnbalancedTransaction is returned for transactions whose debits and
+// credits differ
+var errUnbalancedTransaction = errors.New("ledger transaction is not balanced")
+
+// platformFeeFromEnv reads PLATFORM_FEE_PERCENT (default 5)
+func platformFeeFromEnv() (float64, error) {
+	value := os.Getenv("PLATFORM_FEE_PERCENT")
+	if value == "" {
+		return defaultPlatformFeePercent, nil
+	}
+
+	percent, err := strconv.ParseFloat(value, 64)
+	if err != nil || percent < 0 || percent > 100 {
+		return 0, fmt.Errorf("invalid PLATFORM_FEE_PERCENT: must be a percentage between 0 and 100")
+	}
+
+	return percent, nil
+}
+
+// settlementFromEnv reads SETTLEMENT_DELAY, how old ledger entries must be
+// before they are paid out (Go duration, default 168h), and PAYOUT_MINIMUM,
+// the smallest payout in rupees (default 100)
+func settlementFromEnv() (time.Duration, float64, error) {
+	delay := defaultSettlementDelay
+	if value := os.Getenv("SETTLEMENT_DELAY"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid SETTLEMENT_DELAY: %v", err)
+		}
+		if parsed < 0 {
+			return 0, 0, fmt.Errorf("invalid SETTLEMENT_DELAY: cannot be negative")
+		}
+		delay = parsed
+	}
+
+	minimum := defaultPayoutMinimum
+	if value := os.Getenv("PAYOUT_MINIMUM"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed < 0 {
+			return 0, 0, fmt.Errorf("invalid PAYOUT_MINIMUM: must be a non-negative amount")
+		}
+		minimum = parsed
+	}
+
+	return delay, minimum, nil
+}
+
+// ledgerEntry builds one side of a transaction. Positive amounts are
+// debits and negative amounts credits.
+func ledgerEntry(account, kind string, amount int64, description string) LedgerEntry {
+	entry := LedgerEntry{Account: account, Kind: kind, Description: description}
+	if amount >= 0 {
+		entry.Debit = fromMinorUnits(amount)
+	} else {
+		entry.Credit = fromMinorUnits(-amount)
+	}
+	return entry
+}
+
+// validateLedgerTransaction checks that a transaction's debits equal its credits
+func validateLedgerTransaction(tx LedgerTransaction) error {
+	if len(tx.Entries) < 2 {
+		return errUnbalancedTransaction
+	}
+
+	var debits, credits int64
+	for _, entry := range tx.Entries {
+		debits += toMinorUnits(entry.Debit)
+		credits += toMinorUnits(entry.Credit)
+	}
+	if debits != credits {
+		return errUnbalancedTransaction
+	}
+	return nil
+}
+
+// platformFee is the platform's cut of amount minor units
+func platformFee(amount int64) int64 {
+	return toMinorUnits(fromMinorUnits(amount) * platformFeePercent / 100)
+}
+
+// postLedger posts a transaction. The money has already moved by the time
+// a sale or refund is recorded, so a posting that fails is queued and
+// retried before the next settlement; the reference ID keeps a retry from
+// posting twice. An error means it was neither posted nor queued.
+func postLedger(tx LedgerTransaction) error {
+	if err := validateLedgerTransaction(tx); err != nil {
+		return err
+	}
+
+	// Zero amounts, such as the fee when there is none, need no entry
+	entries := tx.Entries[:0]
+	for _, entry := range tx.Entries {
+		if entry.Debit == 0 && entry.Credit == 0 {
+			continue
+		}
+		entry.ReferenceID = tx.ReferenceID
+		entry.OrganizerID = tx.OrganizerID
+		entry.EventID = tx.EventID
+		entries = append(entries, entry)
+	}
+	tx.Entries = entries
+
+	_, err := ledgerStore.PostLedgerTransaction(tx)
+	if err == nil {
+		return nil
+	}
+
+	fmt.Printf("Error posting ledger transaction %s, queueing it for retry: %v\n", tx.ReferenceID, err)
+	if queueErr := ledgerStore.QueueLedgerTransaction(tx); queueErr != nil {
+		return fmt.Errorf("posting ledger transaction %s: %v (queueing it failed: %v)", tx.ReferenceID, err, queueErr)
+	}
+	return nil
+}
+
+// retryQueuedLedger posts the transactions queued by failed postings and
+// returns how many are still waiting
+func retryQueuedLedger() (int, error) {
+	queued, err := ledgerStore.GetQueuedLedgerTransactions()
+	if err != nil {
+		return 0, err
+	}
+
+	waiting := 0
+	for _, tx := range queued {
+		if _, err := ledgerStore.PostLedgerTransaction(tx); err != nil {
+			fmt.Printf("Error retrying ledger transaction %s: %v\n", tx.ReferenceID, err)
+			waiting++
+			continue
+		}
+		if err := ledgerStore.DequeueLedgerTransaction(tx.ReferenceID); err != nil {
+			// Posting it again later is a no-op
+			fmt.Printf("Error dequeueing ledger transaction %s: %v\n", tx.ReferenceID, err)
+		}
+	}
+
+	return waiting, nil
+}
+
+// recordSale credits the organizer with a captured payment and charges the
+// platform fee on it
+func recordSale(payment *Payment) error {
+	event, err := eventStore.GetEventByID(payment.EventID)
+	if err != nil {
+		return err
+	}
+
+	amount := toMinorUnits(payment.Amount)
+	fee := platformFee(amount)
+	description := "Ticket sale: " + event.Title
+
+	return postLedger(LedgerTransaction{
+		ReferenceID: "sale:" + payment.ID,
+		OrganizerID: event.OrganizerID,
+		EventID:     event.ID,
+		Entries: []LedgerEntry{
+			ledgerEntry(ledgerCash, ledgerSale, amount, description),
+			ledgerEntry(ledgerOrganizerPayable, ledgerSale, -amount, description),
+			ledgerEntry(ledgerOrganizerPayable, ledgerPlatformFee, fee, fmt.Sprintf("Platform fee (%g%%)", platformFeePercent)),
+			ledgerEntry(ledgerPlatformRevenue, ledgerPlatformFee, -fee, fmt.Sprintf("Platform fee (%g%%)", platformFeePercent)),
+		},
+	})
+}
+
+// recordRefund takes a refund back from the organizer and returns the
+// matching share of the platform fee
+func recordRefund(payment *Payment, refundID string, amount int64) error {
+	event, err := eventStore.GetEventByID(payment.EventID)
+	if err != nil {
+		return err
+	}
+
+	fee := platformFee(amount)
+	description := "Refund: " + event.Title
+
+	return postLedger(LedgerTransaction{
+		ReferenceID: "refund:" + refundID,
+		OrganizerID: event.OrganizerID,
+		EventID:     event.ID,
+		Entries: []LedgerEntry{
+			ledgerEntry(ledgerOrganizerPayable, ledgerRefund, amount, description),
+			ledgerEntry(ledgerCash, ledgerRefund, -amount, description),
+			ledgerEntry(ledgerPlatformRevenue, ledgerPlatformFee, fee, "Platform fee returned on refund"),
+			ledgerEntry(ledgerOrganizerPayable, ledgerPlatformFee, -fee, "Platform fee returned on refund"),
+		},
+	})
+}
+
+// runSettlement batches available balances into payouts on an interval
+func runSettlement(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		settleBalances(time.Now())
+	}
+}
+
+// settleBalances pays out every organizer's balance from entries older than
+// the settlement delay, when it reaches the payout minimum. Settlement waits
+// while failed postings are queued, since a missing refund would overpay.
+func settleBalances(now time.Time) []Payout {
+	waiting, err := retryQueuedLedger()
+	if err != nil {
+		fmt.Printf("Error retrying queued ledger transactions: %v\n", err)
+		return nil
+	}
+	if waiting > 0 {
+		fmt.Printf("Settlement postponed: %d ledger transactions are still queued\n", waiting)
+		return nil
+	}
+
+	cutoff := now.Add(-settlementDelay).UTC().Format(time.RFC3339)
+
+	payouts, err := ledgerStore.SettleBalances(cutoff, payoutMinimum)
+	if err != nil {
+		fmt.Printf("Error settling organizer balances: %v\n", err)
+		return nil
+	}
+
+	for _, payout := range payouts {
+		fmt.Printf("Payout %s of %.2f %s created for organizer %s\n", payout.ID, payout.Amount, payout.Currency, payout.OrganizerID)
+	}
+
+	return payouts
+}
+
+// payoutTransaction moves a payout's amount out of the organizer's balance
+func payoutTransaction(payout Payout) LedgerTransaction {
+	amount := toMinorUnits(payout.Amount)
+	description := "Payout " + payout.ID
+
+	return LedgerTransaction{
+		ReferenceID: "payout:" + payout.ID,
+		OrganizerID: payout.OrganizerID,
+		Entries: []LedgerEntry{
+			ledgerEntry(ledgerOrganizerPayable, ledgerPayout, amount, description),
+			ledgerEntry(ledgerCash, ledgerPayout, -amount, description),
+		},
+	}
+}
+
+// parseLedgerTime reads a from/to filter given as RFC 3339 or a date. Dates
+// cover the whole day, in IST.
+func parseLedgerTime(value string, endOfDay bool) (string, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC().Format(time.RFC3339), nil
+	}
+
+	day, err := time.ParseInLocation("2006-01-02", value, istZone)
+	if err != nil {
+		return "", fmt.Errorf("dates must be YYYY-MM-DD or RFC 3339")
+	}
+	if endOfDay {
+		day = day.Add(24*time.Hour - time.Second)
+	}
+	return day.UTC().Format(time.RFC3339), nil
+}
+
+// =====================================================
+// Ledger Handlers
+// =====================================================
+
+// handleOrganizerBalance shows what the platform owes the organizer
+func handleOrganizerBalance(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "Only GET method is allowed")
+		return
+	}
+
+	auth := authFromRequest(r)
+	cutoff := time.Now().Add(-settlementDelay).UTC().Format(time.RFC3339)
+
+	balance, err := ledgerStore.GetLedgerBalance(auth.UserID, cutoff)
+	if err != nil {
+		fmt.Printf("Error fetching balance: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to fetch balance")
+		return
+	}
+
+	sendJSON(w, http.StatusOK, map[string]interface{}{
+		"balance":          balance,
+		"platform_fee":     platformFeePercent,
+		"settlement_delay": settlementDelay.String(),
+		"payout_minimum":   payoutMinimum,
+	})
+}
+
+// handleOrganizerLedger lists the entries on the organizer's account,
+// newest first. It takes event_id, from and to filters and limit/offset
+// pagination; account=all includes the platform's side of each transaction.
+func handleOrganizerLedger(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "Only GET method is allowed")
+		return
+	}
+
+	auth := authFromRequest(r)
+	query := r.URL.Query()
+
+	filter := LedgerFilter{
+		OrganizerID: auth.UserID,
+		EventID:     query.Get("event_id"),
+		Account:     ledgerOrganizerPayable,
+		Limit:       defaultLedgerPageSize,
+	}
+	if query.Get("account") == "all" {
+		filter.Account = ""
+	}
+
+	var err error
+	if value := query.Get("from"); value != "" {
+		if filter.From, err = parseLedgerTime(value, false); err != nil {
+			sendError(w, http.StatusBadRequest, "Validation error", err.Error())
+			return
+		}
+	}
+	if value := query.Get("to"); value != "" {
+		if filter.To, err = parseLedgerTime(value, true); err != nil {
+			sendError(w, http.StatusBadRequest, "Validation error", err.Error())
+			return
+		}
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxLedgerPageSize {
+			sendError(w, http.StatusBadRequest, "Validation error", fmt.Sprintf("limit must be between 1 and %d", maxLedgerPageSize))
+			return
+		}
+		filter.Limit = limit
+	}
+	if value := query.Get("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			sendError(w, http.StatusBadRequest, "Validation error", "offset must be a non-negative number")
+			return
+		}
+		filter.Offset = offset
+	}
+
+	// Fetch one extra entry to learn whether another page follows
+	pageSize := filter.Limit
+	filter.Limit++
+	entries, err := ledgerStore.GetLedgerEntries(filter)
+	if err != nil {
+		fmt.Printf("Error fetching ledger: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to fetch ledger")
+		return
+	}
+
+	hasMore := len(entries) > pageSize
+	if hasMore {
+		entries = entries[:pageSize]
+	}
+
+	response := map[string]interface{}{
+		"entries":  entries,
+		"count":    len(entries),
+		"limit":    pageSize,
+		"offset":   filter.Offset,
+		"has_more": hasMore,
+	}
+	if hasMore {
+		response["next_offset"] = filter.Offset + pageSize
+	}
+
+	sendJSON(w, http.StatusOK, response)
+}
+
+// handleOrganizerPayouts lists the organizer's payouts, newest first
+func handleOrganizerPayouts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "Only GET method is allowed")
+		return
+	}
+
+	auth := authFromRequest(r)
+
+	payouts, err := ledgerStore.GetPayouts(auth.UserID)
+	if err != nil {
+		fmt.Printf("Error fetching payouts: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to fetch payouts")
+		return
+	}
+
+	sendJSON(w, http.StatusOK, map[string]interface{}{
+		"payouts": payouts,
+		"count":   len(payouts),
+	})
+}
+
+// =====================================================
+// Supabase Ledger Functions
+// =====================================================
+
+// PostLedgerTransaction stores a balanced transaction's entries atomically.
+// It returns false without posting if the reference was already posted.
+func (c *SupabaseClient) PostLedgerTransaction(tx LedgerTransaction) (bool, error) {
+	var posted bool
+	payload := map[string]interface{}{
+		"p_reference_id": tx.ReferenceID,
+		"p_organizer_id": tx.OrganizerID,
+		"p_entries":      tx.Entries,
+	}
+	if err := c.doREST("POST", "/rest/v1/rpc/post_ledger_transaction", "", payload, &posted); err != nil {
+		return false, err
+	}
+
+	return posted, nil
+}
+
+// queuedLedgerRow is a ledger_queue row
+type queuedLedgerRow struct {
+	ReferenceID string        `json:"reference_id"`
+	OrganizerID string        `json:"organizer_id"`
+	EventID     string        `json:"event_id"`
+	Entries     []LedgerEntry `json:"entries"`
+}
+
+// QueueLedgerTransaction keeps a transaction that failed to post for retry.
+// Queueing the same reference again is a no-op.
+func (c *SupabaseClient) QueueLedgerTransaction(tx LedgerTransaction) error {
+	payload := map[string]interface{}{
+		"p_reference_id": tx.ReferenceID,
+		"p_organizer_id": tx.OrganizerID,
+		"p_event_id":     nullIfEmpty(tx.EventID),
+		"p_entries":      tx.Entries,
+	}
+
+	return c.doREST("POST", "/rest/v1/rpc/queue_ledger_transaction", "", payload, nil)
+}
+
+// GetQueuedLedgerTransactions returns the queued transactions, oldest first
+func (c *SupabaseClient) GetQueuedLedgerTransactions() ([]LedgerTransaction, error) {
+	var rows []queuedLedgerRow
+	if err := c.doREST("GET", "/rest/v1/ledger_queue?select=*&order=created_at.asc", "", nil, &rows); err != nil {
+		return nil, err
+	}
+
+	queued := make([]LedgerTransaction, 0, len(rows))
+	for _, row := range rows {
+		queued = append(queued, LedgerTransaction{
+			ReferenceID: row.ReferenceID,
+			OrganizerID: row.OrganizerID,
+			EventID:     row.EventID,
+			Entries:     row.Entries,
+		})
+	}
+
+	return queued, nil
+}
+
+// DequeueLedgerTransaction drops a queued transaction once it has posted
+func (c *SupabaseClient) DequeueLedgerTransaction(referenceID string) error {
+	return c.doREST("DELETE", "/rest/v1/ledger_queue?reference_id=eq."+url.QueryEscape(referenceID), "", nil, nil)
+}
+
+// GetLedgerEntries returns the entries matching a filter, newest first
+func (c *SupabaseClient) GetLedgerEntries(filter LedgerFilter) ([]LedgerEntry, error) {
+	path := fmt.Sprintf("/rest/v1/ledger_entries?organizer_id=eq.%s&select=*&order=created_at.desc,id.desc&limit=%d&offset=%d",
+		filter.OrganizerID, filter.Limit, filter.Offset)
+	if filter.EventID != "" {
+		path += "&event_id=eq." + filter.EventID
+	}
+	if filter.Account != "" {
+		path += "&account=eq." + filter.Account
+	}
+	if filter.From != "" {
+		path += "&created_at=gte." + filter.From
+	}
+	if filter.To != "" {
+		path += "&created_at=lte." + filter.To
+	}
+
+	var entries []LedgerEntry
+	if err := c.doREST("GET", path, "", nil, &entries); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// GetLedgerBalance totals an organizer's account. Entries up to cutoff
+// count towards the available balance.
+func (c *SupabaseClient) GetLedgerBalance(organizerID, cutoff string) (*LedgerBalance, error) {
+	var balances []LedgerBalance
+	payload := map[string]interface{}{
+		"p_organizer_id": organizerID,
+		"p_cutoff":       cutoff,
+	}
+	if err := c.doREST("POST", "/rest/v1/rpc/organizer_ledger_balance", "", payload, &balances); err != nil {
+		return nil, err
+	}
+
+	if len(balances) == 0 {
+		return &LedgerBalance{OrganizerID: organizerID, Currency: paymentCurrency}, nil
+	}
+
+	balances[0].Currency = paymentCurrency
+	return &balances[0], nil
+}
+
+// SettleBalances creates a payout for every organizer whose available
+// balance at cutoff reaches minimum, posting it to the ledger in the same
+// transaction
+func (c *SupabaseClient) SettleBalances(cutoff string, minimum float64) ([]Payout, error) {
+	var payouts []Payout
+	payload := map[string]interface{}{
+		"p_cutoff":  cutoff,
+		"p_minimum": minimum,
+	}
+	if err := c.doREST("POST", "/rest/v1/rpc/settle_organizer_balances", "", payload, &payouts); err != nil {
+		return nil, err
+	}
+
+	return payouts, nil
+}
+
+// GetPayouts returns an organizer's payouts, newest first
+func (c *SupabaseClient) GetPayouts(organizerID string) ([]Payout, error) {
+	var payouts []Payout
+	path := fmt.Sprintf("/rest/v1/payouts?organizer_id=eq.%s&select=*&order=created_at.desc", organizerID)
+	if err := c.doREST("GET", path, "", nil, &payouts); err != nil {
+		return nil, err
+	}
+
+	return payouts, nil
+}
+
+// =====================================================
+// In-memory Ledger Functions
+// =====================================================
+
+// PostLedgerTransaction stores a balanced transaction's entries atomically.
+// It returns false without posting if the reference was already posted.
+func (m *MemoryStore) PostLedgerTransaction(tx LedgerTransaction) (bool, error) {
+	if err := validateLedgerTransaction(tx); err != nil {
+		return false, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.postLedgerLocked(tx), nil
+}
+
+// postLedgerLocked appends a transaction's entries. Callers must hold m.mu.
+func (m *MemoryStore) postLedgerLocked(tx LedgerTransaction) bool {
+	if m.ledgerReferences[tx.ReferenceID] {
+		return false
+	}
+	m.ledgerReferences[tx.ReferenceID] = true
+
+	transactionID := newID()
+	createdAt := nowTimestamp()
+	for _, entry := range tx.Entries {
+		entry.ID = newID()
+		entry.TransactionID = transactionID
+		entry.ReferenceID = tx.ReferenceID
+		entry.OrganizerID = tx.OrganizerID
+		entry.EventID = tx.EventID
+		entry.CreatedAt = createdAt
+		m.ledger = append(m.ledger, &entry)
+	}
+
+	return true
+}
+
+// QueueLedgerTransaction keeps a transaction that failed to post for retry.
+// Queueing the same reference again is a no-op.
+func (m *MemoryStore) QueueLedgerTransaction(tx LedgerTransaction) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, queued := range m.ledgerQueue {
+		if queued.ReferenceID == tx.ReferenceID {
+			return nil
+		}
+	}
+
+	tx.Entries = append([]LedgerEntry(nil), tx.Entries...)
+	m.ledgerQueue = append(m.ledgerQueue, tx)
+	return nil
+}
+
+// GetQueuedLedgerTransactions returns the queued transactions, oldest first
+func (m *MemoryStore) GetQueuedLedgerTransactions() ([]LedgerTransaction, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return append([]LedgerTransaction{}, m.ledgerQueue...), nil
+}
+
+// DequeueLedgerTransaction drops a queued transaction once it has posted
+func (m *MemoryStore) DequeueLedgerTransaction(referenceID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, queued := range m.ledgerQueue {
+		if queued.ReferenceID == referenceID {
+			m.ledgerQueue = append(m.ledgerQueue[:i], m.ledgerQueue[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// GetLedgerEntries returns the entries matching a filter, newest first
+func (m *MemoryStore) GetLedgerEntries(filter LedgerFilter) ([]LedgerEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entries := []LedgerEntry{}
+	skipped := 0
+	for i := len(m.ledger) - 1; i >= 0 && len(entries) < filter.Limit; i-- {
+		entry := m.ledger[i]
+		if entry.OrganizerID != filter.OrganizerID ||
+			(filter.EventID != "" && entry.EventID != filter.EventID) ||
+			(filter.Account != "" && entry.Account != filter.Account) ||
+			(filter.From != "" && entry.CreatedAt < filter.From) ||
+			(filter.To != "" && entry.CreatedAt > filter.To) {
+			continue
+		}
+		if skipped < filter.Offset {
+			skipped++
+			continue
+		}
+		entries = append(entries, *entry)
+	}
+
+	return entries, nil
+}
+
+// GetLedgerBalance totals an organizer's account. Entries up to cutoff
+// count towards the available balance.
+func (m *MemoryStore) GetLedgerBalance(organizerID, cutoff string) (*LedgerBalance, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.ledgerBalanceLocked(organizerID, cutoff), nil
+}
+
+// ledgerBalanceLocked totals an organizer's account. Callers must hold m.mu.
+func (m *MemoryStore) ledgerBalanceLocked(organizerID, cutoff string) *LedgerBalance {
+	var sales, fees, refunds, paidOut, balance, settled int64
+	for _, entry := range m.ledger {
+		if entry.OrganizerID != organizerID || entry.Account != ledgerOrganizerPayable {
+			continue
+		}
+
+		net := toMinorUnits(entry.Credit) - toMinorUnits(entry.Debit)
+		balance += net
+		switch entry.Kind {
+		case ledgerSale:
+			sales += net
+		case ledgerPlatformFee:
+			fees -= net
+		case ledgerRefund:
+			refunds -= net
+		case ledgerPayout:
+			paidOut -= net
+		}
+		if entry.Kind != ledgerPayout && entry.CreatedAt <= cutoff {
+			settled += net
+		}
+	}
+
+	available := max(min(settled-paidOut, balance), 0)
+
+	return &LedgerBalance{
+		OrganizerID:  organizerID,
+		Sales:        fromMinorUnits(sales),
+		PlatformFees: fromMinorUnits(fees),
+		Refunds:      fromMinorUnits(refunds),
+		PaidOut:      fromMinorUnits(paidOut),
+		Balance:      fromMinorUnits(balance),
+		Available:    fromMinorUnits(available),
+		Pending:      fromMinorUnits(balance - available),
+		Currency:     paymentCurrency,
+	}
+}
+
+// SettleBalances creates a payout for every organizer whose available
+// balance at cutoff reaches minimum, posting it to the ledger in the same
+// transaction
+func (m *MemoryStore) SettleBalances(cutoff string, minimum float64) ([]Payout, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	organizers := make(map[string]bool)
+	for _, entry := range m.ledger {
+		organizers[entry.OrganizerID] = true
+	}
+
+	payouts := []Payout{}
+	for organizerID := range organizers {
+		balance := m.ledgerBalanceLocked(organizerID, cutoff)
+		if balance.Available <= 0 || balance.Available < minimum {
+			continue
+		}
+
+		payout := Payout{
+			ID:          newID(),
+			OrganizerID: organizerID,
+			Amount:      balance.Available,
+			Currency:    paymentCurrency,
+			Status:      "pending",
+			SettledUpTo: cutoff,
+			CreatedAt:   nowTimestamp(),
+		}
+		m.payouts[payout.ID] = &payout
+		m.postLedgerLocked(payoutTransaction(payout))
+
+		payouts = append(payouts, payout)
+	}
+
+	return payouts, nil
+}
+
+// GetPayouts returns an organizer's payouts, newest first
+func (m *MemoryStore) GetPayouts(organizerID string) ([]Payout, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	payouts := []Payout{}
+	for _, payout := range m.payouts {
+		if payout.OrganizerID == organizerID {
+			payouts = append(payouts, *payout)
+		}
+	}
+
+	sort.Slice(payouts, func(i, j int) bool {
+		return payouts[i].CreatedAt > payouts[j].CreatedAt
+	})
+
+	return payouts, nil
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// organizerBalance fetches the balance the holder of token is owed
+func organizerBalance(t *testing.T, token string) LedgerBalance {
+	t.Helper()
+
+	rec := serveAuthenticated(handleOrganizerBalance, http.MethodGet, "/api/organizer/balance", token, nil)
+	expectStatus(t, rec, http.StatusOK)
+
+	var resp struct {
+		Balance LedgerBalance `json:"balance"`
+	}
+	decodeBody(t, rec, &resp)
+	return resp.Balance
+}
+
+// assertLedgerBalanced checks that every account's debits and credits in
+// the store add up to the same total
+func assertLedgerBalanced(t *testing.T, store *MemoryStore) {
+	t.Helper()
+
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	var debits, credits int64
+	for _, entry := range store.ledger {
+		debits += toMinorUnits(entry.Debit)
+		credits += toMinorUnits(entry.Credit)
+	}
+	if debits != credits {
+		t.Fatalf("expected the ledger to balance, got %d debits and %d credits", debits, credits)
+	}
+}
+
+// unavailableLedger is a ledger store whose postings, and optionally its
+// retry queue, fail
+type unavailableLedger struct {
+	*MemoryStore
+	postingFails bool
+	queueFails   bool
+}
+
+func (l *unavailableLedger) PostLedgerTransaction(tx LedgerTransaction) (bool, error) {
+	if l.postingFails {
+		return false, errors.New("ledger unavailable")
+	}
+	return l.MemoryStore.PostLedgerTransaction(tx)
+}
+
+func (l *unavailableLedger) QueueLedgerTransaction(tx LedgerTransaction) error {
+	if l.queueFails {
+		return errors.New("ledger queue unavailable")
+	}
+	return l.MemoryStore.QueueLedgerTransaction(tx)
+}
+
+func TestValidateLedgerTransaction(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []LedgerEntry
+		valid   bool
+	}{
+		{"balanced", []LedgerEntry{ledgerEntry(ledgerCash, ledgerSale, 1000, ""), ledgerEntry(ledgerOrganizerPayable, ledgerSale, -1000, "")}, true},
+		{"unbalanced", []LedgerEntry{ledgerEntry(ledgerCash, ledgerSale, 1000, ""), ledgerEntry(ledgerOrganizerPayable, ledgerSale, -999, "")}, false},
+		{"one side", []LedgerEntry{ledgerEntry(ledgerCash, ledgerSale, 0, "")}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateLedgerTransaction(LedgerTransaction{Entries: tt.entries}); (err == nil) != tt.valid {
+				t.Fatalf("expected valid=%v, got %v", tt.valid, err)
+			}
+		})
+	}
+
+	if fee := platformFee(99999); fee != 5000 {
+		t.Fatalf("expected a 5%% fee of 5000, got %d", fee)
+	}
+}
+
+func TestPostLedgerTransactionOnce(t *testing.T) {
+	store := newTestStore(t)
+
+	tx := LedgerTransaction{
+		ReferenceID: "sale:payment-1",
+		OrganizerID: "organizer-1",
+		Entries: []LedgerEntry{
+			ledgerEntry(ledgerCash, ledgerSale, 1000, "Sale"),
+			ledgerEntry(ledgerOrganizerPayable, ledgerSale, -1000, "Sale"),
+		},
+	}
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		posted int
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ok, err := store.PostLedgerTransaction(tx)
+			if err != nil {
+				t.Error(err)
+			}
+			if ok {
+				mu.Lock()
+				posted++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if posted != 1 {
+		t.Fatalf("expected the transaction to post once, got %d", posted)
+	}
+	if balance, _ := store.GetLedgerBalance("organizer-1", ""); balance.Balance != 10 {
+		t.Fatalf("expected a balance of 10, got %v", balance.Balance)
+	}
+}
+
+func TestParseLedgerTime(t *testing.T) {
+	tests := []struct {
+		value    string
+		endOfDay bool
+		wanted   string
+	}{
+		{"2026-04-01", false, "2026-03-31T18:30:00Z"},
+		{"2026-04-01", true, "2026-04-01T18:29:59Z"},
+		{"2026-04-01T10:00:00+05:30", true, "2026-04-01T04:30:00Z"},
+	}
+	for _, tt := range tests {
+		if got, err := parseLedgerTime(tt.value, tt.endOfDay); err != nil || got != tt.wanted {
+			t.Errorf("%s: expected %s, got %s (%v)", tt.value, tt.wanted, got, err)
+		}
+	}
+
+	if _, err := parseLedgerTime("01/04/2026", false); err == nil {
+		t.Fatal("expected an unknown date format to be refused")
+	}
+}
+
+func TestOrganizerLedger(t *testing.T) {
+	store := newTestStore(t)
+	organizerID, organizerToken := newTestUser(t, store, "organizer@example.com", roleOrganizer)
+	smallID, smallToken := newTestUser(t, store, "small@example.com", roleOrganizer)
+	_, buyerToken := newTestUser(t, store, "buyer@example.com", roleAttendee)
+
+	event := newTestEvent(t, store, organizerID, CreateEventRequest{Price: 1000})
+	sold := buyTickets(t, buyerToken, EventRegistrationRequest{EventID: event.ID, Quantity: 2})
+
+	small := newTestEvent(t, store, smallID, CreateEventRequest{Price: 50})
+	buyTickets(t, buyerToken, EventRegistrationRequest{EventID: small.ID})
+
+	t.Run("sales", func(t *testing.T) {
+		balance := organizerBalance(t, organizerToken)
+		if balance.Sales != 2000 || balance.PlatformFees != 100 || balance.Balance != 1900 {
+			t.Fatalf("expected 2000 sold less a 100 fee, got %+v", balance)
+		}
+		if balance.Available != 0 || balance.Pending != 1900 {
+			t.Fatalf("expected new sales to be pending, got %+v", balance)
+		}
+		assertLedgerBalanced(t, store)
+	})
+
+	t.Run("refunds return the fee", func(t *testing.T) {
+		// Events without a policy refund in full before they start
+		cancelRegistration(t, buyerToken, sold.Registration.ID)
+
+		balance := organizerBalance(t, organizerToken)
+		if balance.Refunds != 2000 || balance.PlatformFees != 0 || balance.Balance != 0 {
+			t.Fatalf("expected the sale and its fee to be reversed, got %+v", balance)
+		}
+		assertLedgerBalanced(t, store)
+
+		_, secondToken := newTestUser(t, store, "second@example.com", roleAttendee)
+		buyTickets(t, secondToken, EventRegistrationRequest{EventID: event.ID})
+	})
+
+	t.Run("pagination", func(t *testing.T) {
+		rec := serveAuthenticated(handleOrganizerLedger, http.MethodGet, "/api/organizer/ledger?limit=4", organizerToken, nil)
+		expectStatus(t, rec, http.StatusOK)
+
+		var page struct {
+			Entries    []LedgerEntry `json:"entries"`
+			HasMore    bool          `json:"has_more"`
+			NextOffset int           `json:"next_offset"`
+		}
+		decodeBody(t, rec, &page)
+		if len(page.Entries) != 4 || !page.HasMore || page.NextOffset != 4 {
+			t.Fatalf("expected a first page of 4 with more to come, got %+v", page)
+		}
+		if page.Entries[0].Kind != ledgerPlatformFee || page.Entries[0].Account != ledgerOrganizerPayable {
+			t.Fatalf("expected the newest entry, the latest sale's fee, first, got %+v", page.Entries[0])
+		}
+
+		rec = serveAuthenticated(handleOrganizerLedger, http.MethodGet, "/api/organizer/ledger?offset=4", organizerToken, nil)
+		expectStatus(t, rec, http.StatusOK)
+		page.Entries = nil
+		decodeBody(t, rec, &page)
+		if len(page.Entries) != 2 || page.HasMore {
+			t.Fatalf("expected the 2 remaining entries, got %+v", page)
+		}
+
+		for _, query := range []string{"limit=0", "limit=201", "offset=-1", "from=yesterday"} {
+			rec := serveAuthenticated(handleOrganizerLedger, http.MethodGet, "/api/organizer/ledger?"+query, organizerToken, nil)
+			expectStatus(t, rec, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("settlement", func(t *testing.T) {
+		if payouts := settleBalances(time.Now()); len(payouts) != 0 {
+			t.Fatalf("expected nothing settled before the delay, got %+v", payouts)
+		}
+
+		later := time.Now().Add(settlementDelay + time.Minute)
+		payouts := settleBalances(later)
+		if len(payouts) != 1 || payouts[0].OrganizerID != organizerID || payouts[0].Amount != 950 {
+			t.Fatalf("expected one payout of 950, leaving the small organizer under the minimum, got %+v", payouts)
+		}
+		if again := settleBalances(later); len(again) != 0 {
+			t.Fatalf("expected a settled balance not to be paid twice, got %+v", again)
+		}
+
+		balance := organizerBalance(t, organizerToken)
+		if balance.PaidOut != 950 || balance.Balance != 0 {
+			t.Fatalf("expected the balance paid out, got %+v", balance)
+		}
+		if small := organizerBalance(t, smallToken); small.Balance != 47.5 || small.PaidOut != 0 {
+			t.Fatalf("expected the small balance to wait for the minimum, got %+v", small)
+		}
+		assertLedgerBalanced(t, store)
+
+		rec := serveAuthenticated(handleOrganizerPayouts, http.MethodGet, "/api/organizer/payouts", organizerToken, nil)
+		expectStatus(t, rec, http.StatusOK)
+		var resp struct {
+			Payouts []Payout `json:"payouts"`
+		}
+		decodeBody(t, rec, &resp)
+		if len(resp.Payouts) != 1 || resp.Payouts[0].Status != "pending" {
+			t.Fatalf("expected the payout listed, got %+v", resp.Payouts)
+		}
+	})
+}
+
+func TestFailedLedgerPostings(t *testing.T) {
+	store := newTestStore(t)
+	organizerID, organizerToken := newTestUser(t, store, "organizer@example.com", roleOrganizer)
+	_, buyerToken := newTestUser(t, store, "buyer@example.com", roleAttendee)
+
+	ledger := &unavailableLedger{MemoryStore: store, postingFails: true}
+	ledgerStore = ledger
+
+	event := newTestEvent(t, store, organizerID, CreateEventRequest{Price: 1000})
+	later := time.Now().Add(settlementDelay + time.Minute)
+
+	t.Run("a sale that fails to post is queued", func(t *testing.T) {
+		buyTickets(t, buyerToken, EventRegistrationRequest{EventID: event.ID})
+
+		if queued, _ := store.GetQueuedLedgerTransactions(); len(queued) != 1 || !strings.HasPrefix(queued[0].ReferenceID, "sale:") {
+			t.Fatalf("expected the sale to be queued, got %+v", queued)
+		}
+		if payouts := settleBalances(later); len(payouts) != 0 {
+			t.Fatalf("expected settlement to wait for the queue, got %+v", payouts)
+		}
+
+		ledger.postingFails = false
+		settleBalances(time.Now())
+
+		if queued, _ := store.GetQueuedLedgerTransactions(); len(queued) != 0 {
+			t.Fatalf("expected the retry to empty the queue, got %+v", queued)
+		}
+		if balance := organizerBalance(t, organizerToken); balance.Sales != 1000 {
+			t.Fatalf("expected the retried sale in the balance, got %+v", balance)
+		}
+		assertLedgerBalanced(t, store)
+	})
+
+	t.Run("a refund that cannot be recorded fails the cancellation", func(t *testing.T) {
+		_, otherToken := newTestUser(t, store, "other@example.com", roleAttendee)
+		sold := buyTickets(t, otherToken, EventRegistrationRequest{EventID: event.ID})
+
+		ledger.postingFails, ledger.queueFails = true, true
+		rec := serveAuthenticated(handleCancelRegistration, http.MethodPost, "/api/registrations/cancel", otherToken, CancelRegistrationRequest{RegistrationID: sold.Registration.ID})
+		expectStatus(t, rec, http.StatusBadGateway)
+		if registration, _ := store.GetRegistrationByID("", sold.Registration.ID); registration.Status != "confirmed" {
+			t.Fatalf("expected the registration to stand, got %s", registration.Status)
+		}
+
+		// The retry gets the same keyed refund and posts it once
+		ledger.postingFails, ledger.queueFails = false, false
+		cancelRegistration(t, otherToken, sold.Registration.ID)
+
+		payment, _ := store.GetRegistrationPayment(sold.Registration.ID)
+		if intent, _ := paymentProvider.GetIntent(payment.IntentID); intent.AmountRefunded != 100000 {
+			t.Fatalf("expected one refund of 100000, got %d", intent.AmountRefunded)
+		}
+		if balance := organizerBalance(t, organizerToken); balance.Refunds != 1000 || balance.Balance != 950 {
+			t.Fatalf("expected the refund posted once, got %+v", balance)
+		}
+		assertLedgerBalanced(t, store)
+	})
+}
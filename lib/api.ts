@@ -12,14 +12,41 @@ export function getAuthToken(): string | null {
   return localStorage.getItem('auth_token');
 }
 
-export function setAuthToken(token: string): void {
+export function setAuthToken(token: string, refreshToken?: string): void {
   if (typeof window === 'undefined') return;
   localStorage.setItem('auth_token', token);
+  if (refreshToken) {
+    localStorage.setItem('refresh_token', refreshToken);
+  }
 }
 
 export function clearAuthToken(): void {
   if (typeof window === 'undefined') return;
   localStorage.removeItem('auth_token');
+  localStorage.removeItem('refresh_token');
+}
+
+// Exchanges the stored refresh token for a new token pair; returns false
+// and signs out locally when the session has ended
+export async function refreshAccessToken(): Promise<boolean> {
+  if (typeof window === 'undefined') return false;
+  const refreshToken = localStorage.getItem('refresh_token');
+  if (!refreshToken) return false;
+
+  const response = await fetch(`${API_URL}/api/token/refresh`, {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ refresh_token: refreshToken }),
+  });
+
+  if (!response.ok) {
+    clearAuthToken();
+    return false;
+  }
+
+  const data = await response.json();
+  setAuthToken(data.token, data.refresh_token);
+  return true;
 }
 
 // =====================================================
@@ -28,7 +55,8 @@ export function clearAuthToken(): void {
 
 async function apiFetch(
   endpoint: string,
-  options: RequestInit = {}
+  options: RequestInit = {},
+  retry = true
 ): Promise<any> {
   const url = `${API_URL}${endpoint}`;
   const token = getAuthToken();
@@ -47,6 +75,11 @@ async function apiFetch(
     headers,
   });
 
+  // Expired access tokens are refreshed once, then the request is retried
+  if (response.status === 401 && token && retry && (await refreshAccessToken())) {
+    return apiFetch(endpoint, options, false);
+  }
+
   const data = await response.json();
 
   if (!response.ok) {
@@ -66,7 +99,22 @@ export async function loginUser(email: string, password: string) {
     body: JSON.stringify({ email, password }),
   });
   if (data.token) {
-    setAuthToken(data.token);
+    setAuthToken(data.token, data.refresh_token);
+  }
+  return data;
+}
+
+// Completes a login that answered with two_factor_required
+export async function loginTwoFactor(
+  challengeToken: string,
+  factor: { code?: string; recovery_code?: string }
+) {
+  const data = await apiFetch('/api/login/2fa', {
+    method: 'POST',
+    body: JSON.stringify({ challenge_token: challengeToken, ...factor }),
+  });
+  if (data.token) {
+    setAuthToken(data.token, data.refresh_token);
   }
   return data;
 }
@@ -83,7 +131,7 @@ export async function registerUser(payload: {
     body: JSON.stringify(payload),
   });
   if (data.token) {
-    setAuthToken(data.token);
+    setAuthToken(data.token, data.refresh_token);
   }
   return data;
 }
@@ -92,6 +140,73 @@ export async function getProfile() {
   return apiFetch('/api/profile');
 }
 
+export async function getTwoFactorStatus() {
+  return apiFetch('/api/2fa');
+}
+
+export async function enrollTwoFactor() {
+  return apiFetch('/api/2fa/enroll', { method: 'POST' });
+}
+
+export async function confirmTwoFactor(code: string) {
+  return apiFetch('/api/2fa/confirm', {
+    method: 'POST',
+    body: JSON.stringify({ code }),
+  });
+}
+
+export async function disableTwoFactor(factor: { code?: string; recovery_code?: string }) {
+  return apiFetch('/api/2fa', {
+    method: 'DELETE',
+    body: JSON.stringify(factor),
+  });
+}
+
+export async function getSessions() {
+  return apiFetch('/api/sessions');
+}
+
+export async function revokeSession(sessionId: string) {
+  return apiFetch(`/api/sessions/${sessionId}`, { method: 'DELETE' });
+}
+
+// Signs out every session, or every other one when keepCurrent is set
+export async function logoutEverywhere(keepCurrent = false) {
+  const data = await apiFetch(`/api/sessions${keepCurrent ? '?others=true' : ''}`, { method: 'DELETE' });
+  if (!keepCurrent) {
+    clearAuthToken();
+  }
+  return data;
+}
+
+export async function forgotPassword(email: string) {
+  return apiFetch('/api/password/forgot', {
+    method: 'POST',
+    body: JSON.stringify({ email }),
+  });
+}
+
+export async function resetPassword(token: string, password: string) {
+  return apiFetch('/api/password/reset', {
+    method: 'POST',
+    body: JSON.stringify({ token, password }),
+  });
+}
+
+export async function verifyEmail(token: string) {
+  return apiFetch('/api/email/verify', {
+    method: 'POST',
+    body: JSON.stringify({ token }),
+  });
+}
+
+export async function resendVerification(email: string) {
+  return apiFetch('/api/email/verify/resend', {
+    method: 'POST',
+    body: JSON.stringify({ email }),
+  });
+}
+
 // =====================================================
 // Events API
 // =====================================================
@@ -173,9 +288,25 @@ export interface Registration {
   status: string;
   notes: string;
   created_at: string;
+  quantity: number;
+  attendees?: Attendee[];
+  promo_code_id?: string;
+  discount?: number;
   events?: Event;
 }
 
+export interface Attendee {
+  name: string;
+  email?: string;
+}
+
+export interface BillingDetails {
+  name?: string;
+  gstin?: string;
+  state_code?: string;
+  address?: string;
+}
+
 export async function fetchRegistrations(status?: string): Promise<{
   registrations: Registration[];
   count: number;
@@ -187,6 +318,10 @@ export async function fetchRegistrations(status?: string): Promise<{
 export async function registerForEvent(payload: {
   event_id: string;
   notes?: string;
+  quantity?: number;
+  attendees?: Attendee[];
+  promo_code?: string;
+  billing?: BillingDetails;
 }) {
   return apiFetch('/api/registrations', {
     method: 'POST',
@@ -201,6 +336,33 @@ export async function cancelRegistration(registrationId: string) {
   });
 }
 
+// =====================================================
+// Invoices API
+// =====================================================
+
+export interface Invoice {
+  id: string;
+  document_type: 'tax_invoice' | 'bill_of_supply';
+  invoice_number: string;
+  registration_id: string;
+  event_id: string;
+  taxable_value: number;
+  cgst: number;
+  sgst: number;
+  igst: number;
+  total: number;
+  currency: string;
+  issued_at: string;
+}
+
+export async function fetchInvoices(): Promise<{ invoices: Invoice[]; count: number }> {
+  return apiFetch('/api/invoices');
+}
+
+export async function fetchRegistrationInvoice(registrationId: string): Promise<{ invoice: Invoice }> {
+  return apiFetch(`/api/invoices?registration_id=${registrationId}`);
+}
+
 // =====================================================
 // Utility: Format price in INR
 // =====================================================
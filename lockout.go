@@ -0,0 +1,460 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Failed login tracking
+const (
+	// loginBackoffBase is the wait after the second failure in a row; each
+	// further failure doubles it until the lockout threshold
+	loginBackoffBase = time.Second
+	// loginFailureWindow is how long without a failure resets the count
+	loginFailureWindow = time.Hour
+
+	defaultAccountLockoutThreshold = 5
+	defaultIPLockoutThreshold      = 20
+	defaultLockoutDuration         = 15 * time.Minute
+)
+
+// loginLockout holds the lockout settings, initialized in setup
+var loginLockout LoginLockoutPolicy
+
+// LoginLockoutPolicy sets how many failed logins in a row lock an account
+// or an IP address, and for how long
+type LoginLockoutPolicy struct {
+	AccountThreshold int
+	IPThreshold      int
+	Duration         time.Duration
+}
+
+// LoginThrottle counts the recent failed logins for an account or an IP
+// address. Keys are "account:<email>" or "ip:<address>".
+type LoginThrottle struct {
+	Key           string `json:"key"`
+	Failures      int    `json:"failures"`
+	LastFailureAt string `json:"last_failure_at"`
+	LockedUntil   string `json:"locked_until"`
+}
+
+// LoginAttempt is the outcome of reserving a login attempt under a key
+type LoginAttempt struct {
+	Throttle *LoginThrottle `json:"throttle"`
+	// Allowed is false while the key is locked out or backing off, in
+	// which case the attempt was not counted
+	Allowed bool `json:"allowed"`
+	// NewlyLocked is set when this attempt reached the threshold and
+	// started a lockout
+	NewlyLocked bool `json:"newly_locked"`
+	// PreviousFailureAt is the last failure before this attempt, put back
+	// if the attempt is released
+	PreviousFailureAt string `json:"previous_failure_at"`
+}
+
+// loginLockoutFromEnv reads LOGIN_LOCKOUT_THRESHOLD,
+// LOGIN_IP_LOCKOUT_THRESHOLD and LOGIN_LOCKOUT_DURATION
+func loginLockoutFromEnv() (LoginLockoutPolicy, error) {
+	policy := LoginLockoutPolicy{
+		AccountThreshold: defaultAccountLockoutThreshold,
+		IPThreshold:      defaultIPLockoutThreshold,
+		Duration:         defaultLockoutDuration,
+	}
+
+	if value := os.Getenv("LOGIN_LOCKOUT_THRESHOLD"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			return policy, fmt.Errorf("invalid LOGIN_LOCKOUT_THRESHOLD: must be a positive number")
+		}
+		policy.AccountThreshold = parsed
+	}
+
+	if value := os.Getenv("LOGIN_IP_LOCKOUT_THRESHOLD"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			return policy, fmt.Errorf("invalid LOGIN_IP_LOCKOUT_THRESHOLD: must be a positive number")
+		}
+		policy.IPThreshold = parsed
+	}
+
+	if value := os.Getenv("LOGIN_LOCKOUT_DURATION"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			return policy, fmt.Errorf("invalid LOGIN_LOCKOUT_DURATION %q", value)
+		}
+		policy.Duration = parsed
+	}
+
+	return policy, nil
+}
+
+// accountThrottleKey and ipThrottleKey name the failure counters
+func accountThrottleKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+// loginBackoff is how long to wait after a number of failures in a row.
+// The first quarter of the threshold is free, since people mistype, then
+// the wait starts at a second and doubles, never longer than a lockout.
+// An account with the default threshold of 5 waits 1s, 2s, then 4s.
+func loginBackoff(failures, threshold int) time.Duration {
+	free := max(threshold/4, 1)
+	if failures <= free {
+		return 0
+	}
+
+	delay := loginBackoffBase * time.Duration(math.Pow(2, float64(min(failures-free-1, 20))))
+	return min(delay, loginLockout.Duration)
+}
+
+// loginRetryAfter returns how long until another login may be tried, and
+// whether that is because of a lockout rather than backoff
+func loginRetryAfter(throttle *LoginThrottle, threshold int, now time.Time) (time.Duration, bool) {
+	if throttle == nil {
+		return 0, false
+	}
+
+	if lockedUntil, err := time.Parse(time.RFC3339, throttle.LockedUntil); err == nil && lockedUntil.After(now) {
+		return lockedUntil.Sub(now), true
+	}
+
+	lastFailure, err := time.Parse(time.RFC3339, throttle.LastFailureAt)
+	if err != nil || now.Sub(lastFailure) >= loginFailureWindow {
+		return 0, false
+	}
+
+	return max(lastFailure.Add(loginBackoff(throttle.Failures, threshold)).Sub(now), 0), false
+}
+
+// describeWait turns a wait into "N seconds" or "N minutes", rounding up
+func describeWait(wait time.Duration) string {
+	seconds := int(math.Ceil(wait.Seconds()))
+	switch {
+	case seconds <= 1:
+		return "1 second"
+	case seconds < 120:
+		return fmt.Sprintf("%d seconds", seconds)
+	}
+	return fmt.Sprintf("%d minutes", int(math.Ceil(wait.Minutes())))
+}
+
+// loginAttempt is a login counted against the account's and the IP
+// address's failure counters before the credentials are checked
+type loginAttempt struct {
+	email   string
+	ip      string
+	account *LoginAttempt
+	address *LoginAttempt
+}
+
+// beginLoginAttempt reserves a login attempt against the account and the
+// caller's IP address, rejecting it while either is locked out or backing
+// off after failures. The attempt counts as a failure from the start, so
+// parallel guesses cannot all pass before any of them is recorded; callers
+// finish it with failed or release.
+func beginLoginAttempt(w http.ResponseWriter, email, ip string) (*loginAttempt, bool) {
+	attempt := &loginAttempt{email: strings.ToLower(strings.TrimSpace(email)), ip: ip}
+
+	var err error
+	attempt.account, err = loginThrottleStore.ReserveLoginAttempt(accountThrottleKey(attempt.email), loginLockout.AccountThreshold, loginLockout.Duration)
+	if err != nil {
+		fmt.Printf("Error checking failed logins: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to sign in")
+		return nil, false
+	}
+	if !attempt.account.Allowed {
+		sendLoginThrottled(w, attempt.account.Throttle, loginLockout.AccountThreshold, true)
+		return nil, false
+	}
+
+	attempt.address, err = loginThrottleStore.ReserveLoginAttempt(ipThrottleKey(ip), loginLockout.IPThreshold, loginLockout.Duration)
+	if err != nil || !attempt.address.Allowed {
+		releaseLoginAttempt(accountThrottleKey(attempt.email), attempt.account)
+		if err != nil {
+			fmt.Printf("Error checking failed logins: %v\n", err)
+			sendError(w, http.StatusInternalServerError, "Server error", "Unable to sign in")
+		} else {
+			sendLoginThrottled(w, attempt.address.Throttle, loginLockout.IPThreshold, false)
+		}
+		return nil, false
+	}
+
+	return attempt, true
+}
+
+// sendLoginThrottled rejects a login while an account or IP address is
+// locked out or backing off
+func sendLoginThrottled(w http.ResponseWriter, throttle *LoginThrottle, threshold int, account bool) {
+	wait, locked := loginRetryAfter(throttle, threshold, time.Now())
+	w.Header().Set("Retry-After", strconv.Itoa(max(int(math.Ceil(wait.Seconds())), 1)))
+
+	switch {
+	case locked && account:
+		sendError(w, http.StatusTooManyRequests, "Account locked", fmt.Sprintf("Too many failed sign-in attempts. This account is locked for %s; reset your password to unlock it now.", describeWait(wait)))
+	case locked:
+		sendError(w, http.StatusTooManyRequests, "Too many attempts", fmt.Sprintf("Too many failed sign-in attempts from your network. Try again in %s.", describeWait(wait)))
+	default:
+		sendError(w, http.StatusTooManyRequests, "Too many attempts", fmt.Sprintf("Too many failed sign-in attempts. Try again in %s.", describeWait(wait)))
+	}
+}
+
+// failed keeps the attempt counted as a failed login, and tells the
+// account's owner if it locked the account
+func (a *loginAttempt) failed() {
+	if a.account.NewlyLocked {
+		failures := a.account.Throttle.Failures
+		fmt.Printf("Account %s locked after %d failed logins, the last from %s\n", a.email, failures, a.ip)
+		if err := sendLockoutNotice(a.email, a.ip, failures); err != nil {
+			fmt.Printf("Error sending lockout notice: %v\n", err)
+		}
+	}
+
+	if a.address.NewlyLocked {
+		fmt.Printf("IP %s locked out after %d failed logins\n", a.ip, a.address.Throttle.Failures)
+	}
+}
+
+// release gives back the attempt once the credentials checked out, along
+// with any lockout it started. IP counters otherwise only expire, so
+// signing in to one account does not reset guesses against others.
+func (a *loginAttempt) release() {
+	releaseLoginAttempt(accountThrottleKey(a.email), a.account)
+	releaseLoginAttempt(ipThrottleKey(a.ip), a.address)
+}
+
+// releaseLoginAttempt gives back one reserved attempt
+func releaseLoginAttempt(key string, attempt *LoginAttempt) {
+	if err := loginThrottleStore.ReleaseLoginAttempt(key, attempt); err != nil {
+		fmt.Printf("Error releasing login attempt: %v\n", err)
+	}
+}
+
+// clearLoginFailures resets an account's failure count once its owner
+// signs in or resets their password. IP counters only expire, so signing
+// in to one account does not reset guesses against others.
+func clearLoginFailures(email string) {
+	if _, err := loginThrottleStore.ClearLoginThrottle(accountThrottleKey(email)); err != nil {
+		fmt.Printf("Error clearing failed logins: %v\n", err)
+	}
+}
+
+// sendLockoutNotice emails the owner of a locked account, if there is one
+func sendLockoutNotice(email, ip string, failures int) error {
+	exists, err := userStore.UserExists(email)
+	if err != nil || !exists {
+		return err
+	}
+
+	if !mailAllowed("lockout", email) {
+		fmt.Printf("Lockout notice to %s skipped: rate limited\n", email)
+		return nil
+	}
+
+	return mailer.Send(MailMessage{
+		To:      email,
+		Subject: "Sign-in to your GoTicket account was locked",
+		Body: fmt.Sprintf("After %d failed sign-in attempts, the last from %s, sign-in to your GoTicket account is locked for %s.\n\n"+
+			"If this was you, wait, or reset your password from the sign-in page to unlock it now:\n%s/login\n\n"+
+			"If it wasn't you, someone may be guessing your password; resetting it is a good idea.\n",
+			failures, ip, describeWait(loginLockout.Duration), appURL),
+	})
+}
+
+// =====================================================
+// Lockout Handlers
+// =====================================================
+
+// handleUnlockUser serves POST /api/admin/users/{id}/unlock, where admins
+// lift a lockout before it expires
+func handleUnlockUser(w http.ResponseWriter, r *http.Request, userID string) {
+	auth := authFromRequest(r)
+
+	if r.Method != http.MethodPost {
+		sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "Only POST method is allowed")
+		return
+	}
+
+	if !hasPermission(auth.Role, permManageSecurity) {
+		sendError(w, http.StatusForbidden, "Forbidden", fmt.Sprintf("Your %s account is not allowed to do this", auth.Role))
+		return
+	}
+
+	user, err := userStore.GetUserByID(userID)
+	if err != nil {
+		sendError(w, http.StatusNotFound, "Not found", "User not found")
+		return
+	}
+
+	cleared, err := loginThrottleStore.ClearLoginThrottle(accountThrottleKey(user.Email))
+	if err != nil {
+		fmt.Printf("Error unlocking account: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to unlock account")
+		return
+	}
+
+	failures := 0
+	wasLocked := false
+	if cleared != nil {
+		failures = cleared.Failures
+		_, wasLocked = loginRetryAfter(cleared, loginLockout.AccountThreshold, time.Now())
+	}
+
+	fmt.Printf("Admin %s unlocked sign-in for user %s (%d failed logins)\n", auth.UserID, userID, failures)
+
+	sendJSON(w, http.StatusOK, map[string]interface{}{
+		"user_id":    userID,
+		"was_locked": wasLocked,
+		"failures":   failures,
+		"message":    "Failed logins cleared; the account can sign in again",
+	})
+}
+
+// =====================================================
+// Supabase Lockout Functions
+// =====================================================
+
+// ReserveLoginAttempt counts a login attempt under a key in one
+// transaction, refusing it while the key is locked out or backing off and
+// locking the key once threshold attempts are counted
+func (c *SupabaseClient) ReserveLoginAttempt(key string, threshold int, lockout time.Duration) (*LoginAttempt, error) {
+	payload := map[string]interface{}{
+		"p_key":             key,
+		"p_threshold":       threshold,
+		"p_lockout_seconds": int(lockout.Seconds()),
+		"p_window_seconds":  int(loginFailureWindow.Seconds()),
+	}
+
+	var attempt LoginAttempt
+	if err := c.doREST("POST", "/rest/v1/rpc/reserve_login_attempt", "", payload, &attempt); err != nil {
+		return nil, err
+	}
+
+	if attempt.Throttle == nil {
+		return nil, fmt.Errorf("login attempt reserved but no data returned")
+	}
+
+	return &attempt, nil
+}
+
+// ReleaseLoginAttempt uncounts a reserved attempt that succeeded, lifting
+// the lockout it started and putting back the previous failure time
+func (c *SupabaseClient) ReleaseLoginAttempt(key string, attempt *LoginAttempt) error {
+	lockedUntil := ""
+	if attempt.NewlyLocked {
+		lockedUntil = attempt.Throttle.LockedUntil
+	}
+
+	payload := map[string]interface{}{
+		"p_key":                 key,
+		"p_locked_until":        nullIfEmpty(lockedUntil),
+		"p_failed_at":           attempt.Throttle.LastFailureAt,
+		"p_previous_failure_at": nullIfEmpty(attempt.PreviousFailureAt),
+	}
+
+	return c.doREST("POST", "/rest/v1/rpc/release_login_attempt", "", payload, nil)
+}
+
+// ClearLoginThrottle removes the failure count under a key, returning it,
+// or nil if there was none
+func (c *SupabaseClient) ClearLoginThrottle(key string) (*LoginThrottle, error) {
+	var cleared []LoginThrottle
+	if err := c.doREST("DELETE", "/rest/v1/login_throttles?key=eq."+url.QueryEscape(key), "", nil, &cleared); err != nil {
+		return nil, err
+	}
+
+	if len(cleared) == 0 {
+		return nil, nil
+	}
+
+	return &cleared[0], nil
+}
+
+// =====================================================
+// In-memory Lockout Functions
+// =====================================================
+
+// ReserveLoginAttempt counts a login attempt under a key, refusing it
+// while the key is locked out or backing off and locking the key once
+// threshold attempts are counted
+func (m *MemoryStore) ReserveLoginAttempt(key string, threshold int, lockout time.Duration) (*LoginAttempt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+	throttle, exists := m.loginThrottles[key]
+	if !exists {
+		throttle = &LoginThrottle{Key: key}
+		m.loginThrottles[key] = throttle
+	}
+
+	if wait, _ := loginRetryAfter(throttle, threshold, now); wait > 0 {
+		refused := *throttle
+		return &LoginAttempt{Throttle: &refused}, nil
+	}
+
+	if last, err := time.Parse(time.RFC3339, throttle.LastFailureAt); err != nil || now.Sub(last) >= loginFailureWindow {
+		throttle.Failures = 0
+	}
+
+	previousFailureAt := throttle.LastFailureAt
+	throttle.Failures++
+	throttle.LastFailureAt = now.Format(time.RFC3339Nano)
+
+	newlyLocked := false
+	if throttle.Failures >= threshold {
+		throttle.LockedUntil = now.Add(lockout).Format(time.RFC3339Nano)
+		newlyLocked = true
+	}
+
+	reserved := *throttle
+	return &LoginAttempt{Throttle: &reserved, Allowed: true, NewlyLocked: newlyLocked, PreviousFailureAt: previousFailureAt}, nil
+}
+
+// ReleaseLoginAttempt uncounts a reserved attempt that succeeded, lifting
+// the lockout it started and putting back the previous failure time
+func (m *MemoryStore) ReleaseLoginAttempt(key string, attempt *LoginAttempt) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	throttle, exists := m.loginThrottles[key]
+	if !exists {
+		return nil
+	}
+
+	throttle.Failures = max(throttle.Failures-1, 0)
+	if attempt.NewlyLocked && throttle.LockedUntil == attempt.Throttle.LockedUntil {
+		throttle.LockedUntil = ""
+	}
+
+	// A later attempt that has failed since keeps its own time
+	if throttle.LastFailureAt == attempt.Throttle.LastFailureAt {
+		throttle.LastFailureAt = attempt.PreviousFailureAt
+	}
+
+	return nil
+}
+
+// ClearLoginThrottle removes the failure count under a key, returning it,
+// or nil if there was none
+func (m *MemoryStore) ClearLoginThrottle(key string) (*LoginThrottle, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	throttle, exists := m.loginThrottles[key]
+	if !exists {
+		return nil, nil
+	}
+
+	delete(m.loginThrottles, key)
+	return throttle, nil
+}
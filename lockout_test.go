@@ -0,0 +1,395 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ageLoginFailures moves a throttle's last failure back by d, standing in
+// for waiting out the backoff between guesses
+func ageLoginFailures(store *MemoryStore, key string, d time.Duration) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if throttle, exists := store.loginThrottles[key]; exists {
+		last, _ := time.Parse(time.RFC3339, throttle.LastFailureAt)
+		throttle.LastFailureAt = last.Add(-d).Format(time.RFC3339Nano)
+	}
+}
+
+// loginFailures returns the failures counted under a throttle key
+func loginFailures(store *MemoryStore, key string) int {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if throttle, exists := store.loginThrottles[key]; exists {
+		return throttle.Failures
+	}
+	return 0
+}
+
+// useLockoutPolicy swaps the lockout settings for the length of a test
+func useLockoutPolicy(t *testing.T, policy LoginLockoutPolicy) {
+	previous := loginLockout
+	t.Cleanup(func() { loginLockout = previous })
+	loginLockout = policy
+}
+
+// loginFrom signs in from a client address
+func loginFrom(email, password, ip string) *httptest.ResponseRecorder {
+	req := newTestRequest(http.MethodPost, "/api/login", map[string]string{"email": email, "password": password})
+	req.RemoteAddr = ip + ":4000"
+
+	rec := httptest.NewRecorder()
+	handleLogin(rec, req)
+	return rec
+}
+
+func TestLoginLockoutFromEnv(t *testing.T) {
+	policy, err := loginLockoutFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy != (LoginLockoutPolicy{AccountThreshold: 5, IPThreshold: 20, Duration: 15 * time.Minute}) {
+		t.Fatalf("unexpected defaults %+v", policy)
+	}
+
+	t.Setenv("LOGIN_LOCKOUT_THRESHOLD", "8")
+	t.Setenv("LOGIN_IP_LOCKOUT_THRESHOLD", "50")
+	t.Setenv("LOGIN_LOCKOUT_DURATION", "1h")
+	policy, err = loginLockoutFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy != (LoginLockoutPolicy{AccountThreshold: 8, IPThreshold: 50, Duration: time.Hour}) {
+		t.Fatalf("unexpected policy %+v", policy)
+	}
+
+	for name, value := range map[string]string{
+		"LOGIN_LOCKOUT_THRESHOLD":    "0",
+		"LOGIN_IP_LOCKOUT_THRESHOLD": "many",
+		"LOGIN_LOCKOUT_DURATION":     "-5m",
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, value)
+			if _, err := loginLockoutFromEnv(); err == nil {
+				t.Fatalf("expected %s=%q to be refused", name, value)
+			}
+		})
+	}
+}
+
+func TestLoginBackoff(t *testing.T) {
+	useLockoutPolicy(t, LoginLockoutPolicy{AccountThreshold: 5, IPThreshold: 20, Duration: 15 * time.Minute})
+
+	tests := []struct {
+		failures  int
+		threshold int
+		want      time.Duration
+	}{
+		{1, 5, 0},
+		{2, 5, time.Second},
+		{3, 5, 2 * time.Second},
+		{4, 5, 4 * time.Second},
+		{5, 20, 0},
+		{6, 20, time.Second},
+		{19, 20, 15 * time.Minute},
+		{1000, 20, 15 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := loginBackoff(tt.failures, tt.threshold); got != tt.want {
+			t.Errorf("loginBackoff(%d, %d) = %v, want %v", tt.failures, tt.threshold, got, tt.want)
+		}
+	}
+
+	now := time.Now().Truncate(time.Second)
+	locked := &LoginThrottle{Failures: 5, LastFailureAt: now.Format(time.RFC3339), LockedUntil: now.Add(10 * time.Minute).Format(time.RFC3339)}
+	if wait, isLocked := loginRetryAfter(locked, 5, now); !isLocked || wait != 10*time.Minute {
+		t.Fatalf("expected a 10 minute lockout, got %v %v", wait, isLocked)
+	}
+
+	backingOff := &LoginThrottle{Failures: 3, LastFailureAt: now.Add(-time.Second).Format(time.RFC3339)}
+	if wait, isLocked := loginRetryAfter(backingOff, 5, now); isLocked || wait != time.Second {
+		t.Fatalf("expected a second of backoff, got %v %v", wait, isLocked)
+	}
+
+	stale := &LoginThrottle{Failures: 4, LastFailureAt: now.Add(-loginFailureWindow).Format(time.RFC3339)}
+	if wait, _ := loginRetryAfter(stale, 5, now); wait != 0 {
+		t.Fatalf("expected failures outside the window to be forgotten, got %v", wait)
+	}
+
+	for wait, want := range map[time.Duration]string{
+		200 * time.Millisecond: "1 second",
+		90 * time.Second:       "90 seconds",
+		15 * time.Minute:       "15 minutes",
+	} {
+		if got := describeWait(wait); got != want {
+			t.Errorf("describeWait(%v) = %q, want %q", wait, got, want)
+		}
+	}
+}
+
+func TestAccountLockout(t *testing.T) {
+	store := newTestStore(t)
+	box := captureMail(t)
+	useLockoutPolicy(t, LoginLockoutPolicy{AccountThreshold: 5, IPThreshold: 20, Duration: 15 * time.Minute})
+
+	const email = "guarded@example.com"
+	userID, _ := newTestUser(t, store, email, roleAttendee)
+	_, adminToken := newTestUser(t, store, "admin@example.com", roleAdmin)
+	_, organizerToken := newTestUser(t, store, "organizer@example.com", roleOrganizer)
+	key := accountThrottleKey(email)
+
+	// guess fails a login, then skips the backoff it started
+	guess := func(t *testing.T, email string) {
+		t.Helper()
+
+		expectStatus(t, login(email, "Wrong1234"), http.StatusUnauthorized)
+		ageLoginFailures(store, accountThrottleKey(email), time.Minute)
+		ageLoginFailures(store, ipThrottleKey("192.0.2.1"), time.Minute)
+	}
+
+	// lock guesses the account's password until it locks. The test
+	// client's address takes every guess, so they are forgotten there.
+	lock := func(t *testing.T) {
+		t.Helper()
+
+		for i := 0; i < loginLockout.AccountThreshold; i++ {
+			guess(t, email)
+		}
+		if _, err := store.ClearLoginThrottle(ipThrottleKey("192.0.2.1")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("failures back off before locking", func(t *testing.T) {
+		expectStatus(t, login(email, "Wrong1234"), http.StatusUnauthorized)
+		expectStatus(t, login(email, "Wrong1234"), http.StatusUnauthorized)
+
+		// Even the right password waits out the backoff
+		rec := login(email, testPassword)
+		expectStatus(t, rec, http.StatusTooManyRequests)
+		if rec.Header().Get("Retry-After") != "1" {
+			t.Fatalf("expected Retry-After 1, got %q", rec.Header().Get("Retry-After"))
+		}
+
+		ageLoginFailures(store, key, time.Minute)
+		expectStatus(t, login(strings.ToUpper(email), testPassword), http.StatusOK)
+		if failures := loginFailures(store, key); failures != 0 {
+			t.Fatalf("expected signing in to clear the failures, got %d", failures)
+		}
+	})
+
+	t.Run("the threshold locks the account and tells its owner", func(t *testing.T) {
+		lock(t)
+
+		rec := login(email, testPassword)
+		expectStatus(t, rec, http.StatusTooManyRequests)
+		if !strings.Contains(rec.Body.String(), "Account locked") || rec.Header().Get("Retry-After") != "900" {
+			t.Fatalf("expected a 15 minute lockout, got %s (Retry-After %q)", rec.Body.String(), rec.Header().Get("Retry-After"))
+		}
+
+		sent := box.to(email)
+		if len(sent) != 1 || !strings.Contains(sent[0].Body, "After 5 failed sign-in attempts, the last from 192.0.2.1") {
+			t.Fatalf("expected one lockout notice, got %+v", sent)
+		}
+	})
+
+	t.Run("admins unlock accounts", func(t *testing.T) {
+		target := "/api/admin/users/" + userID + "/unlock"
+		expectStatus(t, serveAuthenticated(handleAdminUser, http.MethodPost, target, organizerToken, nil), http.StatusForbidden)
+
+		rec := serveAuthenticated(handleAdminUser, http.MethodPost, target, adminToken, nil)
+		expectStatus(t, rec, http.StatusOK)
+		var resp struct {
+			WasLocked bool `json:"was_locked"`
+			Failures  int  `json:"failures"`
+		}
+		decodeBody(t, rec, &resp)
+		if !resp.WasLocked || resp.Failures != 5 {
+			t.Fatalf("expected a cleared lockout of 5 failures, got %+v", resp)
+		}
+
+		expectStatus(t, login(email, testPassword), http.StatusOK)
+	})
+
+	t.Run("resetting the password unlocks the account", func(t *testing.T) {
+		lock(t)
+		expectStatus(t, login(email, testPassword), http.StatusTooManyRequests)
+
+		expectStatus(t, servePublic(handleForgotPassword, http.MethodPost, "/api/forgot-password", ForgotPasswordRequest{Email: email}), http.StatusOK)
+		reset := ResetPasswordRequest{Token: box.lastToken(t, email), Password: "Changed123"}
+		expectStatus(t, servePublic(handleResetPassword, http.MethodPost, "/api/reset-password", reset), http.StatusOK)
+
+		expectStatus(t, login(email, "Changed123"), http.StatusOK)
+	})
+
+	t.Run("unknown accounts lock without mail", func(t *testing.T) {
+		for i := 0; i < loginLockout.AccountThreshold; i++ {
+			guess(t, "ghost@example.com")
+		}
+
+		expectStatus(t, login("ghost@example.com", "Wrong1234"), http.StatusTooManyRequests)
+		if sent := box.to("ghost@example.com"); len(sent) != 0 {
+			t.Fatalf("expected no mail, got %+v", sent)
+		}
+	})
+}
+
+func TestConcurrentLoginFailures(t *testing.T) {
+	store := newTestStore(t)
+	useLockoutPolicy(t, LoginLockoutPolicy{AccountThreshold: 5, IPThreshold: 20, Duration: 15 * time.Minute})
+	newTestUser(t, store, "target@example.com", roleAttendee)
+
+	const guesses = 20
+	var wg sync.WaitGroup
+	codes := make(chan int, guesses)
+	for i := 0; i < guesses; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- login("target@example.com", "Wrong1234").Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	counts := map[int]int{}
+	for code := range codes {
+		counts[code]++
+	}
+
+	// Only the free failure and the one after it are checked; the rest
+	// arrive during the backoff the second one started
+	if counts[http.StatusUnauthorized] != 2 || counts[http.StatusTooManyRequests] != guesses-2 {
+		t.Fatalf("expected 2 checked guesses and %d throttled, got %v", guesses-2, counts)
+	}
+	if failures := loginFailures(store, accountThrottleKey("target@example.com")); failures != 2 {
+		t.Fatalf("expected 2 failures counted, got %d", failures)
+	}
+}
+
+func TestIPLockout(t *testing.T) {
+	store := newTestStore(t)
+	useLockoutPolicy(t, LoginLockoutPolicy{AccountThreshold: 5, IPThreshold: 3, Duration: 15 * time.Minute})
+	newTestUser(t, store, "victim@example.com", roleAttendee)
+
+	const attacker = "198.51.100.7"
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		expectStatus(t, loginFrom(email, "Wrong1234", attacker), http.StatusUnauthorized)
+		ageLoginFailures(store, ipThrottleKey(attacker), time.Minute)
+	}
+
+	rec := loginFrom("victim@example.com", testPassword, attacker)
+	expectStatus(t, rec, http.StatusTooManyRequests)
+	if !strings.Contains(rec.Body.String(), "from your network") {
+		t.Fatalf("expected a network lockout, got %s", rec.Body.String())
+	}
+
+	// The refused attempt is not held against the account
+	if failures := loginFailures(store, accountThrottleKey("victim@example.com")); failures != 0 {
+		t.Fatalf("expected no failures on the account, got %d", failures)
+	}
+
+	expectStatus(t, loginFrom("victim@example.com", testPassword, "203.0.113.9"), http.StatusOK)
+}
+
+func TestGetClientIP(t *testing.T) {
+	previous := trustedProxies
+	t.Cleanup(func() { trustedProxies = previous })
+
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8, 192.0.2.1")
+	var err error
+	trustedProxies, err = trustedProxiesFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		realIP     string
+		want       string
+	}{
+		{"direct client", "198.51.100.7:5000", "", "", "198.51.100.7"},
+		{"forged header from a client", "198.51.100.7:5000", "203.0.113.9", "203.0.113.9", "198.51.100.7"},
+		{"one trusted proxy", "192.0.2.1:4000", "203.0.113.9", "", "203.0.113.9"},
+		{"forged hop before the proxy", "192.0.2.1:4000", "1.2.3.4, 203.0.113.9", "", "203.0.113.9"},
+		{"chain of trusted proxies", "192.0.2.1:4000", "203.0.113.9, 10.1.2.3", "", "203.0.113.9"},
+		{"garbage hop", "192.0.2.1:4000", "203.0.113.9, not-an-ip", "", "192.0.2.1"},
+		{"real IP header", "10.4.4.4:80", "", "203.0.113.9", "203.0.113.9"},
+		{"bad real IP header", "10.4.4.4:80", "", "unknown", "10.4.4.4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/login", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-Ip", tt.realIP)
+			}
+
+			if got := getClientIP(req); got != tt.want {
+				t.Fatalf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/33")
+	if _, err := trustedProxiesFromEnv(); err == nil {
+		t.Fatal("expected an invalid entry to be refused")
+	}
+}
+
+func TestReleasedAttemptKeepsFailureTime(t *testing.T) {
+	store := newTestStore(t)
+	useLockoutPolicy(t, LoginLockoutPolicy{AccountThreshold: 5, IPThreshold: 20, Duration: 15 * time.Minute})
+
+	const email = "regular@example.com"
+	newTestUser(t, store, email, roleAttendee)
+	address := ipThrottleKey("192.0.2.1")
+
+	t.Run("signing in does not keep old failures in the window", func(t *testing.T) {
+		expectStatus(t, login(email, "Wrong1234"), http.StatusUnauthorized)
+		ageLoginFailures(store, address, loginFailureWindow-time.Minute)
+
+		expectStatus(t, login(email, testPassword), http.StatusOK)
+		ageLoginFailures(store, address, 2*time.Minute)
+
+		// The old failure has left the window, so counting starts over
+		expectStatus(t, login(email, "Wrong1234"), http.StatusUnauthorized)
+		if failures := loginFailures(store, address); failures != 1 {
+			t.Fatalf("expected the address's count to start over, got %d", failures)
+		}
+	})
+
+	t.Run("a failure since the attempt keeps its time", func(t *testing.T) {
+		key := accountThrottleKey("parallel@example.com")
+
+		succeeded, err := store.ReserveLoginAttempt(key, 20, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		failed, err := store.ReserveLoginAttempt(key, 20, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.ReleaseLoginAttempt(key, succeeded); err != nil {
+			t.Fatal(err)
+		}
+
+		store.mu.Lock()
+		throttle := *store.loginThrottles[key]
+		store.mu.Unlock()
+		if throttle.Failures != 1 || throttle.LastFailureAt != failed.Throttle.LastFailureAt {
+			t.Fatalf("expected the later failure to stand, got %+v", throttle)
+		}
+	})
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// mailer sends account emails, initialized in setup
+var mailer Mailer
+
+// MailMessage is a plain-text email
+type MailMessage struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers emails. MAIL_SENDER picks the implementation: "log"
+// prints messages to stdout and "smtp" hands them to an SMTP server, such
+// as a local sink like MailHog or Mailpit during development.
+type Mailer interface {
+	Send(msg MailMessage) error
+}
+
+// LogMailer prints each message instead of sending it
+type LogMailer struct{}
+
+// Send prints the message to stdout
+func (LogMailer) Send(msg MailMessage) error {
+	fmt.Printf("Mail to %s: %s\n%s\n", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// SMTPMailer sends messages through an SMTP server, authenticating only
+// when a username is configured
+type SMTPMailer struct {
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+// Send delivers the message over SMTP
+func (m *SMTPMailer) Send(msg MailMessage) error {
+	host, _, err := net.SplitHostPort(m.Addr)
+	if err != nil {
+		return err
+	}
+
+	// The envelope sender is the bare address from MAIL_FROM
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+
+	return smtp.SendMail(m.Addr, auth, from.Address, []string{msg.To}, m.format(msg))
+}
+
+func (m *SMTPMailer) format(msg MailMessage) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", m.From)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// newMailerFromEnv builds the mail sender selected by MAIL_SENDER
+func newMailerFromEnv() (Mailer, error) {
+	switch sender := os.Getenv("MAIL_SENDER"); sender {
+	case "", "log":
+		return LogMailer{}, nil
+	case "smtp":
+		host := os.Getenv("SMTP_HOST")
+		if host == "" {
+			host = "localhost"
+		}
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "1025"
+		}
+		from := os.Getenv("MAIL_FROM")
+		if from == "" {
+			from = "GoTicket <no-reply@goticket.local>"
+		}
+		if _, err := mail.ParseAddress(from); err != nil {
+			return nil, fmt.Errorf("invalid MAIL_FROM: %w", err)
+		}
+
+		return &SMTPMailer{
+			Addr:     net.JoinHostPort(host, port),
+			From:     from,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown MAIL_SENDER %q (use log or smtp)", sender)
+	}
+}
@@ -3,8 +3,10 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"os"
 	"strings"
@@ -58,6 +60,13 @@ type Event struct {
 	Status      string  `json:"status"`
 	CreatedAt   string  `json:"created_at"`
 	UpdatedAt   string  `json:"updated_at"`
+
+	// WaitlistEnabled lets registrations beyond capacity join a waitlist
+	WaitlistEnabled bool `json:"waitlist_enabled"`
+
+	// RefundPolicy sets how much a cancellation refunds; nil refunds in full
+	// until the event starts
+	RefundPolicy *RefundPolicy `json:"refund_policy,omitempty"`
 }
 
 // Registration represents a user's registration for an event
@@ -69,6 +78,30 @@ type Registration struct {
 	Status           string `json:"status"`
 	Notes            string `json:"notes"`
 	CreatedAt        string `json:"created_at"`
+	WaitlistPosition *int   `json:"waitlist_position,omitempty"`
+	TierID           string `json:"tier_id,omitempty"`
+	Quantity         int    `json:"quantity"`
+
+	// Attendees optionally names the person for each seat, in ticket order
+	Attendees []Attendee `json:"attendees,omitempty"`
+
+	// Promo code applied to the order and the amount it took off
+	PromoCodeID string  `json:"promo_code_id,omitempty"`
+	Discount    float64 `json:"discount,omitempty"`
+}
+
+// Attendee names the person a seat is booked for
+type Attendee struct {
+	Name  string `json:"name"`
+	Email string `json:"email,omitempty"`
+}
+
+// Seats returns the number of seats a registration takes, at least one
+func (r *Registration) Seats() int {
+	if r.Quantity < 1 {
+		return 1
+	}
+	return r.Quantity
 }
 
 // RegisterRequest represents registration input
@@ -90,17 +123,38 @@ type CreateEventRequest struct {
 	Price       float64 `json:"price"`
 	Capacity    *int    `json:"capacity"`
 	ImageURL    string  `json:"image_url"`
+
+	WaitlistEnabled bool          `json:"waitlist_enabled"`
+	RefundPolicy    *RefundPolicy `json:"refund_policy,omitempty"`
+
+	// Tiers optionally creates ticket tiers along with the event
+	Tiers []TierRequest `json:"tiers,omitempty"`
 }
 
 // EventRegistrationRequest represents event registration input
 type EventRegistrationRequest struct {
 	EventID string `json:"event_id"`
 	Notes   string `json:"notes"`
+	TierID  string `json:"tier_id"`
+
+	// Quantity books several seats in one order (default 1, or one per attendee)
+	Quantity  int        `json:"quantity"`
+	Attendees []Attendee `json:"attendees"`
+
+	// PromoCode optionally applies one of the event's discount codes
+	PromoCode string `json:"promo_code"`
+
+	// Billing optionally names the buyer on the invoice of a paid order
+	Billing *BillingDetails `json:"billing"`
 }
 
 // CancelRegistrationRequest represents a registration cancellation input
 type CancelRegistrationRequest struct {
 	RegistrationID string `json:"registration_id"`
+
+	// ExpectedRefund optionally guards against the refund changing between
+	// the quote and the cancellation
+	ExpectedRefund *float64 `json:"expected_refund,omitempty"`
 }
 
 // ErrorResponse represents an error response
@@ -124,14 +178,18 @@ type EventWithRegistrations struct {
 
 // RegistrationWithEvent represents a registration joined with event data
 type RegistrationWithEvent struct {
-	ID               string `json:"id"`
-	EventID          string `json:"event_id"`
-	UserID           string `json:"user_id"`
-	RegistrationDate string `json:"registration_date"`
-	Status           string `json:"status"`
-	Notes            string `json:"notes"`
-	CreatedAt        string `json:"created_at"`
-	Event            Event  `json:"events"`
+	ID               string     `json:"id"`
+	EventID          string     `json:"event_id"`
+	UserID           string     `json:"user_id"`
+	RegistrationDate string     `json:"registration_date"`
+	Status           string     `json:"status"`
+	Notes            string     `json:"notes"`
+	CreatedAt        string     `json:"created_at"`
+	WaitlistPosition *int       `json:"waitlist_position,omitempty"`
+	TierID           string     `json:"tier_id,omitempty"`
+	Quantity         int        `json:"quantity"`
+	Attendees        []Attendee `json:"attendees,omitempty"`
+	Event            Event      `json:"events"`
 }
 
 // RateLimiter implements simple rate limiting
@@ -182,40 +240,167 @@ func (rl *RateLimiter) IsAllowed(ip string) bool {
 
 // Global instances
 var (
-	supabaseClient *SupabaseClient
-	rateLimiter    *RateLimiter
+	supabaseClient    *SupabaseClient
+	rateLimiter       *RateLimiter
+	reservationLedger *ReservationLedger
+	jwtIssuer         *JWTIssuer
+
+	// supabaseVerifier validates Supabase access tokens locally when configured
+	supabaseVerifier   *SupabaseTokenVerifier
+	authRemoteFallback bool
+
+	// trustedProxies are the networks whose X-Forwarded-For and X-Real-Ip
+	// headers name the client, from TRUSTED_PROXIES
+	trustedProxies []*net.IPNet
 )
 
-func init() {
+// setup loads configuration and initializes the store and the shared
+// services. It panics on invalid configuration.
+func setup() {
 	// Load .env file (ignore error if file doesn't exist)
 	_ = godotenv.Load()
 
-	// Initialize Supabase client
-	supabaseURL := os.Getenv("SUPABASE_URL")
-	supabaseKey := os.Getenv("SUPABASE_ANON_KEY")
-	supabaseServiceRoleKey := os.Getenv("SUPABASE_SERVICE_ROLE_KEY")
+	// Initialize storage backend (Supabase unless STORAGE_BACKEND=memory)
+	store, err := newStoreFromEnv()
+	if err != nil {
+		panic(err)
+	}
+	setStore(store)
 
-	if supabaseURL == "" || supabaseKey == "" {
-		panic("SUPABASE_URL and SUPABASE_ANON_KEY environment variables must be set")
+	// Initialize access token issuer
+	jwtIssuer, err = newJWTIssuerFromEnv()
+	if err != nil {
+		panic(err)
 	}
 
-	supabaseClient = NewSupabaseClient(supabaseURL, supabaseKey, supabaseServiceRoleKey)
+	// Initialize local verification of Supabase access tokens
+	supabaseVerifier, authRemoteFallback, err = newSupabaseVerifierFromEnv()
+	if err != nil {
+		panic(err)
+	}
+
+	// Initialize ticket payload signing
+	ticketSigner, ticketVerifier, err = newTicketSignerFromEnv()
+	if err != nil {
+		panic(err)
+	}
+
+	// Initialize the reverse proxies whose forwarding headers are believed
+	trustedProxies, err = trustedProxiesFromEnv()
+	if err != nil {
+		panic(err)
+	}
 
 	// Initialize rate limiter: 100 requests per hour
 	rateLimiter = NewRateLimiter(100, time.Hour)
+
+	// Initialize reservation ledger used to serialize capacity checks
+	reservationLedger = NewReservationLedger()
+
+	// Initialize cache of account roles loaded on authentication
+	accountRoles = NewRoleCache(roleCacheTTL)
+
+	// Initialize cache of rendered ticket QR codes
+	ticketQRCache = NewQRCache(qrCacheEntries)
+
+	// Initialize the payment provider for paid events
+	paymentProvider, err = newPaymentProviderFromEnv()
+	if err != nil {
+		panic(err)
+	}
+
+	// Configure how long seat holds last during checkout
+	seatHoldTTL, err = seatHoldTTLFromEnv()
+	if err != nil {
+		panic(err)
+	}
+
+	// Configure the GST rate printed on invoices
+	gstRate, err = gstRateFromEnv()
+	if err != nil {
+		panic(err)
+	}
+
+	// Configure platform fees and organizer payouts
+	platformFeePercent, err = platformFeeFromEnv()
+	if err != nil {
+		panic(err)
+	}
+
+	settlementDelay, payoutMinimum, err = settlementFromEnv()
+	if err != nil {
+		panic(err)
+	}
+
+	// Initialize the mail sender for password reset and verification emails,
+	// limited to 5 emails of each kind per address per hour
+	mailer, err = newMailerFromEnv()
+	if err != nil {
+		panic(err)
+	}
+	appURL = appURLFromEnv()
+	accountMailLimiter = NewRateLimiter(5, time.Hour)
+
+	// Initialize how long refresh tokens, and so idle sessions, last
+	refreshTokenTTL, err = refreshTokenTTLFromEnv()
+	if err != nil {
+		panic(err)
+	}
+
+	// Initialize when repeated failed logins lock an account or IP address
+	loginLockout, err = loginLockoutFromEnv()
+	if err != nil {
+		panic(err)
+	}
 }
 
 func main() {
+	setup()
+
 	// Setup routes
 	router := http.NewServeMux()
 	router.HandleFunc("/", enableCORS(handleHome))
 	router.HandleFunc("/api/register", enableCORS(rateLimit(handleRegister)))
 	router.HandleFunc("/api/login", enableCORS(rateLimit(handleLogin)))
 	router.HandleFunc("/api/profile", enableCORS(authenticate(handleProfile)))
+	router.HandleFunc("/api/login/2fa", enableCORS(rateLimit(handleLoginTwoFactor)))
+	router.HandleFunc("/api/2fa", enableCORS(authenticate(handleTwoFactor)))
+	router.HandleFunc("/api/2fa/enroll", enableCORS(authenticate(handleTwoFactorEnroll)))
+	router.HandleFunc("/api/2fa/confirm", enableCORS(authenticate(handleTwoFactorConfirm)))
+	router.HandleFunc("/api/token/refresh", enableCORS(rateLimit(handleRefreshToken)))
+	router.HandleFunc("/api/sessions", enableCORS(authenticate(handleSessions)))
+	router.HandleFunc("/api/sessions/", enableCORS(authenticate(handleSessionDetail)))
+	router.HandleFunc("/api/password/forgot", enableCORS(rateLimit(handleForgotPassword)))
+	router.HandleFunc("/api/password/reset", enableCORS(rateLimit(handleResetPassword)))
+	router.HandleFunc("/api/email/verify", enableCORS(rateLimit(handleVerifyEmail)))
+	router.HandleFunc("/api/email/verify/resend", enableCORS(rateLimit(handleResendVerification)))
 	router.HandleFunc("/api/events", enableCORS(handleEvents))
 	router.HandleFunc("/api/events/", enableCORS(handleEventDetail))
 	router.HandleFunc("/api/registrations", enableCORS(authenticate(handleRegistrations)))
 	router.HandleFunc("/api/registrations/cancel", enableCORS(authenticate(handleCancelRegistration)))
+	router.HandleFunc("/api/tickets", enableCORS(authenticate(handleTickets)))
+	router.HandleFunc("/api/tickets/", enableCORS(authenticate(handleTicketDetail)))
+	router.HandleFunc("/api/ticket-keys", enableCORS(handleTicketKeys))
+	router.HandleFunc("/api/holds", enableCORS(authenticate(handleHolds)))
+	router.HandleFunc("/api/holds/", enableCORS(authenticate(handleHoldDetail)))
+	router.HandleFunc("/api/payments/webhook", handlePaymentWebhook)
+	router.HandleFunc("/api/payments/mock/authorize", enableCORS(authenticate(handleMockAuthorize)))
+	router.HandleFunc("/api/invoices", enableCORS(authenticate(handleInvoices)))
+	router.HandleFunc("/api/invoices/", enableCORS(authenticate(handleInvoiceDetail)))
+	router.HandleFunc("/api/organizer/tax-profile", enableCORS(authenticate(requirePermission(permOrganizerTools, handleTaxProfile))))
+	router.HandleFunc("/api/organizer/balance", enableCORS(authenticate(requirePermission(permOrganizerTools, handleOrganizerBalance))))
+	router.HandleFunc("/api/organizer/ledger", enableCORS(authenticate(requirePermission(permOrganizerTools, handleOrganizerLedger))))
+	router.HandleFunc("/api/organizer/payouts", enableCORS(authenticate(requirePermission(permOrganizerTools, handleOrganizerPayouts))))
+	router.HandleFunc("/api/organizer/api-keys", enableCORS(authenticate(requirePermission(permOrganizerTools, handleAPIKeys))))
+	router.HandleFunc("/api/organizer/api-keys/", enableCORS(authenticate(requirePermission(permOrganizerTools, handleAPIKeyDetail))))
+	router.HandleFunc("/api/admin/users/", enableCORS(authenticate(requirePermission(permManageRoles, handleAdminUser))))
+	router.HandleFunc("/api/admin/settings/two-factor", enableCORS(authenticate(requirePermission(permManageSecurity, handleTwoFactorPolicy))))
+
+	// Release expired seat holds in the background
+	go runHoldSweeper(holdSweepInterval)
+
+	// Settle organizer balances into payouts in the background
+	go runSettlement(settlementInterval)
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -223,7 +408,11 @@ func main() {
 	}
 
 	fmt.Printf("Server starting on port %s\n", port)
-	fmt.Printf("Supabase URL: %s\n", supabaseClient.URL)
+	if supabaseClient != nil {
+		fmt.Printf("Supabase URL: %s\n", supabaseClient.URL)
+	} else {
+		fmt.Printf("Storage backend: in-memory (data is not persisted)\n")
+	}
 
 	if err := http.ListenAndServe(":"+port, router); err != nil {
 		panic(err)
@@ -274,9 +463,36 @@ func authenticate(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		// Store token in context for handler use
-		r.Header.Set("X-User-Token", token)
-		next(w, r)
+		var info *AuthInfo
+		var err error
+		if strings.HasPrefix(token, apiKeyPrefix) {
+			info, err = resolveAPIKey(token)
+		} else {
+			info, err = resolveToken(token)
+		}
+		if err != nil {
+			sendError(w, http.StatusUnauthorized, "Unauthorized", "Invalid or expired token")
+			return
+		}
+		if info.APIKey != nil && !authorizeAPIKey(w, r, info.APIKey) {
+			return
+		}
+		if info.SessionID != "" {
+			if err := checkSession(info.SessionID, getClientIP(r)); err != nil {
+				sendError(w, http.StatusUnauthorized, "Unauthorized", "Your session has ended; sign in again")
+				return
+			}
+		}
+
+		// The role comes from the caller's profile rather than the token,
+		// so promotions and demotions apply right away
+		info.Role = loadRole(info.UserID)
+		if info.APIKey == nil && !enforceTwoFactor(w, r, info) {
+			return
+		}
+
+		// Store the caller's identity in the request context for handler use
+		next(w, withAuth(r, info))
 	}
 }
 
@@ -290,14 +506,77 @@ func handleHome(w http.ResponseWriter, r *http.Request) {
 			{"path": "/api/register", "method": "POST", "description": "User registration"},
 			{"path": "/api/login", "method": "POST", "description": "User authentication"},
 			{"path": "/api/profile", "method": "GET", "description": "User profile (protected)"},
+			{"path": "/api/login/2fa", "method": "POST", "description": "Finish signing in with a two-factor or recovery code"},
+			{"path": "/api/2fa", "method": "GET", "description": "Two-factor authentication status (protected)"},
+			{"path": "/api/2fa", "method": "DELETE", "description": "Turn off two-factor authentication with a code (protected)"},
+			{"path": "/api/2fa/enroll", "method": "POST", "description": "Start TOTP enrollment: otpauth URI and recovery codes (protected)"},
+			{"path": "/api/2fa/confirm", "method": "POST", "description": "Confirm the first code to turn on two-factor authentication (protected)"},
+			{"path": "/api/token/refresh", "method": "POST", "description": "Exchange a refresh token for a new token pair"},
+			{"path": "/api/sessions", "method": "GET", "description": "List your active sessions (protected)"},
+			{"path": "/api/sessions", "method": "DELETE", "description": "Log out everywhere; ?others=true keeps this session (protected)"},
+			{"path": "/api/sessions/{id}", "method": "DELETE", "description": "Sign out one session (protected)"},
+			{"path": "/api/password/forgot", "method": "POST", "description": "Email a password reset link"},
+			{"path": "/api/password/reset", "method": "POST", "description": "Set a new password with a reset token"},
+			{"path": "/api/email/verify", "method": "POST", "description": "Confirm an email address with a verification token"},
+			{"path": "/api/email/verify/resend", "method": "POST", "description": "Email a new verification link"},
+			{"path": "/api/admin/users/{id}/role", "method": "GET", "description": "Get an account's role (protected, admin only)"},
+			{"path": "/api/admin/users/{id}/role", "method": "PUT", "description": "Promote or demote an account (protected, admin only)"},
+			{"path": "/api/admin/users/{id}/unlock", "method": "POST", "description": "Clear an account's failed logins and lockout (protected, admin only)"},
+			{"path": "/api/admin/settings/two-factor", "method": "GET", "description": "Whether organizers must use two-factor authentication (protected, admin only)"},
+			{"path": "/api/admin/settings/two-factor", "method": "PUT", "description": "Require two-factor authentication for organizers (protected, admin only)"},
 			{"path": "/api/events", "method": "GET", "description": "List all active events"},
-			{"path": "/api/events", "method": "POST", "description": "Create a new event (protected)"},
+			{"path": "/api/events", "method": "POST", "description": "Create a new event (protected, organizer or admin)"},
 			{"path": "/api/events/{id}", "method": "GET", "description": "Get event details"},
-			{"path": "/api/events/{id}", "method": "PUT", "description": "Update event (protected, organizer only)"},
-			{"path": "/api/events/{id}", "method": "DELETE", "description": "Cancel event (protected, organizer only)"},
+			{"path": "/api/events/{id}", "method": "PUT", "description": "Update event (protected, owner, co-organizer or admin)"},
+			{"path": "/api/events/{id}", "method": "DELETE", "description": "Cancel event (protected, owner or admin)"},
+			{"path": "/api/events/{id}/waitlist", "method": "GET", "description": "List the event waitlist (protected, event team)"},
+			{"path": "/api/events/{id}/waitlist", "method": "PUT", "description": "Reorder the event waitlist (protected, owner or co-organizer)"},
+			{"path": "/api/events/{id}/registrations", "method": "GET", "description": "List the event's registrations, ?status= (protected, event team)"},
+			{"path": "/api/events/{id}/tiers", "method": "GET", "description": "List ticket tiers with availability"},
+			{"path": "/api/events/{id}/tiers", "method": "POST", "description": "Add a ticket tier (protected, owner or co-organizer)"},
+			{"path": "/api/events/{id}/tiers", "method": "PUT", "description": "Update a ticket tier (protected, owner or co-organizer)"},
+			{"path": "/api/events/{id}/tiers", "method": "DELETE", "description": "Delete an unsold ticket tier (protected, owner or co-organizer)"},
+			{"path": "/api/events/{id}/promo-codes", "method": "GET", "description": "List promo codes with redemptions (protected, event team)"},
+			{"path": "/api/events/{id}/promo-codes", "method": "POST", "description": "Create a promo code (protected, owner or co-organizer)"},
+			{"path": "/api/events/{id}/promo-codes", "method": "DELETE", "description": "Deactivate a promo code (protected, owner or co-organizer)"},
+			{"path": "/api/events/{id}/checkin", "method": "POST", "description": "Check in a ticket by payload or ticket number (protected, owner, co-organizer or check-in staff)"},
+			{"path": "/api/events/{id}/staff", "method": "GET", "description": "List check-in staff (protected, owner or co-organizer)"},
+			{"path": "/api/events/{id}/staff", "method": "POST", "description": "Add check-in staff (protected, owner or co-organizer)"},
+			{"path": "/api/events/{id}/staff", "method": "DELETE", "description": "Remove check-in staff (protected, owner or co-organizer)"},
+			{"path": "/api/events/{id}/members", "method": "GET", "description": "List the event team and your role on it (protected, event team)"},
+			{"path": "/api/events/{id}/members", "method": "POST", "description": "Invite a co-organizer, check-in staff or viewer (protected, owner or co-organizer)"},
+			{"path": "/api/events/{id}/members?user_id=", "method": "DELETE", "description": "Remove a team member (protected, owner or co-organizer)"},
+			{"path": "/api/events/{id}/manifest", "method": "GET", "description": "Download the ticket manifest for offline scanning (protected, owner, co-organizer or check-in staff)"},
+			{"path": "/api/events/{id}/sync", "method": "POST", "description": "Upload offline check-ins and get conflicts back (protected, owner, co-organizer or check-in staff)"},
 			{"path": "/api/registrations", "method": "GET", "description": "List user registrations (protected)"},
-			{"path": "/api/registrations", "method": "POST", "description": "Register for an event (protected)"},
-			{"path": "/api/registrations/cancel", "method": "POST", "description": "Cancel a registration (protected)"},
+			{"path": "/api/registrations", "method": "POST", "description": "Register for an event, one or more seats (protected)"},
+			{"path": "/api/registrations/cancel?registration_id=", "method": "GET", "description": "Preview the refund for cancelling a registration (protected)"},
+			{"path": "/api/registrations/cancel", "method": "POST", "description": "Cancel a registration and refund it per the event's policy (protected)"},
+			{"path": "/api/holds", "method": "GET", "description": "List active seat holds (protected)"},
+			{"path": "/api/holds", "method": "POST", "description": "Hold seats during checkout (protected)"},
+			{"path": "/api/holds/{id}", "method": "GET", "description": "Get a seat hold (protected, holder only)"},
+			{"path": "/api/holds/{id}", "method": "DELETE", "description": "Release a seat hold (protected, holder only)"},
+			{"path": "/api/holds/{id}/confirm", "method": "POST", "description": "Confirm a seat hold into a registration (protected, holder only)"},
+			{"path": "/api/holds/{id}/payment", "method": "POST", "description": "Start the payment for a paid seat hold (protected, holder only)"},
+			{"path": "/api/payments/mock/authorize", "method": "POST", "description": "Authorize a test card against a mock payment (protected, mock provider only)"},
+			{"path": "/api/payments/webhook", "method": "POST", "description": "Signed payment provider notifications"},
+			{"path": "/api/invoices", "method": "GET", "description": "List your GST invoices, or an organizer's with ?role=organizer (protected)"},
+			{"path": "/api/invoices?registration_id=", "method": "GET", "description": "Get the invoice for a paid registration (protected, buyer or organizer)"},
+			{"path": "/api/invoices/{id}", "method": "GET", "description": "Get an invoice as JSON (protected, buyer or organizer)"},
+			{"path": "/api/invoices/{id}/pdf", "method": "GET", "description": "Download an invoice as PDF (protected, buyer or organizer)"},
+			{"path": "/api/organizer/tax-profile", "method": "GET", "description": "Get your GST registration details (protected, organizer account)"},
+			{"path": "/api/organizer/tax-profile", "method": "PUT", "description": "Set the GST registration details invoices are issued under (protected, organizer account)"},
+			{"path": "/api/organizer/balance", "method": "GET", "description": "What the platform owes you from ticket sales (protected, organizer account)"},
+			{"path": "/api/organizer/ledger", "method": "GET", "description": "List your ledger entries (protected, organizer account, ?event_id=&from=&to=&limit=&offset=)"},
+			{"path": "/api/organizer/payouts", "method": "GET", "description": "List your payouts (protected, organizer account)"},
+			{"path": "/api/organizer/api-keys", "method": "GET", "description": "List your API keys (protected, organizer account)"},
+			{"path": "/api/organizer/api-keys", "method": "POST", "description": "Create a scoped API key, shown once (protected, organizer account)"},
+			{"path": "/api/organizer/api-keys/{id}", "method": "DELETE", "description": "Revoke an API key (protected, organizer account)"},
+			{"path": "/api/tickets", "method": "GET", "description": "List user tickets (protected)"},
+			{"path": "/api/tickets/{id}", "method": "GET", "description": "Get ticket details (protected, holder only)"},
+			{"path": "/api/tickets/{id}/payload", "method": "GET", "description": "Get the signed ticket verification payload (protected, holder only)"},
+			{"path": "/api/tickets/{id}/qr", "method": "GET", "description": "Get the ticket QR code as PNG or SVG (protected, holder only)"},
+			{"path": "/api/ticket-keys", "method": "GET", "description": "Public keys for offline ticket verification"},
 		},
 	})
 }
@@ -321,7 +600,7 @@ func handleRegister(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if user exists
-	exists, err := checkUserExists(req.Email)
+	exists, err := userStore.UserExists(req.Email)
 	if err != nil {
 		sendError(w, http.StatusInternalServerError, "Server error", "Unable to verify user")
 		return
@@ -333,7 +612,7 @@ func handleRegister(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create user in Supabase
-	user, _, err := createSupabaseUser(req)
+	user, _, err := userStore.CreateUser(req)
 	if err != nil {
 		fmt.Printf("Supabase error: %v\n", err)
 		sendError(w, http.StatusInternalServerError, "Registration failed", "Unable to create user account")
@@ -344,25 +623,29 @@ func handleRegister(w http.ResponseWriter, r *http.Request) {
 	fmt.Printf("User created successfully: %s\n", user.ID)
 
 	// Create profile using service role key (bypasses RLS)
-	err = createUserProfile(user.ID, req.FullName, req.PhoneNumber, req.Email)
+	err = userStore.CreateProfile(user.ID, req.FullName, req.PhoneNumber, req.Email)
 	if err != nil {
 		fmt.Printf("Profile creation error: %v\n", err)
 	} else {
 		fmt.Printf("Profile created successfully for user: %s\n", user.ID)
 	}
 
-	// Generate JWT token
-	token, err := generateJWT(user.ID)
+	// Ask the user to confirm their email address
+	if err := sendVerificationEmail(req.Email); err != nil {
+		fmt.Printf("Error sending verification email: %v\n", err)
+	}
+
+	// Start a session with an access/refresh token pair
+	response, err := startSession(r, user)
 	if err != nil {
+		fmt.Printf("Error starting session: %v\n", err)
 		sendError(w, http.StatusInternalServerError, "Token error", "Failed to generate authentication token")
 		return
 	}
 
-	sendJSON(w, http.StatusOK, map[string]interface{}{
-		"user":    user,
-		"token":   token,
-		"message": "Registration successful",
-	})
+	response["user"] = user
+	response["message"] = "Registration successful"
+	sendJSON(w, http.StatusOK, response)
 }
 
 func handleLogin(w http.ResponseWriter, r *http.Request) {
@@ -386,25 +669,70 @@ func handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Accounts and IP addresses with repeated failures back off, then lock
+	attempt, ok := beginLoginAttempt(w, req.Email, getClientIP(r))
+	if !ok {
+		return
+	}
+
 	// Authenticate with Supabase
-	user, token, err := authenticateSupabaseUser(req.Email, req.Password)
+	user, _, err := userStore.Authenticate(req.Email, req.Password)
 	if err != nil {
+		attempt.failed()
 		sendError(w, http.StatusUnauthorized, "Invalid credentials", "Email or password is incorrect")
 		return
 	}
 
-	// Generate JWT token
-	token, err = generateJWT(user.ID)
+	// The password was right, so this was not a failed login; the account's
+	// count is only cleared once any second factor checks out
+	attempt.release()
+
+	// Accounts with two-factor authentication finish at /api/login/2fa
+	enabled, err := twoFactorEnabled(user.ID)
+	if err != nil {
+		fmt.Printf("Error fetching two-factor settings: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to sign in")
+		return
+	}
+	if enabled {
+		challenge, err := issueTwoFactorChallenge(user.ID)
+		if err != nil {
+			sendError(w, http.StatusInternalServerError, "Token error", "Failed to generate sign-in challenge")
+			return
+		}
+
+		sendJSON(w, http.StatusOK, map[string]interface{}{
+			"two_factor_required": true,
+			"challenge_token":     challenge,
+			"expires_in":          int(twoFactorChallengeTTL.Seconds()),
+			"message":             "Enter the code from your authenticator app",
+		})
+		return
+	}
+
+	clearLoginFailures(req.Email)
+
+	// Start a session with an access/refresh token pair
+	response, err := startSession(r, user)
 	if err != nil {
+		fmt.Printf("Error starting session: %v\n", err)
 		sendError(w, http.StatusInternalServerError, "Token error", "Failed to generate authentication token")
 		return
 	}
 
-	sendJSON(w, http.StatusOK, map[string]interface{}{
-		"user":    user,
-		"token":   token,
-		"message": "Login successful",
-	})
+	// Organizers who must use two-factor authentication enroll before
+	// anything else
+	setupRequired, err := twoFactorSetupRequired(user.ID, loadRole(user.ID))
+	if err != nil {
+		fmt.Printf("Error checking two-factor enrollment: %v\n", err)
+	}
+	if setupRequired {
+		response["two_factor_setup_required"] = true
+	}
+
+	response["user"] = user
+	response["message"] = "Login successful"
+	sendJSON(w, http.StatusOK, response)
 }
 
 func handleProfile(w http.ResponseWriter, r *http.Request) {
@@ -413,20 +741,46 @@ func handleProfile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token := r.Header.Get("X-User-Token")
+	auth := authFromRequest(r)
 
-	// Get user from Supabase
-	user, err := getUserFromSupabase(token)
+	// Supabase tokens can be resolved directly; our own tokens only carry the user ID
+	var user *User
+	var err error
+	if auth.SupabaseToken != "" {
+		user, err = userStore.GetUser(auth.SupabaseToken)
+	} else {
+		user, err = userStore.GetUserByID(auth.UserID)
+	}
 	if err != nil {
 		sendError(w, http.StatusUnauthorized, "Invalid token", "Unable to verify user")
 		return
 	}
 
+	// Report the role in effect, which comes from the profile
+	user.AccountType = auth.Role
+
 	sendJSON(w, http.StatusOK, user)
 }
 
 // Helper functions
 
+// validatePassword checks a new password is long and varied enough
+func validatePassword(password string) error {
+	if password == "" {
+		return fmt.Errorf("password is required")
+	}
+
+	if len(password) < 8 {
+		return fmt.Errorf("password must be at least 8 characters")
+	}
+
+	if !isStrongPassword(password) {
+		return fmt.Errorf("password must contain uppercase, lowercase, and number")
+	}
+
+	return nil
+}
+
 func validateRegistrationInput(req RegisterRequest) error {
 	if req.Email == "" {
 		return fmt.Errorf("email is required")
@@ -436,16 +790,8 @@ func validateRegistrationInput(req RegisterRequest) error {
 		return fmt.Errorf("invalid email format")
 	}
 
-	if req.Password == "" {
-		return fmt.Errorf("password is required")
-	}
-
-	if len(req.Password) < 8 {
-		return fmt.Errorf("password must be at least 8 characters")
-	}
-
-	if !isStrongPassword(req.Password) {
-		return fmt.Errorf("password must contain uppercase, lowercase, and number")
+	if err := validatePassword(req.Password); err != nil {
+		return err
 	}
 
 	if req.FullName == "" {
@@ -502,18 +848,19 @@ func isStrongPassword(password string) bool {
 	return hasUpper && hasLower && hasNumber
 }
 
-func checkUserExists(email string) (bool, error) {
-	url := fmt.Sprintf("%s/auth/v1/admin/users?email=%s", supabaseClient.URL, email)
+// UserExists reports whether an auth user with the given email exists
+func (c *SupabaseClient) UserExists(email string) (bool, error) {
+	url := fmt.Sprintf("%s/auth/v1/admin/users?email=%s", c.URL, email)
 
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return false, err
 	}
 
-	req.Header.Set("apikey", supabaseClient.AnonKey)
-	req.Header.Set("Authorization", "Bearer "+supabaseClient.AnonKey)
+	req.Header.Set("apikey", c.AnonKey)
+	req.Header.Set("Authorization", "Bearer "+c.AnonKey)
 
-	resp, err := supabaseClient.Client.Do(req)
+	resp, err := c.Client.Do(req)
 	if err != nil {
 		return false, err
 	}
@@ -522,8 +869,9 @@ func checkUserExists(email string) (bool, error) {
 	return resp.StatusCode == http.StatusOK, nil
 }
 
-func createSupabaseUser(req RegisterRequest) (*User, string, error) {
-	url := fmt.Sprintf("%s/auth/v1/signup", supabaseClient.URL)
+// CreateUser signs up a new user with Supabase Auth
+func (c *SupabaseClient) CreateUser(req RegisterRequest) (*User, string, error) {
+	url := fmt.Sprintf("%s/auth/v1/signup", c.URL)
 
 	payload := map[string]interface{}{
 		"email":    req.Email,
@@ -548,10 +896,10 @@ func createSupabaseUser(req RegisterRequest) (*User, string, error) {
 	}
 
 	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("apikey", supabaseClient.AnonKey)
-	httpReq.Header.Set("Authorization", "Bearer "+supabaseClient.AnonKey)
+	httpReq.Header.Set("apikey", c.AnonKey)
+	httpReq.Header.Set("Authorization", "Bearer "+c.AnonKey)
 
-	resp, err := supabaseClient.Client.Do(httpReq)
+	resp, err := c.Client.Do(httpReq)
 	if err != nil {
 		return nil, "", err
 	}
@@ -596,8 +944,9 @@ func createSupabaseUser(req RegisterRequest) (*User, string, error) {
 	}, result.AccessToken, nil
 }
 
-func authenticateSupabaseUser(email, password string) (*User, string, error) {
-	url := fmt.Sprintf("%s/auth/v1/token?grant_type=password", supabaseClient.URL)
+// Authenticate signs a user in with email and password
+func (c *SupabaseClient) Authenticate(email, password string) (*User, string, error) {
+	url := fmt.Sprintf("%s/auth/v1/token?grant_type=password", c.URL)
 
 	payload := map[string]string{
 		"email":    email,
@@ -615,10 +964,10 @@ func authenticateSupabaseUser(email, password string) (*User, string, error) {
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("apikey", supabaseClient.AnonKey)
-	req.Header.Set("Authorization", "Bearer "+supabaseClient.AnonKey)
+	req.Header.Set("apikey", c.AnonKey)
+	req.Header.Set("Authorization", "Bearer "+c.AnonKey)
 
-	resp, err := supabaseClient.Client.Do(req)
+	resp, err := c.Client.Do(req)
 	if err != nil {
 		return nil, "", err
 	}
@@ -661,18 +1010,19 @@ func authenticateSupabaseUser(email, password string) (*User, string, error) {
 	}, result.AccessToken, nil
 }
 
-func getUserFromSupabase(token string) (*User, error) {
-	url := fmt.Sprintf("%s/auth/v1/user", supabaseClient.URL)
+// GetUser fetches the user that owns the given access token
+func (c *SupabaseClient) GetUser(token string) (*User, error) {
+	url := fmt.Sprintf("%s/auth/v1/user", c.URL)
 
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Set("apikey", supabaseClient.AnonKey)
+	req.Header.Set("apikey", c.AnonKey)
 	req.Header.Set("Authorization", "Bearer "+token)
 
-	resp, err := supabaseClient.Client.Do(req)
+	resp, err := c.Client.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -690,27 +1040,96 @@ func getUserFromSupabase(token string) (*User, error) {
 	return &user, nil
 }
 
-func generateJWT(userID string) (string, error) {
-	// In production, use a proper JWT library like golang-jwt/jwt
-	// For now, return a simple token
-	return fmt.Sprintf("jwt-token-%s-%d", userID, time.Now().Unix()), nil
+// accountTypeOrDefault returns the role to put in issued tokens
+func accountTypeOrDefault(accountType string) string {
+	if accountType == "" {
+		return "attendee"
+	}
+	return accountType
 }
 
+// getClientIP returns the caller's IP address. Forwarding headers can be
+// set by anyone, so they are only believed from TRUSTED_PROXIES; the
+// client is then the last X-Forwarded-For hop that is not a proxy.
 func getClientIP(r *http.Request) string {
-	// Check X-Forwarded-For header (for proxies)
-	xff := r.Header.Get("X-Forwarded-For")
-	if xff != "" {
-		return strings.Split(xff, ",")[0]
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		ip = host
+	}
+	if !isTrustedProxy(ip) {
+		return ip
+	}
+
+	// Check X-Forwarded-For header, walking back from the nearest proxy
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		hops := strings.Split(xff, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if net.ParseIP(hop) == nil {
+				break
+			}
+			ip = hop
+			if !isTrustedProxy(hop) {
+				break
+			}
+		}
+		return ip
 	}
 
 	// Check X-Real-Ip header
-	xri := r.Header.Get("X-Real-Ip")
-	if xri != "" {
+	if xri := strings.TrimSpace(r.Header.Get("X-Real-Ip")); net.ParseIP(xri) != nil {
 		return xri
 	}
 
-	// Fall back to RemoteAddr
-	return strings.Split(r.RemoteAddr, ":")[0]
+	return ip
+}
+
+// isTrustedProxy reports whether ip is one of the TRUSTED_PROXIES
+func isTrustedProxy(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+
+	for _, network := range trustedProxies {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// trustedProxiesFromEnv reads TRUSTED_PROXIES, a comma-separated list of
+// the IP addresses or CIDR ranges of reverse proxies in front of the API
+func trustedProxiesFromEnv() ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, entry := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid TRUSTED_PROXIES entry %q", entry)
+			}
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TRUSTED_PROXIES entry %q", entry)
+		}
+		networks = append(networks, network)
+	}
+
+	return networks, nil
 }
 
 func sendJSON(w http.ResponseWriter, status int, data interface{}) {
@@ -727,8 +1146,9 @@ func sendError(w http.ResponseWriter, status int, error, message string) {
 	})
 }
 
-func createUserProfile(userID, fullName, phoneNumber, email string) error {
-	url := fmt.Sprintf("%s/rest/v1/profiles?id=eq.%s", supabaseClient.URL, userID)
+// CreateProfile inserts the profile row for a new user using the service role key
+func (c *SupabaseClient) CreateProfile(userID, fullName, phoneNumber, email string) error {
+	url := fmt.Sprintf("%s/rest/v1/profiles?id=eq.%s", c.URL, userID)
 
 	payload := map[string]interface{}{
 		"id":           userID,
@@ -749,11 +1169,11 @@ func createUserProfile(userID, fullName, phoneNumber, email string) error {
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("apikey", supabaseClient.ServiceRoleKey)
-	req.Header.Set("Authorization", "Bearer "+supabaseClient.ServiceRoleKey)
+	req.Header.Set("apikey", c.ServiceRoleKey)
+	req.Header.Set("Authorization", "Bearer "+c.ServiceRoleKey)
 	req.Header.Set("Prefer", "return=minimal")
 
-	resp, err := supabaseClient.Client.Do(req)
+	resp, err := c.Client.Do(req)
 	if err != nil {
 		return err
 	}
@@ -815,15 +1235,8 @@ func handleEvents(w http.ResponseWriter, r *http.Request) {
 	case http.MethodGet:
 		handleListEvents(w, r)
 	case http.MethodPost:
-		// POST requires authentication
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			sendError(w, http.StatusUnauthorized, "Unauthorized", "Authorization header required")
-			return
-		}
-		token := strings.TrimPrefix(authHeader, "Bearer ")
-		r.Header.Set("X-User-Token", token)
-		handleCreateEvent(w, r)
+		// POST requires authentication and an organizer account
+		authenticate(requirePermission(permCreateEvents, handleCreateEvent))(w, r)
 	default:
 		sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "Only GET and POST methods are allowed")
 	}
@@ -834,7 +1247,7 @@ func handleListEvents(w http.ResponseWriter, r *http.Request) {
 	category := r.URL.Query().Get("category")
 	search := r.URL.Query().Get("search")
 
-	events, err := getEvents(category, search)
+	events, err := eventStore.GetEvents(category, search)
 	if err != nil {
 		fmt.Printf("Error fetching events: %v\n", err)
 		sendError(w, http.StatusInternalServerError, "Server error", "Unable to fetch events")
@@ -848,7 +1261,7 @@ func handleListEvents(w http.ResponseWriter, r *http.Request) {
 }
 
 func handleCreateEvent(w http.ResponseWriter, r *http.Request) {
-	token := r.Header.Get("X-User-Token")
+	auth := authFromRequest(r)
 
 	var req CreateEventRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -865,109 +1278,187 @@ func handleCreateEvent(w http.ResponseWriter, r *http.Request) {
 		sendError(w, http.StatusBadRequest, "Validation error", "Event date is required")
 		return
 	}
-
-	// Get user ID from token
-	userID, err := getUserIDFromToken(token)
-	if err != nil {
-		sendError(w, http.StatusUnauthorized, "Unauthorized", "Invalid or expired token")
-		return
+	for _, tier := range req.Tiers {
+		if err := validateTierRequest(tier); err != nil {
+			sendError(w, http.StatusBadRequest, "Validation error", err.Error())
+			return
+		}
+	}
+	if req.RefundPolicy != nil {
+		if err := validateRefundPolicy(req.RefundPolicy); err != nil {
+			sendError(w, http.StatusBadRequest, "Validation error", err.Error())
+			return
+		}
 	}
 
 	// Create event
-	event, err := createEvent(token, userID, req)
+	event, err := eventStore.CreateEvent(auth.SupabaseToken, auth.UserID, req)
 	if err != nil {
 		fmt.Printf("Error creating event: %v\n", err)
 		sendError(w, http.StatusInternalServerError, "Server error", "Unable to create event")
 		return
 	}
 
+	// Create ticket tiers; an event without all of its tiers is cancelled
+	// rather than left on sale with the wrong choices
+	tiers := []TicketTier{}
+	for _, tierReq := range req.Tiers {
+		tier, err := tierStore.CreateTier(newTierFromRequest(event.ID, tierReq))
+		if err != nil {
+			fmt.Printf("Error creating tier: %v\n", err)
+			if err := eventStore.DeleteEvent(auth.SupabaseToken, event.ID); err != nil {
+				fmt.Printf("Error cancelling event without tiers: %v\n", err)
+			}
+			sendError(w, http.StatusInternalServerError, "Server error", "Unable to create ticket tiers")
+			return
+		}
+		tiers = append(tiers, *tier)
+	}
+
 	sendJSON(w, http.StatusCreated, map[string]interface{}{
 		"event":   event,
+		"tiers":   tiers,
 		"message": "Event created successfully",
 	})
 }
 
 func handleEventDetail(w http.ResponseWriter, r *http.Request) {
-	// Extract event ID from URL path: /api/events/{id}
+	// Extract event ID from URL path: /api/events/{id} or /api/events/{id}/{resource}
 	path := strings.TrimPrefix(r.URL.Path, "/api/events/")
-	eventID := strings.TrimSpace(path)
+	eventID, resource, _ := strings.Cut(strings.TrimSpace(path), "/")
 
 	if eventID == "" {
 		sendError(w, http.StatusBadRequest, "Invalid request", "Event ID is required")
 		return
 	}
 
+	// Sub-resources of an event
+	switch resource {
+	case "":
+	case "waitlist":
+		authenticate(func(w http.ResponseWriter, r *http.Request) {
+			handleEventWaitlist(w, r, eventID)
+		})(w, r)
+		return
+	case "checkin":
+		authenticate(func(w http.ResponseWriter, r *http.Request) {
+			handleEventCheckin(w, r, eventID)
+		})(w, r)
+		return
+	case "staff":
+		authenticate(func(w http.ResponseWriter, r *http.Request) {
+			handleEventStaff(w, r, eventID)
+		})(w, r)
+		return
+	case "members":
+		authenticate(func(w http.ResponseWriter, r *http.Request) {
+			handleEventMembers(w, r, eventID)
+		})(w, r)
+		return
+	case "registrations":
+		authenticate(func(w http.ResponseWriter, r *http.Request) {
+			handleEventRegistrations(w, r, eventID)
+		})(w, r)
+		return
+	case "tiers":
+		handleEventTiers(w, r, eventID)
+		return
+	case "promo-codes":
+		authenticate(func(w http.ResponseWriter, r *http.Request) {
+			handleEventPromoCodes(w, r, eventID)
+		})(w, r)
+		return
+	case "manifest":
+		authenticate(func(w http.ResponseWriter, r *http.Request) {
+			handleEventManifest(w, r, eventID)
+		})(w, r)
+		return
+	case "sync":
+		authenticate(func(w http.ResponseWriter, r *http.Request) {
+			handleEventSync(w, r, eventID)
+		})(w, r)
+		return
+	default:
+		sendError(w, http.StatusNotFound, "Not found", "Unknown event resource")
+		return
+	}
+
 	switch r.Method {
 	case http.MethodGet:
 		handleGetEvent(w, r, eventID)
 	case http.MethodPut:
 		// PUT requires authentication
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			sendError(w, http.StatusUnauthorized, "Unauthorized", "Authorization header required")
-			return
-		}
-		token := strings.TrimPrefix(authHeader, "Bearer ")
-		r.Header.Set("X-User-Token", token)
-		handleUpdateEvent(w, r, eventID)
+		authenticate(func(w http.ResponseWriter, r *http.Request) {
+			handleUpdateEvent(w, r, eventID)
+		})(w, r)
 	case http.MethodDelete:
 		// DELETE requires authentication
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			sendError(w, http.StatusUnauthorized, "Unauthorized", "Authorization header required")
-			return
-		}
-		token := strings.TrimPrefix(authHeader, "Bearer ")
-		r.Header.Set("X-User-Token", token)
-		handleDeleteEvent(w, r, eventID)
+		authenticate(func(w http.ResponseWriter, r *http.Request) {
+			handleDeleteEvent(w, r, eventID)
+		})(w, r)
 	default:
 		sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "Only GET, PUT, and DELETE methods are allowed")
 	}
 }
 
 func handleGetEvent(w http.ResponseWriter, r *http.Request, eventID string) {
-	event, err := getEventByID(eventID)
+	event, count, err := getEventWithCount(eventID)
 	if err != nil {
 		fmt.Printf("Error fetching event: %v\n", err)
 		sendError(w, http.StatusNotFound, "Not found", "Event not found")
 		return
 	}
 
-	// Get registration count for this event
-	count, err := getEventRegistrationCount(eventID)
+	tiers, err := getTierAvailability(eventID)
 	if err != nil {
-		fmt.Printf("Error fetching registration count: %v\n", err)
-		count = 0
+		fmt.Printf("Error fetching tiers: %v\n", err)
+		tiers = []TierAvailability{}
 	}
 
 	sendJSON(w, http.StatusOK, map[string]interface{}{
 		"event":              event,
 		"registration_count": count,
+		"tiers":              tiers,
 	})
 }
 
-func handleUpdateEvent(w http.ResponseWriter, r *http.Request, eventID string) {
-	token := r.Header.Get("X-User-Token")
+// getEventWithCount fetches an event and its registration count, treating
+// a failed count as zero
+func getEventWithCount(eventID string) (*Event, int, error) {
+	event, err := eventStore.GetEventByID(eventID)
+	if err != nil {
+		return nil, 0, err
+	}
 
-	// Get user ID from token
-	userID, err := getUserIDFromToken(token)
+	// Get registration count for this event
+	count, err := registrationStore.GetEventRegistrationCount(eventID)
 	if err != nil {
-		sendError(w, http.StatusUnauthorized, "Unauthorized", "Invalid or expired token")
-		return
+		fmt.Printf("Error fetching registration count: %v\n", err)
+		count = 0
 	}
 
-	// Verify the user is the organizer
-	existingEvent, err := getEventByID(eventID)
+	return event, count, nil
+}
+
+func handleUpdateEvent(w http.ResponseWriter, r *http.Request, eventID string) {
+	auth := authFromRequest(r)
+
+	// Verify the user is the organizer, a co-organizer or an admin
+	existingEvent, err := eventStore.GetEventByID(eventID)
 	if err != nil {
 		sendError(w, http.StatusNotFound, "Not found", "Event not found")
 		return
 	}
 
-	if existingEvent.OrganizerID != userID {
-		sendError(w, http.StatusForbidden, "Forbidden", "Only the event organizer can update this event")
+	if !authorizeEvent(w, auth, existingEvent, eventManage, "Only the event organizer can update this event") {
 		return
 	}
 
+	token := eventWriteToken(existingEvent, auth)
+	if existingEvent.OrganizerID != auth.UserID {
+		fmt.Printf("User %s is updating event %s of organizer %s\n", auth.UserID, eventID, existingEvent.OrganizerID)
+	}
+
 	var updateData map[string]interface{}
 	if err := json.NewDecoder(r.Body).Decode(&updateData); err != nil {
 		sendError(w, http.StatusBadRequest, "Invalid request", "Invalid JSON format")
@@ -982,7 +1473,14 @@ func handleUpdateEvent(w http.ResponseWriter, r *http.Request, eventID string) {
 	delete(updateData, "organizer_id")
 	delete(updateData, "created_at")
 
-	err = updateEvent(token, eventID, updateData)
+	if policy, ok := updateData["refund_policy"]; ok {
+		if err := refundPolicyFromUpdate(policy); err != nil {
+			sendError(w, http.StatusBadRequest, "Validation error", err.Error())
+			return
+		}
+	}
+
+	err = eventStore.UpdateEvent(token, eventID, updateData)
 	if err != nil {
 		fmt.Printf("Error updating event: %v\n", err)
 		sendError(w, http.StatusInternalServerError, "Server error", "Unable to update event")
@@ -990,7 +1488,7 @@ func handleUpdateEvent(w http.ResponseWriter, r *http.Request, eventID string) {
 	}
 
 	// Fetch updated event
-	updatedEvent, _ := getEventByID(eventID)
+	updatedEvent, _ := eventStore.GetEventByID(eventID)
 
 	sendJSON(w, http.StatusOK, map[string]interface{}{
 		"event":   updatedEvent,
@@ -999,28 +1497,25 @@ func handleUpdateEvent(w http.ResponseWriter, r *http.Request, eventID string) {
 }
 
 func handleDeleteEvent(w http.ResponseWriter, r *http.Request, eventID string) {
-	token := r.Header.Get("X-User-Token")
+	auth := authFromRequest(r)
 
-	// Get user ID from token
-	userID, err := getUserIDFromToken(token)
+	// Only the owner, or an admin, may cancel an event
+	existingEvent, err := eventStore.GetEventByID(eventID)
 	if err != nil {
-		sendError(w, http.StatusUnauthorized, "Unauthorized", "Invalid or expired token")
+		sendError(w, http.StatusNotFound, "Not found", "Event not found")
 		return
 	}
 
-	// Verify the user is the organizer
-	existingEvent, err := getEventByID(eventID)
-	if err != nil {
-		sendError(w, http.StatusNotFound, "Not found", "Event not found")
+	if !authorizeEvent(w, auth, existingEvent, eventCancel, "Only the event organizer can cancel this event") {
 		return
 	}
 
-	if existingEvent.OrganizerID != userID {
-		sendError(w, http.StatusForbidden, "Forbidden", "Only the event organizer can cancel this event")
-		return
+	token := eventWriteToken(existingEvent, auth)
+	if existingEvent.OrganizerID != auth.UserID {
+		fmt.Printf("Admin %s is cancelling event %s of organizer %s\n", auth.UserID, eventID, existingEvent.OrganizerID)
 	}
 
-	err = deleteEvent(token, eventID)
+	err = eventStore.DeleteEvent(token, eventID)
 	if err != nil {
 		fmt.Printf("Error cancelling event: %v\n", err)
 		sendError(w, http.StatusInternalServerError, "Server error", "Unable to cancel event")
@@ -1037,32 +1532,66 @@ func handleDeleteEvent(w http.ResponseWriter, r *http.Request, eventID string) {
 // =====================================================
 
 func handleRegistrations(w http.ResponseWriter, r *http.Request) {
-	token := r.Header.Get("X-User-Token")
-
 	switch r.Method {
 	case http.MethodGet:
-		handleListRegistrations(w, r, token)
+		handleListRegistrations(w, r)
 	case http.MethodPost:
-		handleCreateRegistration(w, r, token)
+		handleCreateRegistration(w, r)
 	default:
 		sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "Only GET and POST methods are allowed")
 	}
 }
 
-func handleListRegistrations(w http.ResponseWriter, r *http.Request, token string) {
-	// Get user ID from token
-	userID, err := getUserIDFromToken(token)
+func handleListRegistrations(w http.ResponseWriter, r *http.Request) {
+	auth := authFromRequest(r)
+
+	// Optional status filter
+	status := r.URL.Query().Get("status")
+
+	registrations, err := registrationStore.GetUserRegistrations(auth.SupabaseToken, auth.UserID, status)
 	if err != nil {
-		sendError(w, http.StatusUnauthorized, "Unauthorized", "Invalid or expired token")
+		fmt.Printf("Error fetching registrations: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to fetch registrations")
+		return
+	}
+
+	sendJSON(w, http.StatusOK, map[string]interface{}{
+		"registrations": registrations,
+		"count":         len(registrations),
+	})
+}
+
+// handleEventRegistrations lists an event's registrations for its team,
+// optionally filtered by ?status=
+func handleEventRegistrations(w http.ResponseWriter, r *http.Request, eventID string) {
+	if r.Method != http.MethodGet {
+		sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "Only GET method is allowed")
+		return
+	}
+
+	auth := authFromRequest(r)
+
+	event, err := eventStore.GetEventByID(eventID)
+	if err != nil {
+		sendError(w, http.StatusNotFound, "Not found", "Event not found")
+		return
+	}
+
+	if !authorizeEvent(w, auth, event, eventView, "Only the event's team can see its registrations") {
 		return
 	}
 
-	// Optional status filter
 	status := r.URL.Query().Get("status")
+	switch status {
+	case "", "pending", "confirmed", "waitlisted", "cancelled":
+	default:
+		sendError(w, http.StatusBadRequest, "Validation error", "status must be pending, confirmed, waitlisted or cancelled")
+		return
+	}
 
-	registrations, err := getUserRegistrations(token, userID, status)
+	registrations, err := registrationStore.GetEventRegistrations(eventID, status)
 	if err != nil {
-		fmt.Printf("Error fetching registrations: %v\n", err)
+		fmt.Printf("Error fetching event registrations: %v\n", err)
 		sendError(w, http.StatusInternalServerError, "Server error", "Unable to fetch registrations")
 		return
 	}
@@ -1073,7 +1602,65 @@ func handleListRegistrations(w http.ResponseWriter, r *http.Request, token strin
 	})
 }
 
-func handleCreateRegistration(w http.ResponseWriter, r *http.Request, token string) {
+// maxSeatsPerOrder caps the seats booked or held in a single order
+const maxSeatsPerOrder = 10
+
+// orderSeats returns the number of seats an order books: quantity, or one
+// per named attendee when quantity is omitted
+func orderSeats(quantity int, attendees []Attendee) (int, error) {
+	if quantity == 0 {
+		quantity = len(attendees)
+	}
+	if quantity == 0 {
+		quantity = 1
+	}
+
+	if quantity < 1 || quantity > maxSeatsPerOrder {
+		return 0, fmt.Errorf("quantity must be between 1 and %d", maxSeatsPerOrder)
+	}
+
+	if err := validateAttendees(attendees, quantity); err != nil {
+		return 0, err
+	}
+
+	return quantity, nil
+}
+
+// validateAttendees checks optional attendee details: when given, there
+// must be one per seat, each with a name and a valid email if present
+func validateAttendees(attendees []Attendee, seats int) error {
+	if len(attendees) == 0 {
+		return nil
+	}
+	if len(attendees) != seats {
+		return fmt.Errorf("attendees must list one person per seat (%d)", seats)
+	}
+
+	for i := range attendees {
+		attendees[i].Name = strings.TrimSpace(attendees[i].Name)
+		attendees[i].Email = strings.TrimSpace(attendees[i].Email)
+		if attendees[i].Name == "" {
+			return fmt.Errorf("attendee %d needs a name", i+1)
+		}
+		if attendees[i].Email != "" && !isValidEmail(attendees[i].Email) {
+			return fmt.Errorf("attendee %d has an invalid email", i+1)
+		}
+	}
+
+	return nil
+}
+
+// attendeesOrEmpty stores a missing attendee list as an empty one
+func attendeesOrEmpty(attendees []Attendee) []Attendee {
+	if attendees == nil {
+		return []Attendee{}
+	}
+	return attendees
+}
+
+func handleCreateRegistration(w http.ResponseWriter, r *http.Request) {
+	auth := authFromRequest(r)
+
 	var req EventRegistrationRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		sendError(w, http.StatusBadRequest, "Invalid request", "Invalid JSON format")
@@ -1085,15 +1672,18 @@ func handleCreateRegistration(w http.ResponseWriter, r *http.Request, token stri
 		return
 	}
 
-	// Get user ID from token
-	userID, err := getUserIDFromToken(token)
+	seats, err := orderSeats(req.Quantity, req.Attendees)
 	if err != nil {
-		sendError(w, http.StatusUnauthorized, "Unauthorized", "Invalid or expired token")
+		sendError(w, http.StatusBadRequest, "Validation error", err.Error())
+		return
+	}
+	if err := validateBilling(req.Billing); err != nil {
+		sendError(w, http.StatusBadRequest, "Validation error", err.Error())
 		return
 	}
 
 	// Check if event exists and is active
-	event, err := getEventByID(req.EventID)
+	event, err := eventStore.GetEventByID(req.EventID)
 	if err != nil {
 		sendError(w, http.StatusNotFound, "Not found", "Event not found")
 		return
@@ -1104,22 +1694,98 @@ func handleCreateRegistration(w http.ResponseWriter, r *http.Request, token stri
 		return
 	}
 
-	// Check capacity
-	if event.Capacity != nil {
-		count, err := getEventRegistrationCount(req.EventID)
-		if err != nil {
-			fmt.Printf("Error checking registration count: %v\n", err)
-		} else if count >= *event.Capacity {
-			sendError(w, http.StatusConflict, "Event full", "This event has reached its maximum capacity")
+	// Events with ticket tiers sell each seat from a tier
+	tiers, err := tierStore.GetEventTiers(req.EventID)
+	if err != nil {
+		fmt.Printf("Error fetching tiers: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to fetch ticket tiers")
+		return
+	}
+
+	tier, err := selectTier(tiers, req.TierID)
+	if err != nil {
+		sendError(w, http.StatusBadRequest, "Validation error", err.Error())
+		return
+	}
+	if tier != nil {
+		if err := checkTierOrder(tier, seats, time.Now()); err != nil {
+			sendError(w, http.StatusConflict, "Tier unavailable", err.Error())
+			return
+		}
+	}
+
+	newRegistration := Registration{
+		EventID:   req.EventID,
+		UserID:    auth.UserID,
+		Notes:     req.Notes,
+		Quantity:  seats,
+		Attendees: req.Attendees,
+	}
+	if tier != nil {
+		newRegistration.TierID = tier.ID
+	}
+
+	var promo *PromoCode
+	if req.PromoCode != "" {
+		if promo, err = orderPromoCode(req.EventID, req.PromoCode, tier, time.Now()); err != nil {
+			sendPromoError(w, err)
 			return
 		}
+		newRegistration.PromoCodeID = promo.ID
+		newRegistration.Discount = promoDiscount(promo, orderAmount(event, newRegistration.TierID, seats))
+	}
+
+	// Paid orders hold the seats and are only confirmed once payment succeeds
+	if amount := orderTotal(event, newRegistration.TierID, seats, newRegistration.Discount); amount > 0 {
+		handlePaidRegistration(w, auth, newRegistration, event, tier, promo, req.Billing, amount)
+		return
+	}
+
+	// Events with a waitlist queue registrations beyond capacity instead of rejecting them
+	var joinWaitlist func() (*Registration, error)
+	if event.WaitlistEnabled {
+		joinWaitlist = func() (*Registration, error) {
+			if err := ensurePromoAvailable(promo, auth.UserID); err != nil {
+				return nil, err
+			}
+			return registrationStore.AddToWaitlist(auth.SupabaseToken, newRegistration)
+		}
 	}
 
-	// Create registration
-	registration, err := createRegistration(token, req.EventID, userID, req.Notes)
+	// Check capacity for every seat and create the registration as one
+	// atomic reservation, so a group is either booked in full or not at all
+	registration, err := reservationLedger.Reserve(req.EventID, event.Capacity, seats, func() (*Registration, error) {
+		if err := ensureTierHasRoom(tier, seats); err != nil {
+			return nil, err
+		}
+		if err := ensurePromoAvailable(promo, auth.UserID); err != nil {
+			return nil, err
+		}
+		return registrationStore.CreateRegistration(auth.SupabaseToken, newRegistration)
+	}, joinWaitlist)
 	if err != nil {
+		if sendPromoError(w, err) {
+			return
+		}
+		// The ledger or the database capacity trigger rejected the seat
+		if err == errEventFull || strings.Contains(err.Error(), "event_full") {
+			message := "This event has reached its maximum capacity"
+			if seats > 1 {
+				message = fmt.Sprintf("This event does not have %d seats left", seats)
+			}
+			sendError(w, http.StatusConflict, "Event full", message)
+			return
+		}
+		if err == errTierSoldOut || strings.Contains(err.Error(), "tier_sold_out") {
+			message := fmt.Sprintf("%s tickets are sold out", tier.Name)
+			if seats > 1 {
+				message = fmt.Sprintf("Not enough %s tickets are left for %d seats", tier.Name, seats)
+			}
+			sendError(w, http.StatusConflict, "Tier sold out", message)
+			return
+		}
 		// Check if it's a unique constraint violation (already registered)
-		if strings.Contains(err.Error(), "duplicate") || strings.Contains(err.Error(), "unique") || strings.Contains(err.Error(), "23505") {
+		if err == errAlreadyRegistered || strings.Contains(err.Error(), "duplicate") || strings.Contains(err.Error(), "unique") || strings.Contains(err.Error(), "23505") {
 			sendError(w, http.StatusConflict, "Already registered", "You are already registered for this event")
 			return
 		}
@@ -1128,19 +1794,83 @@ func handleCreateRegistration(w http.ResponseWriter, r *http.Request, token stri
 		return
 	}
 
+	message := "Registration successful"
+	var ticket *Ticket
+	tickets := []Ticket{}
+	if registration.Status == "waitlisted" {
+		message = fmt.Sprintf("Event is full. You are number %d on the waitlist", *registration.WaitlistPosition)
+	} else {
+		tickets = issueTicketsForRegistration(registration, event)
+		if len(tickets) > 0 {
+			ticket = &tickets[0]
+		}
+	}
+
 	sendJSON(w, http.StatusCreated, map[string]interface{}{
 		"registration": registration,
-		"message":      "Registration successful",
+		"ticket":       ticket,
+		"tickets":      tickets,
+		"message":      message,
+	})
+}
+
+// handlePaidRegistration holds the seats of a paid order and starts its
+// payment. The buyer authorizes the payment and then confirms the hold.
+func handlePaidRegistration(w http.ResponseWriter, auth *AuthInfo, registration Registration, event *Event, tier *TicketTier, promo *PromoCode, billing *BillingDetails, amount float64) {
+	if err := ensureNotRegistered(auth.SupabaseToken, auth.UserID, event.ID); err != nil {
+		if err == errAlreadyRegistered {
+			sendError(w, http.StatusConflict, "Already registered", "You are already registered for this event")
+			return
+		}
+		fmt.Printf("Error checking registrations: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to create registration")
+		return
+	}
+
+	hold, err := placeHold(SeatHold{
+		EventID:   registration.EventID,
+		UserID:    registration.UserID,
+		Quantity:  registration.Seats(),
+		Notes:     registration.Notes,
+		Attendees: registration.Attendees,
+
+		PromoCodeID: registration.PromoCodeID,
+		Discount:    registration.Discount,
+		Billing:     billing,
+	}, event, tier, promo)
+	if err != nil {
+		sendHoldError(w, err, tier)
+		return
+	}
+
+	payment, intent, err := startHoldPayment(hold, amount)
+	if err != nil {
+		fmt.Printf("Error starting payment: %v\n", err)
+		if err := holdStore.ReleaseHold(hold.ID); err != nil {
+			fmt.Printf("Error releasing hold: %v\n", err)
+		}
+		sendError(w, http.StatusBadGateway, "Payment error", "Unable to start payment")
+		return
+	}
+
+	sendJSON(w, http.StatusAccepted, map[string]interface{}{
+		"hold":    hold,
+		"payment": paymentResponse(payment, intent),
+		"message": fmt.Sprintf("Seats held until %s. Complete payment and confirm the hold to finish registering", hold.ExpiresAt),
 	})
 }
 
 func handleCancelRegistration(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		handleCancellationQuote(w, r)
+		return
+	}
 	if r.Method != http.MethodPost {
-		sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "Only POST method is allowed")
+		sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "Only GET and POST methods are allowed")
 		return
 	}
 
-	token := r.Header.Get("X-User-Token")
+	auth := authFromRequest(r)
 
 	var req CancelRegistrationRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -1153,14 +1883,79 @@ func handleCancelRegistration(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get user ID from token
-	userID, err := getUserIDFromToken(token)
+	registration, err := registrationStore.GetRegistrationByID(auth.SupabaseToken, req.RegistrationID)
+	if err != nil || registration.UserID != auth.UserID {
+		sendError(w, http.StatusNotFound, "Not found", "Registration not found")
+		return
+	}
+	if registration.Status == "cancelled" {
+		sendError(w, http.StatusConflict, "Already cancelled", "This registration has already been cancelled")
+		return
+	}
+
+	event, err := eventStore.GetEventByID(registration.EventID)
 	if err != nil {
-		sendError(w, http.StatusUnauthorized, "Unauthorized", "Invalid or expired token")
+		sendError(w, http.StatusNotFound, "Not found", "Event not found")
 		return
 	}
 
-	err = cancelRegistration(token, req.RegistrationID, userID)
+	// Cancel and hand a freed seat to the waitlist without letting new registrations interleave
+	var quote *RefundQuote
+	err = reservationLedger.WithEvent(registration.EventID, func() error {
+		var err error
+		if quote, err = quoteRefund(registration, event, time.Now()); err != nil {
+			return err
+		}
+		if req.ExpectedRefund != nil && toMinorUnits(*req.ExpectedRefund) != toMinorUnits(quote.RefundAmount) {
+			return errRefundChanged
+		}
+
+		// Return the money first so a failed refund leaves the registration intact
+		if err := refundRegistration(quote); err != nil {
+			return fmt.Errorf("%w: %v", errRefundFailed, err)
+		}
+
+		if err := registrationStore.CancelRegistration(auth.SupabaseToken, req.RegistrationID, auth.UserID); err != nil {
+			return err
+		}
+
+		for _, ticket := range quote.Tickets {
+			if ticket.RefundAmount <= 0 {
+				continue
+			}
+			if err := ticketStore.RefundTicket(ticket.TicketID, ticket.RefundAmount); err != nil {
+				return err
+			}
+		}
+		if err := ticketStore.CancelRegistrationTickets(req.RegistrationID); err != nil {
+			return err
+		}
+
+		switch registration.Status {
+		case "confirmed":
+			if err := fillFromWaitlist(registration.EventID); err != nil {
+				// The cancellation stands; the next cancellation retries the promotion
+				fmt.Printf("Error promoting from waitlist: %v\n", err)
+			}
+		case "waitlisted":
+			return registrationStore.CompactWaitlist(registration.EventID)
+		}
+		return nil
+	})
+	if errors.Is(err, errRefundChanged) {
+		sendJSON(w, http.StatusConflict, map[string]interface{}{
+			"error":   "Refund changed",
+			"message": "The refund for this registration has changed; review it and try again",
+			"code":    http.StatusConflict,
+			"refund":  quote,
+		})
+		return
+	}
+	if errors.Is(err, errRefundFailed) {
+		fmt.Printf("Error refunding registration %s: %v\n", req.RegistrationID, err)
+		sendError(w, http.StatusBadGateway, "Refund error", "Unable to refund payment; the registration was not cancelled")
+		return
+	}
 	if err != nil {
 		fmt.Printf("Error cancelling registration: %v\n", err)
 		sendError(w, http.StatusInternalServerError, "Server error", "Unable to cancel registration")
@@ -1168,6 +1963,7 @@ func handleCancelRegistration(w http.ResponseWriter, r *http.Request) {
 	}
 
 	sendJSON(w, http.StatusOK, map[string]interface{}{
+		"refund":  quote,
 		"message": "Registration cancelled successfully",
 	})
 }
@@ -1176,19 +1972,82 @@ func handleCancelRegistration(w http.ResponseWriter, r *http.Request) {
 // Supabase REST Helper Functions
 // =====================================================
 
-// getUserIDFromToken extracts the user ID from a Supabase auth token
-func getUserIDFromToken(token string) (string, error) {
-	url := fmt.Sprintf("%s/auth/v1/user", supabaseClient.URL)
+// bearer returns the token to authorize a REST call with. Requests made on
+// behalf of a Supabase session use the caller's token so RLS applies;
+// otherwise the server has already authorized the caller and uses the
+// service role key.
+func (c *SupabaseClient) bearer(token string) string {
+	if token != "" {
+		return token
+	}
+	if c.ServiceRoleKey != "" {
+		return c.ServiceRoleKey
+	}
+	return c.AnonKey
+}
+
+// GetUserByID fetches a user through the auth admin API using the service role key
+func (c *SupabaseClient) GetUserByID(userID string) (*User, error) {
+	url := fmt.Sprintf("%s/auth/v1/admin/users/%s", c.URL, userID)
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("apikey", c.ServiceRoleKey)
+	req.Header.Set("Authorization", "Bearer "+c.ServiceRoleKey)
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("failed to get user: %s", string(body))
+	}
+
+	var result struct {
+		ID        string `json:"id"`
+		Email     string `json:"email"`
+		CreatedAt string `json:"created_at"`
+		Data      struct {
+			FullName    string `json:"full_name"`
+			PhoneNumber string `json:"phone_number"`
+			Username    string `json:"username"`
+			AccountType string `json:"account_type"`
+		} `json:"user_metadata"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	return &User{
+		ID:          result.ID,
+		Email:       result.Email,
+		FullName:    result.Data.FullName,
+		PhoneNumber: result.Data.PhoneNumber,
+		Username:    result.Data.Username,
+		AccountType: result.Data.AccountType,
+		CreatedAt:   result.CreatedAt,
+	}, nil
+}
+
+// UserIDFromToken extracts the user ID from a Supabase auth token
+func (c *SupabaseClient) UserIDFromToken(token string) (string, error) {
+	url := fmt.Sprintf("%s/auth/v1/user", c.URL)
 
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return "", err
 	}
 
-	req.Header.Set("apikey", supabaseClient.AnonKey)
+	req.Header.Set("apikey", c.AnonKey)
 	req.Header.Set("Authorization", "Bearer "+token)
 
-	resp, err := supabaseClient.Client.Do(req)
+	resp, err := c.Client.Do(req)
 	if err != nil {
 		return "", err
 	}
@@ -1209,9 +2068,9 @@ func getUserIDFromToken(token string) (string, error) {
 	return result.ID, nil
 }
 
-// getEvents fetches all active events with optional filtering
-func getEvents(category, search string) ([]Event, error) {
-	queryURL := fmt.Sprintf("%s/rest/v1/events?status=eq.active&order=event_date.asc", supabaseClient.URL)
+// GetEvents fetches all active events with optional filtering
+func (c *SupabaseClient) GetEvents(category, search string) ([]Event, error) {
+	queryURL := fmt.Sprintf("%s/rest/v1/events?status=eq.active&order=event_date.asc", c.URL)
 
 	if category != "" {
 		queryURL += fmt.Sprintf("&category=eq.%s", category)
@@ -1225,10 +2084,10 @@ func getEvents(category, search string) ([]Event, error) {
 		return nil, err
 	}
 
-	req.Header.Set("apikey", supabaseClient.AnonKey)
-	req.Header.Set("Authorization", "Bearer "+supabaseClient.AnonKey)
+	req.Header.Set("apikey", c.AnonKey)
+	req.Header.Set("Authorization", "Bearer "+c.AnonKey)
 
-	resp, err := supabaseClient.Client.Do(req)
+	resp, err := c.Client.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -1251,20 +2110,20 @@ func getEvents(category, search string) ([]Event, error) {
 	return events, nil
 }
 
-// getEventByID fetches a single event by its ID
-func getEventByID(eventID string) (*Event, error) {
-	queryURL := fmt.Sprintf("%s/rest/v1/events?id=eq.%s", supabaseClient.URL, eventID)
+// GetEventByID fetches a single event by its ID
+func (c *SupabaseClient) GetEventByID(eventID string) (*Event, error) {
+	queryURL := fmt.Sprintf("%s/rest/v1/events?id=eq.%s", c.URL, eventID)
 
 	req, err := http.NewRequest("GET", queryURL, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Set("apikey", supabaseClient.AnonKey)
-	req.Header.Set("Authorization", "Bearer "+supabaseClient.AnonKey)
+	req.Header.Set("apikey", c.AnonKey)
+	req.Header.Set("Authorization", "Bearer "+c.AnonKey)
 	req.Header.Set("Accept", "application/json")
 
-	resp, err := supabaseClient.Client.Do(req)
+	resp, err := c.Client.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -1291,21 +2150,23 @@ func getEventByID(eventID string) (*Event, error) {
 	return &events[0], nil
 }
 
-// createEvent inserts a new event into Supabase
-func createEvent(token, organizerID string, req CreateEventRequest) (*Event, error) {
-	queryURL := fmt.Sprintf("%s/rest/v1/events", supabaseClient.URL)
+// CreateEvent inserts a new event into Supabase
+func (c *SupabaseClient) CreateEvent(token, organizerID string, req CreateEventRequest) (*Event, error) {
+	queryURL := fmt.Sprintf("%s/rest/v1/events", c.URL)
 
 	payload := map[string]interface{}{
-		"title":        req.Title,
-		"description":  req.Description,
-		"event_date":   req.EventDate,
-		"location":     req.Location,
-		"category":     req.Category,
-		"price":        req.Price,
-		"capacity":     req.Capacity,
-		"image_url":    req.ImageURL,
-		"organizer_id": organizerID,
-		"status":       "active",
+		"title":            req.Title,
+		"description":      req.Description,
+		"event_date":       req.EventDate,
+		"location":         req.Location,
+		"category":         req.Category,
+		"price":            req.Price,
+		"capacity":         req.Capacity,
+		"image_url":        req.ImageURL,
+		"organizer_id":     organizerID,
+		"status":           "active",
+		"waitlist_enabled": req.WaitlistEnabled,
+		"refund_policy":    req.RefundPolicy,
 	}
 
 	jsonData, err := json.Marshal(payload)
@@ -1319,11 +2180,11 @@ func createEvent(token, organizerID string, req CreateEventRequest) (*Event, err
 	}
 
 	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("apikey", supabaseClient.AnonKey)
-	httpReq.Header.Set("Authorization", "Bearer "+token)
+	httpReq.Header.Set("apikey", c.AnonKey)
+	httpReq.Header.Set("Authorization", "Bearer "+c.bearer(token))
 	httpReq.Header.Set("Prefer", "return=representation")
 
-	resp, err := supabaseClient.Client.Do(httpReq)
+	resp, err := c.Client.Do(httpReq)
 	if err != nil {
 		return nil, err
 	}
@@ -1350,9 +2211,9 @@ func createEvent(token, organizerID string, req CreateEventRequest) (*Event, err
 	return &events[0], nil
 }
 
-// updateEvent patches an existing event in Supabase
-func updateEvent(token, eventID string, data map[string]interface{}) error {
-	queryURL := fmt.Sprintf("%s/rest/v1/events?id=eq.%s", supabaseClient.URL, eventID)
+// UpdateEvent patches an existing event in Supabase
+func (c *SupabaseClient) UpdateEvent(token, eventID string, data map[string]interface{}) error {
+	queryURL := fmt.Sprintf("%s/rest/v1/events?id=eq.%s", c.URL, eventID)
 
 	jsonData, err := json.Marshal(data)
 	if err != nil {
@@ -1365,11 +2226,11 @@ func updateEvent(token, eventID string, data map[string]interface{}) error {
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("apikey", supabaseClient.AnonKey)
-	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("apikey", c.AnonKey)
+	req.Header.Set("Authorization", "Bearer "+c.bearer(token))
 	req.Header.Set("Prefer", "return=minimal")
 
-	resp, err := supabaseClient.Client.Do(req)
+	resp, err := c.Client.Do(req)
 	if err != nil {
 		return err
 	}
@@ -1383,17 +2244,17 @@ func updateEvent(token, eventID string, data map[string]interface{}) error {
 	return nil
 }
 
-// deleteEvent soft-deletes an event by setting its status to 'cancelled'
-func deleteEvent(token, eventID string) error {
-	return updateEvent(token, eventID, map[string]interface{}{
+// DeleteEvent soft-deletes an event by setting its status to 'cancelled'
+func (c *SupabaseClient) DeleteEvent(token, eventID string) error {
+	return c.UpdateEvent(token, eventID, map[string]interface{}{
 		"status":     "cancelled",
 		"updated_at": time.Now().UTC().Format(time.RFC3339),
 	})
 }
 
-// getUserRegistrations fetches all registrations for a user, joined with event data
-func getUserRegistrations(token, userID, status string) ([]RegistrationWithEvent, error) {
-	queryURL := fmt.Sprintf("%s/rest/v1/registrations?user_id=eq.%s&select=*,events(*)", supabaseClient.URL, userID)
+// GetUserRegistrations fetches all registrations for a user, joined with event data
+func (c *SupabaseClient) GetUserRegistrations(token, userID, status string) ([]RegistrationWithEvent, error) {
+	queryURL := fmt.Sprintf("%s/rest/v1/registrations?user_id=eq.%s&select=*,events(*)", c.URL, userID)
 
 	if status != "" {
 		queryURL += fmt.Sprintf("&status=eq.%s", status)
@@ -1406,10 +2267,10 @@ func getUserRegistrations(token, userID, status string) ([]RegistrationWithEvent
 		return nil, err
 	}
 
-	req.Header.Set("apikey", supabaseClient.AnonKey)
-	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("apikey", c.AnonKey)
+	req.Header.Set("Authorization", "Bearer "+c.bearer(token))
 
-	resp, err := supabaseClient.Client.Do(req)
+	resp, err := c.Client.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -1432,15 +2293,21 @@ func getUserRegistrations(token, userID, status string) ([]RegistrationWithEvent
 	return registrations, nil
 }
 
-// createRegistration inserts a new registration into Supabase
-func createRegistration(token, eventID, userID, notes string) (*Registration, error) {
-	queryURL := fmt.Sprintf("%s/rest/v1/registrations", supabaseClient.URL)
+// CreateRegistration inserts a new registration into Supabase
+func (c *SupabaseClient) CreateRegistration(token string, registration Registration) (*Registration, error) {
+	queryURL := fmt.Sprintf("%s/rest/v1/registrations", c.URL)
 
 	payload := map[string]interface{}{
-		"event_id": eventID,
-		"user_id":  userID,
-		"status":   "confirmed",
-		"notes":    notes,
+		"event_id":  registration.EventID,
+		"user_id":   registration.UserID,
+		"status":    "confirmed",
+		"notes":     registration.Notes,
+		"tier_id":   nullIfEmpty(registration.TierID),
+		"quantity":  registration.Seats(),
+		"attendees": attendeesOrEmpty(registration.Attendees),
+
+		"promo_code_id": nullIfEmpty(registration.PromoCodeID),
+		"discount":      registration.Discount,
 	}
 
 	jsonData, err := json.Marshal(payload)
@@ -1454,11 +2321,11 @@ func createRegistration(token, eventID, userID, notes string) (*Registration, er
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("apikey", supabaseClient.AnonKey)
-	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("apikey", c.AnonKey)
+	req.Header.Set("Authorization", "Bearer "+c.bearer(token))
 	req.Header.Set("Prefer", "return=representation")
 
-	resp, err := supabaseClient.Client.Do(req)
+	resp, err := c.Client.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -1485,10 +2352,10 @@ func createRegistration(token, eventID, userID, notes string) (*Registration, er
 	return &registrations[0], nil
 }
 
-// cancelRegistration sets a registration's status to 'cancelled'
-func cancelRegistration(token, registrationID, userID string) error {
+// CancelRegistration sets a registration's status to 'cancelled'
+func (c *SupabaseClient) CancelRegistration(token, registrationID, userID string) error {
 	queryURL := fmt.Sprintf("%s/rest/v1/registrations?id=eq.%s&user_id=eq.%s",
-		supabaseClient.URL, registrationID, userID)
+		c.URL, registrationID, userID)
 
 	payload := map[string]interface{}{
 		"status": "cancelled",
@@ -1505,11 +2372,11 @@ func cancelRegistration(token, registrationID, userID string) error {
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("apikey", supabaseClient.AnonKey)
-	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("apikey", c.AnonKey)
+	req.Header.Set("Authorization", "Bearer "+c.bearer(token))
 	req.Header.Set("Prefer", "return=minimal")
 
-	resp, err := supabaseClient.Client.Do(req)
+	resp, err := c.Client.Do(req)
 	if err != nil {
 		return err
 	}
@@ -1523,21 +2390,38 @@ func cancelRegistration(token, registrationID, userID string) error {
 	return nil
 }
 
-// getEventRegistrationCount returns the number of confirmed registrations for an event
-func getEventRegistrationCount(eventID string) (int, error) {
-	queryURL := fmt.Sprintf("%s/rest/v1/registrations?event_id=eq.%s&status=eq.confirmed&select=id",
-		supabaseClient.URL, eventID)
+// GetEventRegistrations lists an event's registrations, oldest first,
+// optionally only those with a status
+func (c *SupabaseClient) GetEventRegistrations(eventID, status string) ([]Registration, error) {
+	path := fmt.Sprintf("/rest/v1/registrations?event_id=eq.%s&order=created_at.asc", eventID)
+	if status != "" {
+		path += "&status=eq." + status
+	}
+
+	var registrations []Registration
+	if err := c.doREST("GET", path, "", nil, &registrations); err != nil {
+		return nil, err
+	}
+
+	return registrations, nil
+}
+
+// GetEventRegistrationCount returns the seats taken for an event: confirmed
+// registrations plus active seat holds
+func (c *SupabaseClient) GetEventRegistrationCount(eventID string) (int, error) {
+	queryURL := fmt.Sprintf("%s/rest/v1/registrations?event_id=eq.%s&status=eq.confirmed&select=id,quantity",
+		c.URL, eventID)
 
 	req, err := http.NewRequest("GET", queryURL, nil)
 	if err != nil {
 		return 0, err
 	}
 
-	req.Header.Set("apikey", supabaseClient.AnonKey)
-	req.Header.Set("Authorization", "Bearer "+supabaseClient.AnonKey)
+	req.Header.Set("apikey", c.AnonKey)
+	req.Header.Set("Authorization", "Bearer "+c.AnonKey)
 	req.Header.Set("Prefer", "count=exact")
 
-	resp, err := supabaseClient.Client.Do(req)
+	resp, err := c.Client.Do(req)
 	if err != nil {
 		return 0, err
 	}
@@ -1552,10 +2436,20 @@ func getEventRegistrationCount(eventID string) (int, error) {
 		return 0, fmt.Errorf("failed to get registration count: %s", string(body))
 	}
 
-	var registrations []map[string]interface{}
+	var registrations []Registration
 	if err := json.Unmarshal(body, &registrations); err != nil {
 		return 0, err
 	}
 
-	return len(registrations), nil
+	held, _, err := c.heldSeats(eventID)
+	if err != nil {
+		return 0, err
+	}
+
+	count := held
+	for i := range registrations {
+		count += registrations[i].Seats()
+	}
+
+	return count, nil
 }
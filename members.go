@@ -0,0 +1,492 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Event team roles. The event's organizer is always its owner; everyone
+// else is added as a member with one of the other roles.
+const (
+	memberOwner        = "owner"
+	memberCoOrganizer  = "co_organizer"
+	memberCheckinStaff = "checkin_staff"
+	memberViewer       = "viewer"
+)
+
+// Things an event's team members may do
+const (
+	eventView       = "view"
+	eventCheckIn    = "checkin"
+	eventManage     = "manage"
+	eventManageTeam = "manage_team"
+	eventCancel     = "cancel"
+)
+
+// memberCapabilities lists what each team role may do on its event
+var memberCapabilities = map[string][]string{
+	memberOwner:        {eventView, eventCheckIn, eventManage, eventManageTeam, eventCancel},
+	memberCoOrganizer:  {eventView, eventCheckIn, eventManage, eventManageTeam},
+	memberCheckinStaff: {eventView, eventCheckIn},
+	memberViewer:       {eventView},
+}
+
+// EventMember is a user on an event's team
+type EventMember struct {
+	EventID   string `json:"event_id"`
+	UserID    string `json:"user_id"`
+	Role      string `json:"role"`
+	AddedBy   string `json:"added_by,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
+
+// InviteMemberRequest adds a user to an event's team, or changes their role
+type InviteMemberRequest struct {
+	UserID string `json:"user_id"`
+	Role   string `json:"role"`
+}
+
+// eventMemberRole returns a user's role on an event's team, or "" if they
+// are not on it. Admins act as owners of every event, except through an
+// API key, which only reaches the owner's own events and teams.
+func eventMemberRole(event *Event, auth *AuthInfo) (string, error) {
+	manageAny := auth.APIKey == nil && hasPermission(auth.Role, permManageAnyEvent)
+	if event.OrganizerID == auth.UserID || manageAny {
+		return memberOwner, nil
+	}
+
+	member, err := eventMemberStore.GetEventMember(event.ID, auth.UserID)
+	if err != nil || member == nil {
+		return "", err
+	}
+
+	return member.Role, nil
+}
+
+// memberCan reports whether a team role allows an action
+func memberCan(role, action string) bool {
+	for _, allowed := range memberCapabilities[role] {
+		if allowed == action {
+			return true
+		}
+	}
+	return false
+}
+
+// authorizeEvent checks the caller may take an action on an event, writing
+// the error response when they may not
+func authorizeEvent(w http.ResponseWriter, auth *AuthInfo, event *Event, action, message string) bool {
+	role, err := eventMemberRole(event, auth)
+	if err != nil {
+		fmt.Printf("Error checking event membership: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to verify permissions")
+		return false
+	}
+
+	if !memberCan(role, action) {
+		sendError(w, http.StatusForbidden, "Forbidden", message)
+		return false
+	}
+
+	return true
+}
+
+// eventWriteToken is the token to change an event's own row with. Only the
+// organizer passes Supabase's row policies, so team members and admins
+// write with the service role once authorizeEvent has let them through.
+func eventWriteToken(event *Event, auth *AuthInfo) string {
+	if event.OrganizerID == auth.UserID {
+		return auth.SupabaseToken
+	}
+	return ""
+}
+
+// canAssignRole reports whether a team role may add or remove members with
+// another role. Co-organizers manage check-in staff and viewers; owners
+// also manage co-organizers.
+func canAssignRole(role, assigned string) bool {
+	switch assigned {
+	case memberCoOrganizer:
+		return role == memberOwner
+	case memberCheckinStaff, memberViewer:
+		return memberCan(role, eventManageTeam)
+	default:
+		return false
+	}
+}
+
+// =====================================================
+// Event Team Handlers
+// =====================================================
+
+// handleEventMembers lists, invites and removes the members of an event's team
+func handleEventMembers(w http.ResponseWriter, r *http.Request, eventID string) {
+	auth := authFromRequest(r)
+
+	event, err := eventStore.GetEventByID(eventID)
+	if err != nil {
+		sendError(w, http.StatusNotFound, "Not found", "Event not found")
+		return
+	}
+
+	role, err := eventMemberRole(event, auth)
+	if err != nil {
+		fmt.Printf("Error checking event membership: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to verify permissions")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if !memberCan(role, eventView) {
+			sendError(w, http.StatusForbidden, "Forbidden", "Only the event's team can see its members")
+			return
+		}
+
+		members, err := eventMemberStore.GetEventMembers(eventID)
+		if err != nil {
+			fmt.Printf("Error fetching event members: %v\n", err)
+			sendError(w, http.StatusInternalServerError, "Server error", "Unable to fetch members")
+			return
+		}
+
+		owner := EventMember{EventID: eventID, UserID: event.OrganizerID, Role: memberOwner, CreatedAt: event.CreatedAt}
+		members = append([]EventMember{owner}, members...)
+
+		sendJSON(w, http.StatusOK, map[string]interface{}{
+			"members": members,
+			"count":   len(members),
+			"role":    role,
+		})
+	case http.MethodPost:
+		var req InviteMemberRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			sendError(w, http.StatusBadRequest, "Invalid request", "Invalid JSON format")
+			return
+		}
+
+		member, ok := inviteEventMember(w, auth, event, role, req)
+		if !ok {
+			return
+		}
+
+		sendJSON(w, http.StatusCreated, map[string]interface{}{
+			"member":  member,
+			"message": "Member added successfully",
+		})
+	case http.MethodDelete:
+		userID := r.URL.Query().Get("user_id")
+		if userID == "" {
+			sendError(w, http.StatusBadRequest, "Validation error", "user_id query parameter is required")
+			return
+		}
+
+		if !removeEventMember(w, auth, event, role, userID, "") {
+			return
+		}
+
+		sendJSON(w, http.StatusOK, map[string]interface{}{
+			"message": "Member removed successfully",
+		})
+	default:
+		sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "Only GET, POST, and DELETE methods are allowed")
+	}
+}
+
+// inviteEventMember adds a user to an event's team or changes their role,
+// writing the error response when it cannot
+func inviteEventMember(w http.ResponseWriter, auth *AuthInfo, event *Event, role string, req InviteMemberRequest) (*EventMember, bool) {
+	req.UserID = strings.TrimSpace(req.UserID)
+	if req.UserID == "" {
+		sendError(w, http.StatusBadRequest, "Validation error", "user_id is required")
+		return nil, false
+	}
+	if req.Role != memberCoOrganizer && req.Role != memberCheckinStaff && req.Role != memberViewer {
+		sendError(w, http.StatusBadRequest, "Validation error", "role must be co_organizer, checkin_staff or viewer")
+		return nil, false
+	}
+	if req.UserID == event.OrganizerID {
+		sendError(w, http.StatusConflict, "Already a member", "The organizer already owns this event")
+		return nil, false
+	}
+
+	existing, err := eventMemberStore.GetEventMember(event.ID, req.UserID)
+	if err != nil {
+		fmt.Printf("Error checking event membership: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to add member")
+		return nil, false
+	}
+	if !canAssignRole(role, req.Role) || (existing != nil && !canAssignRole(role, existing.Role)) {
+		sendError(w, http.StatusForbidden, "Forbidden", "Your role on this event cannot assign that role")
+		return nil, false
+	}
+
+	if _, err := userStore.GetUserByID(req.UserID); err != nil {
+		sendError(w, http.StatusNotFound, "Not found", "User not found")
+		return nil, false
+	}
+
+	member, err := eventMemberStore.SaveEventMember(EventMember{
+		EventID: event.ID,
+		UserID:  req.UserID,
+		Role:    req.Role,
+		AddedBy: auth.UserID,
+	})
+	if err != nil {
+		fmt.Printf("Error adding event member: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to add member")
+		return nil, false
+	}
+
+	return member, true
+}
+
+// removeEventMember takes a user off an event's team, writing the error
+// response when it cannot. A non-empty onlyRole limits removal to members
+// with that role.
+func removeEventMember(w http.ResponseWriter, auth *AuthInfo, event *Event, role, userID, onlyRole string) bool {
+	if userID == event.OrganizerID {
+		sendError(w, http.StatusConflict, "Not allowed", "The event's owner cannot be removed")
+		return false
+	}
+
+	existing, err := eventMemberStore.GetEventMember(event.ID, userID)
+	if err != nil {
+		fmt.Printf("Error checking event membership: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to remove member")
+		return false
+	}
+	if existing == nil || (onlyRole != "" && existing.Role != onlyRole) {
+		sendError(w, http.StatusNotFound, "Not found", "Member not found")
+		return false
+	}
+
+	// Members may always leave a team themselves
+	if userID != auth.UserID && !canAssignRole(role, existing.Role) {
+		sendError(w, http.StatusForbidden, "Forbidden", "Your role on this event cannot remove that member")
+		return false
+	}
+
+	if err := eventMemberStore.RemoveEventMember(event.ID, userID); err != nil {
+		fmt.Printf("Error removing event member: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to remove member")
+		return false
+	}
+
+	return true
+}
+
+// handleEventStaff keeps the check-in staff endpoint working on top of
+// event membership; it manages members with the checkin_staff role
+func handleEventStaff(w http.ResponseWriter, r *http.Request, eventID string) {
+	auth := authFromRequest(r)
+
+	event, err := eventStore.GetEventByID(eventID)
+	if err != nil {
+		sendError(w, http.StatusNotFound, "Not found", "Event not found")
+		return
+	}
+
+	role, err := eventMemberRole(event, auth)
+	if err != nil {
+		fmt.Printf("Error checking event membership: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to verify permissions")
+		return
+	}
+	if !memberCan(role, eventManageTeam) {
+		sendError(w, http.StatusForbidden, "Forbidden", "Only the event organizer can manage check-in staff")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		members, err := eventMemberStore.GetEventMembers(eventID)
+		if err != nil {
+			fmt.Printf("Error fetching event staff: %v\n", err)
+			sendError(w, http.StatusInternalServerError, "Server error", "Unable to fetch staff")
+			return
+		}
+
+		staff := []EventMember{}
+		for _, member := range members {
+			if member.Role == memberCheckinStaff {
+				staff = append(staff, member)
+			}
+		}
+
+		sendJSON(w, http.StatusOK, map[string]interface{}{
+			"staff": staff,
+			"count": len(staff),
+		})
+	case http.MethodPost:
+		var req InviteMemberRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			sendError(w, http.StatusBadRequest, "Invalid request", "Invalid JSON format")
+			return
+		}
+		req.Role = memberCheckinStaff
+
+		staff, ok := inviteEventMember(w, auth, event, role, req)
+		if !ok {
+			return
+		}
+
+		sendJSON(w, http.StatusCreated, map[string]interface{}{
+			"staff":   staff,
+			"message": "Staff member added successfully",
+		})
+	case http.MethodDelete:
+		userID := r.URL.Query().Get("user_id")
+		if userID == "" {
+			sendError(w, http.StatusBadRequest, "Validation error", "user_id query parameter is required")
+			return
+		}
+
+		if !removeEventMember(w, auth, event, role, userID, memberCheckinStaff) {
+			return
+		}
+
+		sendJSON(w, http.StatusOK, map[string]interface{}{
+			"message": "Staff member removed successfully",
+		})
+	default:
+		sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "Only GET, POST, and DELETE methods are allowed")
+	}
+}
+
+// =====================================================
+// Supabase Event Member Functions
+// =====================================================
+
+// GetEventMembers lists an event's team, oldest first, not counting its owner
+func (c *SupabaseClient) GetEventMembers(eventID string) ([]EventMember, error) {
+	var members []EventMember
+	if err := c.doREST("GET", fmt.Sprintf("/rest/v1/event_members?event_id=eq.%s&order=created_at.asc", eventID), "", nil, &members); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// GetEventMember returns a user's membership of an event, or nil if they
+// are not on its team
+func (c *SupabaseClient) GetEventMember(eventID, userID string) (*EventMember, error) {
+	var members []EventMember
+	path := fmt.Sprintf("/rest/v1/event_members?event_id=eq.%s&user_id=eq.%s", eventID, userID)
+	if err := c.doREST("GET", path, "", nil, &members); err != nil {
+		return nil, err
+	}
+
+	if len(members) == 0 {
+		return nil, nil
+	}
+
+	return &members[0], nil
+}
+
+// SaveEventMember adds a user to an event's team, or changes their role if
+// they are already on it
+func (c *SupabaseClient) SaveEventMember(member EventMember) (*EventMember, error) {
+	var saved []EventMember
+	path := fmt.Sprintf("/rest/v1/event_members?event_id=eq.%s&user_id=eq.%s", member.EventID, member.UserID)
+	if err := c.doREST("PATCH", path, "", map[string]interface{}{"role": member.Role}, &saved); err != nil {
+		return nil, err
+	}
+
+	if len(saved) == 0 {
+		payload := map[string]interface{}{
+			"event_id": member.EventID,
+			"user_id":  member.UserID,
+			"role":     member.Role,
+			"added_by": nullIfEmpty(member.AddedBy),
+		}
+		if err := c.doREST("POST", "/rest/v1/event_members", "", payload, &saved); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(saved) == 0 {
+		return nil, fmt.Errorf("member saved but no data returned")
+	}
+
+	return &saved[0], nil
+}
+
+// RemoveEventMember takes a user off an event's team
+func (c *SupabaseClient) RemoveEventMember(eventID, userID string) error {
+	return c.doREST("DELETE", fmt.Sprintf("/rest/v1/event_members?event_id=eq.%s&user_id=eq.%s", eventID, userID), "", nil, nil)
+}
+
+// =====================================================
+// In-memory Event Member Functions
+// =====================================================
+
+func eventMemberKey(eventID, userID string) string {
+	return eventID + "/" + userID
+}
+
+// GetEventMembers lists an event's team, oldest first, not counting its owner
+func (m *MemoryStore) GetEventMembers(eventID string) ([]EventMember, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	members := []EventMember{}
+	for _, member := range m.eventMembers {
+		if member.EventID == eventID {
+			members = append(members, *member)
+		}
+	}
+
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].CreatedAt < members[j].CreatedAt
+	})
+
+	return members, nil
+}
+
+// GetEventMember returns a user's membership of an event, or nil if they
+// are not on its team
+func (m *MemoryStore) GetEventMember(eventID, userID string) (*EventMember, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	member, exists := m.eventMembers[eventMemberKey(eventID, userID)]
+	if !exists {
+		return nil, nil
+	}
+
+	found := *member
+	return &found, nil
+}
+
+// SaveEventMember adds a user to an event's team, or changes their role if
+// they are already on it
+func (m *MemoryStore) SaveEventMember(member EventMember) (*EventMember, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := eventMemberKey(member.EventID, member.UserID)
+	if existing, exists := m.eventMembers[key]; exists {
+		existing.Role = member.Role
+		saved := *existing
+		return &saved, nil
+	}
+
+	member.CreatedAt = nowTimestamp()
+	m.eventMembers[key] = &member
+
+	saved := member
+	return &saved, nil
+}
+
+// RemoveEventMember takes a user off an event's team
+func (m *MemoryStore) RemoveEventMember(eventID, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.eventMembers, eventMemberKey(eventID, userID))
+	return nil
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestMemberCapabilities(t *testing.T) {
+	actions := []string{eventView, eventCheckIn, eventManage, eventManageTeam, eventCancel}
+	allowed := map[string][]string{
+		memberOwner:        actions,
+		memberCoOrganizer:  {eventView, eventCheckIn, eventManage, eventManageTeam},
+		memberCheckinStaff: {eventView, eventCheckIn},
+		memberViewer:       {eventView},
+		"":                 {},
+	}
+
+	for role, granted := range allowed {
+		for _, action := range actions {
+			wanted := false
+			for _, a := range granted {
+				wanted = wanted || a == action
+			}
+			if memberCan(role, action) != wanted {
+				t.Errorf("%q %s: expected %v", role, action, wanted)
+			}
+		}
+	}
+
+	assignments := []struct {
+		role, assigned string
+		wanted         bool
+	}{
+		{memberOwner, memberCoOrganizer, true},
+		{memberOwner, memberViewer, true},
+		{memberOwner, memberOwner, false},
+		{memberCoOrganizer, memberCoOrganizer, false},
+		{memberCoOrganizer, memberCheckinStaff, true},
+		{memberCoOrganizer, memberViewer, true},
+		{memberCheckinStaff, memberViewer, false},
+		{memberViewer, memberViewer, false},
+	}
+	for _, tt := range assignments {
+		if canAssignRole(tt.role, tt.assigned) != tt.wanted {
+			t.Errorf("%s assigning %s: expected %v", tt.role, tt.assigned, tt.wanted)
+		}
+	}
+}
+
+func TestEventTeamPermissions(t *testing.T) {
+	store := newTestStore(t)
+	ownerID, ownerToken := newTestUser(t, store, "owner@example.com", roleOrganizer)
+	_, adminToken := newTestUser(t, store, "admin@example.com", roleAdmin)
+	coOrganizerID, coOrganizerToken := newTestUser(t, store, "co@example.com", roleOrganizer)
+	staffID, staffToken := newTestUser(t, store, "staff@example.com", roleAttendee)
+	viewerID, viewerToken := newTestUser(t, store, "viewer@example.com", roleAttendee)
+	_, outsiderToken := newTestUser(t, store, "outsider@example.com", roleOrganizer)
+
+	event := newTestEvent(t, store, ownerID, CreateEventRequest{})
+	addTestMember(t, store, event.ID, coOrganizerID, memberCoOrganizer)
+	addTestMember(t, store, event.ID, staffID, memberCheckinStaff)
+	addTestMember(t, store, event.ID, viewerID, memberViewer)
+
+	base := "/api/events/" + event.ID
+	members := []struct {
+		name  string
+		token string
+		can   []string
+	}{
+		{"owner", ownerToken, []string{eventView, eventCheckIn, eventManage, eventManageTeam, eventCancel}},
+		{"admin", adminToken, []string{eventView, eventCheckIn, eventManage, eventManageTeam, eventCancel}},
+		{"co-organizer", coOrganizerToken, []string{eventView, eventCheckIn, eventManage, eventManageTeam}},
+		{"check-in staff", staffToken, []string{eventView, eventCheckIn}},
+		{"viewer", viewerToken, []string{eventView}},
+		{"outsider", outsiderToken, nil},
+	}
+
+	invitees := 0
+	attempts := map[string]func(token string) int{
+		eventView: func(token string) int {
+			return serveAuthenticated(handleEventDetail, http.MethodGet, base+"/registrations", token, nil).Code
+		},
+		// An empty scan gets past the permission check to validation
+		eventCheckIn: func(token string) int {
+			rec := serveAuthenticated(handleEventDetail, http.MethodPost, base+"/checkin", token, CheckinRequest{})
+			if rec.Code == http.StatusBadRequest {
+				return http.StatusOK
+			}
+			return rec.Code
+		},
+		eventManage: func(token string) int {
+			return serveAuthenticated(handleEventDetail, http.MethodPut, base, token, map[string]interface{}{"description": "Updated"}).Code
+		},
+		eventManageTeam: func(token string) int {
+			invitees++
+			inviteeID, _ := newTestUser(t, store, fmt.Sprintf("invitee-%d@example.com", invitees), roleAttendee)
+			rec := serveAuthenticated(handleEventDetail, http.MethodPost, base+"/members", token, InviteMemberRequest{UserID: inviteeID, Role: memberViewer})
+			if rec.Code == http.StatusCreated {
+				return http.StatusOK
+			}
+			return rec.Code
+		},
+	}
+
+	for _, member := range members {
+		for action, attempt := range attempts {
+			wanted := http.StatusForbidden
+			for _, allowed := range member.can {
+				if allowed == action {
+					wanted = http.StatusOK
+				}
+			}
+			if status := attempt(member.token); status != wanted {
+				t.Errorf("%s %s: expected %d, got %d", member.name, action, wanted, status)
+			}
+		}
+	}
+
+	// Only the owner and admins may cancel; try everyone else first
+	for _, member := range members[2:] {
+		rec := serveAuthenticated(handleEventDetail, http.MethodDelete, base, member.token, nil)
+		expectStatus(t, rec, http.StatusForbidden)
+	}
+	expectStatus(t, serveAuthenticated(handleEventDetail, http.MethodDelete, base, ownerToken, nil), http.StatusOK)
+}
+
+func TestEventTeamManagement(t *testing.T) {
+	store := newTestStore(t)
+	ownerID, ownerToken := newTestUser(t, store, "owner@example.com", roleOrganizer)
+	coOrganizerID, coOrganizerToken := newTestUser(t, store, "co@example.com", roleOrganizer)
+	otherCoOrganizerID, _ := newTestUser(t, store, "co2@example.com", roleOrganizer)
+	staffID, staffToken := newTestUser(t, store, "staff@example.com", roleAttendee)
+	newcomerID, _ := newTestUser(t, store, "newcomer@example.com", roleAttendee)
+
+	event := newTestEvent(t, store, ownerID, CreateEventRequest{})
+	addTestMember(t, store, event.ID, coOrganizerID, memberCoOrganizer)
+	addTestMember(t, store, event.ID, otherCoOrganizerID, memberCoOrganizer)
+	addTestMember(t, store, event.ID, staffID, memberCheckinStaff)
+
+	target := "/api/events/" + event.ID + "/members"
+	invite := func(token, userID, role string) int {
+		return serveAuthenticated(handleEventDetail, http.MethodPost, target, token, InviteMemberRequest{UserID: userID, Role: role}).Code
+	}
+	remove := func(token, userID string) int {
+		return serveAuthenticated(handleEventDetail, http.MethodDelete, target+"?user_id="+userID, token, nil).Code
+	}
+
+	tests := []struct {
+		name   string
+		status int
+		do     func() int
+	}{
+		{"co-organizer cannot add a co-organizer", http.StatusForbidden, func() int { return invite(coOrganizerToken, newcomerID, memberCoOrganizer) }},
+		{"co-organizer cannot demote a co-organizer", http.StatusForbidden, func() int { return invite(coOrganizerToken, otherCoOrganizerID, memberViewer) }},
+		{"co-organizer cannot remove a co-organizer", http.StatusForbidden, func() int { return remove(coOrganizerToken, otherCoOrganizerID) }},
+		{"staff cannot remove a co-organizer", http.StatusForbidden, func() int { return remove(staffToken, coOrganizerID) }},
+		{"owner role cannot be given", http.StatusBadRequest, func() int { return invite(ownerToken, newcomerID, memberOwner) }},
+		{"owner cannot be invited", http.StatusConflict, func() int { return invite(coOrganizerToken, ownerID, memberViewer) }},
+		{"owner cannot be removed", http.StatusConflict, func() int { return remove(coOrganizerToken, ownerID) }},
+		{"unknown user", http.StatusNotFound, func() int { return invite(ownerToken, "missing", memberViewer) }},
+		{"removing a non-member", http.StatusNotFound, func() int { return remove(ownerToken, newcomerID) }},
+		{"co-organizer adds a viewer", http.StatusCreated, func() int { return invite(coOrganizerToken, newcomerID, memberViewer) }},
+		{"co-organizer promotes a viewer to staff", http.StatusCreated, func() int { return invite(coOrganizerToken, newcomerID, memberCheckinStaff) }},
+		{"owner promotes staff to co-organizer", http.StatusCreated, func() int { return invite(ownerToken, newcomerID, memberCoOrganizer) }},
+		{"owner removes a co-organizer", http.StatusOK, func() int { return remove(ownerToken, otherCoOrganizerID) }},
+		{"staff can leave", http.StatusOK, func() int { return remove(staffToken, staffID) }},
+	}
+	for _, tt := range tests {
+		if status := tt.do(); status != tt.status {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.status, status)
+		}
+	}
+
+	rec := serveAuthenticated(handleEventDetail, http.MethodGet, target, coOrganizerToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+
+	var resp struct {
+		Members []EventMember `json:"members"`
+		Role    string        `json:"role"`
+	}
+	decodeBody(t, rec, &resp)
+
+	roles := make(map[string]string)
+	for _, member := range resp.Members {
+		roles[member.UserID] = member.Role
+	}
+	wanted := map[string]string{ownerID: memberOwner, coOrganizerID: memberCoOrganizer, newcomerID: memberCoOrganizer}
+	if resp.Role != memberCoOrganizer || resp.Members[0].UserID != ownerID || fmt.Sprint(roles) != fmt.Sprint(wanted) {
+		t.Fatalf("expected the owner first and two co-organizers, got %+v", resp)
+	}
+}
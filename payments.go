@@ -0,0 +1,576 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/your-username/go-ticket-api/payments"
+)
+
+// paymentCurrency is the currency every order is charged in
+const paymentCurrency = "INR"
+
+// maxWebhookBytes bounds the size of a payment webhook body
+const maxWebhookBytes = 1 << 20
+
+// paymentProvider takes payments for paid orders, initialized in setup
+var paymentProvider payments.Provider
+
+// Payment records the payment of one order with the provider
+type Payment struct {
+	ID             string  `json:"id"`
+	Provider       string  `json:"provider"`
+	IntentID       string  `json:"intent_id"`
+	UserID         string  `json:"user_id"`
+	EventID        string  `json:"event_id"`
+	HoldID         string  `json:"hold_id,omitempty"`
+	RegistrationID string  `json:"registration_id,omitempty"`
+	Amount         float64 `json:"amount"`
+	AmountRefunded float64 `json:"amount_refunded"`
+	Currency       string  `json:"currency"`
+	Status         string  `json:"status"`
+	FailureReason  string  `json:"failure_reason,omitempty"`
+	CreatedAt      string  `json:"created_at"`
+	UpdatedAt      string  `json:"updated_at"`
+}
+
+// MockAuthorizeRequest represents a card entered against a mock payment intent
+type MockAuthorizeRequest struct {
+	IntentID   string `json:"intent_id"`
+	CardNumber string `json:"card_number"`
+}
+
+// Payment errors
+var (
+	errPaymentRequired     = errors.New("payment required")
+	errPaymentNotCompleted = errors.New("payment not completed")
+)
+
+// newPaymentProviderFromEnv builds the provider selected by PAYMENT_PROVIDER.
+// Only the built-in mock gateway is available:
+//
+//	PAYMENT_PROVIDER             mock (default)
+//	MOCK_PAYMENT_WEBHOOK_SECRET  secret that signs mock webhooks
+func newPaymentProviderFromEnv() (payments.Provider, error) {
+	switch provider := envOrDefault("PAYMENT_PROVIDER", "mock"); provider {
+	case "mock":
+		secret := os.Getenv("MOCK_PAYMENT_WEBHOOK_SECRET")
+		if secret == "" {
+			b := make([]byte, 32)
+			if _, err := rand.Read(b); err != nil {
+				return nil, err
+			}
+			secret = hex.EncodeToString(b)
+			fmt.Println("Warning: MOCK_PAYMENT_WEBHOOK_SECRET is not set, using a random secret for this process")
+		}
+		return payments.NewMock(secret), nil
+	default:
+		return nil, fmt.Errorf("unknown PAYMENT_PROVIDER %q (expected mock)", provider)
+	}
+}
+
+// toMinorUnits converts an amount in rupees to paise
+func toMinorUnits(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+// fromMinorUnits converts an amount in paise to rupees
+func fromMinorUnits(amount int64) float64 {
+	return float64(amount) / 100
+}
+
+// orderAmount returns the total price of seats in a tier (or at the event price)
+func orderAmount(event *Event, tierID string, seats int) float64 {
+	price := registrationPrice(&Registration{TierID: tierID}, event)
+	return fromMinorUnits(toMinorUnits(price) * int64(seats))
+}
+
+// applyIntent copies an intent's state onto its payment record
+func applyIntent(payment *Payment, intent *payments.Intent) {
+	switch intent.Status {
+	case payments.StatusRequiresPaymentMethod:
+		payment.Status = "pending"
+	case payments.StatusRequiresCapture:
+		payment.Status = "authorized"
+	case payments.StatusSucceeded:
+		payment.Status = "captured"
+	case payments.StatusCanceled:
+		payment.Status = "cancelled"
+	}
+	payment.FailureReason = intent.FailureMessage
+}
+
+// startHoldPayment creates a payment intent for a hold, or returns the
+// hold's open one so retries do not create duplicate charges
+func startHoldPayment(hold *SeatHold, amount float64) (*Payment, *payments.Intent, error) {
+	existing, err := paymentStore.GetHoldPayment(hold.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if existing != nil && (existing.Status == "pending" || existing.Status == "authorized") {
+		intent, err := paymentProvider.GetIntent(existing.IntentID)
+		if err != nil {
+			return nil, nil, err
+		}
+		return existing, intent, nil
+	}
+
+	intent, err := paymentProvider.CreateIntent(toMinorUnits(amount), paymentCurrency, map[string]string{
+		"hold_id":  hold.ID,
+		"event_id": hold.EventID,
+		"user_id":  hold.UserID,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	payment, err := paymentStore.CreatePayment(Payment{
+		Provider: paymentProvider.Name(),
+		IntentID: intent.ID,
+		UserID:   hold.UserID,
+		EventID:  hold.EventID,
+		HoldID:   hold.ID,
+		Amount:   amount,
+		Currency: paymentCurrency,
+		Status:   "pending",
+	})
+	if err != nil {
+		paymentProvider.Cancel(intent.ID)
+		return nil, nil, err
+	}
+
+	return payment, intent, nil
+}
+
+// capturePaidHold collects the payment for a hold and confirms it into a
+// registration. If the registration cannot be created after the money was
+// taken, the payment is refunded in full. Callers must hold the event's
+// reservation lock and pass the hold as reloaded under it.
+func capturePaidHold(hold *SeatHold, notes string, attendees []Attendee) (*Registration, *Payment, error) {
+	payment, err := paymentStore.GetHoldPayment(hold.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if payment == nil {
+		return nil, nil, errPaymentRequired
+	}
+
+	intent, err := paymentProvider.Capture(payment.IntentID)
+	if err == payments.ErrInvalidState {
+		intent, err = paymentProvider.GetIntent(payment.IntentID)
+	}
+	if err != nil {
+		return nil, payment, err
+	}
+
+	applyIntent(payment, intent)
+	if intent.Status != payments.StatusSucceeded {
+		updatePayment(payment)
+		return nil, payment, errPaymentNotCompleted
+	}
+
+	registration, err := holdStore.ConfirmHold(hold.ID, notes, attendees)
+	if err != nil {
+		if _, refundErr := paymentProvider.Refund(intent.ID, intent.Amount-intent.AmountRefunded, "hold:"+hold.ID); refundErr != nil {
+			fmt.Printf("Error refunding payment %s after failed confirmation: %v\n", payment.ID, refundErr)
+		} else {
+			payment.Status = "refunded"
+			payment.AmountRefunded = payment.Amount
+		}
+		updatePayment(payment)
+		return nil, payment, err
+	}
+
+	payment.RegistrationID = registration.ID
+	updatePayment(payment)
+	if err := recordSale(payment); err != nil {
+		// The order stands; the sale is missing from the organizer's ledger
+		fmt.Printf("Error recording sale for payment %s: %v\n", payment.ID, err)
+	}
+
+	return registration, payment, nil
+}
+
+// cancelHoldPayment voids the uncaptured payment of a hold that was
+// released or expired
+func cancelHoldPayment(holdID string) {
+	payment, err := paymentStore.GetHoldPayment(holdID)
+	if err != nil || payment == nil {
+		return
+	}
+	if payment.Status != "pending" && payment.Status != "authorized" {
+		return
+	}
+
+	intent, err := paymentProvider.Cancel(payment.IntentID)
+	if err != nil {
+		fmt.Printf("Error cancelling payment %s: %v\n", payment.ID, err)
+		return
+	}
+
+	applyIntent(payment, intent)
+	updatePayment(payment)
+}
+
+// updatePayment saves a payment's status, logging instead of failing
+// because the provider has already acted on it
+func updatePayment(payment *Payment) {
+	if err := paymentStore.UpdatePayment(*payment); err != nil {
+		fmt.Printf("Error updating payment %s: %v\n", payment.ID, err)
+	}
+}
+
+// paymentResponse is what buyers get back when a payment is started
+func paymentResponse(payment *Payment, intent *payments.Intent) map[string]interface{} {
+	return map[string]interface{}{
+		"id":            payment.ID,
+		"provider":      payment.Provider,
+		"intent_id":     intent.ID,
+		"client_secret": intent.ClientSecret,
+		"amount":        payment.Amount,
+		"currency":      payment.Currency,
+		"status":        payment.Status,
+	}
+}
+
+// =====================================================
+// Payment Handlers
+// =====================================================
+
+// handleHoldPayment starts (or resumes) the payment for a paid hold
+func handleHoldPayment(w http.ResponseWriter, hold *SeatHold) {
+	if !holdIsActive(hold, time.Now()) {
+		sendError(w, http.StatusGone, "Hold expired", "This hold is no longer active")
+		return
+	}
+
+	event, err := eventStore.GetEventByID(hold.EventID)
+	if err != nil {
+		sendError(w, http.StatusNotFound, "Not found", "Event not found")
+		return
+	}
+
+	amount := orderTotal(event, hold.TierID, hold.Quantity, hold.Discount)
+	if amount <= 0 {
+		sendError(w, http.StatusBadRequest, "No payment needed", "This hold is free; confirm it directly")
+		return
+	}
+
+	payment, intent, err := startHoldPayment(hold, amount)
+	if err != nil {
+		fmt.Printf("Error starting payment: %v\n", err)
+		sendError(w, http.StatusBadGateway, "Payment error", "Unable to start payment")
+		return
+	}
+
+	sendJSON(w, http.StatusOK, map[string]interface{}{
+		"hold":    hold,
+		"payment": paymentResponse(payment, intent),
+	})
+}
+
+// handleMockAuthorize stands in for the processor's checkout page when the
+// mock provider is active: it authorizes the buyer's card against an intent
+func handleMockAuthorize(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "Only POST method is allowed")
+		return
+	}
+
+	mock, ok := paymentProvider.(*payments.Mock)
+	if !ok {
+		sendError(w, http.StatusNotFound, "Not found", "The mock payment provider is not enabled")
+		return
+	}
+
+	auth := authFromRequest(r)
+
+	var req MockAuthorizeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, "Invalid request", "Invalid JSON format")
+		return
+	}
+
+	if req.IntentID == "" || req.CardNumber == "" {
+		sendError(w, http.StatusBadRequest, "Validation error", "intent_id and card_number are required")
+		return
+	}
+
+	payment, err := paymentStore.GetPaymentByIntent(req.IntentID)
+	if err != nil || payment.UserID != auth.UserID {
+		sendError(w, http.StatusNotFound, "Not found", "Payment not found")
+		return
+	}
+
+	intent, err := mock.Authorize(req.IntentID, req.CardNumber)
+	if err == payments.ErrInvalidState {
+		sendError(w, http.StatusConflict, "Payment error", "This payment has already been authorized or closed")
+		return
+	}
+	if err != nil {
+		fmt.Printf("Error authorizing mock payment: %v\n", err)
+		sendError(w, http.StatusBadGateway, "Payment error", "Unable to authorize payment")
+		return
+	}
+
+	applyIntent(payment, intent)
+	updatePayment(payment)
+
+	if intent.FailureCode != "" {
+		sendError(w, http.StatusPaymentRequired, "Payment failed", intent.FailureMessage)
+		return
+	}
+
+	sendJSON(w, http.StatusOK, map[string]interface{}{
+		"payment": payment,
+		"message": "Payment authorized. Confirm the hold to complete your registration",
+	})
+}
+
+// handlePaymentWebhook receives signed notifications from the provider.
+// An authorized payment for a still-active hold completes the order even
+// if the buyer never comes back to confirm it.
+func handlePaymentWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "Only POST method is allowed")
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBytes))
+	if err != nil {
+		sendError(w, http.StatusBadRequest, "Invalid request", "Unable to read webhook body")
+		return
+	}
+
+	event, err := paymentProvider.VerifyWebhook(body, r.Header.Get("Payment-Signature"))
+	if err != nil {
+		sendError(w, http.StatusBadRequest, "Invalid webhook", err.Error())
+		return
+	}
+
+	payment, err := paymentStore.GetPaymentByIntent(event.Intent.ID)
+	if err != nil {
+		// Not one of ours; acknowledge so the provider stops retrying
+		sendJSON(w, http.StatusOK, map[string]interface{}{"received": true})
+		return
+	}
+
+	switch event.Type {
+	case payments.EventAuthorized:
+		if payment.Status == "pending" {
+			applyIntent(payment, &event.Intent)
+			updatePayment(payment)
+		}
+		if payment.HoldID != "" && payment.RegistrationID == "" {
+			completeHoldFromWebhook(payment.HoldID)
+		}
+	case payments.EventSucceeded, payments.EventCanceled, payments.EventPaymentFailed:
+		if payment.Status == "pending" || payment.Status == "authorized" {
+			applyIntent(payment, &event.Intent)
+			updatePayment(payment)
+		}
+	case payments.EventRefunded:
+		payment.AmountRefunded = fromMinorUnits(event.Intent.AmountRefunded)
+		if event.Intent.AmountRefunded >= event.Intent.Amount {
+			payment.Status = "refunded"
+		} else {
+			payment.Status = "partially_refunded"
+		}
+		updatePayment(payment)
+	}
+
+	sendJSON(w, http.StatusOK, map[string]interface{}{"received": true})
+}
+
+// completeHoldFromWebhook captures and confirms a hold whose payment was
+// authorized, issuing its tickets
+func completeHoldFromWebhook(holdID string) {
+	hold, err := holdStore.GetHold(holdID)
+	if err != nil || !holdIsActive(hold, time.Now()) {
+		return
+	}
+
+	event, err := eventStore.GetEventByID(hold.EventID)
+	if err != nil {
+		fmt.Printf("Error fetching event for hold %s: %v\n", holdID, err)
+		return
+	}
+
+	var registration *Registration
+	var payment *Payment
+	err = reservationLedger.WithEvent(hold.EventID, func() error {
+		// The buyer may have confirmed the hold since it was loaded
+		current, existing, err := reloadHold(holdID)
+		if err != nil || existing != nil {
+			return err
+		}
+		registration, payment, err = capturePaidHold(current, current.Notes, current.Attendees)
+		return err
+	})
+	if err == errHoldExpired {
+		return
+	}
+	if err != nil {
+		fmt.Printf("Error completing hold %s from webhook: %v\n", holdID, err)
+		return
+	}
+	if registration == nil {
+		return
+	}
+
+	issueTicketsForRegistration(registration, event)
+	invoicePaidOrder(registration, event, payment)
+}
+
+// =====================================================
+// Supabase Payment Functions
+// =====================================================
+
+// CreatePayment stores a payment record
+func (c *SupabaseClient) CreatePayment(payment Payment) (*Payment, error) {
+	payload := map[string]interface{}{
+		"provider":  payment.Provider,
+		"intent_id": payment.IntentID,
+		"user_id":   payment.UserID,
+		"event_id":  payment.EventID,
+		"hold_id":   nullIfEmpty(payment.HoldID),
+		"amount":    payment.Amount,
+		"currency":  payment.Currency,
+		"status":    payment.Status,
+	}
+
+	var created []Payment
+	if err := c.doREST("POST", "/rest/v1/payments", "", payload, &created); err != nil {
+		return nil, err
+	}
+
+	if len(created) == 0 {
+		return nil, fmt.Errorf("payment created but no data returned")
+	}
+
+	return &created[0], nil
+}
+
+// GetPaymentByIntent returns the payment for a provider intent
+func (c *SupabaseClient) GetPaymentByIntent(intentID string) (*Payment, error) {
+	var found []Payment
+	if err := c.doREST("GET", fmt.Sprintf("/rest/v1/payments?intent_id=eq.%s&select=*", intentID), "", nil, &found); err != nil {
+		return nil, err
+	}
+
+	if len(found) == 0 {
+		return nil, fmt.Errorf("payment not found")
+	}
+
+	return &found[0], nil
+}
+
+// GetHoldPayment returns the latest payment for a hold, or nil if there is none
+func (c *SupabaseClient) GetHoldPayment(holdID string) (*Payment, error) {
+	path := fmt.Sprintf("/rest/v1/payments?hold_id=eq.%s&select=*&order=created_at.desc&limit=1", holdID)
+
+	var found []Payment
+	if err := c.doREST("GET", path, "", nil, &found); err != nil {
+		return nil, err
+	}
+
+	if len(found) == 0 {
+		return nil, nil
+	}
+
+	return &found[0], nil
+}
+
+// UpdatePayment saves a payment's status, refunds and the registration it paid for
+func (c *SupabaseClient) UpdatePayment(payment Payment) error {
+	payload := map[string]interface{}{
+		"status":          payment.Status,
+		"registration_id": nullIfEmpty(payment.RegistrationID),
+		"failure_reason":  nullIfEmpty(payment.FailureReason),
+		"amount_refunded": payment.AmountRefunded,
+		"updated_at":      nowTimestamp(),
+	}
+
+	return c.doREST("PATCH", fmt.Sprintf("/rest/v1/payments?id=eq.%s", payment.ID), "", payload, nil)
+}
+
+// =====================================================
+// In-memory Payment Functions
+// =====================================================
+
+// CreatePayment stores a payment record
+func (m *MemoryStore) CreatePayment(payment Payment) (*Payment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := nowTimestamp()
+	payment.ID = newID()
+	payment.CreatedAt = now
+	payment.UpdatedAt = now
+	m.payments[payment.ID] = &payment
+
+	created := payment
+	return &created, nil
+}
+
+// GetPaymentByIntent returns the payment for a provider intent
+func (m *MemoryStore) GetPaymentByIntent(intentID string) (*Payment, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, payment := range m.payments {
+		if payment.IntentID == intentID {
+			found := *payment
+			return &found, nil
+		}
+	}
+
+	return nil, fmt.Errorf("payment not found")
+}
+
+// GetHoldPayment returns the latest payment for a hold, or nil if there is none
+func (m *MemoryStore) GetHoldPayment(holdID string) (*Payment, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var latest *Payment
+	for _, payment := range m.payments {
+		if payment.HoldID == holdID && (latest == nil || payment.CreatedAt >= latest.CreatedAt) {
+			latest = payment
+		}
+	}
+
+	if latest == nil {
+		return nil, nil
+	}
+
+	found := *latest
+	return &found, nil
+}
+
+// UpdatePayment saves a payment's status, refunds and the registration it paid for
+func (m *MemoryStore) UpdatePayment(payment Payment) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, exists := m.payments[payment.ID]
+	if !exists {
+		return fmt.Errorf("payment not found")
+	}
+
+	existing.Status = payment.Status
+	existing.RegistrationID = payment.RegistrationID
+	existing.FailureReason = payment.FailureReason
+	existing.AmountRefunded = payment.AmountRefunded
+	existing.UpdatedAt = nowTimestamp()
+
+	return nil
+}
@@ -0,0 +1,286 @@
+package payments
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"sync"
+)
+
+// Mock card numbers with deterministic outcomes. Any other number that
+// passes the Luhn check is authorized successfully.
+const (
+	CardSuccess           = "4242424242424242"
+	CardDeclined          = "4000000000000002"
+	CardInsufficientFunds = "4000000000009995"
+	CardExpired           = "4000000000000069"
+	CardCaptureFails      = "4000000000000341"
+)
+
+// mockFailures maps failing cards to their failure code and message
+var mockFailures = map[string][2]string{
+	CardDeclined:          {"card_declined", "Your card was declined."},
+	CardInsufficientFunds: {"insufficient_funds", "Your card has insufficient funds."},
+	CardExpired:           {"expired_card", "Your card has expired."},
+}
+
+// Mock is an in-memory payment provider for local development and tests.
+// Cards are "entered" with Authorize, which stands in for the processor's
+// client-side SDK.
+type Mock struct {
+	mu            sync.Mutex
+	intents       map[string]*mockIntent
+	refunds       map[string]*Refund
+	webhookSecret []byte
+}
+
+type mockIntent struct {
+	Intent
+	card string
+}
+
+// NewMock creates a mock provider whose webhooks are signed with secret
+func NewMock(webhookSecret string) *Mock {
+	return &Mock{
+		intents:       make(map[string]*mockIntent),
+		refunds:       make(map[string]*Refund),
+		webhookSecret: []byte(webhookSecret),
+	}
+}
+
+// Name returns "mock"
+func (m *Mock) Name() string { return "mock" }
+
+// CreateIntent starts a payment awaiting a card
+func (m *Mock) CreateIntent(amount int64, currency string, metadata map[string]string) (*Intent, error) {
+	if amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+
+	id := "pi_mock_" + randomHex(12)
+	intent := &mockIntent{Intent: Intent{
+		ID:           id,
+		Amount:       amount,
+		Currency:     strings.ToLower(currency),
+		Status:       StatusRequiresPaymentMethod,
+		ClientSecret: id + "_secret_" + randomHex(12),
+		Metadata:     copyMetadata(metadata),
+	}}
+
+	m.mu.Lock()
+	m.intents[id] = intent
+	m.mu.Unlock()
+
+	return intent.snapshot(), nil
+}
+
+// GetIntent returns the current state of an intent
+func (m *Mock) GetIntent(intentID string) (*Intent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	intent, exists := m.intents[intentID]
+	if !exists {
+		return nil, ErrNotFound
+	}
+
+	return intent.snapshot(), nil
+}
+
+// Authorize simulates the buyer entering cardNumber. Failing cards leave
+// the intent awaiting another card with the failure recorded on it.
+func (m *Mock) Authorize(intentID, cardNumber string) (*Intent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	intent, exists := m.intents[intentID]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	if intent.Status != StatusRequiresPaymentMethod {
+		return nil, ErrInvalidState
+	}
+
+	card := strings.ReplaceAll(strings.ReplaceAll(cardNumber, " ", ""), "-", "")
+	intent.FailureCode, intent.FailureMessage = "", ""
+
+	if failure, fails := mockFailures[card]; fails {
+		intent.FailureCode, intent.FailureMessage = failure[0], failure[1]
+		return intent.snapshot(), nil
+	}
+	if !luhnValid(card) {
+		intent.FailureCode, intent.FailureMessage = "incorrect_number", "Your card number is incorrect."
+		return intent.snapshot(), nil
+	}
+
+	intent.card = card
+	intent.Status = StatusRequiresCapture
+	return intent.snapshot(), nil
+}
+
+// Capture collects an authorized intent
+func (m *Mock) Capture(intentID string) (*Intent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	intent, exists := m.intents[intentID]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	if intent.Status == StatusSucceeded {
+		return intent.snapshot(), nil
+	}
+	if intent.Status != StatusRequiresCapture {
+		return nil, ErrInvalidState
+	}
+
+	if intent.card == CardCaptureFails {
+		intent.Status = StatusRequiresPaymentMethod
+		intent.FailureCode, intent.FailureMessage = "processing_error", "An error occurred while processing your card."
+		return intent.snapshot(), nil
+	}
+
+	intent.Status = StatusSucceeded
+	return intent.snapshot(), nil
+}
+
+// Cancel voids an intent that has not been captured
+func (m *Mock) Cancel(intentID string) (*Intent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	intent, exists := m.intents[intentID]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	if intent.Status == StatusSucceeded {
+		return nil, ErrInvalidState
+	}
+
+	intent.Status = StatusCanceled
+	return intent.snapshot(), nil
+}
+
+// Refund returns amount minor units of a captured intent, or the refund
+// already made under idempotencyKey
+func (m *Mock) Refund(intentID string, amount int64, idempotencyKey string) (*Refund, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if existing, exists := m.refunds[idempotencyKey]; exists && idempotencyKey != "" {
+		if existing.IntentID != intentID {
+			return nil, ErrInvalidState
+		}
+		refund := *existing
+		return &refund, nil
+	}
+
+	intent, exists := m.intents[intentID]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	if intent.Status != StatusSucceeded {
+		return nil, ErrInvalidState
+	}
+	if amount <= 0 || intent.AmountRefunded+amount > intent.Amount {
+		return nil, ErrInvalidAmount
+	}
+
+	intent.AmountRefunded += amount
+
+	refund := &Refund{
+		ID:       "re_mock_" + randomHex(12),
+		IntentID: intentID,
+		Amount:   amount,
+		Status:   StatusSucceeded,
+	}
+	if idempotencyKey != "" {
+		m.refunds[idempotencyKey] = refund
+	}
+
+	result := *refund
+	return &result, nil
+}
+
+// VerifyWebhook checks the hex HMAC-SHA256 signature of payload and
+// decodes its event
+func (m *Mock) VerifyWebhook(payload []byte, signature string) (*Event, error) {
+	expected, err := hex.DecodeString(signature)
+	if err != nil || len(m.webhookSecret) == 0 || !hmac.Equal(expected, m.mac(payload)) {
+		return nil, ErrBadSignature
+	}
+
+	var event Event
+	if err := json.Unmarshal(payload, &event); err != nil || event.Type == "" || event.Intent.ID == "" {
+		return nil, ErrMalformed
+	}
+
+	return &event, nil
+}
+
+// SignWebhook returns the signature VerifyWebhook expects for payload,
+// for simulating webhook deliveries
+func (m *Mock) SignWebhook(payload []byte) string {
+	return hex.EncodeToString(m.mac(payload))
+}
+
+func (m *Mock) mac(payload []byte) []byte {
+	h := hmac.New(sha256.New, m.webhookSecret)
+	h.Write(payload)
+	return h.Sum(nil)
+}
+
+// snapshot returns a copy that is safe to hand out after unlocking
+func (i *mockIntent) snapshot() *Intent {
+	copied := i.Intent
+	copied.Metadata = copyMetadata(i.Metadata)
+	return &copied
+}
+
+func copyMetadata(metadata map[string]string) map[string]string {
+	if metadata == nil {
+		return nil
+	}
+	copied := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		copied[k] = v
+	}
+	return copied
+}
+
+// luhnValid reports whether number is a plausible card number
+func luhnValid(number string) bool {
+	if len(number) < 12 || len(number) > 19 {
+		return false
+	}
+
+	sum := 0
+	double := false
+	for i := len(number) - 1; i >= 0; i-- {
+		digit := int(number[i] - '0')
+		if digit < 0 || digit > 9 {
+			return false
+		}
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+
+	return sum%10 == 0
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,204 @@
+package payments
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// authorizedIntent creates an intent of amount and authorizes card against it
+func authorizedIntent(t *testing.T, mock *Mock, amount int64, card string) *Intent {
+	t.Helper()
+
+	intent, err := mock.CreateIntent(amount, "INR", map[string]string{"hold_id": "hold-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if intent, err = mock.Authorize(intent.ID, card); err != nil {
+		t.Fatal(err)
+	}
+	return intent
+}
+
+func TestMockCardOutcomes(t *testing.T) {
+	tests := []struct {
+		card    string
+		status  string
+		failure string
+	}{
+		{CardSuccess, StatusRequiresCapture, ""},
+		{"4242 4242 4242 4242", StatusRequiresCapture, ""},
+		{"5555-5555-5555-4444", StatusRequiresCapture, ""},
+		{CardDeclined, StatusRequiresPaymentMethod, "card_declined"},
+		{CardInsufficientFunds, StatusRequiresPaymentMethod, "insufficient_funds"},
+		{CardExpired, StatusRequiresPaymentMethod, "expired_card"},
+		{"4242424242424241", StatusRequiresPaymentMethod, "incorrect_number"},
+		{"4242", StatusRequiresPaymentMethod, "incorrect_number"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.card, func(t *testing.T) {
+			intent := authorizedIntent(t, NewMock("secret"), 1000, tt.card)
+			if intent.Status != tt.status || intent.FailureCode != tt.failure {
+				t.Fatalf("expected %s (%q), got %s (%q)", tt.status, tt.failure, intent.Status, intent.FailureCode)
+			}
+		})
+	}
+}
+
+func TestMockIntentLifecycle(t *testing.T) {
+	mock := NewMock("secret")
+
+	if _, err := mock.CreateIntent(0, "INR", nil); !errors.Is(err, ErrInvalidAmount) {
+		t.Fatalf("expected ErrInvalidAmount, got %v", err)
+	}
+
+	intent, err := mock.CreateIntent(1000, "INR", map[string]string{"hold_id": "hold-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if intent.Currency != "inr" || intent.ClientSecret == "" || intent.Metadata["hold_id"] != "hold-1" {
+		t.Fatalf("unexpected intent %+v", intent)
+	}
+	if _, err := mock.Capture(intent.ID); !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("expected capturing an unauthorized intent to fail, got %v", err)
+	}
+
+	// A declined card can be replaced with a good one
+	if intent, _ = mock.Authorize(intent.ID, CardDeclined); intent.Status != StatusRequiresPaymentMethod {
+		t.Fatalf("expected the intent to wait for another card, got %s", intent.Status)
+	}
+	if intent, _ = mock.Authorize(intent.ID, CardSuccess); intent.Status != StatusRequiresCapture || intent.FailureCode != "" {
+		t.Fatalf("expected the second card to be authorized, got %+v", intent)
+	}
+	if _, err := mock.Authorize(intent.ID, CardSuccess); !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("expected a second authorization to fail, got %v", err)
+	}
+
+	captured, err := mock.Capture(intent.ID)
+	if err != nil || captured.Status != StatusSucceeded {
+		t.Fatalf("expected the capture to succeed, got %+v, %v", captured, err)
+	}
+	if again, err := mock.Capture(intent.ID); err != nil || again.Status != StatusSucceeded {
+		t.Fatalf("expected a repeated capture to be a no-op, got %+v, %v", again, err)
+	}
+	if _, err := mock.Cancel(intent.ID); !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("expected a captured intent not to be cancellable, got %v", err)
+	}
+
+	// Snapshots cannot change the stored intent
+	captured.Metadata["hold_id"] = "changed"
+	if stored, _ := mock.GetIntent(intent.ID); stored.Metadata["hold_id"] != "hold-1" {
+		t.Fatal("expected GetIntent to return a copy")
+	}
+	if _, err := mock.GetIntent("pi_unknown"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestMockCaptureFailure(t *testing.T) {
+	mock := NewMock("secret")
+	intent := authorizedIntent(t, mock, 1000, CardCaptureFails)
+
+	captured, err := mock.Capture(intent.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if captured.Status != StatusRequiresPaymentMethod || captured.FailureCode != "processing_error" {
+		t.Fatalf("expected the capture to fail, got %+v", captured)
+	}
+
+	canceled, err := mock.Cancel(intent.ID)
+	if err != nil || canceled.Status != StatusCanceled {
+		t.Fatalf("expected the failed intent to be cancellable, got %+v, %v", canceled, err)
+	}
+}
+
+func TestMockRefunds(t *testing.T) {
+	mock := NewMock("secret")
+	intent := authorizedIntent(t, mock, 1000, CardSuccess)
+
+	if _, err := mock.Refund(intent.ID, 100, "early"); !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("expected refunding an uncaptured intent to fail, got %v", err)
+	}
+	if _, err := mock.Capture(intent.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := mock.Refund(intent.ID, 600, "registration:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A retry with the same key returns the original refund without paying out again
+	retried, err := mock.Refund(intent.ID, 600, "registration:1")
+	if err != nil || *retried != *first {
+		t.Fatalf("expected the original refund, got %+v, %v", retried, err)
+	}
+	if stored, _ := mock.GetIntent(intent.ID); stored.AmountRefunded != 600 {
+		t.Fatalf("expected 600 refunded, got %d", stored.AmountRefunded)
+	}
+
+	if _, err := mock.Refund(intent.ID, 500, "registration:2"); !errors.Is(err, ErrInvalidAmount) {
+		t.Fatalf("expected refunding more than was captured to fail, got %v", err)
+	}
+	if _, err := mock.Refund(intent.ID, 400, "registration:2"); err != nil {
+		t.Fatalf("expected the remaining 400 to be refundable, got %v", err)
+	}
+
+	other := authorizedIntent(t, mock, 1000, CardSuccess)
+	if _, err := mock.Capture(other.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mock.Refund(other.ID, 100, "registration:1"); !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("expected a key reused for another intent to fail, got %v", err)
+	}
+
+	// Refunds without a key are never deduplicated
+	for i := 0; i < 2; i++ {
+		if _, err := mock.Refund(other.ID, 100, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stored, _ := mock.GetIntent(other.ID); stored.AmountRefunded != 200 {
+		t.Fatalf("expected 200 refunded, got %d", stored.AmountRefunded)
+	}
+}
+
+func TestMockWebhooks(t *testing.T) {
+	mock := NewMock("secret")
+	payload, _ := json.Marshal(Event{ID: "evt_1", Type: EventSucceeded, Intent: Intent{ID: "pi_1", Status: StatusSucceeded}})
+
+	event, err := mock.VerifyWebhook(payload, mock.SignWebhook(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != EventSucceeded || event.Intent.ID != "pi_1" {
+		t.Fatalf("unexpected event %+v", event)
+	}
+
+	tampered := append([]byte{}, payload...)
+	tampered[len(tampered)-2] = ' '
+	tests := []struct {
+		name      string
+		payload   []byte
+		signature string
+		want      error
+	}{
+		{"tampered payload", tampered, mock.SignWebhook(payload), ErrBadSignature},
+		{"other secret", payload, NewMock("other").SignWebhook(payload), ErrBadSignature},
+		{"not hex", payload, "not-a-signature", ErrBadSignature},
+		{"no event type", []byte(`{"data":{"id":"pi_1"}}`), mock.SignWebhook([]byte(`{"data":{"id":"pi_1"}}`)), ErrMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := mock.VerifyWebhook(tt.payload, tt.signature); !errors.Is(err, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+
+	unsigned := NewMock("")
+	if _, err := unsigned.VerifyWebhook(payload, unsigned.SignWebhook(payload)); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("expected webhooks to be refused without a secret, got %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+// Package payments defines the interface the API uses to take payments
+// and a mock processor that implements it in memory, so checkout can be
+// exercised locally without a real payment gateway.
+//
+// Payments follow the authorize-then-capture model: an intent is created
+// for the order amount, the buyer's card is authorized against it on the
+// client side, and the server captures it once the seats are confirmed.
+// Amounts are always in the currency's minor unit (paise for INR).
+package payments
+
+import "errors"
+
+// Intent statuses
+const (
+	StatusRequiresPaymentMethod = "requires_payment_method"
+	StatusRequiresCapture       = "requires_capture"
+	StatusSucceeded             = "succeeded"
+	StatusCanceled              = "canceled"
+)
+
+// Webhook event types
+const (
+	EventAuthorized    = "payment_intent.amount_capturable_updated"
+	EventSucceeded     = "payment_intent.succeeded"
+	EventPaymentFailed = "payment_intent.payment_failed"
+	EventCanceled      = "payment_intent.canceled"
+	EventRefunded      = "charge.refunded"
+)
+
+// Provider errors
+var (
+	ErrNotFound      = errors.New("payments: intent not found")
+	ErrInvalidState  = errors.New("payments: intent is not in a state that allows this operation")
+	ErrInvalidAmount = errors.New("payments: invalid amount")
+	ErrBadSignature  = errors.New("payments: invalid webhook signature")
+	ErrMalformed     = errors.New("payments: malformed webhook payload")
+)
+
+// Intent tracks the payment of one order
+type Intent struct {
+	ID             string            `json:"id"`
+	Amount         int64             `json:"amount"`
+	AmountRefunded int64             `json:"amount_refunded"`
+	Currency       string            `json:"currency"`
+	Status         string            `json:"status"`
+	ClientSecret   string            `json:"client_secret,omitempty"`
+	FailureCode    string            `json:"failure_code,omitempty"`
+	FailureMessage string            `json:"failure_message,omitempty"`
+	Metadata       map[string]string `json:"metadata,omitempty"`
+}
+
+// Refund is money returned against a captured intent
+type Refund struct {
+	ID       string `json:"id"`
+	IntentID string `json:"intent_id"`
+	Amount   int64  `json:"amount"`
+	Status   string `json:"status"`
+}
+
+// Event is a verified webhook notification about an intent
+type Event struct {
+	ID     string `json:"id"`
+	Type   string `json:"type"`
+	Intent Intent `json:"data"`
+}
+
+// Provider is a payment processor
+type Provider interface {
+	// Name identifies the provider in stored payment records
+	Name() string
+
+	// CreateIntent starts a payment of amount minor units. Metadata is
+	// stored with the intent and echoed back in webhook events.
+	CreateIntent(amount int64, currency string, metadata map[string]string) (*Intent, error)
+
+	// GetIntent returns the current state of an intent
+	GetIntent(intentID string) (*Intent, error)
+
+	// Capture collects an authorized intent
+	Capture(intentID string) (*Intent, error)
+
+	// Cancel voids an intent that has not been captured
+	Cancel(intentID string) (*Intent, error)
+
+	// Refund returns amount minor units of a captured intent. Retrying
+	// with the same idempotency key returns the original refund instead
+	// of returning the money again.
+	Refund(intentID string, amount int64, idempotencyKey string) (*Refund, error)
+
+	// VerifyWebhook checks a webhook's signature and decodes its event
+	VerifyWebhook(payload []byte, signature string) (*Event, error)
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/your-username/go-ticket-api/payments"
+)
+
+// paidOrderResponse is the body of a paid registration awaiting payment
+type paidOrderResponse struct {
+	Hold    SeatHold `json:"hold"`
+	Payment struct {
+		ID       string  `json:"id"`
+		IntentID string  `json:"intent_id"`
+		Amount   float64 `json:"amount"`
+		Status   string  `json:"status"`
+	} `json:"payment"`
+}
+
+// startPaidOrder registers for a paid event and expects the seats to be
+// held pending payment
+func startPaidOrder(t *testing.T, token string, req EventRegistrationRequest) paidOrderResponse {
+	t.Helper()
+
+	rec := serveAuthenticated(handleRegistrations, http.MethodPost, "/api/registrations", token, req)
+	expectStatus(t, rec, http.StatusAccepted)
+
+	var resp paidOrderResponse
+	decodeBody(t, rec, &resp)
+	return resp
+}
+
+// authorizeCard enters a card against a mock payment intent
+func authorizeCard(token, intentID, card string) *httptest.ResponseRecorder {
+	return serveAuthenticated(handleMockAuthorize, http.MethodPost, "/api/payments/mock/authorize", token, MockAuthorizeRequest{IntentID: intentID, CardNumber: card})
+}
+
+// confirmHold confirms a hold for the holder of token
+func confirmHold(token, holdID string) *httptest.ResponseRecorder {
+	return serveAuthenticated(handleHoldDetail, http.MethodPost, "/api/holds/"+holdID+"/confirm", token, nil)
+}
+
+// buyTickets pays for an order with a good card and confirms it
+func buyTickets(t *testing.T, token string, req EventRegistrationRequest) registrationResponse {
+	t.Helper()
+
+	order := startPaidOrder(t, token, req)
+	expectStatus(t, authorizeCard(token, order.Payment.IntentID, payments.CardSuccess), http.StatusOK)
+
+	rec := confirmHold(token, order.Hold.ID)
+	expectStatus(t, rec, http.StatusCreated)
+
+	var resp registrationResponse
+	decodeBody(t, rec, &resp)
+	return resp
+}
+
+// deliverWebhook sends a payment webhook signed by the mock provider
+func deliverWebhook(t *testing.T, event payments.Event, signature string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	payload, _ := json.Marshal(event)
+	if signature == "" {
+		signature = paymentProvider.(*payments.Mock).SignWebhook(payload)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/payments/webhook", bytes.NewReader(payload))
+	req.Header.Set("Payment-Signature", signature)
+	rec := httptest.NewRecorder()
+	handlePaymentWebhook(rec, req)
+	return rec
+}
+
+func TestToMinorUnits(t *testing.T) {
+	tests := []struct {
+		amount float64
+		want   int64
+	}{
+		{0, 0},
+		{499, 49900},
+		{0.1 + 0.2, 30},
+		{19.995, 2000},
+		{1180.005, 118001},
+	}
+	for _, tt := range tests {
+		if got := toMinorUnits(tt.amount); got != tt.want {
+			t.Fatalf("toMinorUnits(%v) = %d, want %d", tt.amount, got, tt.want)
+		}
+	}
+	if got := fromMinorUnits(118001); got != 1180.01 {
+		t.Fatalf("fromMinorUnits(118001) = %v", got)
+	}
+}
+
+func TestPaidCheckout(t *testing.T) {
+	store := newTestStore(t)
+	organizerID, _ := newTestUser(t, store, "organizer@example.com", roleOrganizer)
+	buyerID, buyerToken := newTestUser(t, store, "buyer@example.com", roleAttendee)
+	_, otherToken := newTestUser(t, store, "other@example.com", roleAttendee)
+
+	event := newTestEvent(t, store, organizerID, CreateEventRequest{Price: 499})
+
+	order := startPaidOrder(t, buyerToken, EventRegistrationRequest{EventID: event.ID, Quantity: 2})
+	if order.Payment.Amount != 998 || order.Payment.Status != "pending" || order.Hold.Quantity != 2 {
+		t.Fatalf("expected a pending payment of 998 for 2 held seats, got %+v", order)
+	}
+
+	t.Run("resuming the payment reuses the intent", func(t *testing.T) {
+		rec := serveAuthenticated(handleHoldDetail, http.MethodPost, "/api/holds/"+order.Hold.ID+"/payment", buyerToken, nil)
+		expectStatus(t, rec, http.StatusOK)
+
+		var resumed paidOrderResponse
+		decodeBody(t, rec, &resumed)
+		if resumed.Payment.IntentID != order.Payment.IntentID {
+			t.Fatalf("expected the open intent to be reused, got %s", resumed.Payment.IntentID)
+		}
+	})
+
+	t.Run("confirming needs an authorized payment", func(t *testing.T) {
+		expectStatus(t, confirmHold(buyerToken, order.Hold.ID), http.StatusPaymentRequired)
+
+		expectStatus(t, authorizeCard(otherToken, order.Payment.IntentID, payments.CardSuccess), http.StatusNotFound)
+
+		rec := authorizeCard(buyerToken, order.Payment.IntentID, payments.CardDeclined)
+		expectStatus(t, rec, http.StatusPaymentRequired)
+		expectStatus(t, confirmHold(buyerToken, order.Hold.ID), http.StatusPaymentRequired)
+
+		if registrations, _ := store.GetUserRegistrations("", buyerID, ""); len(registrations) != 0 {
+			t.Fatalf("expected no registration before payment, got %+v", registrations)
+		}
+	})
+
+	t.Run("a good card completes the order", func(t *testing.T) {
+		expectStatus(t, authorizeCard(buyerToken, order.Payment.IntentID, payments.CardSuccess), http.StatusOK)
+
+		rec := confirmHold(buyerToken, order.Hold.ID)
+		expectStatus(t, rec, http.StatusCreated)
+
+		var resp struct {
+			Registration Registration `json:"registration"`
+			Tickets      []Ticket     `json:"tickets"`
+			Payment      Payment      `json:"payment"`
+		}
+		decodeBody(t, rec, &resp)
+		if resp.Payment.Status != "captured" || resp.Payment.RegistrationID != resp.Registration.ID {
+			t.Fatalf("expected the payment to be captured for the registration, got %+v", resp.Payment)
+		}
+		if len(resp.Tickets) != 2 || resp.Tickets[0].PricePaid != 499 {
+			t.Fatalf("expected 2 tickets at 499, got %+v", resp.Tickets)
+		}
+
+		intent, _ := paymentProvider.GetIntent(order.Payment.IntentID)
+		if intent.Status != payments.StatusSucceeded || intent.Amount != 99800 {
+			t.Fatalf("expected 99800 paise captured, got %+v", intent)
+		}
+	})
+}
+
+func TestPaidCheckoutCaptureFailure(t *testing.T) {
+	store := newTestStore(t)
+	organizerID, _ := newTestUser(t, store, "organizer@example.com", roleOrganizer)
+	buyerID, buyerToken := newTestUser(t, store, "buyer@example.com", roleAttendee)
+
+	event := newTestEvent(t, store, organizerID, CreateEventRequest{Price: 499})
+	order := startPaidOrder(t, buyerToken, EventRegistrationRequest{EventID: event.ID})
+
+	expectStatus(t, authorizeCard(buyerToken, order.Payment.IntentID, payments.CardCaptureFails), http.StatusOK)
+	expectStatus(t, confirmHold(buyerToken, order.Hold.ID), http.StatusPaymentRequired)
+
+	if registrations, _ := store.GetUserRegistrations("", buyerID, ""); len(registrations) != 0 {
+		t.Fatalf("expected no registration after a failed capture, got %+v", registrations)
+	}
+}
+
+func TestReleasedHoldCancelsPayment(t *testing.T) {
+	store := newTestStore(t)
+	organizerID, _ := newTestUser(t, store, "organizer@example.com", roleOrganizer)
+	_, buyerToken := newTestUser(t, store, "buyer@example.com", roleAttendee)
+
+	event := newTestEvent(t, store, organizerID, CreateEventRequest{Price: 499})
+	order := startPaidOrder(t, buyerToken, EventRegistrationRequest{EventID: event.ID})
+	expectStatus(t, authorizeCard(buyerToken, order.Payment.IntentID, payments.CardSuccess), http.StatusOK)
+
+	rec := serveAuthenticated(handleHoldDetail, http.MethodDelete, "/api/holds/"+order.Hold.ID, buyerToken, nil)
+	expectStatus(t, rec, http.StatusOK)
+
+	intent, _ := paymentProvider.GetIntent(order.Payment.IntentID)
+	if intent.Status != payments.StatusCanceled {
+		t.Fatalf("expected the authorization to be voided, got %s", intent.Status)
+	}
+	if payment, _ := store.GetPaymentByIntent(order.Payment.IntentID); payment.Status != "cancelled" {
+		t.Fatalf("expected the payment to be cancelled, got %s", payment.Status)
+	}
+}
+
+func TestPaymentWebhook(t *testing.T) {
+	store := newTestStore(t)
+	organizerID, _ := newTestUser(t, store, "organizer@example.com", roleOrganizer)
+	buyerID, buyerToken := newTestUser(t, store, "buyer@example.com", roleAttendee)
+
+	event := newTestEvent(t, store, organizerID, CreateEventRequest{Price: 499})
+	order := startPaidOrder(t, buyerToken, EventRegistrationRequest{EventID: event.ID})
+	expectStatus(t, authorizeCard(buyerToken, order.Payment.IntentID, payments.CardSuccess), http.StatusOK)
+
+	intent, _ := paymentProvider.GetIntent(order.Payment.IntentID)
+	authorized := payments.Event{ID: "evt_1", Type: payments.EventAuthorized, Intent: *intent}
+
+	expectStatus(t, deliverWebhook(t, authorized, "deadbeef"), http.StatusBadRequest)
+	if registrations, _ := store.GetUserRegistrations("", buyerID, ""); len(registrations) != 0 {
+		t.Fatal("expected an unsigned webhook to be ignored")
+	}
+
+	// The buyer never comes back; the webhook finishes the order
+	expectStatus(t, deliverWebhook(t, authorized, ""), http.StatusOK)
+
+	registrations, _ := store.GetUserRegistrations("", buyerID, "")
+	if len(registrations) != 1 || registrations[0].Status != "confirmed" {
+		t.Fatalf("expected the webhook to confirm the order, got %+v", registrations)
+	}
+	if tickets, _ := store.GetUserTickets(buyerID, "active"); len(tickets) != 1 {
+		t.Fatalf("expected the webhook to issue the ticket, got %d", len(tickets))
+	}
+
+	// A redelivery or a late confirmation returns the same order
+	expectStatus(t, deliverWebhook(t, authorized, ""), http.StatusOK)
+	rec := confirmHold(buyerToken, order.Hold.ID)
+	expectStatus(t, rec, http.StatusOK)
+	if tickets, _ := store.GetUserTickets(buyerID, "active"); len(tickets) != 1 {
+		t.Fatalf("expected no extra tickets, got %d", len(tickets))
+	}
+
+	// Unknown intents are acknowledged so the provider stops retrying
+	unknown := payments.Event{ID: "evt_2", Type: payments.EventSucceeded, Intent: payments.Intent{ID: "pi_unknown"}}
+	expectStatus(t, deliverWebhook(t, unknown, ""), http.StatusOK)
+}
+
+func TestConfirmAfterWebhookKeepsPayment(t *testing.T) {
+	store := newTestStore(t)
+	organizerID, _ := newTestUser(t, store, "organizer@example.com", roleOrganizer)
+	buyerID, buyerToken := newTestUser(t, store, "buyer@example.com", roleAttendee)
+
+	event := newTestEvent(t, store, organizerID, CreateEventRequest{Price: 499})
+	order := startPaidOrder(t, buyerToken, EventRegistrationRequest{EventID: event.ID})
+	expectStatus(t, authorizeCard(buyerToken, order.Payment.IntentID, payments.CardSuccess), http.StatusOK)
+
+	// The buyer's confirmation loads the hold, then the webhook completes
+	// the order before the confirmation takes the reservation lock
+	stale, err := store.GetHold(order.Hold.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	intent, _ := paymentProvider.GetIntent(order.Payment.IntentID)
+	expectStatus(t, deliverWebhook(t, payments.Event{ID: "evt_1", Type: payments.EventAuthorized, Intent: *intent}, ""), http.StatusOK)
+
+	rec := httptest.NewRecorder()
+	handleConfirmHold(rec, newTestRequest(http.MethodPost, "/api/holds/"+stale.ID+"/confirm", nil), stale)
+	expectStatus(t, rec, http.StatusOK)
+
+	var resp registrationResponse
+	decodeBody(t, rec, &resp)
+	if resp.Registration.Status != "confirmed" || len(resp.Tickets) != 1 {
+		t.Fatalf("expected the webhook's order, got %+v", resp)
+	}
+
+	if intent, _ := paymentProvider.GetIntent(order.Payment.IntentID); intent.AmountRefunded != 0 {
+		t.Fatalf("expected the payment to be kept, got %d refunded", intent.AmountRefunded)
+	}
+	if payment, _ := store.GetPaymentByIntent(order.Payment.IntentID); payment.Status != "captured" || payment.RegistrationID != resp.Registration.ID {
+		t.Fatalf("expected the payment captured for the registration, got %+v", payment)
+	}
+	if tickets, _ := store.GetUserTickets(buyerID, "active"); len(tickets) != 1 {
+		t.Fatalf("expected one valid ticket, got %d", len(tickets))
+	}
+}
+
+func TestConcurrentWebhookAndConfirm(t *testing.T) {
+	store := newTestStore(t)
+	organizerID, _ := newTestUser(t, store, "organizer@example.com", roleOrganizer)
+	buyerID, buyerToken := newTestUser(t, store, "buyer@example.com", roleAttendee)
+
+	event := newTestEvent(t, store, organizerID, CreateEventRequest{Price: 499})
+	order := startPaidOrder(t, buyerToken, EventRegistrationRequest{EventID: event.ID})
+	expectStatus(t, authorizeCard(buyerToken, order.Payment.IntentID, payments.CardSuccess), http.StatusOK)
+
+	intent, _ := paymentProvider.GetIntent(order.Payment.IntentID)
+	authorized := payments.Event{ID: "evt_1", Type: payments.EventAuthorized, Intent: *intent}
+
+	var wg sync.WaitGroup
+	statuses := make(chan int, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			deliverWebhook(t, authorized, "")
+		}()
+		go func() {
+			defer wg.Done()
+			statuses <- confirmHold(buyerToken, order.Hold.ID).Code
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	for status := range statuses {
+		if status != http.StatusOK && status != http.StatusCreated {
+			t.Fatalf("expected every confirmation to return the order, got %d", status)
+		}
+	}
+
+	if intent, _ := paymentProvider.GetIntent(order.Payment.IntentID); intent.AmountRefunded != 0 {
+		t.Fatalf("expected the payment to be kept, got %d refunded", intent.AmountRefunded)
+	}
+	if registrations, _ := store.GetUserRegistrations("", buyerID, ""); len(registrations) != 1 {
+		t.Fatalf("expected one registration, got %d", len(registrations))
+	}
+	if tickets, _ := store.GetUserTickets(buyerID, "active"); len(tickets) != 1 {
+		t.Fatalf("expected one valid ticket, got %d", len(tickets))
+	}
+}
@@ -0,0 +1,168 @@
+// Package pdf writes simple single-font PDF documents (text and ruled
+// lines on A4 pages) without any external dependencies. It is meant for
+// generated paperwork such as invoices, not for general layout.
+//
+// Coordinates are in points from the top-left corner of the page, and text
+// uses the standard Helvetica fonts with WinAnsi encoding, so characters
+// outside Latin-1 are replaced with '?'.
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// A4 page size in points
+const (
+	PageWidth  = 595.28
+	PageHeight = 841.89
+)
+
+// Document is a PDF being built page by page
+type Document struct {
+	pages []*bytes.Buffer
+	title string
+}
+
+// New creates an empty document with the given title in its metadata
+func New(title string) *Document {
+	return &Document{title: title}
+}
+
+// AddPage starts a new page; drawing calls go to the last page added
+func (d *Document) AddPage() {
+	d.pages = append(d.pages, &bytes.Buffer{})
+}
+
+func (d *Document) page() *bytes.Buffer {
+	if len(d.pages) == 0 {
+		d.AddPage()
+	}
+	return d.pages[len(d.pages)-1]
+}
+
+// Text draws s with its baseline at (x, y) in the regular font
+func (d *Document) Text(x, y, size float64, s string) {
+	d.text("F1", x, y, size, s)
+}
+
+// BoldText draws s with its baseline at (x, y) in the bold font
+func (d *Document) BoldText(x, y, size float64, s string) {
+	d.text("F2", x, y, size, s)
+}
+
+// RightText draws s in the regular font so that it ends at x
+func (d *Document) RightText(x, y, size float64, s string) {
+	d.text("F1", x-TextWidth(s, size), y, size, s)
+}
+
+func (d *Document) text(font string, x, y, size float64, s string) {
+	fmt.Fprintf(d.page(), "BT /%s %s Tf %s %s Td (%s) Tj ET\n",
+		font, num(size), num(x), num(PageHeight-y), escape(s))
+}
+
+// Line draws a thin line from (x1, y1) to (x2, y2)
+func (d *Document) Line(x1, y1, x2, y2 float64) {
+	fmt.Fprintf(d.page(), "0.5 w %s %s m %s %s l S\n",
+		num(x1), num(PageHeight-y1), num(x2), num(PageHeight-y2))
+}
+
+// TextWidth estimates the width of s in the regular font. Helvetica is
+// proportional; an average glyph width is close enough to right-align
+// numbers, which use fixed-width digits.
+func TextWidth(s string, size float64) float64 {
+	width := 0.0
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9', r == ' ', r == '.', r == ',':
+			if r == ' ' || r == '.' || r == ',' {
+				width += 278
+			} else {
+				width += 556
+			}
+		case r >= 'A' && r <= 'Z':
+			width += 667
+		default:
+			width += 500
+		}
+	}
+	return width * size / 1000
+}
+
+// Bytes renders the document
+func (d *Document) Bytes() []byte {
+	if len(d.pages) == 0 {
+		d.AddPage()
+	}
+
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// 1: catalog, 2: page tree, 3-4: fonts, 5: info, then a page and its
+	// content stream for each page
+	const firstPage = 6
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPage+2*i)
+	}
+
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	object(fmt.Sprintf("<< /Title (%s) /Producer (go-ticket-api) >>", escape(d.title)))
+
+	for i, content := range d.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] "+
+			"/Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			num(PageWidth), num(PageHeight), firstPage+2*i+1))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	return out.Bytes()
+}
+
+// escape encodes s as the body of a PDF literal string in WinAnsi
+func escape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n' || r == '\r' || r == '\t':
+			b.WriteByte(' ')
+		case r >= 0x20 && r < 0x7f:
+			b.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// num formats a coordinate without needless precision
+func num(v float64) string {
+	s := fmt.Sprintf("%.2f", v)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	if s == "" || s == "-" {
+		return "0"
+	}
+	return s
+}
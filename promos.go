@@ -0,0 +1,573 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Promo code discount types
+const (
+	promoPercent = "percent"
+	promoFixed   = "fixed"
+)
+
+// PromoCode is a discount code an organizer offers for an event. A percent
+// code takes a share off the order; a fixed code takes an amount off the
+// whole order, never more than its total.
+type PromoCode struct {
+	ID             string   `json:"id"`
+	EventID        string   `json:"event_id"`
+	Code           string   `json:"code"`
+	DiscountType   string   `json:"discount_type"`
+	DiscountValue  float64  `json:"discount_value"`
+	MaxRedemptions *int     `json:"max_redemptions"`
+	PerUserLimit   int      `json:"per_user_limit"`
+	ValidFrom      string   `json:"valid_from,omitempty"`
+	ValidUntil     string   `json:"valid_until,omitempty"`
+	TierIDs        []string `json:"tier_ids,omitempty"`
+	Active         bool     `json:"active"`
+	CreatedAt      string   `json:"created_at"`
+}
+
+// PromoCodeUsage is a promo code as shown to its organizer
+type PromoCodeUsage struct {
+	PromoCode
+	Redemptions int  `json:"redemptions"`
+	Remaining   *int `json:"remaining"`
+}
+
+// PromoCodeRequest represents promo code input
+type PromoCodeRequest struct {
+	Code           string   `json:"code"`
+	DiscountType   string   `json:"discount_type"`
+	DiscountValue  float64  `json:"discount_value"`
+	MaxRedemptions *int     `json:"max_redemptions"`
+	PerUserLimit   int      `json:"per_user_limit"`
+	ValidFrom      string   `json:"valid_from"`
+	ValidUntil     string   `json:"valid_until"`
+	TierIDs        []string `json:"tier_ids"`
+}
+
+// Promo code errors
+var (
+	errPromoInvalid       = errors.New("invalid promo code")
+	errPromoExhausted     = errors.New("promo code fully redeemed")
+	errPromoUserLimit     = errors.New("promo code user limit reached")
+	errDuplicatePromoCode = errors.New("promo code already exists")
+)
+
+// promoCodePattern is the shape of a normalized promo code
+var promoCodePattern = regexp.MustCompile(`^[A-Z0-9_-]{3,32}$`)
+
+// normalizePromoCode makes codes case-insensitive
+func normalizePromoCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// validatePromoCodeRequest checks promo code input against the event's tiers
+func validatePromoCodeRequest(req PromoCodeRequest, tiers []TicketTier) error {
+	if !promoCodePattern.MatchString(normalizePromoCode(req.Code)) {
+		return fmt.Errorf("code must be 3-32 letters, digits, dashes or underscores")
+	}
+
+	switch req.DiscountType {
+	case promoPercent:
+		if req.DiscountValue <= 0 || req.DiscountValue > 100 {
+			return fmt.Errorf("a percent discount must be between 0 and 100")
+		}
+	case promoFixed:
+		if req.DiscountValue <= 0 {
+			return fmt.Errorf("a fixed discount must be positive")
+		}
+	default:
+		return fmt.Errorf("discount_type must be percent or fixed")
+	}
+
+	if req.MaxRedemptions != nil && *req.MaxRedemptions < 1 {
+		return fmt.Errorf("max_redemptions must be at least 1")
+	}
+	if req.PerUserLimit < 0 {
+		return fmt.Errorf("per_user_limit cannot be negative")
+	}
+
+	var from, until time.Time
+	var err error
+	if req.ValidFrom != "" {
+		if from, err = time.Parse(time.RFC3339, req.ValidFrom); err != nil {
+			return fmt.Errorf("valid_from must be an RFC 3339 timestamp")
+		}
+	}
+	if req.ValidUntil != "" {
+		if until, err = time.Parse(time.RFC3339, req.ValidUntil); err != nil {
+			return fmt.Errorf("valid_until must be an RFC 3339 timestamp")
+		}
+	}
+	if req.ValidFrom != "" && req.ValidUntil != "" && !until.After(from) {
+		return fmt.Errorf("valid_until must be after valid_from")
+	}
+
+	for _, tierID := range req.TierIDs {
+		found := false
+		for _, tier := range tiers {
+			if tier.ID == tierID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("tier %s does not belong to this event", tierID)
+		}
+	}
+
+	return nil
+}
+
+// orderPromoCode looks up the promo code given with an order and checks
+// that it can be used for the chosen tier right now
+func orderPromoCode(eventID, code string, tier *TicketTier, now time.Time) (*PromoCode, error) {
+	promo, err := promoStore.GetPromoCodeByCode(eventID, normalizePromoCode(code))
+	if err != nil {
+		return nil, fmt.Errorf("%w: this code does not exist for this event", errPromoInvalid)
+	}
+
+	if !promo.Active {
+		return nil, fmt.Errorf("%w: this code is no longer active", errPromoInvalid)
+	}
+	if from, err := time.Parse(time.RFC3339, promo.ValidFrom); err == nil && now.Before(from) {
+		return nil, fmt.Errorf("%w: this code is not valid yet", errPromoInvalid)
+	}
+	if until, err := time.Parse(time.RFC3339, promo.ValidUntil); err == nil && !now.Before(until) {
+		return nil, fmt.Errorf("%w: this code has expired", errPromoInvalid)
+	}
+
+	if len(promo.TierIDs) > 0 {
+		applies := false
+		for _, tierID := range promo.TierIDs {
+			if tier != nil && tier.ID == tierID {
+				applies = true
+				break
+			}
+		}
+		if !applies {
+			return nil, fmt.Errorf("%w: this code does not apply to the selected ticket tier", errPromoInvalid)
+		}
+	}
+
+	return promo, nil
+}
+
+// promoDiscount returns the discount a promo code gives on subtotal
+func promoDiscount(promo *PromoCode, subtotal float64) float64 {
+	if promo == nil {
+		return 0
+	}
+
+	var discount int64
+	switch promo.DiscountType {
+	case promoPercent:
+		discount = toMinorUnits(subtotal * promo.DiscountValue / 100)
+	case promoFixed:
+		discount = toMinorUnits(promo.DiscountValue)
+	}
+
+	return fromMinorUnits(min(discount, toMinorUnits(subtotal)))
+}
+
+// orderTotal returns what an order of seats costs after its discount
+func orderTotal(event *Event, tierID string, seats int, discount float64) float64 {
+	subtotal := toMinorUnits(orderAmount(event, tierID, seats))
+	return fromMinorUnits(max(subtotal-toMinorUnits(discount), 0))
+}
+
+// ensurePromoAvailable checks a promo code's redemption limits before a
+// registration or hold uses it. Redemptions are counted from live
+// registrations and active holds, so callers must hold the event's
+// reservation lock for the check to be atomic with the insert.
+func ensurePromoAvailable(promo *PromoCode, userID string) error {
+	if promo == nil {
+		return nil
+	}
+
+	total, byUser, err := promoStore.CountPromoRedemptions(promo.ID, userID)
+	if err != nil {
+		return err
+	}
+
+	if promo.MaxRedemptions != nil && total >= *promo.MaxRedemptions {
+		return errPromoExhausted
+	}
+	if promo.PerUserLimit > 0 && byUser >= promo.PerUserLimit {
+		return errPromoUserLimit
+	}
+
+	return nil
+}
+
+// sendPromoError reports why a promo code could not be used, returning
+// false if err is not a promo code error
+func sendPromoError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, errPromoInvalid):
+		sendError(w, http.StatusBadRequest, "Invalid promo code", strings.TrimPrefix(err.Error(), errPromoInvalid.Error()+": "))
+	case err == errPromoExhausted || strings.Contains(err.Error(), "promo_exhausted"):
+		sendError(w, http.StatusConflict, "Promo code unavailable", "This code has been fully redeemed")
+	case err == errPromoUserLimit || strings.Contains(err.Error(), "promo_user_limit"):
+		sendError(w, http.StatusConflict, "Promo code unavailable", "You have already used this code the maximum number of times")
+	default:
+		return false
+	}
+	return true
+}
+
+// seatPrices splits an order's discount across its seats, so each ticket
+// records what was actually paid for it and the prices add up to the total
+func seatPrices(price float64, seats int, discount float64) []float64 {
+	prices := make([]float64, seats)
+	if seats == 0 {
+		return prices
+	}
+
+	off := toMinorUnits(discount)
+	share, remainder := off/int64(seats), off%int64(seats)
+	for seat := range prices {
+		paid := toMinorUnits(price) - share
+		if int64(seat) < remainder {
+			paid--
+		}
+		prices[seat] = fromMinorUnits(max(paid, 0))
+	}
+
+	return prices
+}
+
+// =====================================================
+// Promo Code Handlers
+// =====================================================
+
+// handleEventPromoCodes lets an event's team list, create and deactivate
+// its promo codes
+func handleEventPromoCodes(w http.ResponseWriter, r *http.Request, eventID string) {
+	auth := authFromRequest(r)
+
+	event, err := eventStore.GetEventByID(eventID)
+	if err != nil {
+		sendError(w, http.StatusNotFound, "Not found", "Event not found")
+		return
+	}
+
+	// Every team member may see promo codes; co-organizers and up change them
+	action := eventManage
+	if r.Method == http.MethodGet {
+		action = eventView
+	}
+	if !authorizeEvent(w, auth, event, action, "Only the event organizer can manage promo codes") {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		codes, err := promoStore.GetEventPromoCodes(eventID)
+		if err != nil {
+			fmt.Printf("Error fetching promo codes: %v\n", err)
+			sendError(w, http.StatusInternalServerError, "Server error", "Unable to fetch promo codes")
+			return
+		}
+
+		usage := []PromoCodeUsage{}
+		for _, code := range codes {
+			redemptions, _, err := promoStore.CountPromoRedemptions(code.ID, "")
+			if err != nil {
+				fmt.Printf("Error counting promo code redemptions: %v\n", err)
+				sendError(w, http.StatusInternalServerError, "Server error", "Unable to fetch promo codes")
+				return
+			}
+
+			entry := PromoCodeUsage{PromoCode: code, Redemptions: redemptions}
+			if code.MaxRedemptions != nil {
+				remaining := max(*code.MaxRedemptions-redemptions, 0)
+				entry.Remaining = &remaining
+			}
+			usage = append(usage, entry)
+		}
+
+		sendJSON(w, http.StatusOK, map[string]interface{}{
+			"promo_codes": usage,
+			"count":       len(usage),
+		})
+	case http.MethodPost:
+		var req PromoCodeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			sendError(w, http.StatusBadRequest, "Invalid request", "Invalid JSON format")
+			return
+		}
+
+		tiers, err := tierStore.GetEventTiers(eventID)
+		if err != nil {
+			fmt.Printf("Error fetching tiers: %v\n", err)
+			sendError(w, http.StatusInternalServerError, "Server error", "Unable to fetch ticket tiers")
+			return
+		}
+
+		if err := validatePromoCodeRequest(req, tiers); err != nil {
+			sendError(w, http.StatusBadRequest, "Validation error", err.Error())
+			return
+		}
+
+		promo, err := promoStore.CreatePromoCode(PromoCode{
+			EventID:        eventID,
+			Code:           normalizePromoCode(req.Code),
+			DiscountType:   req.DiscountType,
+			DiscountValue:  req.DiscountValue,
+			MaxRedemptions: req.MaxRedemptions,
+			PerUserLimit:   req.PerUserLimit,
+			ValidFrom:      req.ValidFrom,
+			ValidUntil:     req.ValidUntil,
+			TierIDs:        req.TierIDs,
+			Active:         true,
+		})
+		if err != nil {
+			if err == errDuplicatePromoCode || strings.Contains(err.Error(), "duplicate") || strings.Contains(err.Error(), "23505") {
+				sendError(w, http.StatusConflict, "Duplicate code", "This event already has that promo code")
+				return
+			}
+			fmt.Printf("Error creating promo code: %v\n", err)
+			sendError(w, http.StatusInternalServerError, "Server error", "Unable to create promo code")
+			return
+		}
+
+		sendJSON(w, http.StatusCreated, map[string]interface{}{
+			"promo_code": promo,
+			"message":    "Promo code created successfully",
+		})
+	case http.MethodDelete:
+		codeID := r.URL.Query().Get("code_id")
+		if codeID == "" {
+			sendError(w, http.StatusBadRequest, "Validation error", "code_id query parameter is required")
+			return
+		}
+
+		if err := promoStore.DeactivatePromoCode(eventID, codeID); err != nil {
+			fmt.Printf("Error deactivating promo code: %v\n", err)
+			sendError(w, http.StatusInternalServerError, "Server error", "Unable to deactivate promo code")
+			return
+		}
+
+		sendJSON(w, http.StatusOK, map[string]interface{}{
+			"message": "Promo code deactivated successfully",
+		})
+	default:
+		sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "Only GET, POST, and DELETE methods are allowed")
+	}
+}
+
+// =====================================================
+// Supabase Promo Code Functions
+// =====================================================
+
+// CreatePromoCode stores a promo code
+func (c *SupabaseClient) CreatePromoCode(promo PromoCode) (*PromoCode, error) {
+	payload := map[string]interface{}{
+		"event_id":        promo.EventID,
+		"code":            promo.Code,
+		"discount_type":   promo.DiscountType,
+		"discount_value":  promo.DiscountValue,
+		"max_redemptions": promo.MaxRedemptions,
+		"per_user_limit":  promo.PerUserLimit,
+		"valid_from":      nullIfEmpty(promo.ValidFrom),
+		"valid_until":     nullIfEmpty(promo.ValidUntil),
+		"tier_ids":        promo.TierIDs,
+		"active":          promo.Active,
+	}
+
+	var created []PromoCode
+	if err := c.doREST("POST", "/rest/v1/promo_codes", "", payload, &created); err != nil {
+		return nil, err
+	}
+
+	if len(created) == 0 {
+		return nil, fmt.Errorf("promo code created but no data returned")
+	}
+
+	return &created[0], nil
+}
+
+// GetEventPromoCodes returns an event's promo codes, newest first
+func (c *SupabaseClient) GetEventPromoCodes(eventID string) ([]PromoCode, error) {
+	path := fmt.Sprintf("/rest/v1/promo_codes?event_id=eq.%s&select=*&order=created_at.desc", eventID)
+
+	var codes []PromoCode
+	if err := c.doREST("GET", path, "", nil, &codes); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// GetPromoCodeByCode returns an event's promo code by its normalized code
+func (c *SupabaseClient) GetPromoCodeByCode(eventID, code string) (*PromoCode, error) {
+	path := fmt.Sprintf("/rest/v1/promo_codes?event_id=eq.%s&code=eq.%s&select=*", eventID, url.QueryEscape(code))
+
+	var codes []PromoCode
+	if err := c.doREST("GET", path, "", nil, &codes); err != nil {
+		return nil, err
+	}
+
+	if len(codes) == 0 {
+		return nil, fmt.Errorf("promo code not found")
+	}
+
+	return &codes[0], nil
+}
+
+// DeactivatePromoCode stops a promo code from being used for new orders
+func (c *SupabaseClient) DeactivatePromoCode(eventID, codeID string) error {
+	path := fmt.Sprintf("/rest/v1/promo_codes?id=eq.%s&event_id=eq.%s", codeID, eventID)
+	return c.doREST("PATCH", path, "", map[string]interface{}{"active": false}, nil)
+}
+
+// CountPromoRedemptions counts a promo code's live redemptions, and those
+// of them made by userID
+func (c *SupabaseClient) CountPromoRedemptions(codeID, userID string) (int, int, error) {
+	var registrations []struct {
+		UserID string `json:"user_id"`
+		Status string `json:"status"`
+	}
+	path := fmt.Sprintf("/rest/v1/registrations?promo_code_id=eq.%s&select=user_id,status", codeID)
+	if err := c.doREST("GET", path, "", nil, &registrations); err != nil {
+		return 0, 0, err
+	}
+
+	var holds []struct {
+		UserID string `json:"user_id"`
+	}
+	path = fmt.Sprintf("/rest/v1/seat_holds?promo_code_id=eq.%s&status=eq.active&expires_at=gt.%s&select=user_id",
+		codeID, url.QueryEscape(nowTimestamp()))
+	if err := c.doREST("GET", path, "", nil, &holds); err != nil {
+		return 0, 0, err
+	}
+
+	total, byUser := len(holds), 0
+	for _, registration := range registrations {
+		if registration.Status == "confirmed" || registration.Status == "waitlisted" {
+			total++
+		}
+		if registration.UserID == userID && registration.Status != "cancelled" {
+			byUser++
+		}
+	}
+	for _, hold := range holds {
+		if hold.UserID == userID {
+			byUser++
+		}
+	}
+
+	return total, byUser, nil
+}
+
+// =====================================================
+// In-memory Promo Code Functions
+// =====================================================
+
+// CreatePromoCode stores a promo code, enforcing unique codes per event
+func (m *MemoryStore) CreatePromoCode(promo PromoCode) (*PromoCode, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.promoCodes {
+		if existing.EventID == promo.EventID && existing.Code == promo.Code {
+			return nil, errDuplicatePromoCode
+		}
+	}
+
+	promo.ID = newID()
+	promo.CreatedAt = nowTimestamp()
+	m.promoCodes[promo.ID] = &promo
+
+	created := promo
+	return &created, nil
+}
+
+// GetEventPromoCodes returns an event's promo codes, newest first
+func (m *MemoryStore) GetEventPromoCodes(eventID string) ([]PromoCode, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	codes := []PromoCode{}
+	for _, promo := range m.promoCodes {
+		if promo.EventID == eventID {
+			codes = append(codes, *promo)
+		}
+	}
+
+	sort.Slice(codes, func(i, j int) bool {
+		return codes[i].CreatedAt > codes[j].CreatedAt
+	})
+
+	return codes, nil
+}
+
+// GetPromoCodeByCode returns an event's promo code by its normalized code
+func (m *MemoryStore) GetPromoCodeByCode(eventID, code string) (*PromoCode, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, promo := range m.promoCodes {
+		if promo.EventID == eventID && promo.Code == code {
+			found := *promo
+			return &found, nil
+		}
+	}
+
+	return nil, fmt.Errorf("promo code not found")
+}
+
+// DeactivatePromoCode stops a promo code from being used for new orders
+func (m *MemoryStore) DeactivatePromoCode(eventID, codeID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if promo, exists := m.promoCodes[codeID]; exists && promo.EventID == eventID {
+		promo.Active = false
+	}
+
+	return nil
+}
+
+// CountPromoRedemptions counts a promo code's live redemptions, and those
+// of them made by userID
+func (m *MemoryStore) CountPromoRedemptions(codeID, userID string) (int, int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	total, byUser := 0, 0
+	for _, reg := range m.registrations {
+		if reg.PromoCodeID != codeID {
+			continue
+		}
+		if reg.Status == "confirmed" || reg.Status == "waitlisted" {
+			total++
+		}
+		if reg.UserID == userID && reg.Status != "cancelled" {
+			byUser++
+		}
+	}
+
+	now := time.Now()
+	for _, hold := range m.holds {
+		if hold.PromoCodeID == codeID && holdIsActive(hold, now) {
+			total++
+			if hold.UserID == userID {
+				byUser++
+			}
+		}
+	}
+
+	return total, byUser, nil
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// createPromo creates a promo code through the event's promo code route
+func createPromo(t *testing.T, token, eventID string, req PromoCodeRequest) PromoCode {
+	t.Helper()
+
+	rec := serveAuthenticated(handleEventDetail, http.MethodPost, "/api/events/"+eventID+"/promo-codes", token, req)
+	expectStatus(t, rec, http.StatusCreated)
+
+	var resp struct {
+		PromoCode PromoCode `json:"promo_code"`
+	}
+	decodeBody(t, rec, &resp)
+	return resp.PromoCode
+}
+
+func TestValidatePromoCodeRequest(t *testing.T) {
+	zero := 0
+	tiers := []TicketTier{{ID: "tier-1"}}
+
+	tests := []struct {
+		name  string
+		req   PromoCodeRequest
+		valid bool
+	}{
+		{"percent", PromoCodeRequest{Code: "early-bird", DiscountType: promoPercent, DiscountValue: 100}, true},
+		{"fixed for a tier", PromoCodeRequest{Code: "VIP_50", DiscountType: promoFixed, DiscountValue: 50, TierIDs: []string{"tier-1"}}, true},
+		{"short code", PromoCodeRequest{Code: "AB", DiscountType: promoPercent, DiscountValue: 10}, false},
+		{"code with spaces", PromoCodeRequest{Code: "EARLY BIRD", DiscountType: promoPercent, DiscountValue: 10}, false},
+		{"percent over 100", PromoCodeRequest{Code: "FREE", DiscountType: promoPercent, DiscountValue: 101}, false},
+		{"zero fixed", PromoCodeRequest{Code: "NONE", DiscountType: promoFixed}, false},
+		{"unknown type", PromoCodeRequest{Code: "BOGO", DiscountType: "bogo", DiscountValue: 1}, false},
+		{"zero redemptions", PromoCodeRequest{Code: "NONE", DiscountType: promoFixed, DiscountValue: 1, MaxRedemptions: &zero}, false},
+		{"negative user limit", PromoCodeRequest{Code: "NONE", DiscountType: promoFixed, DiscountValue: 1, PerUserLimit: -1}, false},
+		{"bad date", PromoCodeRequest{Code: "NONE", DiscountType: promoFixed, DiscountValue: 1, ValidFrom: "tomorrow"}, false},
+		{"window ends at its start", PromoCodeRequest{Code: "NONE", DiscountType: promoFixed, DiscountValue: 1, ValidFrom: "2030-01-01T00:00:00Z", ValidUntil: "2030-01-01T00:00:00Z"}, false},
+		{"another event's tier", PromoCodeRequest{Code: "NONE", DiscountType: promoFixed, DiscountValue: 1, TierIDs: []string{"tier-2"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validatePromoCodeRequest(tt.req, tiers); (err == nil) != tt.valid {
+				t.Fatalf("expected valid=%v, got %v", tt.valid, err)
+			}
+		})
+	}
+}
+
+func TestPromoDiscount(t *testing.T) {
+	tests := []struct {
+		name     string
+		promo    *PromoCode
+		subtotal float64
+		wanted   float64
+	}{
+		{"no code", nil, 999, 0},
+		{"percent", &PromoCode{DiscountType: promoPercent, DiscountValue: 10}, 999, 99.9},
+		{"percent rounds to the paisa", &PromoCode{DiscountType: promoPercent, DiscountValue: 15}, 333.33, 50},
+		{"full comp", &PromoCode{DiscountType: promoPercent, DiscountValue: 100}, 1498.5, 1498.5},
+		{"fixed", &PromoCode{DiscountType: promoFixed, DiscountValue: 150}, 999, 150},
+		{"fixed over the subtotal", &PromoCode{DiscountType: promoFixed, DiscountValue: 500}, 299, 299},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if discount := promoDiscount(tt.promo, tt.subtotal); discount != tt.wanted {
+				t.Fatalf("expected %v off, got %v", tt.wanted, discount)
+			}
+		})
+	}
+}
+
+func TestSeatPrices(t *testing.T) {
+	tests := []struct {
+		name     string
+		price    float64
+		seats    int
+		discount float64
+		wanted   []float64
+	}{
+		{"no discount", 100, 2, 0, []float64{100, 100}},
+		{"even split", 100, 2, 50, []float64{75, 75}},
+		{"leftover paise go to the first seats", 100, 3, 10, []float64{96.66, 96.67, 96.67}},
+		{"comp", 100, 2, 200, []float64{0, 0}},
+		{"no seats", 100, 0, 10, []float64{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prices := seatPrices(tt.price, tt.seats, tt.discount)
+			if fmt.Sprint(prices) != fmt.Sprint(tt.wanted) {
+				t.Fatalf("expected %v, got %v", tt.wanted, prices)
+			}
+
+			var paid int64
+			for _, price := range prices {
+				paid += toMinorUnits(price)
+			}
+			if total := max(toMinorUnits(tt.price)*int64(tt.seats)-toMinorUnits(tt.discount), 0); paid != total {
+				t.Fatalf("expected the seats to add up to %d, got %d", total, paid)
+			}
+		})
+	}
+}
+
+func TestOrderPromoCode(t *testing.T) {
+	store := newTestStore(t)
+	organizerID, organizerToken := newTestUser(t, store, "organizer@example.com", roleOrganizer)
+	event := newTestEvent(t, store, organizerID, CreateEventRequest{Price: 500})
+
+	vip, err := store.CreateTier(TicketTier{EventID: event.ID, Name: "VIP", Price: 1500})
+	if err != nil {
+		t.Fatal(err)
+	}
+	general, err := store.CreateTier(TicketTier{EventID: event.ID, Name: "General", Price: 500})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	from := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	until := from.Add(24 * time.Hour)
+	createPromo(t, organizerToken, event.ID, PromoCodeRequest{Code: "launch", DiscountType: promoPercent, DiscountValue: 20, ValidFrom: from.Format(time.RFC3339), ValidUntil: until.Format(time.RFC3339)})
+	createPromo(t, organizerToken, event.ID, PromoCodeRequest{Code: "VIP-ONLY", DiscountType: promoFixed, DiscountValue: 300, TierIDs: []string{vip.ID}})
+
+	tests := []struct {
+		name  string
+		code  string
+		tier  *TicketTier
+		now   time.Time
+		valid bool
+	}{
+		{"case-insensitive", " Launch ", nil, from, true},
+		{"not valid yet", "LAUNCH", nil, from.Add(-time.Second), false},
+		{"last moment", "LAUNCH", nil, until.Add(-time.Second), true},
+		{"expired", "LAUNCH", nil, until, false},
+		{"its tier", "VIP-ONLY", vip, from, true},
+		{"another tier", "VIP-ONLY", general, from, false},
+		{"no tier", "VIP-ONLY", nil, from, false},
+		{"unknown", "NOPE", nil, from, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := orderPromoCode(event.ID, tt.code, tt.tier, tt.now); (err == nil) != tt.valid {
+				t.Fatalf("expected valid=%v, got %v", tt.valid, err)
+			}
+		})
+	}
+
+	t.Run("duplicate", func(t *testing.T) {
+		rec := serveAuthenticated(handleEventDetail, http.MethodPost, "/api/events/"+event.ID+"/promo-codes", organizerToken, PromoCodeRequest{Code: "LAUNCH", DiscountType: promoFixed, DiscountValue: 1})
+		expectStatus(t, rec, http.StatusConflict)
+	})
+
+	t.Run("deactivated", func(t *testing.T) {
+		codes, _ := store.GetEventPromoCodes(event.ID)
+		for _, code := range codes {
+			rec := serveAuthenticated(handleEventDetail, http.MethodDelete, "/api/events/"+event.ID+"/promo-codes?code_id="+code.ID, organizerToken, nil)
+			expectStatus(t, rec, http.StatusOK)
+		}
+		if _, err := orderPromoCode(event.ID, "LAUNCH", nil, from); err == nil {
+			t.Fatal("expected a deactivated code to be refused")
+		}
+	})
+}
+
+func TestPromoRedemptionLimits(t *testing.T) {
+	store := newTestStore(t)
+	organizerID, organizerToken := newTestUser(t, store, "organizer@example.com", roleOrganizer)
+	event := newTestEvent(t, store, organizerID, CreateEventRequest{Price: 400})
+
+	t.Run("concurrent orders respect max redemptions", func(t *testing.T) {
+		const limit = 5
+		const buyers = 30
+
+		maxRedemptions := limit
+		createPromo(t, organizerToken, event.ID, PromoCodeRequest{Code: "FIRST5", DiscountType: promoPercent, DiscountValue: 25, MaxRedemptions: &maxRedemptions})
+
+		tokens := make([]string, buyers)
+		for i := range tokens {
+			_, tokens[i] = newTestUser(t, store, fmt.Sprintf("buyer-%d@example.com", i), roleAttendee)
+		}
+
+		var (
+			wg       sync.WaitGroup
+			mu       sync.Mutex
+			statuses = make(map[int]int)
+		)
+		for _, token := range tokens {
+			wg.Add(1)
+			go func(token string) {
+				defer wg.Done()
+
+				rec := serveAuthenticated(handleRegistrations, http.MethodPost, "/api/registrations", token, EventRegistrationRequest{EventID: event.ID, PromoCode: "first5"})
+
+				mu.Lock()
+				statuses[rec.Code]++
+				mu.Unlock()
+			}(token)
+		}
+		wg.Wait()
+
+		if statuses[http.StatusAccepted] != limit || statuses[http.StatusConflict] != buyers-limit {
+			t.Fatalf("expected %d discounted orders and %d refusals, got %v", limit, buyers-limit, statuses)
+		}
+
+		rec := serveAuthenticated(handleEventDetail, http.MethodGet, "/api/events/"+event.ID+"/promo-codes", organizerToken, nil)
+		expectStatus(t, rec, http.StatusOK)
+
+		var resp struct {
+			PromoCodes []PromoCodeUsage `json:"promo_codes"`
+		}
+		decodeBody(t, rec, &resp)
+		if len(resp.PromoCodes) != 1 || resp.PromoCodes[0].Redemptions != limit || *resp.PromoCodes[0].Remaining != 0 {
+			t.Fatalf("expected %d redemptions and none remaining, got %+v", limit, resp.PromoCodes)
+		}
+	})
+
+	t.Run("per-user limit ignores cancelled registrations", func(t *testing.T) {
+		promo := createPromo(t, organizerToken, event.ID, PromoCodeRequest{Code: "COMP", DiscountType: promoPercent, DiscountValue: 100, PerUserLimit: 1})
+		userID, token := newTestUser(t, store, "guest@example.com", roleAttendee)
+
+		// A comped order costs nothing, so it is confirmed straight away
+		first := registerForEvent(t, token, EventRegistrationRequest{EventID: event.ID, PromoCode: "COMP", Quantity: 2})
+		if first.Registration.Discount != 800 || first.Tickets[0].PricePaid != 0 {
+			t.Fatalf("expected the order to be comped, got %+v", first)
+		}
+
+		rec := serveAuthenticated(handleRegistrations, http.MethodPost, "/api/registrations", token, EventRegistrationRequest{EventID: event.ID, PromoCode: "COMP"})
+		expectStatus(t, rec, http.StatusConflict)
+		var resp ErrorResponse
+		decodeBody(t, rec, &resp)
+		if resp.Error != "Promo code unavailable" {
+			t.Fatalf("expected the user limit to refuse the code, got %+v", resp)
+		}
+
+		cancelRegistration(t, token, first.Registration.ID)
+		if total, byUser, _ := store.CountPromoRedemptions(promo.ID, userID); total != 0 || byUser != 0 {
+			t.Fatalf("expected a cancelled registration not to count, got %d total and %d for the user", total, byUser)
+		}
+	})
+}
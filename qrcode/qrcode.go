@@ -0,0 +1,603 @@
+// Package qrcode encodes data as QR Code symbols (ISO/IEC 18004, model 2)
+// in byte mode, versions 1 to 40, and renders them as PNG or SVG without
+// any external services.
+package qrcode
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Level is an error correction level
+type Level int
+
+// Error correction levels, recovering roughly 7%, 15%, 25% and 30% of the symbol
+const (
+	Low Level = iota
+	Medium
+	Quartile
+	High
+)
+
+// ErrTooLong is returned when data does not fit in a version 40 symbol
+var ErrTooLong = errors.New("qrcode: data too long")
+
+// ParseLevel parses "L", "M", "Q" or "H" (case-insensitive)
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToUpper(s) {
+	case "L":
+		return Low, nil
+	case "M":
+		return Medium, nil
+	case "Q":
+		return Quartile, nil
+	case "H":
+		return High, nil
+	default:
+		return 0, fmt.Errorf("qrcode: unknown error correction level %q (expected L, M, Q or H)", s)
+	}
+}
+
+// String returns the level's letter
+func (l Level) String() string {
+	return "LMQH"[l : l+1]
+}
+
+// formatBits returns the two bits encoding the level in the format information
+func (l Level) formatBits() int {
+	return [...]int{1, 0, 3, 2}[l]
+}
+
+// Code is an encoded QR Code symbol
+type Code struct {
+	Version int
+	Level   Level
+	Size    int
+
+	modules    [][]bool
+	isFunction [][]bool
+}
+
+// Dark reports whether the module at column x, row y is dark. Coordinates
+// outside the symbol are light, which covers the quiet zone.
+func (c *Code) Dark(x, y int) bool {
+	return x >= 0 && x < c.Size && y >= 0 && y < c.Size && c.modules[y][x]
+}
+
+// Encode encodes data in byte mode using the smallest version that fits at
+// the given level, choosing the mask with the lowest penalty score
+func Encode(data []byte, level Level) (*Code, error) {
+	if level < Low || level > High {
+		return nil, fmt.Errorf("qrcode: invalid error correction level %d", level)
+	}
+
+	version := 1
+	for ; version <= 40; version++ {
+		if dataBits(version, len(data)) <= numDataCodewords(version, level)*8 {
+			break
+		}
+	}
+	if version > 40 {
+		return nil, ErrTooLong
+	}
+
+	codewords := addECCAndInterleave(encodeData(data, version, level), version, level)
+
+	size := version*4 + 17
+	c := &Code{
+		Version:    version,
+		Level:      level,
+		Size:       size,
+		modules:    newGrid(size),
+		isFunction: newGrid(size),
+	}
+
+	c.drawFunctionPatterns()
+	c.drawCodewords(codewords)
+
+	bestMask, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		c.applyMask(mask)
+		c.drawFormatBits(mask)
+		if penalty := c.penaltyScore(); bestPenalty < 0 || penalty < bestPenalty {
+			bestMask, bestPenalty = mask, penalty
+		}
+		c.applyMask(mask) // masking is an XOR, so this undoes it
+	}
+
+	c.applyMask(bestMask)
+	c.drawFormatBits(bestMask)
+
+	return c, nil
+}
+
+func newGrid(size int) [][]bool {
+	grid := make([][]bool, size)
+	for i := range grid {
+		grid[i] = make([]bool, size)
+	}
+	return grid
+}
+
+// =====================================================
+// Data Encoding
+// =====================================================
+
+// charCountBits returns the width of the byte mode character count field
+func charCountBits(version int) int {
+	if version <= 9 {
+		return 8
+	}
+	return 16
+}
+
+// dataBits returns the number of bits needed for n bytes in byte mode
+func dataBits(version, n int) int {
+	return 4 + charCountBits(version) + 8*n
+}
+
+// bitBuffer accumulates bits most significant first
+type bitBuffer []bool
+
+func (b *bitBuffer) append(value, length int) {
+	for i := length - 1; i >= 0; i-- {
+		*b = append(*b, (value>>i)&1 == 1)
+	}
+}
+
+// encodeData builds the data codewords: mode, count, data, terminator and padding
+func encodeData(data []byte, version int, level Level) []byte {
+	capacity := numDataCodewords(version, level) * 8
+
+	var bits bitBuffer
+	bits.append(0x4, 4) // byte mode indicator
+	bits.append(len(data), charCountBits(version))
+	for _, b := range data {
+		bits.append(int(b), 8)
+	}
+
+	// Terminator of up to four zero bits, then pad to a byte boundary
+	terminator := capacity - len(bits)
+	if terminator > 4 {
+		terminator = 4
+	}
+	bits.append(0, terminator)
+	bits.append(0, (8-len(bits)%8)%8)
+
+	codewords := make([]byte, len(bits)/8, capacity/8)
+	for i, bit := range bits {
+		if bit {
+			codewords[i>>3] |= 1 << (7 - uint(i&7))
+		}
+	}
+
+	// Alternate pad bytes until the capacity is reached
+	for pad := byte(0xEC); len(codewords) < capacity/8; pad ^= 0xEC ^ 0x11 {
+		codewords = append(codewords, pad)
+	}
+
+	return codewords
+}
+
+// addECCAndInterleave splits data into blocks, appends Reed-Solomon error
+// correction to each and interleaves the result
+func addECCAndInterleave(data []byte, version int, level Level) []byte {
+	numBlocks := numErrorCorrectionBlocks[level][version]
+	blockECCLen := eccCodewordsPerBlock[level][version]
+	rawCodewords := numRawDataModules(version) / 8
+	numShortBlocks := numBlocks - rawCodewords%numBlocks
+	shortBlockLen := rawCodewords / numBlocks
+
+	divisor := reedSolomonDivisor(blockECCLen)
+
+	blocks := make([][]byte, numBlocks)
+	for i, k := 0, 0; i < numBlocks; i++ {
+		datLen := shortBlockLen - blockECCLen
+		if i >= numShortBlocks {
+			datLen++
+		}
+
+		block := make([]byte, 0, shortBlockLen+1)
+		block = append(block, data[k:k+datLen]...)
+		k += datLen
+
+		ecc := reedSolomonRemainder(block, divisor)
+		if i < numShortBlocks {
+			block = append(block, 0) // placeholder keeps blocks aligned, skipped below
+		}
+		blocks[i] = append(block, ecc...)
+	}
+
+	result := make([]byte, 0, rawCodewords)
+	for i := range blocks[0] {
+		for j, block := range blocks {
+			if i != shortBlockLen-blockECCLen || j >= numShortBlocks {
+				result = append(result, block[i])
+			}
+		}
+	}
+
+	return result
+}
+
+// =====================================================
+// Function Patterns
+// =====================================================
+
+func (c *Code) setFunction(x, y int, dark bool) {
+	c.modules[y][x] = dark
+	c.isFunction[y][x] = true
+}
+
+func (c *Code) drawFunctionPatterns() {
+	// Timing patterns
+	for i := 0; i < c.Size; i++ {
+		c.setFunction(6, i, i%2 == 0)
+		c.setFunction(i, 6, i%2 == 0)
+	}
+
+	// Finder patterns with their separators
+	c.drawFinderPattern(3, 3)
+	c.drawFinderPattern(c.Size-4, 3)
+	c.drawFinderPattern(3, c.Size-4)
+
+	// Alignment patterns, except where they would overlap the finders
+	positions := alignmentPatternPositions(c.Version)
+	last := len(positions) - 1
+	for i, y := range positions {
+		for j, x := range positions {
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			c.drawAlignmentPattern(x, y)
+		}
+	}
+
+	// Reserve the format areas; the real bits are drawn once the mask is chosen
+	c.drawFormatBits(0)
+	c.drawVersion()
+}
+
+// drawFinderPattern draws a finder centered on (x, y) plus its light border
+func (c *Code) drawFinderPattern(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			xx, yy := x+dx, y+dy
+			if xx < 0 || xx >= c.Size || yy < 0 || yy >= c.Size {
+				continue
+			}
+			dist := max(abs(dx), abs(dy))
+			c.setFunction(xx, yy, dist != 2 && dist != 4)
+		}
+	}
+}
+
+// drawAlignmentPattern draws a 5x5 alignment pattern centered on (x, y)
+func (c *Code) drawAlignmentPattern(x, y int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			c.setFunction(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+// drawFormatBits draws both copies of the level and mask with their BCH
+// error correction, plus the always-dark module
+func (c *Code) drawFormatBits(mask int) {
+	data := c.Level.formatBits()<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+
+	bit := func(i int) bool { return (bits>>i)&1 == 1 }
+
+	// Around the top left finder
+	for i := 0; i <= 5; i++ {
+		c.setFunction(8, i, bit(i))
+	}
+	c.setFunction(8, 7, bit(6))
+	c.setFunction(8, 8, bit(7))
+	c.setFunction(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		c.setFunction(14-i, 8, bit(i))
+	}
+
+	// Split between the other two finders
+	for i := 0; i < 8; i++ {
+		c.setFunction(c.Size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		c.setFunction(8, c.Size-15+i, bit(i))
+	}
+	c.setFunction(8, c.Size-8, true)
+}
+
+// drawVersion draws both copies of the version information (version 7 and up)
+func (c *Code) drawVersion() {
+	if c.Version < 7 {
+		return
+	}
+
+	rem := c.Version
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+	}
+	bits := c.Version<<12 | rem
+
+	for i := 0; i < 18; i++ {
+		dark := (bits>>i)&1 == 1
+		a, b := c.Size-11+i%3, i/3
+		c.setFunction(a, b, dark)
+		c.setFunction(b, a, dark)
+	}
+}
+
+// =====================================================
+// Codewords and Masking
+// =====================================================
+
+// drawCodewords places data in the zigzag order, two columns at a time from
+// the bottom right, skipping function modules
+func (c *Code) drawCodewords(data []byte) {
+	i := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5 // skip the vertical timing pattern
+		}
+		for vert := 0; vert < c.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = c.Size - 1 - vert // upward
+				}
+				if !c.isFunction[y][x] && i < len(data)*8 {
+					c.modules[y][x] = (data[i>>3]>>(7-uint(i&7)))&1 == 1
+					i++
+				}
+			}
+		}
+	}
+}
+
+// applyMask XORs the data modules with one of the eight mask patterns
+func (c *Code) applyMask(mask int) {
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert && !c.isFunction[y][x] {
+				c.modules[y][x] = !c.modules[y][x]
+			}
+		}
+	}
+}
+
+// Penalty weights from the specification
+const (
+	penaltyN1 = 3
+	penaltyN2 = 3
+	penaltyN3 = 40
+	penaltyN4 = 10
+)
+
+// finderLike is the 1:1:3:1:1 pattern penalized when next to four light modules
+var finderLike = []bool{true, false, true, true, true, false, true}
+
+// penaltyScore rates how hard the symbol is to scan; lower is better
+func (c *Code) penaltyScore() int {
+	result := 0
+	dark := 0
+
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if c.modules[y][x] {
+				dark++
+			}
+
+			// Runs of five or more, scored where each run starts
+			if x == 0 || c.modules[y][x] != c.modules[y][x-1] {
+				if run := c.run(x, y, 1, 0); run >= 5 {
+					result += penaltyN1 + run - 5
+				}
+			}
+			if y == 0 || c.modules[y][x] != c.modules[y-1][x] {
+				if run := c.run(x, y, 0, 1); run >= 5 {
+					result += penaltyN1 + run - 5
+				}
+			}
+
+			// 2x2 blocks of one color
+			if x < c.Size-1 && y < c.Size-1 {
+				color := c.modules[y][x]
+				if color == c.modules[y][x+1] && color == c.modules[y+1][x] && color == c.modules[y+1][x+1] {
+					result += penaltyN2
+				}
+			}
+
+			// Finder-like patterns, with the quiet zone counting as light
+			if c.finderLikeAt(x, y, 1, 0) {
+				result += penaltyN3
+			}
+			if c.finderLikeAt(x, y, 0, 1) {
+				result += penaltyN3
+			}
+		}
+	}
+
+	// Deviation of the dark proportion from 50%, in 5% steps
+	total := c.Size * c.Size
+	k := (abs(dark*20-total*10)+total-1)/total - 1
+	result += k * penaltyN4
+
+	return result
+}
+
+// run returns the length of the same-color run starting at (x, y)
+func (c *Code) run(x, y, dx, dy int) int {
+	color := c.modules[y][x]
+	n := 0
+	for x < c.Size && y < c.Size && c.modules[y][x] == color {
+		n++
+		x, y = x+dx, y+dy
+	}
+	return n
+}
+
+// finderLikeAt reports whether a 1:1:3:1:1 pattern starts at (x, y) with
+// four light modules before or after it
+func (c *Code) finderLikeAt(x, y, dx, dy int) bool {
+	for i, dark := range finderLike {
+		if c.Dark(x+i*dx, y+i*dy) != dark {
+			return false
+		}
+	}
+
+	lightBefore, lightAfter := true, true
+	for i := 1; i <= 4; i++ {
+		if c.Dark(x-i*dx, y-i*dy) {
+			lightBefore = false
+		}
+		if c.Dark(x+(6+i)*dx, y+(6+i)*dy) {
+			lightAfter = false
+		}
+	}
+
+	return lightBefore || lightAfter
+}
+
+// =====================================================
+// Reed-Solomon
+// =====================================================
+
+// reedSolomonDivisor returns the generator polynomial of the given degree,
+// highest term first with the leading 1 omitted
+func reedSolomonDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = gfMultiply(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+
+	return result
+}
+
+// reedSolomonRemainder returns the error correction codewords for data
+func reedSolomonRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, coef := range divisor {
+			result[i] ^= gfMultiply(coef, factor)
+		}
+	}
+	return result
+}
+
+// gfMultiply multiplies in GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1
+func gfMultiply(x, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>uint(i))&1) * int(x)
+	}
+	return byte(z)
+}
+
+// =====================================================
+// Capacity Tables
+// =====================================================
+
+// alignmentPatternPositions returns the row/column centers of the alignment patterns
+func alignmentPatternPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+
+	numAlign := version/7 + 2
+	step := (version*4 + numAlign*2 + 1) / (numAlign*2 - 2) * 2
+	if version == 32 {
+		step = 26
+	}
+
+	positions := make([]int, numAlign)
+	positions[0] = 6
+	for i, pos := numAlign-1, version*4+10; i >= 1; i, pos = i-1, pos-step {
+		positions[i] = pos
+	}
+
+	return positions
+}
+
+// numRawDataModules returns the number of modules available for data and
+// error correction once function patterns are placed
+func numRawDataModules(version int) int {
+	result := (16*version+128)*version + 64
+	if version >= 2 {
+		numAlign := version/7 + 2
+		result -= (25*numAlign-10)*numAlign - 55
+		if version >= 7 {
+			result -= 36
+		}
+	}
+	return result
+}
+
+// numDataCodewords returns the data capacity in bytes, excluding error correction
+func numDataCodewords(version int, level Level) int {
+	return numRawDataModules(version)/8 -
+		eccCodewordsPerBlock[level][version]*numErrorCorrectionBlocks[level][version]
+}
+
+// eccCodewordsPerBlock is indexed by level then version (index 0 unused)
+var eccCodewordsPerBlock = [4][41]int{
+	{0, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30, 28, 28, 28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{0, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26, 26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28},
+	{0, 13, 22, 18, 26, 18, 24, 18, 22, 20, 24, 28, 26, 24, 20, 30, 24, 28, 28, 26, 30, 28, 30, 30, 30, 30, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{0, 17, 28, 22, 16, 22, 28, 26, 26, 24, 28, 24, 28, 22, 24, 24, 30, 28, 28, 26, 28, 30, 24, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+}
+
+// numErrorCorrectionBlocks is indexed by level then version (index 0 unused)
+var numErrorCorrectionBlocks = [4][41]int{
+	{0, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8, 8, 9, 9, 10, 12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25},
+	{0, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16, 17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49},
+	{0, 1, 1, 2, 2, 4, 4, 6, 6, 8, 8, 8, 10, 12, 16, 12, 17, 16, 18, 21, 20, 23, 23, 25, 27, 29, 34, 34, 35, 38, 40, 43, 45, 48, 51, 53, 56, 59, 62, 65, 68},
+	{0, 1, 1, 2, 4, 4, 4, 5, 6, 8, 8, 11, 11, 16, 16, 18, 16, 19, 21, 25, 25, 25, 34, 30, 32, 35, 37, 40, 42, 45, 48, 51, 54, 57, 60, 63, 66, 70, 74, 77, 81},
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
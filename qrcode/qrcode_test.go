@@ -0,0 +1,429 @@
+package qrcode
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// Known answers from ISO/IEC 18004 and its worked examples
+var (
+	// Format information strings, indexed by level then mask
+	formatStrings = map[Level][8]string{
+		Low:      {"111011111000100", "111001011110011", "111110110101010", "111100010011101", "110011000101111", "110001100011000", "110110001000001", "110100101110110"},
+		Medium:   {"101010000010010", "101000100100101", "101111001111100", "101101101001011", "100010111111001", "100000011001110", "100111110010111", "100101010100000"},
+		Quartile: {"011010101011111", "011000001101000", "011111100110001", "011101000000110", "010010010110100", "010000110000011", "010111011011010", "010101111101101"},
+		High:     {"001011010001001", "001001110111110", "001110011100111", "001100111010000", "000011101100010", "000001001010101", "000110100001100", "000100000111011"},
+	}
+
+	// Version information strings
+	versionStrings = map[int]string{
+		7:  "000111110010010100",
+		8:  "001000010110111100",
+		9:  "001001101010011001",
+		10: "001010010011010011",
+		40: "101000110001101001",
+	}
+)
+
+func TestReedSolomon(t *testing.T) {
+	// "HELLO WORLD" in alphanumeric mode, the standard worked example
+	data := []byte{0x20, 0x5B, 0x0B, 0x78, 0xD1, 0x72, 0xDC, 0x4D, 0x43, 0x40, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11}
+
+	tests := []struct {
+		name string
+		data []byte
+		want []byte
+	}{
+		{"1-M", data, []byte{0xC4, 0x23, 0x27, 0x77, 0xEB, 0xD7, 0xE7, 0xE2, 0x5D, 0x17}},
+		{"1-Q", data[:13], []byte{0xA8, 0x48, 0x16, 0x52, 0xD9, 0x36, 0x9C, 0x00, 0x2E, 0x0F, 0xB4, 0x7A, 0x10}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := reedSolomonRemainder(tt.data, reedSolomonDivisor(len(tt.want)))
+			if !bytes.Equal(got, tt.want) {
+				t.Fatalf("expected % X, got % X", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestEncodeData(t *testing.T) {
+	// Mode 0100, count 00000001, 'A' 01000001, terminator 0000, then pad bytes
+	want := []byte{0x40, 0x14, 0x10, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC}
+	if got := encodeData([]byte("A"), 1, Medium); !bytes.Equal(got, want) {
+		t.Fatalf("expected % X, got % X", want, got)
+	}
+
+	// Version 10 and up use a 16-bit count
+	got := encodeData([]byte("A"), 10, Medium)
+	if !bytes.Equal(got[:4], []byte{0x40, 0x00, 0x14, 0x10}) || len(got) != numDataCodewords(10, Medium) {
+		t.Fatalf("unexpected version 10 data codewords % X", got[:4])
+	}
+}
+
+func TestFormatAndVersionBits(t *testing.T) {
+	for level, strings := range formatStrings {
+		for mask, want := range strings {
+			c := blankCode(1, level)
+			c.drawFormatBits(mask)
+
+			first, second := readFormatBits(c)
+			if first != want || second != want {
+				t.Fatalf("%s mask %d: expected %s, got %s and %s", level, mask, want, first, second)
+			}
+		}
+	}
+
+	for version, want := range versionStrings {
+		c := blankCode(version, Low)
+		c.drawVersion()
+
+		first, second := readVersionBits(c)
+		if first != want || second != want {
+			t.Fatalf("version %d: expected %s, got %s and %s", version, want, first, second)
+		}
+	}
+}
+
+func TestCapacity(t *testing.T) {
+	// Byte mode capacities from the specification
+	tests := []struct {
+		version int
+		level   Level
+		bytes   int
+	}{
+		{1, Low, 17}, {1, Medium, 14}, {1, Quartile, 11}, {1, High, 7},
+		{2, Low, 32}, {2, High, 14},
+		{10, Low, 271}, {10, Medium, 213}, {10, Quartile, 151}, {10, High, 119},
+		{40, Low, 2953}, {40, Medium, 2331}, {40, Quartile, 1663}, {40, High, 1273},
+	}
+	for _, tt := range tests {
+		code, err := Encode(make([]byte, tt.bytes), tt.level)
+		if err != nil || code.Version != tt.version {
+			t.Fatalf("%d bytes at %s: expected version %d, got %+v (%v)", tt.bytes, tt.level, tt.version, code, err)
+		}
+		if tt.version == 40 {
+			continue
+		}
+		if code, _ := Encode(make([]byte, tt.bytes+1), tt.level); code.Version != tt.version+1 {
+			t.Fatalf("%d bytes at %s: expected version %d, got %d", tt.bytes+1, tt.level, tt.version+1, code.Version)
+		}
+	}
+
+	if _, err := Encode(make([]byte, 2954), Low); !errors.Is(err, ErrTooLong) {
+		t.Fatalf("expected ErrTooLong, got %v", err)
+	}
+	if _, err := Encode(nil, Level(7)); err == nil {
+		t.Fatal("expected an invalid level to be rejected")
+	}
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	tests := []struct {
+		data  string
+		level Level
+	}{
+		{"HELLO WORLD", Medium},
+		{"GT1.ed-1.eyJlIjoiZXZlbnQtMSIsInQiOiJ0aWNrZXQtMSJ9.c2lnbmF0dXJl", Quartile},
+		{strings.Repeat("ticket-", 40), High},                // several blocks of two lengths
+		{strings.Repeat("0123456789", 30), Low},              // version 10+, 16-bit count
+		{strings.Repeat("multi-block-payload ", 60), Medium}, // version info present
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d bytes at %s", len(tt.data), tt.level), func(t *testing.T) {
+			code, err := Encode([]byte(tt.data), tt.level)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := decode(t, code); got != tt.data {
+				t.Fatalf("expected %q, got %q", tt.data, got)
+			}
+		})
+	}
+}
+
+func TestFunctionPatterns(t *testing.T) {
+	code, err := Encode([]byte("HELLO WORLD"), Medium)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code.Version != 1 || code.Size != 21 {
+		t.Fatalf("expected a 21x21 version 1 symbol, got version %d size %d", code.Version, code.Size)
+	}
+
+	// Finder: dark ring, light ring, dark 3x3 center, then a light separator
+	for _, corner := range [][2]int{{0, 0}, {code.Size - 7, 0}, {0, code.Size - 7}} {
+		for dy := 0; dy < 7; dy++ {
+			for dx := 0; dx < 7; dx++ {
+				ring := max(abs(dx-3), abs(dy-3))
+				if want := ring != 2; code.Dark(corner[0]+dx, corner[1]+dy) != want {
+					t.Fatalf("finder at %v: module (%d,%d) should be dark=%v", corner, dx, dy, want)
+				}
+			}
+		}
+	}
+
+	for i := 8; i < code.Size-8; i++ {
+		if code.Dark(i, 6) != (i%2 == 0) || code.Dark(6, i) != (i%2 == 0) {
+			t.Fatalf("timing pattern broken at %d", i)
+		}
+	}
+	if !code.Dark(8, code.Size-8) {
+		t.Fatal("expected the dark module to be set")
+	}
+	if code.Dark(-1, 0) || code.Dark(0, code.Size) {
+		t.Fatal("expected the quiet zone to be light")
+	}
+}
+
+func TestRender(t *testing.T) {
+	code, err := Encode([]byte("HELLO WORLD"), Medium)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if scale := code.Scale(290); scale != 10 {
+		t.Fatalf("expected 10 pixels per module for 29 modules in 290px, got %d", scale)
+	}
+	if scale := code.Scale(10); scale != 1 {
+		t.Fatalf("expected the scale to be at least 1, got %d", scale)
+	}
+
+	raw, err := code.PNG(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bounds := img.Bounds(); bounds.Dx() != 87 || bounds.Dy() != 87 {
+		t.Fatalf("expected an 87x87 image, got %v", bounds)
+	}
+	for _, p := range [][2]int{{0, 0}, {11, 11}, {13, 13}, {15, 15}} {
+		r, _, _, _ := img.At(p[0], p[1]).RGBA()
+		module := p[0]/3 - QuietZone
+		if dark := r == 0; dark != code.Dark(module, module) {
+			t.Fatalf("pixel %v should show module (%d,%d)", p, module, module)
+		}
+	}
+
+	svg := string(code.SVG(200))
+	if !strings.Contains(svg, `width="200" height="200" viewBox="0 0 29 29"`) {
+		t.Fatalf("unexpected SVG header: %s", svg[:200])
+	}
+	if !strings.Contains(svg, "M4,4h1v1h-1z") {
+		t.Fatal("expected the top left finder module to be drawn")
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for _, s := range []string{"L", "m", "Q", "h"} {
+		level, err := ParseLevel(s)
+		if err != nil || level.String() != strings.ToUpper(s) {
+			t.Fatalf("ParseLevel(%q) = %v, %v", s, level, err)
+		}
+	}
+	if _, err := ParseLevel("X"); err == nil {
+		t.Fatal("expected an unknown level to be rejected")
+	}
+}
+
+// =====================================================
+// Decoding helpers
+// =====================================================
+
+func blankCode(version int, level Level) *Code {
+	size := version*4 + 17
+	return &Code{Version: version, Level: level, Size: size, modules: newGrid(size), isFunction: newGrid(size)}
+}
+
+func bitString(bits []bool) string {
+	var sb strings.Builder
+	for _, bit := range bits {
+		if bit {
+			sb.WriteByte('1')
+		} else {
+			sb.WriteByte('0')
+		}
+	}
+	return sb.String()
+}
+
+// readFormatBits reads both copies of the format information, most significant bit first
+func readFormatBits(c *Code) (string, string) {
+	first := make([]bool, 15)
+	second := make([]bool, 15)
+
+	// Bit 14 down to bit 0 around the top left finder
+	coords := [][2]int{{0, 8}, {1, 8}, {2, 8}, {3, 8}, {4, 8}, {5, 8}, {7, 8}, {8, 8}, {8, 7}, {8, 5}, {8, 4}, {8, 3}, {8, 2}, {8, 1}, {8, 0}}
+	for i, p := range coords {
+		first[i] = c.modules[p[1]][p[0]]
+	}
+
+	// Bits 14 to 8 beside the bottom left finder, bits 7 to 0 below the top right one
+	for i := 0; i < 7; i++ {
+		second[i] = c.modules[c.Size-1-i][8]
+	}
+	for i := 7; i < 15; i++ {
+		second[i] = c.modules[8][c.Size-15+i]
+	}
+
+	return bitString(first), bitString(second)
+}
+
+// readVersionBits reads both copies of the version information, most significant bit first
+func readVersionBits(c *Code) (string, string) {
+	first := make([]bool, 18)
+	second := make([]bool, 18)
+	for i := 0; i < 18; i++ {
+		a, b := c.Size-11+i%3, i/3
+		first[17-i] = c.modules[b][a]
+		second[17-i] = c.modules[a][b]
+	}
+	return bitString(first), bitString(second)
+}
+
+// maskAt is the specification's mask condition for row i, column j
+func maskAt(mask, i, j int) bool {
+	switch mask {
+	case 0:
+		return (i+j)%2 == 0
+	case 1:
+		return i%2 == 0
+	case 2:
+		return j%3 == 0
+	case 3:
+		return (i+j)%3 == 0
+	case 4:
+		return (i/2+j/3)%2 == 0
+	case 5:
+		return (i*j)%2+(i*j)%3 == 0
+	case 6:
+		return ((i*j)%2+(i*j)%3)%2 == 0
+	default:
+		return ((i+j)%2+(i*j)%3)%2 == 0
+	}
+}
+
+// decode reads a symbol back: it identifies the level and mask from the
+// format information, unmasks, reads the codewords in placement order,
+// de-interleaves the blocks, checks their error correction and parses
+// the byte mode segment
+func decode(t *testing.T, c *Code) string {
+	t.Helper()
+
+	format, formatCopy := readFormatBits(c)
+	if format != formatCopy {
+		t.Fatalf("format copies differ: %s and %s", format, formatCopy)
+	}
+	mask := -1
+	for m, s := range formatStrings[c.Level] {
+		if s == format {
+			mask = m
+		}
+	}
+	if mask < 0 {
+		t.Fatalf("format %s is not a %s format string", format, c.Level)
+	}
+	if want, known := versionStrings[c.Version]; known {
+		if version, versionCopy := readVersionBits(c); version != want || versionCopy != want {
+			t.Fatalf("expected version information %s, got %s and %s", want, version, versionCopy)
+		}
+	}
+
+	// Read the data modules upward and downward in two-column strips
+	var bits []bool
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < c.Size; vert++ {
+			y := vert
+			if (right+1)&2 == 0 {
+				y = c.Size - 1 - vert
+			}
+			for _, x := range []int{right, right - 1} {
+				if !c.isFunction[y][x] {
+					bits = append(bits, c.modules[y][x] != maskAt(mask, y, x))
+				}
+			}
+		}
+	}
+	raw := make([]byte, len(bits)/8)
+	for i := range raw {
+		for _, bit := range bits[i*8 : i*8+8] {
+			raw[i] <<= 1
+			if bit {
+				raw[i] |= 1
+			}
+		}
+	}
+
+	// De-interleave: data codewords column by column, then error correction
+	numBlocks := numErrorCorrectionBlocks[c.Level][c.Version]
+	eccLen := eccCodewordsPerBlock[c.Level][c.Version]
+	totalData := numDataCodewords(c.Version, c.Level)
+	longBlocks := totalData % numBlocks
+
+	blocks := make([][]byte, numBlocks)
+	ecc := make([][]byte, numBlocks)
+	k := 0
+	for col := 0; col <= totalData/numBlocks; col++ {
+		for j := range blocks {
+			dataLen := totalData / numBlocks
+			if j >= numBlocks-longBlocks {
+				dataLen++
+			}
+			if col < dataLen {
+				blocks[j] = append(blocks[j], raw[k])
+				k++
+			}
+		}
+	}
+	for col := 0; col < eccLen; col++ {
+		for j := range ecc {
+			ecc[j] = append(ecc[j], raw[k])
+			k++
+		}
+	}
+
+	var data []byte
+	for j, block := range blocks {
+		if want := reedSolomonRemainder(block, reedSolomonDivisor(eccLen)); !bytes.Equal(ecc[j], want) {
+			t.Fatalf("block %d: error correction does not match its data", j)
+		}
+		data = append(data, block...)
+	}
+
+	// Parse the byte mode segment
+	if data[0]>>4 != 0x4 {
+		t.Fatalf("expected byte mode, got mode %X", data[0]>>4)
+	}
+	var dataBits bitBuffer
+	for _, b := range data {
+		dataBits.append(int(b), 8)
+	}
+	read := func(from, n int) int {
+		v := 0
+		for _, bit := range dataBits[from : from+n] {
+			v <<= 1
+			if bit {
+				v |= 1
+			}
+		}
+		return v
+	}
+	count := read(4, charCountBits(c.Version))
+	start := 4 + charCountBits(c.Version)
+	decoded := make([]byte, count)
+	for i := range decoded {
+		decoded[i] = byte(read(start+8*i, 8))
+	}
+
+	return string(decoded)
+}
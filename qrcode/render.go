@@ -0,0 +1,71 @@
+package qrcode
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+)
+
+// QuietZone is the light border, in modules, required around the symbol
+const QuietZone = 4
+
+// Scale returns the whole number of pixels per module that best fits a
+// symbol and its quiet zone within size pixels, never less than 1
+func (c *Code) Scale(size int) int {
+	scale := size / (c.Size + 2*QuietZone)
+	if scale < 1 {
+		return 1
+	}
+	return scale
+}
+
+// PNG renders the symbol with its quiet zone at scale pixels per module
+func (c *Code) PNG(scale int) ([]byte, error) {
+	width := (c.Size + 2*QuietZone) * scale
+
+	palette := color.Palette{color.White, color.Black}
+	img := image.NewPaletted(image.Rect(0, 0, width, width), palette)
+
+	for y := 0; y < width; y++ {
+		for x := 0; x < width; x++ {
+			if c.Dark(x/scale-QuietZone, y/scale-QuietZone) {
+				img.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := encoder.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// SVG renders the symbol with its quiet zone as an SVG document of the
+// given pixel size; the drawing itself is in module units so it scales cleanly
+func (c *Code) SVG(size int) []byte {
+	dimension := c.Size + 2*QuietZone
+
+	var path strings.Builder
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if c.Dark(x, y) {
+				fmt.Fprintf(&path, "M%d,%dh1v1h-1z", x+QuietZone, y+QuietZone)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" version="1.1" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+"\n", size, size, dimension, dimension)
+	fmt.Fprintf(&buf, `<rect width="100%%" height="100%%" fill="#FFFFFF"/>`+"\n")
+	fmt.Fprintf(&buf, `<path d="%s" fill="#000000"/>`+"\n", path.String())
+	buf.WriteString("</svg>\n")
+
+	return buf.Bytes()
+}
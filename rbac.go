@@ -0,0 +1,312 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Account roles, stored in profiles.account_type
+const (
+	roleAttendee  = "attendee"
+	roleOrganizer = "organizer"
+	roleVendor    = "vendor"
+	roleAdmin     = "admin"
+)
+
+// roleCacheTTL bounds how long a role change takes to reach other instances
+const roleCacheTTL = time.Minute
+
+// Permissions granted by roles
+const (
+	permCreateEvents   = "events:create"
+	permManageAnyEvent = "events:manage_any"
+	permOrganizerTools = "organizer:tools"
+	permManageRoles    = "roles:manage"
+	permManageSecurity = "security:manage"
+)
+
+// rolePermissions lists what each role may do beyond booking tickets,
+// which every account can
+var rolePermissions = map[string][]string{
+	roleAttendee:  {},
+	roleVendor:    {},
+	roleOrganizer: {permCreateEvents, permOrganizerTools},
+	roleAdmin:     {permCreateEvents, permOrganizerTools, permManageAnyEvent, permManageRoles, permManageSecurity},
+}
+
+// accountRoles caches account roles between requests, initialized in setup
+var accountRoles *RoleCache
+
+// UpdateRoleRequest represents an admin changing an account's role
+type UpdateRoleRequest struct {
+	Role string `json:"role"`
+}
+
+// RoleCache remembers recently loaded account roles for a short time, so
+// authenticating a request does not always need a profile lookup
+type RoleCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]cachedRole
+}
+
+type cachedRole struct {
+	role    string
+	expires time.Time
+}
+
+// NewRoleCache creates a cache whose entries live for ttl
+func NewRoleCache(ttl time.Duration) *RoleCache {
+	return &RoleCache{ttl: ttl, entries: make(map[string]cachedRole)}
+}
+
+// Get returns the cached role of an account
+func (c *RoleCache) Get(userID string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[userID]
+	if !ok || time.Now().After(entry.expires) {
+		delete(c.entries, userID)
+		return "", false
+	}
+	return entry.role, true
+}
+
+// Put caches the role of an account
+func (c *RoleCache) Put(userID, role string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[userID] = cachedRole{role: role, expires: time.Now().Add(c.ttl)}
+}
+
+// Forget drops an account's cached role after it changes
+func (c *RoleCache) Forget(userID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, userID)
+}
+
+// validRole reports whether role is one of the account roles
+func validRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// hasPermission reports whether a role grants a permission
+func hasPermission(role, permission string) bool {
+	for _, granted := range rolePermissions[role] {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// loadRole looks up the caller's current role in their profile, so role
+// changes apply without waiting for tokens to expire. Accounts whose role
+// cannot be loaded get the attendee role, which grants nothing extra.
+func loadRole(userID string) string {
+	if role, ok := accountRoles.Get(userID); ok {
+		return role
+	}
+
+	role, err := userStore.GetAccountType(userID)
+	if err != nil {
+		fmt.Printf("Error loading role for user %s: %v\n", userID, err)
+		return roleAttendee
+	}
+
+	role = accountTypeOrDefault(role)
+	if !validRole(role) {
+		role = roleAttendee
+	}
+	accountRoles.Put(userID, role)
+
+	return role
+}
+
+// requirePermission rejects callers whose role lacks permission. It runs
+// after authenticate, which loads the role.
+func requirePermission(permission string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		auth := authFromRequest(r)
+		if !hasPermission(auth.Role, permission) {
+			sendError(w, http.StatusForbidden, "Forbidden", fmt.Sprintf("Your %s account is not allowed to do this", auth.Role))
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// =====================================================
+// Admin Handlers
+// =====================================================
+
+// handleAdminUser serves /api/admin/users/{id}/role, where admins read and
+// change an account's role, and /api/admin/users/{id}/unlock
+func handleAdminUser(w http.ResponseWriter, r *http.Request) {
+	// Extract user ID from URL path: /api/admin/users/{id}/role
+	path := strings.TrimPrefix(r.URL.Path, "/api/admin/users/")
+	userID, resource, _ := strings.Cut(strings.TrimSpace(path), "/")
+
+	if userID == "" {
+		sendError(w, http.StatusBadRequest, "Invalid request", "User ID is required")
+		return
+	}
+	if resource == "unlock" {
+		handleUnlockUser(w, r, userID)
+		return
+	}
+	if resource != "role" {
+		sendError(w, http.StatusNotFound, "Not found", "Unknown user resource")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		handleGetUserRole(w, r, userID)
+	case http.MethodPut:
+		handleUpdateUserRole(w, r, userID)
+	default:
+		sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "Only GET and PUT methods are allowed")
+	}
+}
+
+func handleGetUserRole(w http.ResponseWriter, r *http.Request, userID string) {
+	role, err := userStore.GetAccountType(userID)
+	if err != nil {
+		sendError(w, http.StatusNotFound, "Not found", "User not found")
+		return
+	}
+
+	sendJSON(w, http.StatusOK, map[string]interface{}{
+		"user_id":     userID,
+		"role":        accountTypeOrDefault(role),
+		"permissions": rolePermissions[accountTypeOrDefault(role)],
+	})
+}
+
+func handleUpdateUserRole(w http.ResponseWriter, r *http.Request, userID string) {
+	auth := authFromRequest(r)
+
+	var req UpdateRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, "Invalid request", "Invalid JSON format")
+		return
+	}
+
+	if !validRole(req.Role) {
+		sendError(w, http.StatusBadRequest, "Validation error", "role must be attendee, organizer, vendor or admin")
+		return
+	}
+
+	// Admins cannot demote themselves, so there is always one left to undo a change
+	if userID == auth.UserID {
+		sendError(w, http.StatusConflict, "Not allowed", "You cannot change your own role")
+		return
+	}
+
+	previous, err := userStore.GetAccountType(userID)
+	if err != nil {
+		sendError(w, http.StatusNotFound, "Not found", "User not found")
+		return
+	}
+
+	if err := userStore.SetAccountType(userID, req.Role); err != nil {
+		fmt.Printf("Error updating role: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to update role")
+		return
+	}
+	accountRoles.Forget(userID)
+
+	fmt.Printf("Admin %s changed the role of user %s from %s to %s\n", auth.UserID, userID, accountTypeOrDefault(previous), req.Role)
+
+	sendJSON(w, http.StatusOK, map[string]interface{}{
+		"user_id":       userID,
+		"role":          req.Role,
+		"previous_role": accountTypeOrDefault(previous),
+		"permissions":   rolePermissions[req.Role],
+		"message":       "Role updated successfully",
+	})
+}
+
+// =====================================================
+// Supabase Role Functions
+// =====================================================
+
+// GetAccountType returns the role in a user's profile
+func (c *SupabaseClient) GetAccountType(userID string) (string, error) {
+	var profiles []struct {
+		AccountType string `json:"account_type"`
+	}
+	path := fmt.Sprintf("/rest/v1/profiles?id=eq.%s&select=account_type", userID)
+	if err := c.doREST("GET", path, "", nil, &profiles); err != nil {
+		return "", err
+	}
+
+	if len(profiles) == 0 {
+		return "", fmt.Errorf("profile not found")
+	}
+
+	return profiles[0].AccountType, nil
+}
+
+// SetAccountType changes the role in a user's profile
+func (c *SupabaseClient) SetAccountType(userID, accountType string) error {
+	payload := map[string]interface{}{
+		"account_type": accountType,
+		"updated_at":   nowTimestamp(),
+	}
+
+	var updated []struct {
+		ID string `json:"id"`
+	}
+	if err := c.doREST("PATCH", fmt.Sprintf("/rest/v1/profiles?id=eq.%s", userID), "", payload, &updated); err != nil {
+		return err
+	}
+
+	if len(updated) == 0 {
+		return fmt.Errorf("profile not found")
+	}
+
+	return nil
+}
+
+// =====================================================
+// In-memory Role Functions
+// =====================================================
+
+// GetAccountType returns the role in a user's profile
+func (m *MemoryStore) GetAccountType(userID string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	u, exists := m.users[userID]
+	if !exists {
+		return "", fmt.Errorf("profile not found")
+	}
+
+	return u.AccountType, nil
+}
+
+// SetAccountType changes the role in a user's profile
+func (m *MemoryStore) SetAccountType(userID, accountType string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, exists := m.users[userID]
+	if !exists {
+		return fmt.Errorf("profile not found")
+	}
+
+	u.AccountType = accountType
+	return nil
+}
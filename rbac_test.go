@@ -0,0 +1,158 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRolePermissions(t *testing.T) {
+	permissions := []string{permCreateEvents, permOrganizerTools, permManageAnyEvent, permManageRoles, permManageSecurity}
+	granted := map[string][]string{
+		roleAttendee:  {},
+		roleVendor:    {},
+		roleOrganizer: {permCreateEvents, permOrganizerTools},
+		roleAdmin:     permissions,
+		"superuser":   {},
+	}
+
+	for role, allowed := range granted {
+		for _, permission := range permissions {
+			wanted := false
+			for _, p := range allowed {
+				wanted = wanted || p == permission
+			}
+			if hasPermission(role, permission) != wanted {
+				t.Errorf("%s %s: expected %v", role, permission, wanted)
+			}
+		}
+	}
+
+	if validRole("superuser") || validRole("") || !validRole(roleVendor) {
+		t.Fatal("expected only the four account roles to be valid")
+	}
+}
+
+func TestRoleCache(t *testing.T) {
+	cache := NewRoleCache(time.Hour)
+	cache.Put("user-1", roleOrganizer)
+	if role, ok := cache.Get("user-1"); !ok || role != roleOrganizer {
+		t.Fatalf("expected the cached role, got %q %v", role, ok)
+	}
+
+	cache.Forget("user-1")
+	if _, ok := cache.Get("user-1"); ok {
+		t.Fatal("expected a forgotten role to be gone")
+	}
+
+	expiring := NewRoleCache(time.Millisecond)
+	expiring.Put("user-1", roleAdmin)
+	time.Sleep(5 * time.Millisecond)
+	if _, ok := expiring.Get("user-1"); ok {
+		t.Fatal("expected an expired role to be gone")
+	}
+}
+
+func TestLoadRole(t *testing.T) {
+	store := newTestStore(t)
+	organizerID, _ := newTestUser(t, store, "organizer@example.com", roleOrganizer)
+	attendeeID, _ := newTestUser(t, store, "attendee@example.com", roleAttendee)
+
+	if role := loadRole(organizerID); role != roleOrganizer {
+		t.Fatalf("expected organizer, got %s", role)
+	}
+	if role := loadRole(attendeeID); role != roleAttendee {
+		t.Fatalf("expected an empty account type to be an attendee, got %s", role)
+	}
+	if role := loadRole("missing"); role != roleAttendee {
+		t.Fatalf("expected an unknown account to be an attendee, got %s", role)
+	}
+
+	// A role edited outside the API applies once the cache entry lapses
+	store.SetAccountType(organizerID, roleVendor)
+	if role := loadRole(organizerID); role != roleOrganizer {
+		t.Fatalf("expected the cached role, got %s", role)
+	}
+	accountRoles.Forget(organizerID)
+	if role := loadRole(organizerID); role != roleVendor {
+		t.Fatalf("expected the new role, got %s", role)
+	}
+
+	store.SetAccountType(attendeeID, "superuser")
+	accountRoles.Forget(attendeeID)
+	if role := loadRole(attendeeID); role != roleAttendee {
+		t.Fatalf("expected an unknown role to grant nothing, got %s", role)
+	}
+}
+
+func TestRoleEnforcement(t *testing.T) {
+	store := newTestStore(t)
+	adminID, adminToken := newTestUser(t, store, "admin@example.com", roleAdmin)
+	organizerID, organizerToken := newTestUser(t, store, "organizer@example.com", roleOrganizer)
+	_, otherOrganizerToken := newTestUser(t, store, "other@example.com", roleOrganizer)
+	vendorID, vendorToken := newTestUser(t, store, "vendor@example.com", roleVendor)
+	_, attendeeToken := newTestUser(t, store, "attendee@example.com", roleAttendee)
+
+	newEvent := CreateEventRequest{Title: "Launch", EventDate: "2030-06-01T18:00:00Z"}
+	balance := requirePermission(permOrganizerTools, handleOrganizerBalance)
+	adminUsers := requirePermission(permManageRoles, handleAdminUser)
+
+	t.Run("creating events", func(t *testing.T) {
+		for token, status := range map[string]int{
+			organizerToken: http.StatusCreated,
+			adminToken:     http.StatusCreated,
+			vendorToken:    http.StatusForbidden,
+			attendeeToken:  http.StatusForbidden,
+		} {
+			rec := serveAuthenticated(handleEvents, http.MethodPost, "/api/events", token, newEvent)
+			expectStatus(t, rec, status)
+		}
+	})
+
+	t.Run("organizer tools", func(t *testing.T) {
+		expectStatus(t, serveAuthenticated(balance, http.MethodGet, "/api/organizer/balance", organizerToken, nil), http.StatusOK)
+		expectStatus(t, serveAuthenticated(balance, http.MethodGet, "/api/organizer/balance", attendeeToken, nil), http.StatusForbidden)
+	})
+
+	t.Run("admins manage every event", func(t *testing.T) {
+		event := newTestEvent(t, store, organizerID, newEvent)
+		target := "/api/events/" + event.ID
+		update := map[string]interface{}{"title": "Renamed"}
+
+		expectStatus(t, serveAuthenticated(handleEventDetail, http.MethodPut, target, otherOrganizerToken, update), http.StatusForbidden)
+		expectStatus(t, serveAuthenticated(handleEventDetail, http.MethodPut, target, adminToken, update), http.StatusOK)
+		expectStatus(t, serveAuthenticated(handleEventDetail, http.MethodDelete, target, otherOrganizerToken, nil), http.StatusForbidden)
+		expectStatus(t, serveAuthenticated(handleEventDetail, http.MethodDelete, target, adminToken, nil), http.StatusOK)
+	})
+
+	t.Run("changing roles", func(t *testing.T) {
+		target := "/api/admin/users/" + vendorID + "/role"
+
+		expectStatus(t, serveAuthenticated(adminUsers, http.MethodPut, target, organizerToken, UpdateRoleRequest{Role: roleOrganizer}), http.StatusForbidden)
+		expectStatus(t, serveAuthenticated(adminUsers, http.MethodPut, target, adminToken, UpdateRoleRequest{Role: "superuser"}), http.StatusBadRequest)
+		expectStatus(t, serveAuthenticated(adminUsers, http.MethodPut, "/api/admin/users/"+adminID+"/role", adminToken, UpdateRoleRequest{Role: roleAttendee}), http.StatusConflict)
+		expectStatus(t, serveAuthenticated(adminUsers, http.MethodPut, "/api/admin/users/missing/role", adminToken, UpdateRoleRequest{Role: roleOrganizer}), http.StatusNotFound)
+
+		// The vendor's role is cached from creating an event, and the
+		// promotion still applies on their next request
+		rec := serveAuthenticated(adminUsers, http.MethodPut, target, adminToken, UpdateRoleRequest{Role: roleOrganizer})
+		expectStatus(t, rec, http.StatusOK)
+		var resp struct {
+			Role         string   `json:"role"`
+			PreviousRole string   `json:"previous_role"`
+			Permissions  []string `json:"permissions"`
+		}
+		decodeBody(t, rec, &resp)
+		if resp.Role != roleOrganizer || resp.PreviousRole != roleVendor || len(resp.Permissions) != 2 {
+			t.Fatalf("expected a vendor promoted to organizer, got %+v", resp)
+		}
+		expectStatus(t, serveAuthenticated(handleEvents, http.MethodPost, "/api/events", vendorToken, newEvent), http.StatusCreated)
+
+		rec = serveAuthenticated(adminUsers, http.MethodGet, target, adminToken, nil)
+		expectStatus(t, rec, http.StatusOK)
+		decodeBody(t, rec, &resp)
+		if resp.Role != roleOrganizer {
+			t.Fatalf("expected the new role to be read back, got %+v", resp)
+		}
+	})
+}
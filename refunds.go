@@ -0,0 +1,334 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// RefundPolicy is an event's cancellation policy. Cancelling at least
+// FullRefundDays before the event refunds everything, at least
+// PartialRefundDays before refunds PartialRefundPercent, and later
+// cancellations get nothing back.
+type RefundPolicy struct {
+	FullRefundDays       int     `json:"full_refund_days"`
+	PartialRefundDays    int     `json:"partial_refund_days"`
+	PartialRefundPercent float64 `json:"partial_refund_percent"`
+}
+
+// RefundQuote is the refund a registration would get if cancelled now
+type RefundQuote struct {
+	RegistrationID string         `json:"registration_id"`
+	AmountPaid     float64        `json:"amount_paid"`
+	RefundPercent  float64        `json:"refund_percent"`
+	RefundAmount   float64        `json:"refund_amount"`
+	Currency       string         `json:"currency"`
+	Reason         string         `json:"reason"`
+	Tickets        []TicketRefund `json:"tickets"`
+
+	payment *Payment
+}
+
+// TicketRefund is one ticket's share of a refund
+type TicketRefund struct {
+	TicketID     string  `json:"ticket_id"`
+	TicketNumber string  `json:"ticket_number"`
+	PricePaid    float64 `json:"price_paid"`
+	RefundAmount float64 `json:"refund_amount"`
+}
+
+// Refund errors
+var (
+	errRefundChanged = errors.New("refund changed since it was quoted")
+	errRefundFailed  = errors.New("refund failed")
+)
+
+// validateRefundPolicy checks an organizer's refund policy
+func validateRefundPolicy(policy *RefundPolicy) error {
+	if policy.FullRefundDays < 0 || policy.PartialRefundDays < 0 {
+		return fmt.Errorf("refund policy days cannot be negative")
+	}
+	if policy.PartialRefundDays > policy.FullRefundDays {
+		return fmt.Errorf("partial_refund_days cannot be more than full_refund_days")
+	}
+	if policy.PartialRefundPercent < 0 || policy.PartialRefundPercent > 100 {
+		return fmt.Errorf("partial_refund_percent must be between 0 and 100")
+	}
+	return nil
+}
+
+// refundPolicyFromUpdate validates the refund_policy field of an event
+// update. A null policy removes it.
+func refundPolicyFromUpdate(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("invalid refund_policy")
+	}
+
+	var policy RefundPolicy
+	if err := json.Unmarshal(raw, &policy); err != nil {
+		return fmt.Errorf("invalid refund_policy")
+	}
+
+	return validateRefundPolicy(&policy)
+}
+
+// refundPercent returns the share of the ticket price refunded for
+// cancelling now, and the rule that applied. Events without a policy
+// refund in full until they start; cancelled events always refund in full.
+func refundPercent(event *Event, now time.Time) (float64, string) {
+	if event.Status == "cancelled" {
+		return 100, "The event was cancelled by the organizer"
+	}
+
+	start, err := time.Parse(time.RFC3339, event.EventDate)
+	if err != nil {
+		// Without a parseable start date the policy windows cannot be applied
+		return 100, "Full refund"
+	}
+
+	policy := event.RefundPolicy
+	if policy == nil {
+		if now.Before(start) {
+			return 100, "Full refund until the event starts"
+		}
+		return 0, "No refund after the event has started"
+	}
+
+	until := start.Sub(now)
+	day := 24 * time.Hour
+	switch {
+	case until >= time.Duration(policy.FullRefundDays)*day && until > 0:
+		return 100, fmt.Sprintf("Full refund when cancelling at least %d days before the event", policy.FullRefundDays)
+	case until >= time.Duration(policy.PartialRefundDays)*day && until > 0 && policy.PartialRefundPercent > 0:
+		return policy.PartialRefundPercent, fmt.Sprintf("%g%% refund when cancelling at least %d days before the event", policy.PartialRefundPercent, policy.PartialRefundDays)
+	default:
+		return 0, "No refund this close to the event"
+	}
+}
+
+// quoteRefund computes what cancelling a registration now would refund.
+// Each active ticket gets its share of the price paid, limited to what is
+// left of the registration's captured payment.
+func quoteRefund(registration *Registration, event *Event, now time.Time) (*RefundQuote, error) {
+	quote := &RefundQuote{
+		RegistrationID: registration.ID,
+		Currency:       paymentCurrency,
+		Tickets:        []TicketRefund{},
+	}
+	quote.RefundPercent, quote.Reason = refundPercent(event, now)
+
+	if registration.Status != "confirmed" {
+		quote.RefundPercent = 0
+		quote.Reason = "Nothing was paid for this registration"
+		return quote, nil
+	}
+
+	payment, err := paymentStore.GetRegistrationPayment(registration.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var refundable int64
+	if payment != nil && (payment.Status == "captured" || payment.Status == "partially_refunded") {
+		refundable = toMinorUnits(payment.Amount - payment.AmountRefunded)
+		quote.payment = payment
+	}
+
+	var paid, refunded int64
+	for _, ticket := range registrationTickets(registration) {
+		if ticket.Status != "active" {
+			continue
+		}
+
+		price := toMinorUnits(ticket.PricePaid)
+		share := min(toMinorUnits(ticket.PricePaid*quote.RefundPercent/100), refundable-refunded)
+		paid += price
+		refunded += share
+
+		quote.Tickets = append(quote.Tickets, TicketRefund{
+			TicketID:     ticket.ID,
+			TicketNumber: ticket.TicketNumber,
+			PricePaid:    ticket.PricePaid,
+			RefundAmount: fromMinorUnits(share),
+		})
+	}
+
+	quote.AmountPaid = fromMinorUnits(paid)
+	quote.RefundAmount = fromMinorUnits(refunded)
+	if paid > 0 && quote.payment == nil {
+		quote.Reason = "No payment was taken for this registration"
+	}
+
+	return quote, nil
+}
+
+// refundRegistration returns a quote's refund through the payment provider
+// and records it in the ledger and on the payment. The refund is keyed on
+// the registration, so retrying a cancellation that failed after the
+// provider refunded does not return the money twice.
+func refundRegistration(quote *RefundQuote) error {
+	amount := toMinorUnits(quote.RefundAmount)
+	if amount <= 0 || quote.payment == nil {
+		return nil
+	}
+
+	payment := quote.payment
+	refund, err := paymentProvider.Refund(payment.IntentID, amount, "registration:"+quote.RegistrationID)
+	if err != nil {
+		return err
+	}
+
+	// Take the refunded total from the provider, since a retried refund
+	// may already be counted on the payment
+	refunded := toMinorUnits(payment.AmountRefunded) + refund.Amount
+	if intent, err := paymentProvider.GetIntent(payment.IntentID); err == nil {
+		refunded = intent.AmountRefunded
+	} else {
+		fmt.Printf("Error fetching intent %s after refund: %v\n", payment.IntentID, err)
+	}
+
+	// Record the refund before the payment, so a cancellation that fails
+	// here is quoted the same again and its retry posts the same refund
+	if err := recordRefund(payment, refund.ID, refund.Amount); err != nil {
+		return err
+	}
+
+	payment.AmountRefunded = fromMinorUnits(min(refunded, toMinorUnits(payment.Amount)))
+	if toMinorUnits(payment.AmountRefunded) >= toMinorUnits(payment.Amount) {
+		payment.Status = "refunded"
+	} else {
+		payment.Status = "partially_refunded"
+	}
+	updatePayment(payment)
+
+	return nil
+}
+
+// =====================================================
+// Refund Handlers
+// =====================================================
+
+// handleCancellationQuote shows the refund a registration would get if
+// cancelled now, so the user can decide before confirming
+func handleCancellationQuote(w http.ResponseWriter, r *http.Request) {
+	auth := authFromRequest(r)
+
+	registrationID := r.URL.Query().Get("registration_id")
+	if registrationID == "" {
+		sendError(w, http.StatusBadRequest, "Validation error", "Registration ID is required")
+		return
+	}
+
+	registration, err := registrationStore.GetRegistrationByID(auth.SupabaseToken, registrationID)
+	if err != nil || registration.UserID != auth.UserID {
+		sendError(w, http.StatusNotFound, "Not found", "Registration not found")
+		return
+	}
+	if registration.Status == "cancelled" {
+		sendError(w, http.StatusConflict, "Already cancelled", "This registration has already been cancelled")
+		return
+	}
+
+	event, err := eventStore.GetEventByID(registration.EventID)
+	if err != nil {
+		sendError(w, http.StatusNotFound, "Not found", "Event not found")
+		return
+	}
+
+	quote, err := quoteRefund(registration, event, time.Now())
+	if err != nil {
+		fmt.Printf("Error quoting refund: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to compute refund")
+		return
+	}
+
+	sendJSON(w, http.StatusOK, map[string]interface{}{
+		"refund":        quote,
+		"refund_policy": event.RefundPolicy,
+	})
+}
+
+// =====================================================
+// Supabase Refund Functions
+// =====================================================
+
+// GetRegistrationPayment returns the payment for a registration, or nil if
+// it was free
+func (c *SupabaseClient) GetRegistrationPayment(registrationID string) (*Payment, error) {
+	path := fmt.Sprintf("/rest/v1/payments?registration_id=eq.%s&select=*&order=created_at.desc&limit=1", registrationID)
+
+	var found []Payment
+	if err := c.doREST("GET", path, "", nil, &found); err != nil {
+		return nil, err
+	}
+
+	if len(found) == 0 {
+		return nil, nil
+	}
+
+	return &found[0], nil
+}
+
+// RefundTicket marks an active ticket refunded with the amount returned
+func (c *SupabaseClient) RefundTicket(ticketID string, amount float64) error {
+	payload := map[string]interface{}{
+		"status":        "refunded",
+		"refund_amount": amount,
+		"refunded_at":   nowTimestamp(),
+	}
+
+	return c.doREST("PATCH", fmt.Sprintf("/rest/v1/tickets?id=eq.%s&status=eq.active", ticketID), "", payload, nil)
+}
+
+// =====================================================
+// In-memory Refund Functions
+// =====================================================
+
+// GetRegistrationPayment returns the payment for a registration, or nil if
+// it was free
+func (m *MemoryStore) GetRegistrationPayment(registrationID string) (*Payment, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var latest *Payment
+	for _, payment := range m.payments {
+		if payment.RegistrationID == registrationID && (latest == nil || payment.CreatedAt >= latest.CreatedAt) {
+			latest = payment
+		}
+	}
+
+	if latest == nil {
+		return nil, nil
+	}
+
+	found := *latest
+	return &found, nil
+}
+
+// RefundTicket marks an active ticket refunded with the amount returned
+func (m *MemoryStore) RefundTicket(ticketID string, amount float64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ticket, exists := m.tickets[ticketID]
+	if !exists {
+		return fmt.Errorf("ticket not found")
+	}
+	if ticket.Status != "active" {
+		return nil
+	}
+
+	ticket.Status = "refunded"
+	ticket.RefundAmount = amount
+	ticket.RefundedAt = nowTimestamp()
+	m.touchTicketLocked(ticket)
+
+	return nil
+}
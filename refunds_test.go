@@ -0,0 +1,178 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestValidateRefundPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy RefundPolicy
+		valid  bool
+	}{
+		{"full and partial", RefundPolicy{FullRefundDays: 14, PartialRefundDays: 7, PartialRefundPercent: 50}, true},
+		{"no refunds", RefundPolicy{}, true},
+		{"negative days", RefundPolicy{FullRefundDays: -1}, false},
+		{"partial window outside full window", RefundPolicy{FullRefundDays: 7, PartialRefundDays: 14, PartialRefundPercent: 50}, false},
+		{"percent over 100", RefundPolicy{FullRefundDays: 14, PartialRefundDays: 7, PartialRefundPercent: 101}, false},
+		{"negative percent", RefundPolicy{FullRefundDays: 14, PartialRefundDays: 7, PartialRefundPercent: -5}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateRefundPolicy(&tt.policy); (err == nil) != tt.valid {
+				t.Fatalf("expected valid=%v, got %v", tt.valid, err)
+			}
+		})
+	}
+
+	if err := refundPolicyFromUpdate(nil); err != nil {
+		t.Fatalf("expected a null policy to be accepted, got %v", err)
+	}
+	if err := refundPolicyFromUpdate(map[string]interface{}{"full_refund_days": "soon"}); err == nil {
+		t.Fatal("expected a malformed policy to be refused")
+	}
+}
+
+func TestRefundPercent(t *testing.T) {
+	start := time.Date(2030, 6, 1, 18, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	policy := &RefundPolicy{FullRefundDays: 14, PartialRefundDays: 7, PartialRefundPercent: 50}
+
+	tests := []struct {
+		name   string
+		event  Event
+		now    time.Time
+		wanted float64
+	}{
+		{"well before", Event{RefundPolicy: policy}, start.Add(-30 * day), 100},
+		{"exactly at the full refund cutoff", Event{RefundPolicy: policy}, start.Add(-14 * day), 100},
+		{"just inside the partial window", Event{RefundPolicy: policy}, start.Add(-14*day + time.Second), 50},
+		{"exactly at the partial cutoff", Event{RefundPolicy: policy}, start.Add(-7 * day), 50},
+		{"just past the partial cutoff", Event{RefundPolicy: policy}, start.Add(-7*day + time.Second), 0},
+		{"after the start", Event{RefundPolicy: policy}, start.Add(time.Hour), 0},
+		{"no partial refunds", Event{RefundPolicy: &RefundPolicy{FullRefundDays: 14, PartialRefundDays: 7}}, start.Add(-10 * day), 0},
+		{"same-day policy at the start", Event{RefundPolicy: &RefundPolicy{}}, start, 0},
+		{"same-day policy before the start", Event{RefundPolicy: &RefundPolicy{}}, start.Add(-time.Minute), 100},
+		{"no policy before the start", Event{}, start.Add(-time.Second), 100},
+		{"no policy at the start", Event{}, start, 0},
+		{"cancelled by the organizer", Event{Status: "cancelled", RefundPolicy: policy}, start.Add(day), 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.event.EventDate = start.Format(time.RFC3339)
+			if percent, reason := refundPercent(&tt.event, tt.now); percent != tt.wanted || reason == "" {
+				t.Fatalf("expected %v%%, got %v%% (%s)", tt.wanted, percent, reason)
+			}
+		})
+	}
+}
+
+func TestCancellationRefunds(t *testing.T) {
+	store := newTestStore(t)
+	organizerID, _ := newTestUser(t, store, "organizer@example.com", roleOrganizer)
+	_, buyerToken := newTestUser(t, store, "buyer@example.com", roleAttendee)
+
+	eventDate := time.Now().Add(10 * 24 * time.Hour).UTC().Format(time.RFC3339)
+	event := newTestEvent(t, store, organizerID, CreateEventRequest{
+		Price:        333.33,
+		EventDate:    eventDate,
+		RefundPolicy: &RefundPolicy{FullRefundDays: 14, PartialRefundDays: 7, PartialRefundPercent: 50},
+	})
+
+	order := buyTickets(t, buyerToken, EventRegistrationRequest{EventID: event.ID, Quantity: 3})
+	registrationID := order.Registration.ID
+	payment, _ := store.GetRegistrationPayment(registrationID)
+
+	t.Run("quote", func(t *testing.T) {
+		rec := serveAuthenticated(handleCancelRegistration, http.MethodGet, "/api/registrations/cancel?registration_id="+registrationID, buyerToken, nil)
+		expectStatus(t, rec, http.StatusOK)
+
+		var resp struct {
+			Refund RefundQuote `json:"refund"`
+		}
+		decodeBody(t, rec, &resp)
+		quote := resp.Refund
+		if quote.RefundPercent != 50 || quote.AmountPaid != 999.99 || len(quote.Tickets) != 3 {
+			t.Fatalf("expected 50%% of 999.99 over 3 tickets, got %+v", quote)
+		}
+
+		// Each ticket is rounded to the paisa on its own
+		var total int64
+		for _, ticket := range quote.Tickets {
+			if ticket.RefundAmount != 166.67 {
+				t.Fatalf("expected 166.67 back per ticket, got %v", ticket.RefundAmount)
+			}
+			total += toMinorUnits(ticket.RefundAmount)
+		}
+		if toMinorUnits(quote.RefundAmount) != total {
+			t.Fatalf("expected the refund %v to be the sum of the tickets", quote.RefundAmount)
+		}
+	})
+
+	t.Run("a changed refund is not applied", func(t *testing.T) {
+		expected := 999.99
+		rec := serveAuthenticated(handleCancelRegistration, http.MethodPost, "/api/registrations/cancel", buyerToken, CancelRegistrationRequest{RegistrationID: registrationID, ExpectedRefund: &expected})
+		expectStatus(t, rec, http.StatusConflict)
+
+		if intent, _ := paymentProvider.GetIntent(payment.IntentID); intent.AmountRefunded != 0 {
+			t.Fatalf("expected nothing refunded, got %d", intent.AmountRefunded)
+		}
+	})
+
+	t.Run("a retried cancellation refunds once", func(t *testing.T) {
+		registration, _ := store.GetRegistrationByID("", registrationID)
+
+		// The provider refunds, then the cancellation fails before it is saved
+		quote, err := quoteRefund(registration, event, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := refundRegistration(quote); err != nil {
+			t.Fatal(err)
+		}
+
+		cancelRegistration(t, buyerToken, registrationID)
+
+		intent, _ := paymentProvider.GetIntent(payment.IntentID)
+		if intent.AmountRefunded != 50001 {
+			t.Fatalf("expected 500.01 refunded once, got %d paise", intent.AmountRefunded)
+		}
+
+		stored, _ := store.GetRegistrationPayment(registrationID)
+		if stored.Status != "partially_refunded" || stored.AmountRefunded != 500.01 {
+			t.Fatalf("expected the payment to record one partial refund, got %+v", stored)
+		}
+
+		for _, ticket := range order.Tickets {
+			refunded, _ := store.GetTicketByID(ticket.ID)
+			if refunded.Status != "refunded" {
+				t.Fatalf("expected ticket %s to be refunded, got %s", ticket.ID, refunded.Status)
+			}
+		}
+
+		rec := serveAuthenticated(handleCancelRegistration, http.MethodPost, "/api/registrations/cancel", buyerToken, CancelRegistrationRequest{RegistrationID: registrationID})
+		expectStatus(t, rec, http.StatusConflict)
+	})
+}
+
+func TestCancellationWithoutRefund(t *testing.T) {
+	store := newTestStore(t)
+	organizerID, _ := newTestUser(t, store, "organizer@example.com", roleOrganizer)
+	buyerID, buyerToken := newTestUser(t, store, "buyer@example.com", roleAttendee)
+
+	started := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	event := newTestEvent(t, store, organizerID, CreateEventRequest{Price: 499, EventDate: started})
+	order := buyTickets(t, buyerToken, EventRegistrationRequest{EventID: event.ID})
+	payment, _ := store.GetRegistrationPayment(order.Registration.ID)
+
+	cancelRegistration(t, buyerToken, order.Registration.ID)
+
+	if intent, _ := paymentProvider.GetIntent(payment.IntentID); intent.AmountRefunded != 0 {
+		t.Fatalf("expected no refund once the event started, got %d", intent.AmountRefunded)
+	}
+	if tickets, _ := store.GetUserTickets(buyerID, "cancelled"); len(tickets) != 1 {
+		t.Fatalf("expected the ticket to be cancelled without a refund, got %+v", tickets)
+	}
+}
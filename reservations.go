@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"sync"
+)
+
+// errEventFull is returned when an event has no seats left
+var errEventFull = errors.New("event full")
+
+// ReservationLedger serializes capacity checks per event so that the
+// count-then-insert sequence used by registrations cannot oversell.
+// Counts are always re-read from the store while the event is locked,
+// so the ledger never drifts from what the store has recorded.
+type ReservationLedger struct {
+	mu    sync.Mutex
+	locks map[string]*eventLock
+}
+
+type eventLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// NewReservationLedger creates a new reservation ledger
+func NewReservationLedger() *ReservationLedger {
+	return &ReservationLedger{
+		locks: make(map[string]*eventLock),
+	}
+}
+
+// lockEvent acquires the per-event lock and returns a function that releases it
+func (l *ReservationLedger) lockEvent(eventID string) func() {
+	l.mu.Lock()
+	lock, exists := l.locks[eventID]
+	if !exists {
+		lock = &eventLock{}
+		l.locks[eventID] = lock
+	}
+	lock.refs++
+	l.mu.Unlock()
+
+	lock.mu.Lock()
+
+	return func() {
+		lock.mu.Unlock()
+
+		l.mu.Lock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(l.locks, eventID)
+		}
+		l.mu.Unlock()
+	}
+}
+
+// Reserve runs insert only if the event still has room for quantity seats.
+// The capacity check and the insert happen under the same per-event lock,
+// so concurrent callers for the last seats are decided deterministically.
+// When the seats do not fit, waitlist is run instead if it is non-nil.
+func (l *ReservationLedger) Reserve(eventID string, capacity *int, quantity int, insert, waitlist func() (*Registration, error)) (*Registration, error) {
+	unlock := l.lockEvent(eventID)
+	defer unlock()
+
+	hasRoom, err := eventHasRoom(eventID, capacity, quantity)
+	if err != nil {
+		return nil, err
+	}
+
+	if !hasRoom {
+		if waitlist == nil {
+			return nil, errEventFull
+		}
+		return waitlist()
+	}
+
+	return insert()
+}
+
+// WithEvent runs fn while holding the event's reservation lock, for
+// operations such as cancellation and waitlist promotion that must not
+// interleave with new reservations
+func (l *ReservationLedger) WithEvent(eventID string, fn func() error) error {
+	unlock := l.lockEvent(eventID)
+	defer unlock()
+
+	return fn()
+}
+
+// eventIsFull reports whether confirmed registrations and active seat
+// holds have reached capacity
+func eventIsFull(eventID string, capacity *int) (bool, error) {
+	hasRoom, err := eventHasRoom(eventID, capacity, 1)
+	return !hasRoom, err
+}
+
+// eventHasRoom reports whether quantity more seats fit within capacity
+func eventHasRoom(eventID string, capacity *int, quantity int) (bool, error) {
+	if capacity == nil {
+		return true, nil
+	}
+
+	taken, err := registrationStore.GetEventRegistrationCount(eventID)
+	if err != nil {
+		return false, err
+	}
+
+	return taken+quantity <= *capacity, nil
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeSupabase is a minimal PostgREST/Auth stand-in that holds registrations
+// in memory. Each round-trip is a real HTTP call, so the window between the
+// count and the insert is as wide as it is against Supabase.
+type fakeSupabase struct {
+	mu            sync.Mutex
+	event         Event
+	registrations []Registration
+	tickets       []Ticket
+}
+
+func (f *fakeSupabase) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/auth/v1/user":
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		sendJSON(w, http.StatusOK, map[string]string{"id": token})
+
+	case r.URL.Path == "/rest/v1/events":
+		sendJSON(w, http.StatusOK, []Event{f.event})
+
+	case r.URL.Path == "/rest/v1/ticket_tiers":
+		sendJSON(w, http.StatusOK, []TicketTier{})
+
+	case r.URL.Path == "/rest/v1/seat_holds":
+		sendJSON(w, http.StatusOK, []SeatHold{})
+
+	case r.URL.Path == "/rest/v1/profiles":
+		sendJSON(w, http.StatusOK, []map[string]string{{"account_type": roleAttendee}})
+
+	case r.URL.Path == "/rest/v1/user_two_factor":
+		sendJSON(w, http.StatusOK, []TwoFactor{})
+
+	case r.URL.Path == "/rest/v1/registrations" && r.Method == http.MethodGet:
+		f.mu.Lock()
+		var confirmed []map[string]string
+		for _, reg := range f.registrations {
+			if reg.Status == "confirmed" {
+				confirmed = append(confirmed, map[string]string{"id": reg.ID})
+			}
+		}
+		f.mu.Unlock()
+		sendJSON(w, http.StatusOK, confirmed)
+
+	case r.URL.Path == "/rest/v1/registrations" && r.Method == http.MethodPost:
+		var reg Registration
+		if err := json.NewDecoder(r.Body).Decode(&reg); err != nil {
+			sendError(w, http.StatusBadRequest, "Invalid request", err.Error())
+			return
+		}
+		f.mu.Lock()
+		reg.ID = fmt.Sprintf("reg-%d", len(f.registrations)+1)
+		f.registrations = append(f.registrations, reg)
+		f.mu.Unlock()
+		sendJSON(w, http.StatusCreated, []Registration{reg})
+
+	case r.URL.Path == "/rest/v1/tickets" && r.Method == http.MethodPost:
+		var ticket Ticket
+		if err := json.NewDecoder(r.Body).Decode(&ticket); err != nil {
+			sendError(w, http.StatusBadRequest, "Invalid request", err.Error())
+			return
+		}
+		f.mu.Lock()
+		f.tickets = append(f.tickets, ticket)
+		f.mu.Unlock()
+		sendJSON(w, http.StatusCreated, []Ticket{ticket})
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeSupabase) confirmedCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	count := 0
+	for _, reg := range f.registrations {
+		if reg.Status == "confirmed" {
+			count++
+		}
+	}
+	return count
+}
+
+// confirmedRegistrations returns a copy of the confirmed registrations
+// and the tickets issued for them
+func (f *fakeSupabase) confirmedRegistrations() ([]Registration, []Ticket) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var confirmed []Registration
+	for _, reg := range f.registrations {
+		if reg.Status == "confirmed" {
+			confirmed = append(confirmed, reg)
+		}
+	}
+	return confirmed, append([]Ticket(nil), f.tickets...)
+}
+
+// assertTicketsPerRegistration checks that every confirmed registration
+// was issued exactly one ticket per seat
+func assertTicketsPerRegistration(t *testing.T, registrations []Registration, tickets []Ticket) {
+	t.Helper()
+
+	issued := make(map[string]int)
+	for _, ticket := range tickets {
+		issued[ticket.RegistrationID]++
+	}
+	for _, reg := range registrations {
+		if issued[reg.ID] != reg.Seats() {
+			t.Errorf("registration %s: expected %d tickets, got %d", reg.ID, reg.Seats(), issued[reg.ID])
+		}
+	}
+	if len(issued) != len(registrations) {
+		t.Errorf("expected tickets for %d registrations, got %d", len(registrations), len(issued))
+	}
+}
+
+func TestCreateRegistrationDoesNotOversell(t *testing.T) {
+	const capacity = 25
+	const attempts = 300
+
+	capacityValue := capacity
+
+	t.Run("supabase", func(t *testing.T) {
+		fake := &fakeSupabase{
+			event: Event{ID: "event-1", Title: "Launch", Status: "active", Capacity: &capacityValue},
+		}
+		server := httptest.NewServer(fake)
+		defer server.Close()
+
+		setStore(NewSupabaseClient(server.URL, "anon", "service"))
+
+		// Tokens in the fake are the user IDs themselves
+		tokens := make([]string, attempts)
+		for i := range tokens {
+			tokens[i] = fmt.Sprintf("user-%d", i)
+		}
+
+		runConcurrentRegistrations(t, "event-1", capacity, tokens)
+
+		if got := fake.confirmedCount(); got != capacity {
+			t.Fatalf("expected %d confirmed registrations in store, got %d", capacity, got)
+		}
+
+		registrations, tickets := fake.confirmedRegistrations()
+		assertTicketsPerRegistration(t, registrations, tickets)
+	})
+
+	t.Run("memory", func(t *testing.T) {
+		memory := NewMemoryStore()
+		setStore(memory)
+
+		event, err := memory.CreateEvent("", "organizer", CreateEventRequest{Title: "Launch", Capacity: &capacityValue})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tokens := make([]string, attempts)
+		for i := range tokens {
+			_, token, err := memory.CreateUser(RegisterRequest{Email: fmt.Sprintf("user-%d@example.com", i), Password: "Password1"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			tokens[i] = token
+		}
+
+		runConcurrentRegistrations(t, event.ID, capacity, tokens)
+
+		if got, _ := memory.GetEventRegistrationCount(event.ID); got != capacity {
+			t.Fatalf("expected %d confirmed registrations in store, got %d", capacity, got)
+		}
+
+		var registrations []Registration
+		var tickets []Ticket
+		for _, reg := range memory.registrations {
+			if reg.Status == "confirmed" {
+				registrations = append(registrations, *reg)
+			}
+		}
+		for _, ticket := range memory.tickets {
+			tickets = append(tickets, *ticket)
+		}
+		assertTicketsPerRegistration(t, registrations, tickets)
+	})
+}
+
+// runConcurrentRegistrations fires one registration per token at once
+// and checks that exactly capacity of them succeed
+func runConcurrentRegistrations(t *testing.T, eventID string, capacity int, tokens []string) {
+	t.Helper()
+
+	reservationLedger = NewReservationLedger()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		statuses = make(map[int]int)
+	)
+
+	for _, token := range tokens {
+		wg.Add(1)
+		go func(token string) {
+			defer wg.Done()
+
+			body, _ := json.Marshal(EventRegistrationRequest{EventID: eventID})
+			req := httptest.NewRequest(http.MethodPost, "/api/registrations", bytes.NewReader(body))
+			req.Header.Set("Authorization", "Bearer "+token)
+			rec := httptest.NewRecorder()
+
+			authenticate(handleRegistrations)(rec, req)
+
+			mu.Lock()
+			statuses[rec.Code]++
+			mu.Unlock()
+		}(token)
+	}
+	wg.Wait()
+
+	if statuses[http.StatusCreated] != capacity {
+		t.Fatalf("expected %d successful registrations, got %d (statuses: %v)", capacity, statuses[http.StatusCreated], statuses)
+	}
+	if statuses[http.StatusConflict] != len(tokens)-capacity {
+		t.Fatalf("expected %d conflicts, got %d (statuses: %v)", len(tokens)-capacity, statuses[http.StatusConflict], statuses)
+	}
+}
@@ -0,0 +1,590 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// sessionTouchInterval limits how often a session's last_seen_at is written
+const sessionTouchInterval = time.Minute
+
+// refreshTokenTTL is how long a refresh token, and so an idle session,
+// lasts, initialized in setup
+var refreshTokenTTL time.Duration
+
+// Session errors
+var (
+	errNoSession           = errors.New("session not found")
+	errInvalidRefreshToken = errors.New("refresh token is invalid or has expired")
+	errRefreshTokenReused  = errors.New("refresh token was already used")
+)
+
+// Reasons recorded when a session ends early
+const (
+	sessionRevokedByUser     = "signed_out"
+	sessionRevokedOnReuse    = "refresh_token_reuse"
+	sessionRevokedOnPassword = "password_reset"
+)
+
+// Session is a sign-in on one device. Its access tokens carry its ID, and
+// its refresh token rotates on every use; presenting a refresh token that
+// was already rotated ends the session, since it means the token leaked.
+type Session struct {
+	ID            string `json:"id"`
+	UserID        string `json:"user_id"`
+	Device        string `json:"device"`
+	UserAgent     string `json:"user_agent"`
+	IPAddress     string `json:"ip_address"`
+	CreatedAt     string `json:"created_at"`
+	LastSeenAt    string `json:"last_seen_at"`
+	ExpiresAt     string `json:"expires_at"`
+	RevokedAt     string `json:"revoked_at,omitempty"`
+	RevokedReason string `json:"revoked_reason,omitempty"`
+}
+
+// SessionSummary is a session as listed to its user
+type SessionSummary struct {
+	Session
+	Current bool `json:"current"`
+}
+
+// RefreshTokenRequest exchanges a refresh token for a new token pair
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// refreshTokenTTLFromEnv reads REFRESH_TOKEN_TTL, defaulting to 30 days
+func refreshTokenTTLFromEnv() (time.Duration, error) {
+	value := os.Getenv("REFRESH_TOKEN_TTL")
+	if value == "" {
+		return 30 * 24 * time.Hour, nil
+	}
+
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl <= 0 {
+		return 0, fmt.Errorf("invalid REFRESH_TOKEN_TTL %q", value)
+	}
+	return ttl, nil
+}
+
+// generateRefreshToken returns a new random refresh token
+func generateRefreshToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// describeDevice turns a User-Agent into a short label such as
+// "Chrome on Windows"
+func describeDevice(userAgent string) string {
+	browser := ""
+	switch {
+	case strings.Contains(userAgent, "Edg/"):
+		browser = "Edge"
+	case strings.Contains(userAgent, "Firefox/"):
+		browser = "Firefox"
+	case strings.Contains(userAgent, "Chrome/"):
+		browser = "Chrome"
+	case strings.Contains(userAgent, "Safari/"):
+		browser = "Safari"
+	}
+
+	platform := ""
+	switch {
+	case strings.Contains(userAgent, "Android"):
+		platform = "Android"
+	case strings.Contains(userAgent, "iPhone"), strings.Contains(userAgent, "iPad"):
+		platform = "iOS"
+	case strings.Contains(userAgent, "Windows"):
+		platform = "Windows"
+	case strings.Contains(userAgent, "Mac OS X"):
+		platform = "macOS"
+	case strings.Contains(userAgent, "Linux"):
+		platform = "Linux"
+	}
+
+	switch {
+	case browser != "" && platform != "":
+		return browser + " on " + platform
+	case browser != "":
+		return browser
+	case platform != "":
+		return platform
+	case userAgent != "":
+		// API clients such as curl/8.5.0 name themselves
+		name, _, _ := strings.Cut(userAgent, " ")
+		return name
+	default:
+		return "Unknown device"
+	}
+}
+
+// startSession signs a user in on the requesting device, returning the
+// token pair to send back
+func startSession(r *http.Request, user *User) (map[string]interface{}, error) {
+	refreshToken, err := generateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	session, err := sessionStore.CreateSession(Session{
+		UserID:     user.ID,
+		Device:     describeDevice(r.UserAgent()),
+		UserAgent:  r.UserAgent(),
+		IPAddress:  getClientIP(r),
+		LastSeenAt: now.Format(time.RFC3339),
+		ExpiresAt:  now.Add(refreshTokenTTL).Format(time.RFC3339),
+	}, hashAPIKey(refreshToken))
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := jwtIssuer.IssueForSession(user.ID, accountTypeOrDefault(user.AccountType), session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"token":              token,
+		"expires_in":         int(jwtIssuer.Expiry.Seconds()),
+		"refresh_token":      refreshToken,
+		"refresh_expires_in": int(refreshTokenTTL.Seconds()),
+		"session_id":         session.ID,
+	}, nil
+}
+
+// checkSession rejects access tokens whose session has ended, and records
+// when and where the session was last used
+func checkSession(sessionID, ip string) error {
+	session, err := sessionStore.GetSession(sessionID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	expires, err := time.Parse(time.RFC3339, session.ExpiresAt)
+	if session.RevokedAt != "" || err != nil || now.After(expires) {
+		return errNoSession
+	}
+
+	lastSeen, err := time.Parse(time.RFC3339, session.LastSeenAt)
+	if err != nil || now.Sub(lastSeen) >= sessionTouchInterval || session.IPAddress != ip {
+		if err := sessionStore.TouchSession(sessionID, now.Format(time.RFC3339), ip); err != nil {
+			fmt.Printf("Error recording session activity: %v\n", err)
+		}
+	}
+
+	return nil
+}
+
+// =====================================================
+// Session Handlers
+// =====================================================
+
+func handleRefreshToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "Only POST method is allowed")
+		return
+	}
+
+	var req RefreshTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, "Invalid request", "Invalid JSON format")
+		return
+	}
+
+	if req.RefreshToken == "" {
+		sendError(w, http.StatusBadRequest, "Validation error", "refresh_token is required")
+		return
+	}
+
+	refreshToken, err := generateRefreshToken()
+	if err != nil {
+		sendError(w, http.StatusInternalServerError, "Token error", "Failed to generate refresh token")
+		return
+	}
+
+	expiresAt := time.Now().UTC().Add(refreshTokenTTL).Format(time.RFC3339)
+	session, err := sessionStore.RotateRefreshToken(hashAPIKey(req.RefreshToken), hashAPIKey(refreshToken), expiresAt, getClientIP(r))
+	if err == errRefreshTokenReused {
+		fmt.Printf("Refresh token reuse detected for session %s of user %s; session revoked\n", session.ID, session.UserID)
+		sendError(w, http.StatusUnauthorized, "Unauthorized", "This refresh token was already used, so the session has been signed out. Sign in again.")
+		return
+	}
+	if err == errInvalidRefreshToken {
+		sendError(w, http.StatusUnauthorized, "Unauthorized", "Invalid or expired refresh token")
+		return
+	}
+	if err != nil {
+		fmt.Printf("Error rotating refresh token: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to refresh session")
+		return
+	}
+
+	token, err := jwtIssuer.IssueForSession(session.UserID, loadRole(session.UserID), session.ID)
+	if err != nil {
+		sendError(w, http.StatusInternalServerError, "Token error", "Failed to generate authentication token")
+		return
+	}
+
+	sendJSON(w, http.StatusOK, map[string]interface{}{
+		"token":              token,
+		"expires_in":         int(jwtIssuer.Expiry.Seconds()),
+		"refresh_token":      refreshToken,
+		"refresh_expires_in": int(refreshTokenTTL.Seconds()),
+		"session_id":         session.ID,
+	})
+}
+
+// handleSessions lists the caller's active sessions, or signs them all out
+// ("log out everywhere"); ?others=true keeps the current session
+func handleSessions(w http.ResponseWriter, r *http.Request) {
+	auth := authFromRequest(r)
+
+	switch r.Method {
+	case http.MethodGet:
+		sessions, err := sessionStore.GetUserSessions(auth.UserID)
+		if err != nil {
+			fmt.Printf("Error fetching sessions: %v\n", err)
+			sendError(w, http.StatusInternalServerError, "Server error", "Unable to fetch sessions")
+			return
+		}
+
+		summaries := []SessionSummary{}
+		for _, session := range sessions {
+			summaries = append(summaries, SessionSummary{Session: session, Current: session.ID == auth.SessionID})
+		}
+
+		sendJSON(w, http.StatusOK, map[string]interface{}{
+			"sessions": summaries,
+			"count":    len(summaries),
+		})
+	case http.MethodDelete:
+		keep := ""
+		if r.URL.Query().Get("others") == "true" {
+			keep = auth.SessionID
+		}
+
+		revoked, err := sessionStore.RevokeUserSessions(auth.UserID, keep, sessionRevokedByUser)
+		if err != nil {
+			fmt.Printf("Error revoking sessions: %v\n", err)
+			sendError(w, http.StatusInternalServerError, "Server error", "Unable to sign out")
+			return
+		}
+
+		sendJSON(w, http.StatusOK, map[string]interface{}{
+			"revoked": revoked,
+			"message": "Signed out everywhere",
+		})
+	default:
+		sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "Only GET and DELETE methods are allowed")
+	}
+}
+
+// handleSessionDetail serves /api/sessions/{id}, where users sign out a
+// single session
+func handleSessionDetail(w http.ResponseWriter, r *http.Request) {
+	auth := authFromRequest(r)
+
+	sessionID := strings.TrimSpace(strings.TrimPrefix(r.URL.Path, "/api/sessions/"))
+	if sessionID == "" || strings.Contains(sessionID, "/") {
+		sendError(w, http.StatusBadRequest, "Invalid request", "Session ID is required")
+		return
+	}
+
+	if r.Method != http.MethodDelete {
+		sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "Only DELETE method is allowed")
+		return
+	}
+
+	err := sessionStore.RevokeSession(auth.UserID, sessionID, sessionRevokedByUser)
+	if err == errNoSession {
+		sendError(w, http.StatusNotFound, "Not found", "Session not found or already signed out")
+		return
+	}
+	if err != nil {
+		fmt.Printf("Error revoking session: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to sign out session")
+		return
+	}
+
+	sendJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Session signed out",
+	})
+}
+
+// =====================================================
+// Supabase Session Functions
+// =====================================================
+
+// CreateSession stores a new session and its first refresh token hash
+func (c *SupabaseClient) CreateSession(session Session, refreshHash string) (*Session, error) {
+	payload := map[string]interface{}{
+		"user_id":      session.UserID,
+		"device":       session.Device,
+		"user_agent":   session.UserAgent,
+		"ip_address":   session.IPAddress,
+		"last_seen_at": session.LastSeenAt,
+		"expires_at":   session.ExpiresAt,
+	}
+
+	var created []Session
+	if err := c.doREST("POST", "/rest/v1/sessions", "", payload, &created); err != nil {
+		return nil, err
+	}
+	if len(created) == 0 {
+		return nil, fmt.Errorf("session created but no data returned")
+	}
+
+	token := map[string]interface{}{
+		"token_hash": refreshHash,
+		"session_id": created[0].ID,
+	}
+	if err := c.doREST("POST", "/rest/v1/refresh_tokens", "", token, nil); err != nil {
+		return nil, err
+	}
+
+	return &created[0], nil
+}
+
+// GetSession returns a session, including ended ones
+func (c *SupabaseClient) GetSession(sessionID string) (*Session, error) {
+	var sessions []Session
+	if err := c.doREST("GET", fmt.Sprintf("/rest/v1/sessions?id=eq.%s", sessionID), "", nil, &sessions); err != nil {
+		return nil, err
+	}
+
+	if len(sessions) == 0 {
+		return nil, errNoSession
+	}
+
+	return &sessions[0], nil
+}
+
+// GetUserSessions lists a user's active sessions, most recently used first
+func (c *SupabaseClient) GetUserSessions(userID string) ([]Session, error) {
+	var sessions []Session
+	path := fmt.Sprintf("/rest/v1/sessions?user_id=eq.%s&revoked_at=is.null&expires_at=gt.%s&order=last_seen_at.desc",
+		userID, time.Now().UTC().Format(time.RFC3339))
+	if err := c.doREST("GET", path, "", nil, &sessions); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// RotateRefreshToken swaps a session's refresh token for a new one in a
+// single transaction. Presenting a token that was already rotated revokes
+// the session and returns it with errRefreshTokenReused.
+func (c *SupabaseClient) RotateRefreshToken(oldHash, newHash, expiresAt, ip string) (*Session, error) {
+	payload := map[string]interface{}{
+		"p_old_hash":   oldHash,
+		"p_new_hash":   newHash,
+		"p_expires_at": expiresAt,
+		"p_ip_address": ip,
+	}
+
+	var result struct {
+		Status  string   `json:"status"`
+		Session *Session `json:"session"`
+	}
+	if err := c.doREST("POST", "/rest/v1/rpc/rotate_refresh_token", "", payload, &result); err != nil {
+		return nil, err
+	}
+
+	switch result.Status {
+	case "rotated":
+		return result.Session, nil
+	case "reused":
+		return result.Session, errRefreshTokenReused
+	default:
+		return nil, errInvalidRefreshToken
+	}
+}
+
+// RevokeSession signs out one of a user's active sessions
+func (c *SupabaseClient) RevokeSession(userID, sessionID, reason string) error {
+	var revoked []Session
+	path := fmt.Sprintf("/rest/v1/sessions?id=eq.%s&user_id=eq.%s&revoked_at=is.null", sessionID, userID)
+	payload := map[string]interface{}{"revoked_at": nowTimestamp(), "revoked_reason": reason}
+	if err := c.doREST("PATCH", path, "", payload, &revoked); err != nil {
+		return err
+	}
+
+	if len(revoked) == 0 {
+		return errNoSession
+	}
+
+	return nil
+}
+
+// RevokeUserSessions signs out all of a user's sessions except keepID,
+// returning how many were signed out
+func (c *SupabaseClient) RevokeUserSessions(userID, keepID, reason string) (int, error) {
+	path := fmt.Sprintf("/rest/v1/sessions?user_id=eq.%s&revoked_at=is.null", userID)
+	if keepID != "" {
+		path += "&id=neq." + keepID
+	}
+
+	var revoked []Session
+	payload := map[string]interface{}{"revoked_at": nowTimestamp(), "revoked_reason": reason}
+	if err := c.doREST("PATCH", path, "", payload, &revoked); err != nil {
+		return 0, err
+	}
+
+	return len(revoked), nil
+}
+
+// TouchSession records when and from where a session was last used
+func (c *SupabaseClient) TouchSession(sessionID, lastSeen, ip string) error {
+	payload := map[string]interface{}{"last_seen_at": lastSeen, "ip_address": ip}
+	return c.doREST("PATCH", fmt.Sprintf("/rest/v1/sessions?id=eq.%s", sessionID), "", payload, nil)
+}
+
+// =====================================================
+// In-memory Session Functions
+// =====================================================
+
+// memoryRefreshToken is a refresh token hash and whether it was rotated out
+type memoryRefreshToken struct {
+	sessionID string
+	rotated   bool
+}
+
+// CreateSession stores a new session and its first refresh token hash
+func (m *MemoryStore) CreateSession(session Session, refreshHash string) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session.ID = newID()
+	session.CreatedAt = nowTimestamp()
+	m.sessions[session.ID] = &session
+	m.refreshTokens[refreshHash] = &memoryRefreshToken{sessionID: session.ID}
+
+	created := session
+	return &created, nil
+}
+
+// GetSession returns a session, including ended ones
+func (m *MemoryStore) GetSession(sessionID string) (*Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	session, exists := m.sessions[sessionID]
+	if !exists {
+		return nil, errNoSession
+	}
+
+	found := *session
+	return &found, nil
+}
+
+// GetUserSessions lists a user's active sessions, most recently used first
+func (m *MemoryStore) GetUserSessions(userID string) ([]Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := nowTimestamp()
+	sessions := []Session{}
+	for _, session := range m.sessions {
+		if session.UserID == userID && session.RevokedAt == "" && session.ExpiresAt > now {
+			sessions = append(sessions, *session)
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeenAt > sessions[j].LastSeenAt
+	})
+
+	return sessions, nil
+}
+
+// RotateRefreshToken swaps a session's refresh token for a new one.
+// Presenting a token that was already rotated revokes the session and
+// returns it with errRefreshTokenReused.
+func (m *MemoryStore) RotateRefreshToken(oldHash, newHash, expiresAt, ip string) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token, exists := m.refreshTokens[oldHash]
+	if !exists {
+		return nil, errInvalidRefreshToken
+	}
+
+	session, exists := m.sessions[token.sessionID]
+	if !exists || session.RevokedAt != "" || session.ExpiresAt <= nowTimestamp() {
+		return nil, errInvalidRefreshToken
+	}
+
+	if token.rotated {
+		session.RevokedAt = nowTimestamp()
+		session.RevokedReason = sessionRevokedOnReuse
+		revoked := *session
+		return &revoked, errRefreshTokenReused
+	}
+
+	token.rotated = true
+	m.refreshTokens[newHash] = &memoryRefreshToken{sessionID: session.ID}
+	session.ExpiresAt = expiresAt
+	session.LastSeenAt = nowTimestamp()
+	session.IPAddress = ip
+
+	rotated := *session
+	return &rotated, nil
+}
+
+// RevokeSession signs out one of a user's active sessions
+func (m *MemoryStore) RevokeSession(userID, sessionID, reason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, exists := m.sessions[sessionID]
+	if !exists || session.UserID != userID || session.RevokedAt != "" {
+		return errNoSession
+	}
+
+	session.RevokedAt = nowTimestamp()
+	session.RevokedReason = reason
+	return nil
+}
+
+// RevokeUserSessions signs out all of a user's sessions except keepID,
+// returning how many were signed out
+func (m *MemoryStore) RevokeUserSessions(userID, keepID, reason string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	revoked := 0
+	for _, session := range m.sessions {
+		if session.UserID == userID && session.ID != keepID && session.RevokedAt == "" {
+			session.RevokedAt = nowTimestamp()
+			session.RevokedReason = reason
+			revoked++
+		}
+	}
+
+	return revoked, nil
+}
+
+// TouchSession records when and from where a session was last used
+func (m *MemoryStore) TouchSession(sessionID, lastSeen, ip string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if session, exists := m.sessions[sessionID]; exists {
+		session.LastSeenAt = lastSeen
+		session.IPAddress = ip
+	}
+	return nil
+}
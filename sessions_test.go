@@ -0,0 +1,202 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// tokenPair is the body of a sign-in or refresh
+type tokenPair struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	SessionID    string `json:"session_id"`
+}
+
+// signIn logs in from a device and returns the session's token pair
+func signIn(t *testing.T, email, userAgent string) tokenPair {
+	t.Helper()
+
+	req := newTestRequest(http.MethodPost, "/api/login", map[string]string{"email": email, "password": testPassword})
+	req.Header.Set("User-Agent", userAgent)
+	rec := httptest.NewRecorder()
+	handleLogin(rec, req)
+	expectStatus(t, rec, http.StatusOK)
+
+	var pair tokenPair
+	decodeBody(t, rec, &pair)
+	return pair
+}
+
+// refresh exchanges a refresh token
+func refresh(refreshToken string) *httptest.ResponseRecorder {
+	return servePublic(handleRefreshToken, http.MethodPost, "/api/refresh", RefreshTokenRequest{RefreshToken: refreshToken})
+}
+
+// profileStatus returns the status of a profile request with an access token
+func profileStatus(token string) int {
+	return serveAuthenticated(handleProfile, http.MethodGet, "/api/profile", token, nil).Code
+}
+
+func TestDescribeDevice(t *testing.T) {
+	tests := []struct {
+		userAgent, wanted string
+	}{
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36", "Chrome on Windows"},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36 Edg/120.0", "Edge on Windows"},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1", "Safari on iOS"},
+		{"Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0", "Firefox on Linux"},
+		{"Mozilla/5.0 (Linux; Android 14) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Mobile Safari/537.36", "Chrome on Android"},
+		{"curl/8.5.0", "curl/8.5.0"},
+		{"", "Unknown device"},
+	}
+	for _, tt := range tests {
+		if device := describeDevice(tt.userAgent); device != tt.wanted {
+			t.Errorf("%q: expected %q, got %q", tt.userAgent, tt.wanted, device)
+		}
+	}
+}
+
+func TestRefreshTokenTTLFromEnv(t *testing.T) {
+	t.Setenv("REFRESH_TOKEN_TTL", "")
+	if ttl, err := refreshTokenTTLFromEnv(); err != nil || ttl != 30*24*time.Hour {
+		t.Fatalf("expected 30 days by default, got %v (%v)", ttl, err)
+	}
+
+	t.Setenv("REFRESH_TOKEN_TTL", "12h")
+	if ttl, err := refreshTokenTTLFromEnv(); err != nil || ttl != 12*time.Hour {
+		t.Fatalf("expected 12h, got %v (%v)", ttl, err)
+	}
+
+	for _, value := range []string{"0s", "-1h", "a week"} {
+		t.Setenv("REFRESH_TOKEN_TTL", value)
+		if _, err := refreshTokenTTLFromEnv(); err == nil {
+			t.Errorf("%q: expected an error", value)
+		}
+	}
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	store := newTestStore(t)
+	newTestUser(t, store, "rotate@example.com", roleAttendee)
+
+	first := signIn(t, "rotate@example.com", "curl/8.5.0")
+
+	rec := refresh(first.RefreshToken)
+	expectStatus(t, rec, http.StatusOK)
+	var second tokenPair
+	decodeBody(t, rec, &second)
+
+	if second.RefreshToken == first.RefreshToken || second.SessionID != first.SessionID {
+		t.Fatalf("expected a new refresh token for the same session, got %+v", second)
+	}
+	if profileStatus(first.Token) != http.StatusOK || profileStatus(second.Token) != http.StatusOK {
+		t.Fatal("expected both access tokens of a live session to work")
+	}
+
+	t.Run("invalid tokens", func(t *testing.T) {
+		expectStatus(t, refresh("not-a-refresh-token"), http.StatusUnauthorized)
+		expectStatus(t, refresh(""), http.StatusBadRequest)
+	})
+
+	t.Run("reuse revokes the session", func(t *testing.T) {
+		expectStatus(t, refresh(first.RefreshToken), http.StatusUnauthorized)
+
+		session, _ := store.GetSession(first.SessionID)
+		if session.RevokedAt == "" || session.RevokedReason != sessionRevokedOnReuse {
+			t.Fatalf("expected the session revoked for reuse, got %+v", session)
+		}
+
+		// Neither the thief's nor the owner's tokens work any longer
+		if profileStatus(second.Token) != http.StatusUnauthorized {
+			t.Fatal("expected the session's access token to be rejected")
+		}
+		expectStatus(t, refresh(second.RefreshToken), http.StatusUnauthorized)
+	})
+
+	t.Run("concurrent refreshes", func(t *testing.T) {
+		pair := signIn(t, "rotate@example.com", "curl/8.5.0")
+
+		var (
+			wg       sync.WaitGroup
+			mu       sync.Mutex
+			statuses = make(map[int]int)
+		)
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				rec := refresh(pair.RefreshToken)
+
+				mu.Lock()
+				statuses[rec.Code]++
+				mu.Unlock()
+			}()
+		}
+		wg.Wait()
+
+		if statuses[http.StatusOK] != 1 || statuses[http.StatusUnauthorized] != 9 {
+			t.Fatalf("expected one refresh to win, got %v", statuses)
+		}
+	})
+
+	t.Run("expired session", func(t *testing.T) {
+		pair := signIn(t, "rotate@example.com", "curl/8.5.0")
+
+		store.mu.Lock()
+		store.sessions[pair.SessionID].ExpiresAt = time.Now().Add(-time.Second).UTC().Format(time.RFC3339)
+		store.mu.Unlock()
+
+		if profileStatus(pair.Token) != http.StatusUnauthorized {
+			t.Fatal("expected an expired session's access token to be rejected")
+		}
+		expectStatus(t, refresh(pair.RefreshToken), http.StatusUnauthorized)
+	})
+}
+
+func TestSessionManagement(t *testing.T) {
+	store := newTestStore(t)
+	newTestUser(t, store, "devices@example.com", roleAttendee)
+	_, otherToken := newTestUser(t, store, "other@example.com", roleAttendee)
+
+	laptop := signIn(t, "devices@example.com", "Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0")
+	phone := signIn(t, "devices@example.com", "Mozilla/5.0 (Linux; Android 14) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Mobile Safari/537.36")
+	script := signIn(t, "devices@example.com", "curl/8.5.0")
+
+	rec := serveAuthenticated(handleSessions, http.MethodGet, "/api/sessions", laptop.Token, nil)
+	expectStatus(t, rec, http.StatusOK)
+
+	var resp struct {
+		Sessions []SessionSummary `json:"sessions"`
+	}
+	decodeBody(t, rec, &resp)
+	devices := make(map[string]bool)
+	for _, session := range resp.Sessions {
+		devices[session.Device] = session.Current
+	}
+	if len(devices) != 3 || !devices["Firefox on Linux"] || devices["Chrome on Android"] {
+		t.Fatalf("expected three sessions with the laptop current, got %+v", resp.Sessions)
+	}
+
+	// Signing out one session, which other accounts cannot do
+	expectStatus(t, serveAuthenticated(handleSessionDetail, http.MethodDelete, "/api/sessions/"+phone.SessionID, otherToken, nil), http.StatusNotFound)
+	expectStatus(t, serveAuthenticated(handleSessionDetail, http.MethodDelete, "/api/sessions/"+phone.SessionID, laptop.Token, nil), http.StatusOK)
+	if profileStatus(phone.Token) != http.StatusUnauthorized {
+		t.Fatal("expected the signed-out session's access token to be rejected")
+	}
+	expectStatus(t, refresh(phone.RefreshToken), http.StatusUnauthorized)
+
+	// Signing out everywhere else keeps the current session
+	expectStatus(t, serveAuthenticated(handleSessions, http.MethodDelete, "/api/sessions?others=true", laptop.Token, nil), http.StatusOK)
+	if profileStatus(script.Token) != http.StatusUnauthorized || profileStatus(laptop.Token) != http.StatusOK {
+		t.Fatal("expected only the other sessions to be signed out")
+	}
+
+	expectStatus(t, serveAuthenticated(handleSessions, http.MethodDelete, "/api/sessions", laptop.Token, nil), http.StatusOK)
+	if profileStatus(laptop.Token) != http.StatusUnauthorized {
+		t.Fatal("expected signing out everywhere to end the current session too")
+	}
+}
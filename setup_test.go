@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+// testPassword is the password of every account the tests create
+const testPassword = "Password1"
+
+// TestMain runs the tests against the in-memory backend unless a backend
+// is chosen explicitly, so no Supabase project is needed
+func TestMain(m *testing.M) {
+	if os.Getenv("STORAGE_BACKEND") == "" {
+		os.Setenv("STORAGE_BACKEND", "memory")
+	}
+	setup()
+	os.Exit(m.Run())
+}
+
+// newTestStore installs an empty in-memory store and resets the caches
+// that would otherwise carry state from one test to the next
+func newTestStore(t *testing.T) *MemoryStore {
+	t.Helper()
+
+	store := NewMemoryStore()
+	setStore(store)
+
+	accountRoles = NewRoleCache(roleCacheTTL)
+	reservationLedger = NewReservationLedger()
+	accountMailLimiter = NewRateLimiter(5, time.Hour)
+	organizerTwoFactorPolicy.Set(false)
+
+	return store
+}
+
+// newTestUser creates an account with the given role and returns its ID
+// and an access token for it
+func newTestUser(t *testing.T, store *MemoryStore, email, role string) (string, string) {
+	t.Helper()
+
+	user, token, err := store.CreateUser(RegisterRequest{Email: email, Password: testPassword, FullName: email})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role != roleAttendee {
+		if err := store.SetAccountType(user.ID, role); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return user.ID, token
+}
+
+// serveAuthenticated runs handler behind authenticate for the holder of
+// token, sending body as JSON
+func serveAuthenticated(handler http.HandlerFunc, method, target, token string, body interface{}) *httptest.ResponseRecorder {
+	req := newTestRequest(method, target, body)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	rec := httptest.NewRecorder()
+	authenticate(handler)(rec, req)
+	return rec
+}
+
+// servePublic runs a handler that needs no login, sending body as JSON
+func servePublic(handler http.HandlerFunc, method, target string, body interface{}) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	handler(rec, newTestRequest(method, target, body))
+	return rec
+}
+
+// newTestRequest builds a request with body encoded as JSON
+func newTestRequest(method, target string, body interface{}) *http.Request {
+	var reader io.Reader
+	if body != nil {
+		raw, _ := json.Marshal(body)
+		reader = bytes.NewReader(raw)
+	}
+
+	req := httptest.NewRequest(method, target, reader)
+	req.RemoteAddr = "192.0.2.1:4000"
+	return req
+}
+
+// decodeBody decodes a JSON response into v
+func decodeBody(t *testing.T, rec *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("decoding response %q: %v", rec.Body.String(), err)
+	}
+}
+
+// expectStatus fails the test unless the response has the given status
+func expectStatus(t *testing.T, rec *httptest.ResponseRecorder, status int) {
+	t.Helper()
+
+	if rec.Code != status {
+		t.Fatalf("expected status %d, got %d: %s", status, rec.Code, rec.Body.String())
+	}
+}
+
+// newTestEvent creates an event owned by organizerID
+func newTestEvent(t *testing.T, store *MemoryStore, organizerID string, req CreateEventRequest) *Event {
+	t.Helper()
+
+	if req.Title == "" {
+		req.Title = "Test event"
+	}
+	event, err := store.CreateEvent("", organizerID, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return event
+}
+
+// registrationResponse is the body of a successful registration
+type registrationResponse struct {
+	Registration Registration `json:"registration"`
+	Tickets      []Ticket     `json:"tickets"`
+}
+
+// registerForEvent registers the holder of token and expects 201 Created
+func registerForEvent(t *testing.T, token string, req EventRegistrationRequest) registrationResponse {
+	t.Helper()
+
+	rec := serveAuthenticated(handleRegistrations, http.MethodPost, "/api/registrations", token, req)
+	expectStatus(t, rec, http.StatusCreated)
+
+	var resp registrationResponse
+	decodeBody(t, rec, &resp)
+	return resp
+}
+
+// cancelRegistration cancels a registration for the holder of token and
+// expects 200 OK
+func cancelRegistration(t *testing.T, token, registrationID string) {
+	t.Helper()
+
+	rec := serveAuthenticated(handleCancelRegistration, http.MethodPost, "/api/registrations/cancel", token, CancelRegistrationRequest{RegistrationID: registrationID})
+	expectStatus(t, rec, http.StatusOK)
+}
+
+// addTestMember puts a user on an event's team with the given role
+func addTestMember(t *testing.T, store *MemoryStore, eventID, userID, role string) {
+	t.Helper()
+
+	if _, err := store.SaveEventMember(EventMember{EventID: eventID, UserID: userID, Role: role}); err != nil {
+		t.Fatal(err)
+	}
+}
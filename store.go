@@ -0,0 +1,278 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// errAlreadyRegistered is returned when a user registers twice for the same event
+var errAlreadyRegistered = errors.New("duplicate registration: user is already registered for this event")
+
+// UserStore handles user accounts and access token lookups
+type UserStore interface {
+	UserExists(email string) (bool, error)
+	CreateUser(req RegisterRequest) (*User, string, error)
+	CreateProfile(userID, fullName, phoneNumber, email string) error
+	Authenticate(email, password string) (*User, string, error)
+	GetUser(token string) (*User, error)
+	GetUserByID(userID string) (*User, error)
+	UserIDFromToken(token string) (string, error)
+	GetAccountType(userID string) (string, error)
+	SetAccountType(userID, accountType string) error
+}
+
+// EventStore persists events
+type EventStore interface {
+	GetEvents(category, search string) ([]Event, error)
+	GetEventByID(eventID string) (*Event, error)
+	CreateEvent(token, organizerID string, req CreateEventRequest) (*Event, error)
+	UpdateEvent(token, eventID string, data map[string]interface{}) error
+	DeleteEvent(token, eventID string) error
+}
+
+// RegistrationStore persists event registrations
+type RegistrationStore interface {
+	GetUserRegistrations(token, userID, status string) ([]RegistrationWithEvent, error)
+	CreateRegistration(token string, registration Registration) (*Registration, error)
+	CancelRegistration(token, registrationID, userID string) error
+
+	// GetEventRegistrationCount returns the seats taken: confirmed
+	// registrations plus active seat holds
+	GetEventRegistrationCount(eventID string) (int, error)
+	GetRegistrationByID(token, registrationID string) (*Registration, error)
+	GetEventRegistrations(eventID, status string) ([]Registration, error)
+
+	// Waitlist positions are kept contiguous from 1 by the store
+	AddToWaitlist(token string, registration Registration) (*Registration, error)
+	GetWaitlist(eventID string) ([]Registration, error)
+	PromoteFromWaitlist(eventID, registrationID string) (*Registration, error)
+	ReorderWaitlist(eventID string, registrationIDs []string) error
+	CompactWaitlist(eventID string) error
+}
+
+// TicketStore persists tickets issued for confirmed registrations
+type TicketStore interface {
+	CreateTicket(ticket Ticket) (*Ticket, error)
+	GetUserTickets(userID, status string) ([]Ticket, error)
+	GetTicketByID(ticketID string) (*Ticket, error)
+	CancelRegistrationTickets(registrationID string) error
+	RefundTicket(ticketID string, amount float64) error
+	SetTicketQRCode(ticketID, qrCode string) error
+	GetTicketByNumber(ticketNumber string) (*Ticket, error)
+	CheckInTicket(ticketID, staffID string) (*Ticket, error)
+
+	// Scanner sync: tickets changed after a version, and check-ins recorded offline
+	GetEventTickets(eventID string, sinceVersion int64) ([]Ticket, error)
+	SyncCheckIn(ticketID string, scan CheckinScan) (*Ticket, error)
+}
+
+// TierStore persists ticket tiers
+type TierStore interface {
+	GetEventTiers(eventID string) ([]TicketTier, error)
+	GetTierByID(tierID string) (*TicketTier, error)
+	CreateTier(tier TicketTier) (*TicketTier, error)
+	UpdateTier(tier TicketTier) error
+	DeleteTier(tierID string) error
+	GetTierSoldCounts(eventID string) (map[string]int, error)
+}
+
+// EventMemberStore persists the team members of each event
+type EventMemberStore interface {
+	GetEventMembers(eventID string) ([]EventMember, error)
+	GetEventMember(eventID, userID string) (*EventMember, error)
+	SaveEventMember(member EventMember) (*EventMember, error)
+	RemoveEventMember(eventID, userID string) error
+}
+
+// HoldStore persists seat holds taken during checkout
+type HoldStore interface {
+	CreateHold(hold SeatHold) (*SeatHold, error)
+	GetHold(holdID string) (*SeatHold, error)
+	GetUserHolds(userID string) ([]SeatHold, error)
+	ReleaseHold(holdID string) error
+	ReleaseUserHolds(eventID, userID string) error
+	ConfirmHold(holdID, notes string, attendees []Attendee) (*Registration, error)
+	ExpireHolds() ([]SeatHold, error)
+}
+
+// PaymentStore persists payments taken through the payment provider
+type PaymentStore interface {
+	CreatePayment(payment Payment) (*Payment, error)
+	GetPaymentByIntent(intentID string) (*Payment, error)
+	GetHoldPayment(holdID string) (*Payment, error)
+	GetRegistrationPayment(registrationID string) (*Payment, error)
+	UpdatePayment(payment Payment) error
+}
+
+// PromoStore persists organizers' promo codes
+type PromoStore interface {
+	CreatePromoCode(promo PromoCode) (*PromoCode, error)
+	GetEventPromoCodes(eventID string) ([]PromoCode, error)
+	GetPromoCodeByCode(eventID, code string) (*PromoCode, error)
+	DeactivatePromoCode(eventID, codeID string) error
+	CountPromoRedemptions(codeID, userID string) (total, byUser int, err error)
+}
+
+// InvoiceStore persists organizers' tax profiles and the GST invoices
+// issued for paid orders
+type InvoiceStore interface {
+	GetTaxProfile(organizerID string) (*TaxProfile, error)
+	SaveTaxProfile(profile TaxProfile) (*TaxProfile, error)
+	CreateInvoice(invoice Invoice) (*Invoice, error)
+	GetInvoice(invoiceID string) (*Invoice, error)
+	GetRegistrationInvoice(registrationID string) (*Invoice, error)
+	GetUserInvoices(userID string) ([]Invoice, error)
+	GetOrganizerInvoices(organizerID, eventID string) ([]Invoice, error)
+}
+
+// LedgerStore persists the double-entry ledger of what organizers are owed,
+// the payouts that settle it and the postings queued for retry
+type LedgerStore interface {
+	PostLedgerTransaction(tx LedgerTransaction) (bool, error)
+	QueueLedgerTransaction(tx LedgerTransaction) error
+	GetQueuedLedgerTransactions() ([]LedgerTransaction, error)
+	DequeueLedgerTransaction(referenceID string) error
+	GetLedgerEntries(filter LedgerFilter) ([]LedgerEntry, error)
+	GetLedgerBalance(organizerID, cutoff string) (*LedgerBalance, error)
+	SettleBalances(cutoff string, minimum float64) ([]Payout, error)
+	GetPayouts(organizerID string) ([]Payout, error)
+}
+
+// APIKeyStore persists organizers' API keys, by hash
+type APIKeyStore interface {
+	CreateAPIKey(key APIKey) (*APIKey, error)
+	GetAPIKeyByHash(keyHash string) (*APIKey, error)
+	GetOrganizerAPIKeys(organizerID string) ([]APIKey, error)
+	RevokeAPIKey(organizerID, keyID string) error
+	TouchAPIKey(keyID, usedAt string) error
+}
+
+// AccountStore issues and redeems the one-time tokens emailed for password
+// resets and email verification
+type AccountStore interface {
+	CreatePasswordResetToken(email string) (string, error)
+	ResetPassword(token, password string) (string, error)
+	CreateEmailVerificationToken(email string) (string, error)
+	VerifyEmail(token string) (string, error)
+}
+
+// SessionStore persists sign-in sessions and their rotating refresh
+// tokens, by hash
+type SessionStore interface {
+	CreateSession(session Session, refreshHash string) (*Session, error)
+	GetSession(sessionID string) (*Session, error)
+	GetUserSessions(userID string) ([]Session, error)
+	RotateRefreshToken(oldHash, newHash, expiresAt, ip string) (*Session, error)
+	RevokeSession(userID, sessionID, reason string) error
+	RevokeUserSessions(userID, keepID, reason string) (int, error)
+	TouchSession(sessionID, lastSeen, ip string) error
+}
+
+// TwoFactorStore persists accounts' TOTP secrets, hashed recovery codes
+// and the platform's two-factor policy for organizers
+type TwoFactorStore interface {
+	GetTwoFactor(userID string) (*TwoFactor, error)
+	SaveTwoFactorEnrollment(userID, secret string, recoveryHashes []string) error
+	EnableTwoFactor(userID string) error
+	DeleteTwoFactor(userID string) error
+	UseTwoFactorStep(userID string, step int64) (bool, error)
+	UseRecoveryCode(userID, codeHash string) (bool, error)
+	CountRecoveryCodes(userID string) (int, error)
+	GetOrganizerTwoFactorPolicy() (bool, error)
+	SetOrganizerTwoFactorPolicy(required bool, adminID string) error
+}
+
+// LoginThrottleStore counts failed logins per account and per IP address.
+// Attempts are reserved atomically before credentials are checked and
+// released if they succeed.
+type LoginThrottleStore interface {
+	ReserveLoginAttempt(key string, threshold int, lockout time.Duration) (*LoginAttempt, error)
+	ReleaseLoginAttempt(key string, attempt *LoginAttempt) error
+	ClearLoginThrottle(key string) (*LoginThrottle, error)
+}
+
+// Store groups every storage interface the handlers depend on
+type Store interface {
+	UserStore
+	EventStore
+	RegistrationStore
+	TicketStore
+	TierStore
+	EventMemberStore
+	HoldStore
+	PaymentStore
+	PromoStore
+	InvoiceStore
+	LedgerStore
+	APIKeyStore
+	AccountStore
+	SessionStore
+	TwoFactorStore
+	LoginThrottleStore
+}
+
+// Global stores used by the handlers
+var (
+	userStore          UserStore
+	eventStore         EventStore
+	registrationStore  RegistrationStore
+	ticketStore        TicketStore
+	tierStore          TierStore
+	eventMemberStore   EventMemberStore
+	holdStore          HoldStore
+	paymentStore       PaymentStore
+	promoStore         PromoStore
+	invoiceStore       InvoiceStore
+	ledgerStore        LedgerStore
+	apiKeyStore        APIKeyStore
+	accountStore       AccountStore
+	sessionStore       SessionStore
+	twoFactorStore     TwoFactorStore
+	loginThrottleStore LoginThrottleStore
+)
+
+// setStore points all handler-facing stores at the given backend
+func setStore(store Store) {
+	userStore = store
+	eventStore = store
+	registrationStore = store
+	ticketStore = store
+	tierStore = store
+	eventMemberStore = store
+	holdStore = store
+	paymentStore = store
+	promoStore = store
+	invoiceStore = store
+	ledgerStore = store
+	apiKeyStore = store
+	accountStore = store
+	sessionStore = store
+	twoFactorStore = store
+	loginThrottleStore = store
+}
+
+// newStoreFromEnv builds the backend selected by STORAGE_BACKEND
+// ("supabase" by default, or "memory" to run without a Supabase project)
+func newStoreFromEnv() (Store, error) {
+	backend := os.Getenv("STORAGE_BACKEND")
+
+	switch backend {
+	case "", "supabase":
+		supabaseURL := os.Getenv("SUPABASE_URL")
+		supabaseKey := os.Getenv("SUPABASE_ANON_KEY")
+		supabaseServiceRoleKey := os.Getenv("SUPABASE_SERVICE_ROLE_KEY")
+
+		if supabaseURL == "" || supabaseKey == "" {
+			return nil, fmt.Errorf("SUPABASE_URL and SUPABASE_ANON_KEY environment variables must be set")
+		}
+
+		supabaseClient = NewSupabaseClient(supabaseURL, supabaseKey, supabaseServiceRoleKey)
+		return supabaseClient, nil
+	case "memory":
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_BACKEND %q (expected supabase or memory)", backend)
+	}
+}
@@ -0,0 +1,507 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore is an in-process implementation of Store. It mirrors the
+// behaviour of the Supabase tables closely enough for local development
+// and tests, but keeps nothing across restarts.
+type MemoryStore struct {
+	mu            sync.RWMutex
+	users         map[string]*memoryUser
+	tokens        map[string]string
+	events        map[string]*Event
+	registrations map[string]*Registration
+	tickets       map[string]*Ticket
+	tiers         map[string]*TicketTier
+	eventMembers  map[string]*EventMember
+	holds         map[string]*SeatHold
+	payments      map[string]*Payment
+	promoCodes    map[string]*PromoCode
+	taxProfiles   map[string]*TaxProfile
+	invoices      map[string]*Invoice
+	payouts       map[string]*Payout
+	apiKeys       map[string]*APIKey
+	authTokens    map[string]memoryAuthToken
+	sessions      map[string]*Session
+	refreshTokens map[string]*memoryRefreshToken
+	twoFactors    map[string]*TwoFactor
+	recoveryCodes map[string]map[string]bool
+	ticketVersion int64
+
+	// loginThrottles counts failed logins by account and IP address
+	loginThrottles map[string]*LoginThrottle
+
+	// requireOrganizerTwoFactor is the platform's two-factor policy
+	requireOrganizerTwoFactor bool
+
+	// invoiceSequences holds the last invoice number used per organizer and
+	// financial year
+	invoiceSequences map[string]int
+
+	// ledger holds every ledger entry in posting order, ledgerReferences
+	// the references already posted, and ledgerQueue the transactions
+	// waiting to be retried after a failed posting
+	ledger           []*LedgerEntry
+	ledgerReferences map[string]bool
+	ledgerQueue      []LedgerTransaction
+}
+
+type memoryUser struct {
+	User
+	passwordSalt  string
+	passwordHash  string
+	emailVerified bool
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:         make(map[string]*memoryUser),
+		tokens:        make(map[string]string),
+		events:        make(map[string]*Event),
+		registrations: make(map[string]*Registration),
+		tickets:       make(map[string]*Ticket),
+		tiers:         make(map[string]*TicketTier),
+		eventMembers:  make(map[string]*EventMember),
+		holds:         make(map[string]*SeatHold),
+		payments:      make(map[string]*Payment),
+		promoCodes:    make(map[string]*PromoCode),
+		taxProfiles:   make(map[string]*TaxProfile),
+		invoices:      make(map[string]*Invoice),
+		payouts:       make(map[string]*Payout),
+		apiKeys:       make(map[string]*APIKey),
+		authTokens:    make(map[string]memoryAuthToken),
+		sessions:      make(map[string]*Session),
+		refreshTokens: make(map[string]*memoryRefreshToken),
+		twoFactors:    make(map[string]*TwoFactor),
+		recoveryCodes: make(map[string]map[string]bool),
+
+		loginThrottles: make(map[string]*LoginThrottle),
+
+		invoiceSequences: make(map[string]int),
+		ledgerReferences: make(map[string]bool),
+	}
+}
+
+// newID returns a random RFC 4122 version 4 UUID
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// newToken returns a random opaque token
+func newToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func nowTimestamp() string {
+	return time.Now().UTC().Format(time.RFC3339)
+}
+
+// hashPassword is only meant for the development store; production
+// credentials are always held by Supabase Auth
+func hashPassword(salt, password string) string {
+	sum := sha256.Sum256([]byte(salt + password))
+	return hex.EncodeToString(sum[:])
+}
+
+// =====================================================
+// Users
+// =====================================================
+
+func (m *MemoryStore) findUserByEmail(email string) *memoryUser {
+	for _, u := range m.users {
+		if strings.EqualFold(u.Email, email) {
+			return u
+		}
+	}
+	return nil
+}
+
+// UserExists reports whether a user with the given email exists
+func (m *MemoryStore) UserExists(email string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.findUserByEmail(email) != nil, nil
+}
+
+// CreateUser stores a new user and returns an access token for it
+func (m *MemoryStore) CreateUser(req RegisterRequest) (*User, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.findUserByEmail(req.Email) != nil {
+		return nil, "", fmt.Errorf("user already registered")
+	}
+
+	salt := newToken()
+	u := &memoryUser{
+		User: User{
+			ID:          newID(),
+			Email:       req.Email,
+			FullName:    req.FullName,
+			PhoneNumber: req.PhoneNumber,
+			Username:    req.Username,
+			AccountType: "attendee",
+			CreatedAt:   nowTimestamp(),
+		},
+		passwordSalt: salt,
+		passwordHash: hashPassword(salt, req.Password),
+	}
+	m.users[u.ID] = u
+
+	token := newToken()
+	m.tokens[token] = u.ID
+
+	user := u.User
+	return &user, token, nil
+}
+
+// CreateProfile updates the profile fields of an existing user
+func (m *MemoryStore) CreateProfile(userID, fullName, phoneNumber, email string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, exists := m.users[userID]
+	if !exists {
+		return fmt.Errorf("failed to create profile: user not found")
+	}
+
+	u.FullName = fullName
+	u.PhoneNumber = phoneNumber
+	u.Email = email
+	return nil
+}
+
+// Authenticate checks a user's credentials and returns a new access token
+func (m *MemoryStore) Authenticate(email, password string) (*User, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u := m.findUserByEmail(email)
+	if u == nil || hashPassword(u.passwordSalt, password) != u.passwordHash {
+		return nil, "", fmt.Errorf("authentication failed: invalid login credentials")
+	}
+
+	token := newToken()
+	m.tokens[token] = u.ID
+
+	user := u.User
+	return &user, token, nil
+}
+
+// GetUser returns the user that owns the given access token
+func (m *MemoryStore) GetUser(token string) (*User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	userID, exists := m.tokens[token]
+	if !exists {
+		return nil, fmt.Errorf("failed to get user")
+	}
+
+	user := m.users[userID].User
+	return &user, nil
+}
+
+// GetUserByID returns a user by ID
+func (m *MemoryStore) GetUserByID(userID string) (*User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	u, exists := m.users[userID]
+	if !exists {
+		return nil, fmt.Errorf("failed to get user: user not found")
+	}
+
+	user := u.User
+	return &user, nil
+}
+
+// UserIDFromToken returns the ID of the user that owns the given access token
+func (m *MemoryStore) UserIDFromToken(token string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	userID, exists := m.tokens[token]
+	if !exists {
+		return "", fmt.Errorf("failed to get user: invalid token")
+	}
+
+	return userID, nil
+}
+
+// =====================================================
+// Events
+// =====================================================
+
+// GetEvents returns active events ordered by date with optional filtering
+func (m *MemoryStore) GetEvents(category, search string) ([]Event, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	events := []Event{}
+	for _, e := range m.events {
+		if e.Status != "active" {
+			continue
+		}
+		if category != "" && e.Category != category {
+			continue
+		}
+		if search != "" && !strings.Contains(strings.ToLower(e.Title), strings.ToLower(search)) {
+			continue
+		}
+		events = append(events, *e)
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].EventDate < events[j].EventDate
+	})
+
+	return events, nil
+}
+
+// GetEventByID returns a single event by its ID
+func (m *MemoryStore) GetEventByID(eventID string) (*Event, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	e, exists := m.events[eventID]
+	if !exists {
+		return nil, fmt.Errorf("event not found")
+	}
+
+	event := *e
+	return &event, nil
+}
+
+// CreateEvent stores a new active event
+func (m *MemoryStore) CreateEvent(token, organizerID string, req CreateEventRequest) (*Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := nowTimestamp()
+	e := &Event{
+		ID:          newID(),
+		Title:       req.Title,
+		Description: req.Description,
+		EventDate:   req.EventDate,
+		Location:    req.Location,
+		Category:    req.Category,
+		Price:       req.Price,
+		Capacity:    req.Capacity,
+		OrganizerID: organizerID,
+		ImageURL:    req.ImageURL,
+		Status:      "active",
+		CreatedAt:   now,
+		UpdatedAt:   now,
+
+		WaitlistEnabled: req.WaitlistEnabled,
+		RefundPolicy:    req.RefundPolicy,
+	}
+	m.events[e.ID] = e
+
+	event := *e
+	return &event, nil
+}
+
+// UpdateEvent applies a partial update to an event, like a PostgREST PATCH
+func (m *MemoryStore) UpdateEvent(token, eventID string, data map[string]interface{}) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, exists := m.events[eventID]
+	if !exists {
+		return nil
+	}
+
+	// Round-trip through JSON so column names match the Supabase payload
+	current, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	var merged map[string]interface{}
+	if err := json.Unmarshal(current, &merged); err != nil {
+		return err
+	}
+	for key, value := range data {
+		merged[key] = value
+	}
+
+	updated, err := json.Marshal(merged)
+	if err != nil {
+		return err
+	}
+
+	var event Event
+	if err := json.Unmarshal(updated, &event); err != nil {
+		return fmt.Errorf("failed to update event: %v", err)
+	}
+
+	m.events[eventID] = &event
+	return nil
+}
+
+// DeleteEvent soft-deletes an event by setting its status to 'cancelled'
+func (m *MemoryStore) DeleteEvent(token, eventID string) error {
+	return m.UpdateEvent(token, eventID, map[string]interface{}{
+		"status":     "cancelled",
+		"updated_at": nowTimestamp(),
+	})
+}
+
+// =====================================================
+// Registrations
+// =====================================================
+
+// GetUserRegistrations returns a user's registrations joined with event data
+func (m *MemoryStore) GetUserRegistrations(token, userID, status string) ([]RegistrationWithEvent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	registrations := []RegistrationWithEvent{}
+	for _, reg := range m.registrations {
+		if reg.UserID != userID {
+			continue
+		}
+		if status != "" && reg.Status != status {
+			continue
+		}
+
+		withEvent := RegistrationWithEvent{
+			ID:               reg.ID,
+			EventID:          reg.EventID,
+			UserID:           reg.UserID,
+			RegistrationDate: reg.RegistrationDate,
+			Status:           reg.Status,
+			Notes:            reg.Notes,
+			CreatedAt:        reg.CreatedAt,
+			WaitlistPosition: reg.WaitlistPosition,
+			TierID:           reg.TierID,
+			Quantity:         reg.Quantity,
+			Attendees:        reg.Attendees,
+		}
+		if e, exists := m.events[reg.EventID]; exists {
+			withEvent.Event = *e
+		}
+		registrations = append(registrations, withEvent)
+	}
+
+	sort.Slice(registrations, func(i, j int) bool {
+		return registrations[i].CreatedAt > registrations[j].CreatedAt
+	})
+
+	return registrations, nil
+}
+
+// CreateRegistration stores a confirmed registration, enforcing one per user and event
+func (m *MemoryStore) CreateRegistration(token string, registration Registration) (*Registration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.createRegistrationLocked(registration)
+}
+
+// createRegistrationLocked stores a confirmed registration. Callers must hold m.mu.
+func (m *MemoryStore) createRegistrationLocked(registration Registration) (*Registration, error) {
+	if _, exists := m.events[registration.EventID]; !exists {
+		return nil, fmt.Errorf("failed to create registration: event not found")
+	}
+
+	for _, reg := range m.registrations {
+		if reg.EventID == registration.EventID && reg.UserID == registration.UserID {
+			return nil, errAlreadyRegistered
+		}
+	}
+
+	now := nowTimestamp()
+	reg := &Registration{
+		ID:               newID(),
+		EventID:          registration.EventID,
+		UserID:           registration.UserID,
+		RegistrationDate: now,
+		Status:           "confirmed",
+		Notes:            registration.Notes,
+		CreatedAt:        now,
+		TierID:           registration.TierID,
+		Quantity:         registration.Seats(),
+		Attendees:        registration.Attendees,
+		PromoCodeID:      registration.PromoCodeID,
+		Discount:         registration.Discount,
+	}
+	m.registrations[reg.ID] = reg
+
+	created := *reg
+	return &created, nil
+}
+
+// CancelRegistration sets a registration's status to 'cancelled'
+func (m *MemoryStore) CancelRegistration(token, registrationID, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if reg, exists := m.registrations[registrationID]; exists && reg.UserID == userID {
+		reg.Status = "cancelled"
+		reg.WaitlistPosition = nil
+	}
+
+	return nil
+}
+
+// GetEventRegistrations lists an event's registrations, oldest first,
+// optionally only those with a status
+func (m *MemoryStore) GetEventRegistrations(eventID, status string) ([]Registration, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	registrations := []Registration{}
+	for _, reg := range m.registrations {
+		if reg.EventID == eventID && (status == "" || reg.Status == status) {
+			registrations = append(registrations, *reg)
+		}
+	}
+
+	sort.Slice(registrations, func(i, j int) bool {
+		return registrations[i].CreatedAt < registrations[j].CreatedAt
+	})
+
+	return registrations, nil
+}
+
+// GetEventRegistrationCount returns the seats taken for an event: confirmed
+// registrations plus active seat holds
+func (m *MemoryStore) GetEventRegistrationCount(eventID string) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	count, _ := m.heldSeatsLocked(eventID)
+	for _, reg := range m.registrations {
+		if reg.EventID == eventID && reg.Status == "confirmed" {
+			count += reg.Seats()
+		}
+	}
+
+	return count, nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestNewStoreFromEnv(t *testing.T) {
+	t.Cleanup(func() { supabaseClient = nil })
+
+	t.Run("memory", func(t *testing.T) {
+		t.Setenv("STORAGE_BACKEND", "memory")
+
+		store, err := newStoreFromEnv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := store.(*MemoryStore); !ok {
+			t.Fatalf("expected a MemoryStore, got %T", store)
+		}
+	})
+
+	t.Run("supabase requires its settings", func(t *testing.T) {
+		t.Setenv("STORAGE_BACKEND", "supabase")
+		t.Setenv("SUPABASE_URL", "")
+		t.Setenv("SUPABASE_ANON_KEY", "")
+
+		if _, err := newStoreFromEnv(); err == nil {
+			t.Fatal("expected an error without SUPABASE_URL and SUPABASE_ANON_KEY")
+		}
+	})
+
+	t.Run("supabase", func(t *testing.T) {
+		t.Setenv("STORAGE_BACKEND", "")
+		t.Setenv("SUPABASE_URL", "http://supabase.test")
+		t.Setenv("SUPABASE_ANON_KEY", "anon")
+
+		store, err := newStoreFromEnv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if client, ok := store.(*SupabaseClient); !ok || client.URL != "http://supabase.test" {
+			t.Fatalf("expected a SupabaseClient for http://supabase.test, got %#v", store)
+		}
+	})
+
+	t.Run("unknown backend", func(t *testing.T) {
+		t.Setenv("STORAGE_BACKEND", "sqlite")
+
+		if _, err := newStoreFromEnv(); err == nil {
+			t.Fatal("expected an error for an unknown STORAGE_BACKEND")
+		}
+	})
+}
+
+func TestMemoryStoreUsers(t *testing.T) {
+	store := NewMemoryStore()
+
+	user, token, err := store.CreateUser(RegisterRequest{Email: "ada@example.com", Password: testPassword})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.AccountType != roleAttendee {
+		t.Errorf("expected new accounts to be attendees, got %q", user.AccountType)
+	}
+
+	if _, _, err := store.CreateUser(RegisterRequest{Email: "ada@example.com", Password: testPassword}); err == nil {
+		t.Error("expected registering the same email twice to fail")
+	}
+
+	if userID, err := store.UserIDFromToken(token); err != nil || userID != user.ID {
+		t.Errorf("expected the registration token to resolve to %s, got %q (%v)", user.ID, userID, err)
+	}
+
+	if _, _, err := store.Authenticate("ada@example.com", "wrong password"); err == nil {
+		t.Error("expected a wrong password to be rejected")
+	}
+
+	authenticated, loginToken, err := store.Authenticate("ada@example.com", testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if authenticated.ID != user.ID || loginToken == token {
+		t.Errorf("expected a fresh token for %s, got user %s token %q", user.ID, authenticated.ID, loginToken)
+	}
+
+	if _, err := store.UserIDFromToken("not-a-token"); err == nil {
+		t.Error("expected an unknown token to be rejected")
+	}
+}
+
+func TestMemoryStoreReturnsCopies(t *testing.T) {
+	store := NewMemoryStore()
+
+	capacity := 10
+	created, err := store.CreateEvent("", "organizer-1", CreateEventRequest{Title: "Launch", Capacity: &capacity})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created.Title = "Changed by the caller"
+	fetched, err := store.GetEventByID(created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fetched.Title != "Launch" {
+		t.Fatalf("expected the stored event to be unaffected by callers, got title %q", fetched.Title)
+	}
+
+	if err := store.UpdateEvent("", created.ID, map[string]interface{}{"title": "Relaunch", "capacity": 20}); err != nil {
+		t.Fatal(err)
+	}
+	updated, _ := store.GetEventByID(created.ID)
+	if updated.Title != "Relaunch" || updated.Capacity == nil || *updated.Capacity != 20 {
+		t.Fatalf("expected a partial update of title and capacity, got %+v", updated)
+	}
+	if updated.OrganizerID != "organizer-1" {
+		t.Errorf("expected fields left out of the update to be kept, got organizer %q", updated.OrganizerID)
+	}
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// minJWKSRefetch limits how often an unknown kid can force a JWKS download
+const minJWKSRefetch = time.Minute
+
+// SupabaseClaims are the claims of a Supabase Auth access token
+type SupabaseClaims struct {
+	Subject   string   `json:"sub"`
+	Role      string   `json:"role"`
+	Email     string   `json:"email"`
+	Issuer    string   `json:"iss"`
+	Audience  audience `json:"aud"`
+	IssuedAt  int64    `json:"iat"`
+	NotBefore int64    `json:"nbf"`
+	ExpiresAt int64    `json:"exp"`
+	SessionID string   `json:"session_id"`
+	// AAL is the assurance level of the sign-in: aal2 once an MFA factor
+	// was verified
+	AAL          string `json:"aal"`
+	UserMetadata struct {
+		AccountType string `json:"account_type"`
+	} `json:"user_metadata"`
+}
+
+// audience accepts the aud claim as either a string or a list of strings
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+func (a audience) contains(value string) bool {
+	for _, v := range a {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// SupabaseTokenVerifier validates Supabase-issued access tokens without a
+// round-trip to /auth/v1/user. HS256 tokens are checked against the project
+// JWT secret; asymmetric tokens against the project's JWKS document, which
+// is cached and refreshed in the background.
+type SupabaseTokenVerifier struct {
+	Issuer   string
+	Audience string
+
+	secret          []byte
+	jwksURL         string
+	refreshInterval time.Duration
+	client          *http.Client
+
+	mu        sync.RWMutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+// NewSupabaseTokenVerifier creates a verifier. Either secret or jwksURL
+// (or both) must be set.
+func NewSupabaseTokenVerifier(issuer, audience string, secret []byte, jwksURL string, refreshInterval time.Duration) *SupabaseTokenVerifier {
+	return &SupabaseTokenVerifier{
+		Issuer:          issuer,
+		Audience:        audience,
+		secret:          secret,
+		jwksURL:         jwksURL,
+		refreshInterval: refreshInterval,
+		client:          &http.Client{Timeout: 10 * time.Second},
+		keys:            make(map[string]crypto.PublicKey),
+	}
+}
+
+// Verify checks a Supabase access token's signature, issuer, audience and expiry
+func (v *SupabaseTokenVerifier) Verify(token string) (*SupabaseClaims, error) {
+	header, signingInput, signature, payload, err := splitJWT(token)
+	if err != nil {
+		return nil, err
+	}
+
+	switch header.Algorithm {
+	case "HS256":
+		if len(v.secret) == 0 {
+			return nil, errUnknownKey
+		}
+		mac := hmac.New(sha256.New, v.secret)
+		mac.Write([]byte(signingInput))
+		if subtle.ConstantTimeCompare(mac.Sum(nil), signature) != 1 {
+			return nil, errInvalidToken
+		}
+	case "RS256", "ES256":
+		key, err := v.publicKey(header.KeyID)
+		if err != nil {
+			return nil, err
+		}
+		if err := verifyAsymmetric(header.Algorithm, key, signingInput, signature); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errInvalidToken
+	}
+
+	var claims SupabaseClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, errInvalidToken
+	}
+
+	if claims.Subject == "" {
+		return nil, errInvalidToken
+	}
+	if v.Issuer != "" && claims.Issuer != v.Issuer {
+		return nil, errInvalidToken
+	}
+	if v.Audience != "" && !claims.Audience.contains(v.Audience) {
+		return nil, errInvalidToken
+	}
+
+	if err := checkTokenTimes(claims.IssuedAt, claims.NotBefore, claims.ExpiresAt); err != nil {
+		return nil, err
+	}
+
+	return &claims, nil
+}
+
+// publicKey returns the cached JWKS key for kid, refetching the document
+// once if the kid is unknown (Supabase may have rotated its signing key)
+func (v *SupabaseTokenVerifier) publicKey(kid string) (crypto.PublicKey, error) {
+	if v.jwksURL == "" {
+		return nil, errUnknownKey
+	}
+
+	v.mu.RLock()
+	key, exists := v.keys[kid]
+	fetchedAt := v.fetchedAt
+	v.mu.RUnlock()
+
+	if exists {
+		return key, nil
+	}
+
+	if time.Since(fetchedAt) < minJWKSRefetch {
+		return nil, errUnknownKey
+	}
+
+	if err := v.Refresh(); err != nil {
+		fmt.Printf("Error refreshing Supabase JWKS: %v\n", err)
+		return nil, errUnknownKey
+	}
+
+	v.mu.RLock()
+	key, exists = v.keys[kid]
+	v.mu.RUnlock()
+
+	if !exists {
+		return nil, errUnknownKey
+	}
+	return key, nil
+}
+
+// Refresh downloads the JWKS document and replaces the cached keys
+func (v *SupabaseTokenVerifier) Refresh() error {
+	v.mu.Lock()
+	v.fetchedAt = time.Now()
+	v.mu.Unlock()
+
+	resp, err := v.client.Get(v.jwksURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch JWKS: %s", string(body))
+	}
+
+	var document struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(body, &document); err != nil {
+		return err
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, jwk := range document.Keys {
+		key, err := jwk.publicKey()
+		if err != nil {
+			fmt.Printf("Skipping JWKS key %s: %v\n", jwk.KeyID, err)
+			continue
+		}
+		keys[jwk.KeyID] = key
+	}
+
+	v.mu.Lock()
+	v.keys = keys
+	v.mu.Unlock()
+
+	return nil
+}
+
+// StartRefresh refreshes the JWKS document on the configured interval
+func (v *SupabaseTokenVerifier) StartRefresh() {
+	if v.jwksURL == "" || v.refreshInterval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(v.refreshInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := v.Refresh(); err != nil {
+				fmt.Printf("Error refreshing Supabase JWKS: %v\n", err)
+			}
+		}
+	}()
+}
+
+// jsonWebKey is a single RSA or EC entry of a JWKS document
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Curve   string `json:"crv"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		if k.Curve != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, fmt.Errorf("point is not on curve")
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.KeyType)
+	}
+}
+
+func verifyAsymmetric(algorithm string, key crypto.PublicKey, signingInput string, signature []byte) error {
+	digest := sha256.Sum256([]byte(signingInput))
+
+	switch algorithm {
+	case "RS256":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return errInvalidToken
+		}
+		if err := rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, digest[:], signature); err != nil {
+			return errInvalidToken
+		}
+		return nil
+	case "ES256":
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 64 {
+			return errInvalidToken
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(ecKey, digest[:], r, s) {
+			return errInvalidToken
+		}
+		return nil
+	default:
+		return errInvalidToken
+	}
+}
+
+// newSupabaseVerifierFromEnv builds the local Supabase token verifier:
+//
+//	SUPABASE_JWT_SECRET            project JWT secret for HS256 tokens
+//	SUPABASE_JWKS_URL              JWKS document for RS256/ES256 tokens
+//	SUPABASE_JWKS_REFRESH          JWKS refresh interval (default 10m)
+//	SUPABASE_AUTH_REMOTE_FALLBACK  also try /auth/v1/user when local verification fails
+//
+// It returns a nil verifier when neither the secret nor a JWKS URL is set,
+// in which case tokens are always looked up remotely.
+func newSupabaseVerifierFromEnv() (*SupabaseTokenVerifier, bool, error) {
+	secret := os.Getenv("SUPABASE_JWT_SECRET")
+	jwksURL := os.Getenv("SUPABASE_JWKS_URL")
+	remoteFallback := os.Getenv("SUPABASE_AUTH_REMOTE_FALLBACK") == "true"
+
+	if secret == "" && jwksURL == "" {
+		return nil, true, nil
+	}
+
+	refreshInterval, err := time.ParseDuration(envOrDefault("SUPABASE_JWKS_REFRESH", "10m"))
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid SUPABASE_JWKS_REFRESH: %v", err)
+	}
+
+	issuer := ""
+	if supabaseURL := os.Getenv("SUPABASE_URL"); supabaseURL != "" {
+		issuer = strings.TrimSuffix(supabaseURL, "/") + "/auth/v1"
+	}
+
+	verifier := NewSupabaseTokenVerifier(issuer, "authenticated", []byte(secret), jwksURL, refreshInterval)
+
+	if jwksURL != "" {
+		if err := verifier.Refresh(); err != nil {
+			// Not fatal: keys are fetched again on demand and on the interval
+			fmt.Printf("Error fetching Supabase JWKS: %v\n", err)
+		}
+		verifier.StartRefresh()
+	}
+
+	return verifier, remoteFallback, nil
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testSupabaseIssuer = "https://project.supabase.co/auth/v1"
+
+// signSupabaseToken signs claims the way Supabase Auth would, with an HMAC
+// secret ([]byte), an RSA key or a P-256 key
+func signSupabaseToken(t *testing.T, kid string, key interface{}, claims map[string]interface{}) string {
+	t.Helper()
+
+	header := map[string]string{"typ": "JWT", "kid": kid}
+	switch key.(type) {
+	case []byte:
+		header["alg"] = "HS256"
+	case *rsa.PrivateKey:
+		header["alg"] = "RS256"
+	case *ecdsa.PrivateKey:
+		header["alg"] = "ES256"
+	}
+
+	headerJSON, _ := json.Marshal(header)
+	payloadJSON, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(payloadJSON)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	var signature []byte
+	switch key := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(signingInput))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func supabaseTestClaims() map[string]interface{} {
+	now := time.Now()
+	return map[string]interface{}{
+		"sub":           "supabase-user",
+		"role":          "authenticated",
+		"email":         "ada@example.com",
+		"iss":           testSupabaseIssuer,
+		"aud":           "authenticated",
+		"iat":           now.Unix(),
+		"exp":           now.Add(time.Hour).Unix(),
+		"aal":           "aal1",
+		"user_metadata": map[string]string{"account_type": "organizer"},
+	}
+}
+
+// jwksServer serves a JWKS document whose keys can be swapped out
+type jwksServer struct {
+	mu       sync.Mutex
+	keys     []map[string]string
+	requests int
+}
+
+func (s *jwksServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests++
+	json.NewEncoder(w).Encode(map[string]interface{}{"keys": s.keys})
+}
+
+func (s *jwksServer) setKeys(keys ...map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys = keys
+}
+
+func rsaJWK(kid string, key *rsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA",
+		"kid": kid,
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func ecJWK(kid string, key *ecdsa.PublicKey) map[string]string {
+	x, y := make([]byte, 32), make([]byte, 32)
+	key.X.FillBytes(x)
+	key.Y.FillBytes(y)
+	return map[string]string{
+		"kty": "EC",
+		"kid": kid,
+		"crv": "P-256",
+		"x":   base64.RawURLEncoding.EncodeToString(x),
+		"y":   base64.RawURLEncoding.EncodeToString(y),
+	}
+}
+
+func TestSupabaseVerifierHS256(t *testing.T) {
+	secret := []byte("project-jwt-secret")
+	verifier := NewSupabaseTokenVerifier(testSupabaseIssuer, "authenticated", secret, "", 0)
+
+	claims, err := verifier.Verify(signSupabaseToken(t, "", secret, supabaseTestClaims()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "supabase-user" || claims.UserMetadata.AccountType != "organizer" || claims.AAL != "aal1" {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+
+	// aud may also be a list
+	listAudience := supabaseTestClaims()
+	listAudience["aud"] = []string{"other", "authenticated"}
+	if _, err := verifier.Verify(signSupabaseToken(t, "", secret, listAudience)); err != nil {
+		t.Fatalf("expected an aud list containing authenticated to verify: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		key    []byte
+		modify func(map[string]interface{})
+		want   error
+	}{
+		{"wrong secret", []byte("another-secret"), func(map[string]interface{}) {}, errInvalidToken},
+		{"wrong issuer", secret, func(c map[string]interface{}) { c["iss"] = "https://other.supabase.co/auth/v1" }, errInvalidToken},
+		{"wrong audience", secret, func(c map[string]interface{}) { c["aud"] = "anon" }, errInvalidToken},
+		{"no subject", secret, func(c map[string]interface{}) { delete(c, "sub") }, errInvalidToken},
+		{"expired", secret, func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, errTokenExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := supabaseTestClaims()
+			tt.modify(claims)
+			if _, err := verifier.Verify(signSupabaseToken(t, "", tt.key, claims)); !errors.Is(err, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestSupabaseVerifierJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwks := &jwksServer{}
+	jwks.setKeys(rsaJWK("rsa-1", &rsaKey.PublicKey), ecJWK("ec-1", &ecKey.PublicKey))
+	server := httptest.NewServer(jwks)
+	defer server.Close()
+
+	verifier := NewSupabaseTokenVerifier(testSupabaseIssuer, "authenticated", nil, server.URL, 0)
+
+	for kid, key := range map[string]interface{}{"rsa-1": rsaKey, "ec-1": ecKey} {
+		if _, err := verifier.Verify(signSupabaseToken(t, kid, key, supabaseTestClaims())); err != nil {
+			t.Fatalf("expected a %s token to verify: %v", kid, err)
+		}
+	}
+	if jwks.requests != 1 {
+		t.Fatalf("expected the JWKS to be fetched once and cached, got %d fetches", jwks.requests)
+	}
+
+	t.Run("no HMAC without a secret", func(t *testing.T) {
+		// The public modulus is no secret, so it must not work as an HMAC key
+		token := signSupabaseToken(t, "rsa-1", rsaKey.PublicKey.N.Bytes(), supabaseTestClaims())
+		if _, err := verifier.Verify(token); err == nil {
+			t.Fatal("expected an HS256 token to be rejected without a project secret")
+		}
+	})
+
+	t.Run("key signed by someone else", func(t *testing.T) {
+		otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if _, err := verifier.Verify(signSupabaseToken(t, "ec-1", otherKey, supabaseTestClaims())); err == nil {
+			t.Fatal("expected a token signed with another key to be rejected")
+		}
+	})
+
+	t.Run("rotation", func(t *testing.T) {
+		rotatedKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		jwks.setKeys(ecJWK("ec-2", &rotatedKey.PublicKey))
+		token := signSupabaseToken(t, "ec-2", rotatedKey, supabaseTestClaims())
+
+		// Unknown kids refetch at most once a minute
+		if _, err := verifier.Verify(token); !errors.Is(err, errUnknownKey) {
+			t.Fatalf("expected errUnknownKey right after a fetch, got %v", err)
+		}
+
+		verifier.mu.Lock()
+		verifier.fetchedAt = time.Now().Add(-minJWKSRefetch)
+		verifier.mu.Unlock()
+
+		if _, err := verifier.Verify(token); err != nil {
+			t.Fatalf("expected the rotated key to be fetched: %v", err)
+		}
+		if _, err := verifier.Verify(signSupabaseToken(t, "ec-1", ecKey, supabaseTestClaims())); err == nil {
+			t.Fatal("expected a key dropped from the JWKS to stop verifying")
+		}
+	})
+}
+
+func TestResolveTokenWithSupabaseVerifier(t *testing.T) {
+	store := newTestStore(t)
+	_, memoryToken := newTestUser(t, store, "remote@example.com", roleAttendee)
+
+	secret := []byte("project-jwt-secret")
+	previousVerifier, previousFallback := supabaseVerifier, authRemoteFallback
+	t.Cleanup(func() { supabaseVerifier, authRemoteFallback = previousVerifier, previousFallback })
+	supabaseVerifier = NewSupabaseTokenVerifier(testSupabaseIssuer, "authenticated", secret, "", 0)
+
+	token := signSupabaseToken(t, "", secret, supabaseTestClaims())
+	info, err := resolveToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.UserID != "supabase-user" || info.Role != "organizer" || info.SupabaseToken != token {
+		t.Fatalf("unexpected identity %+v", info)
+	}
+
+	// Tokens that fail local verification only go remote with the fallback on
+	authRemoteFallback = false
+	if _, err := resolveToken(memoryToken); err == nil {
+		t.Fatal("expected an unverifiable token to be rejected without the remote fallback")
+	}
+	authRemoteFallback = true
+	if info, err := resolveToken(memoryToken); err != nil || info.SupabaseToken != memoryToken {
+		t.Fatalf("expected the remote fallback to resolve the token, got %+v (%v)", info, err)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// doREST performs a PostgREST call against path (e.g. "/rest/v1/tickets?id=eq.1").
+// token is passed through bearer, so an empty token runs with the service role.
+// When out is non-nil the response body is decoded into it and the call asks
+// PostgREST to return the affected rows.
+func (c *SupabaseClient) doREST(method, path, token string, payload interface{}, out interface{}) error {
+	var body io.Reader
+	if payload != nil {
+		jsonData, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewBuffer(jsonData)
+	}
+
+	req, err := http.NewRequest(method, c.URL+path, body)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("apikey", c.AnonKey)
+	req.Header.Set("Authorization", "Bearer "+c.bearer(token))
+	if out != nil {
+		req.Header.Set("Prefer", "return=representation")
+	} else {
+		req.Header.Set("Prefer", "return=minimal")
+	}
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("supabase %s %s failed: %s", method, path, string(respBody))
+	}
+
+	if out != nil && len(respBody) > 0 {
+		return json.Unmarshal(respBody, out)
+	}
+
+	return nil
+}
@@ -156,6 +156,42 @@ CREATE TRIGGER on_auth_user_created
   AFTER INSERT ON auth.users
   FOR EACH ROW EXECUTE FUNCTION handle_new_user();
 
+-- Capacity guard: lock the event row and reject confirmed registrations
+-- beyond capacity, so concurrent inserts from several API instances cannot oversell
+DROP TRIGGER IF EXISTS registrations_capacity_guard ON registrations;
+DROP FUNCTION IF EXISTS enforce_event_capacity();
+
+CREATE OR REPLACE FUNCTION enforce_event_capacity()
+RETURNS TRIGGER AS $$
+DECLARE
+  event_capacity INTEGER;
+  confirmed_count INTEGER;
+BEGIN
+  IF NEW.status <> 'confirmed' THEN
+    RETURN NEW;
+  END IF;
+
+  SELECT capacity INTO event_capacity FROM events WHERE id = NEW.event_id FOR UPDATE;
+  IF event_capacity IS NULL THEN
+    RETURN NEW;
+  END IF;
+
+  SELECT COUNT(*) INTO confirmed_count
+  FROM registrations
+  WHERE event_id = NEW.event_id AND status = 'confirmed' AND id <> NEW.id;
+
+  IF confirmed_count >= event_capacity THEN
+    RAISE EXCEPTION 'event_full';
+  END IF;
+
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql SECURITY DEFINER;
+
+CREATE TRIGGER registrations_capacity_guard
+  BEFORE INSERT OR UPDATE OF status ON registrations
+  FOR EACH ROW EXECUTE FUNCTION enforce_event_capacity();
+
 -- Drop existing indexes if they exist
 DROP INDEX IF EXISTS idx_events_organizer;
 DROP INDEX IF EXISTS idx_events_date;
@@ -184,3 +220,1263 @@ BEGIN
     ('Business Workshop', 'Professional development workshop', '2024-05-10 14:00:00+00', 'New York, NY', 'Business', 99.99, 100, 'active');
   END IF;
 END $$;
+
+-- =====================================================
+-- Waitlist
+-- =====================================================
+
+ALTER TABLE events ADD COLUMN IF NOT EXISTS waitlist_enabled BOOLEAN DEFAULT FALSE;
+ALTER TABLE registrations ADD COLUMN IF NOT EXISTS waitlist_position INTEGER;
+
+ALTER TABLE registrations DROP CONSTRAINT IF EXISTS registrations_status_check;
+ALTER TABLE registrations ADD CONSTRAINT registrations_status_check
+  CHECK (status IN ('pending', 'confirmed', 'cancelled', 'waitlisted'));
+
+-- Append new waitlisted registrations to the end of the queue and clear the
+-- position once a registration leaves the waitlist
+CREATE OR REPLACE FUNCTION assign_waitlist_position()
+RETURNS TRIGGER AS $$
+BEGIN
+  IF NEW.status = 'waitlisted' THEN
+    IF NEW.waitlist_position IS NULL THEN
+      PERFORM 1 FROM events WHERE id = NEW.event_id FOR UPDATE;
+      SELECT COALESCE(MAX(waitlist_position), 0) + 1 INTO NEW.waitlist_position
+      FROM registrations
+      WHERE event_id = NEW.event_id AND status = 'waitlisted';
+    END IF;
+  ELSE
+    NEW.waitlist_position := NULL;
+  END IF;
+
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql SECURITY DEFINER;
+
+DROP TRIGGER IF EXISTS registrations_waitlist_position ON registrations;
+CREATE TRIGGER registrations_waitlist_position
+  BEFORE INSERT OR UPDATE OF status ON registrations
+  FOR EACH ROW EXECUTE FUNCTION assign_waitlist_position();
+
+-- Renumber an event's waitlist from 1 without gaps
+CREATE OR REPLACE FUNCTION compact_waitlist(p_event_id UUID)
+RETURNS VOID AS $$
+BEGIN
+  UPDATE registrations r
+  SET waitlist_position = ranked.position
+  FROM (
+    SELECT id, ROW_NUMBER() OVER (ORDER BY waitlist_position, created_at) AS position
+    FROM registrations
+    WHERE event_id = p_event_id AND status = 'waitlisted'
+  ) ranked
+  WHERE r.id = ranked.id;
+END;
+$$ LANGUAGE plpgsql SECURITY DEFINER;
+
+-- Confirm the first waitlisted registration in one transaction; the
+-- capacity guard rejects the promotion if the event is still full
+CREATE OR REPLACE FUNCTION promote_waitlist(p_event_id UUID)
+RETURNS SETOF registrations AS $$
+DECLARE
+  promoted registrations;
+BEGIN
+  PERFORM 1 FROM events WHERE id = p_event_id FOR UPDATE;
+
+  UPDATE registrations
+  SET status = 'confirmed'
+  WHERE id = (
+    SELECT id FROM registrations
+    WHERE event_id = p_event_id AND status = 'waitlisted'
+    ORDER BY waitlist_position
+    LIMIT 1
+  )
+  RETURNING * INTO promoted;
+
+  PERFORM compact_waitlist(p_event_id);
+
+  IF promoted.id IS NOT NULL THEN
+    RETURN NEXT promoted;
+  END IF;
+END;
+$$ LANGUAGE plpgsql SECURITY DEFINER;
+
+-- Apply an organizer-supplied waitlist order
+CREATE OR REPLACE FUNCTION reorder_waitlist(p_event_id UUID, p_registration_ids UUID[])
+RETURNS VOID AS $$
+BEGIN
+  PERFORM 1 FROM events WHERE id = p_event_id FOR UPDATE;
+
+  UPDATE registrations r
+  SET waitlist_position = o.position
+  FROM unnest(p_registration_ids) WITH ORDINALITY AS o(id, position)
+  WHERE r.id = o.id AND r.event_id = p_event_id AND r.status = 'waitlisted';
+
+  PERFORM compact_waitlist(p_event_id);
+END;
+$$ LANGUAGE plpgsql SECURITY DEFINER;
+
+CREATE INDEX IF NOT EXISTS idx_registrations_waitlist ON registrations(event_id, waitlist_position)
+  WHERE status = 'waitlisted';
+
+-- =====================================================
+-- Ticket issuance
+-- =====================================================
+
+-- Tickets are issued by the API (service role) when a registration is confirmed
+ALTER TABLE tickets ADD COLUMN IF NOT EXISTS registration_id UUID REFERENCES registrations(id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_tickets_registration ON tickets(registration_id);
+
+-- =====================================================
+-- Door check-in
+-- =====================================================
+
+-- Scanning a ticket moves it from 'active' to 'used' and records who scanned it
+ALTER TABLE tickets ADD COLUMN IF NOT EXISTS checked_in_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE tickets ADD COLUMN IF NOT EXISTS checked_in_by UUID REFERENCES auth.users(id);
+
+-- Users designated by the organizer to check tickets in
+CREATE TABLE IF NOT EXISTS event_staff (
+  event_id UUID REFERENCES events(id) ON DELETE CASCADE,
+  user_id UUID REFERENCES auth.users(id) ON DELETE CASCADE,
+  added_by UUID REFERENCES auth.users(id),
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+  PRIMARY KEY (event_id, user_id)
+);
+
+-- Managed by the API with the service role only
+ALTER TABLE event_staff ENABLE ROW LEVEL SECURITY;
+
+CREATE INDEX IF NOT EXISTS idx_tickets_event_status ON tickets(event_id, status);
+
+-- =====================================================
+-- Offline scanner sync
+-- =====================================================
+
+-- Device that recorded an offline check-in
+ALTER TABLE tickets ADD COLUMN IF NOT EXISTS checked_in_device TEXT;
+
+-- Every insert or update takes the next version, so scanners can ask for
+-- the tickets changed since the last manifest they downloaded
+CREATE SEQUENCE IF NOT EXISTS ticket_version_seq;
+ALTER TABLE tickets ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT nextval('ticket_version_seq');
+
+CREATE OR REPLACE FUNCTION bump_ticket_version()
+RETURNS TRIGGER AS $$
+BEGIN
+  NEW.version := nextval('ticket_version_seq');
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS bump_ticket_version ON tickets;
+CREATE TRIGGER bump_ticket_version
+  BEFORE INSERT OR UPDATE ON tickets
+  FOR EACH ROW EXECUTE FUNCTION bump_ticket_version();
+
+CREATE INDEX IF NOT EXISTS idx_tickets_event_version ON tickets(event_id, version);
+
+-- =====================================================
+-- Ticket tiers
+-- =====================================================
+
+-- Ticket types sold for an event, each with its own price, capacity,
+-- sale window and per-order limit (0 means no limit)
+CREATE TABLE IF NOT EXISTS ticket_tiers (
+  id UUID DEFAULT uuid_generate_v4() PRIMARY KEY,
+  event_id UUID REFERENCES events(id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  description TEXT,
+  price DECIMAL(10,2) DEFAULT 0 CHECK (price >= 0),
+  capacity INTEGER CHECK (capacity >= 0),
+  sales_start TIMESTAMP WITH TIME ZONE,
+  sales_end TIMESTAMP WITH TIME ZONE,
+  max_per_order INTEGER DEFAULT 0 CHECK (max_per_order >= 0),
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+  CHECK (sales_end IS NULL OR sales_start IS NULL OR sales_end > sales_start)
+);
+
+ALTER TABLE ticket_tiers ENABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS "Anyone can view ticket tiers" ON ticket_tiers;
+CREATE POLICY "Anyone can view ticket tiers" ON ticket_tiers
+  FOR SELECT USING (true);
+
+CREATE INDEX IF NOT EXISTS idx_ticket_tiers_event ON ticket_tiers(event_id);
+
+ALTER TABLE registrations ADD COLUMN IF NOT EXISTS tier_id UUID REFERENCES ticket_tiers(id);
+ALTER TABLE tickets ADD COLUMN IF NOT EXISTS tier_id UUID REFERENCES ticket_tiers(id);
+
+CREATE INDEX IF NOT EXISTS idx_registrations_tier ON registrations(tier_id) WHERE tier_id IS NOT NULL;
+
+-- Tier capacity guard, alongside the event capacity guard
+DROP TRIGGER IF EXISTS registrations_tier_capacity_guard ON registrations;
+
+CREATE OR REPLACE FUNCTION enforce_tier_capacity()
+RETURNS TRIGGER AS $$
+DECLARE
+  tier_capacity INTEGER;
+  confirmed_count INTEGER;
+BEGIN
+  IF NEW.status <> 'confirmed' OR NEW.tier_id IS NULL THEN
+    RETURN NEW;
+  END IF;
+
+  SELECT capacity INTO tier_capacity FROM ticket_tiers WHERE id = NEW.tier_id FOR UPDATE;
+  IF tier_capacity IS NULL THEN
+    RETURN NEW;
+  END IF;
+
+  SELECT COUNT(*) INTO confirmed_count
+  FROM registrations
+  WHERE tier_id = NEW.tier_id AND status = 'confirmed' AND id <> NEW.id;
+
+  IF confirmed_count >= tier_capacity THEN
+    RAISE EXCEPTION 'tier_sold_out';
+  END IF;
+
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql SECURITY DEFINER;
+
+CREATE TRIGGER registrations_tier_capacity_guard
+  BEFORE INSERT OR UPDATE OF status ON registrations
+  FOR EACH ROW EXECUTE FUNCTION enforce_tier_capacity();
+
+-- Waitlist promotion can now target a specific registration, so the API
+-- can skip registrations whose tier is sold out
+DROP FUNCTION IF EXISTS promote_waitlist(UUID);
+
+CREATE OR REPLACE FUNCTION promote_waitlist(p_event_id UUID, p_registration_id UUID DEFAULT NULL)
+RETURNS SETOF registrations AS $$
+DECLARE
+  promoted registrations;
+BEGIN
+  PERFORM 1 FROM events WHERE id = p_event_id FOR UPDATE;
+
+  UPDATE registrations
+  SET status = 'confirmed'
+  WHERE id = (
+    SELECT id FROM registrations
+    WHERE event_id = p_event_id AND status = 'waitlisted'
+      AND (p_registration_id IS NULL OR id = p_registration_id)
+    ORDER BY waitlist_position
+    LIMIT 1
+  )
+  RETURNING * INTO promoted;
+
+  PERFORM compact_waitlist(p_event_id);
+
+  IF promoted.id IS NOT NULL THEN
+    RETURN NEXT promoted;
+  END IF;
+END;
+$$ LANGUAGE plpgsql SECURITY DEFINER;
+
+-- =====================================================
+-- Seat holds
+-- =====================================================
+
+-- A registration can take several seats (one ticket each)
+ALTER TABLE registrations ADD COLUMN IF NOT EXISTS quantity INTEGER NOT NULL DEFAULT 1 CHECK (quantity > 0);
+
+-- Seats reserved while a buyer completes checkout. Active, unexpired holds
+-- count against event and tier capacity until confirmed, released or expired.
+CREATE TABLE IF NOT EXISTS seat_holds (
+  id UUID DEFAULT uuid_generate_v4() PRIMARY KEY,
+  event_id UUID REFERENCES events(id) ON DELETE CASCADE,
+  user_id UUID REFERENCES auth.users(id) ON DELETE CASCADE,
+  tier_id UUID REFERENCES ticket_tiers(id),
+  quantity INTEGER NOT NULL CHECK (quantity > 0),
+  status TEXT DEFAULT 'active' CHECK (status IN ('active', 'confirmed', 'released', 'expired')),
+  expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  registration_id UUID REFERENCES registrations(id) ON DELETE SET NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+ALTER TABLE seat_holds ENABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS "Users can view own seat holds" ON seat_holds;
+CREATE POLICY "Users can view own seat holds" ON seat_holds
+  FOR SELECT USING (auth.uid() = user_id);
+
+CREATE INDEX IF NOT EXISTS idx_seat_holds_active ON seat_holds(event_id, expires_at) WHERE status = 'active';
+CREATE INDEX IF NOT EXISTS idx_seat_holds_user ON seat_holds(user_id);
+
+-- Seats taken for an event, or one of its tiers: confirmed registrations
+-- plus active holds, optionally leaving out the row being written
+CREATE OR REPLACE FUNCTION seats_taken(
+  p_event_id UUID,
+  p_tier_id UUID DEFAULT NULL,
+  p_exclude_registration UUID DEFAULT NULL,
+  p_exclude_hold UUID DEFAULT NULL
+)
+RETURNS INTEGER AS $$
+  SELECT (
+    COALESCE((
+      SELECT SUM(quantity) FROM registrations
+      WHERE event_id = p_event_id AND status = 'confirmed'
+        AND (p_tier_id IS NULL OR tier_id = p_tier_id)
+        AND id IS DISTINCT FROM p_exclude_registration
+    ), 0) +
+    COALESCE((
+      SELECT SUM(quantity) FROM seat_holds
+      WHERE event_id = p_event_id AND status = 'active' AND expires_at > NOW()
+        AND (p_tier_id IS NULL OR tier_id = p_tier_id)
+        AND id IS DISTINCT FROM p_exclude_hold
+    ), 0)
+  )::INTEGER;
+$$ LANGUAGE sql STABLE SECURITY DEFINER;
+
+-- The capacity guards now count seats rather than rows, including held seats
+CREATE OR REPLACE FUNCTION enforce_event_capacity()
+RETURNS TRIGGER AS $$
+DECLARE
+  event_capacity INTEGER;
+BEGIN
+  IF NEW.status <> 'confirmed' THEN
+    RETURN NEW;
+  END IF;
+
+  SELECT capacity INTO event_capacity FROM events WHERE id = NEW.event_id FOR UPDATE;
+  IF event_capacity IS NULL THEN
+    RETURN NEW;
+  END IF;
+
+  IF seats_taken(NEW.event_id, NULL, NEW.id, NULL) + NEW.quantity > event_capacity THEN
+    RAISE EXCEPTION 'event_full';
+  END IF;
+
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql SECURITY DEFINER;
+
+CREATE OR REPLACE FUNCTION enforce_tier_capacity()
+RETURNS TRIGGER AS $$
+DECLARE
+  tier_capacity INTEGER;
+BEGIN
+  IF NEW.status <> 'confirmed' OR NEW.tier_id IS NULL THEN
+    RETURN NEW;
+  END IF;
+
+  SELECT capacity INTO tier_capacity FROM ticket_tiers WHERE id = NEW.tier_id FOR UPDATE;
+  IF tier_capacity IS NULL THEN
+    RETURN NEW;
+  END IF;
+
+  IF seats_taken(NEW.event_id, NEW.tier_id, NEW.id, NULL) + NEW.quantity > tier_capacity THEN
+    RAISE EXCEPTION 'tier_sold_out';
+  END IF;
+
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql SECURITY DEFINER;
+
+DROP TRIGGER IF EXISTS registrations_capacity_guard ON registrations;
+CREATE TRIGGER registrations_capacity_guard
+  BEFORE INSERT OR UPDATE OF status, quantity ON registrations
+  FOR EACH ROW EXECUTE FUNCTION enforce_event_capacity();
+
+DROP TRIGGER IF EXISTS registrations_tier_capacity_guard ON registrations;
+CREATE TRIGGER registrations_tier_capacity_guard
+  BEFORE INSERT OR UPDATE OF status, quantity ON registrations
+  FOR EACH ROW EXECUTE FUNCTION enforce_tier_capacity();
+
+-- New holds are checked against the same capacity as registrations
+CREATE OR REPLACE FUNCTION enforce_hold_capacity()
+RETURNS TRIGGER AS $$
+DECLARE
+  event_capacity INTEGER;
+  tier_capacity INTEGER;
+BEGIN
+  IF NEW.status <> 'active' THEN
+    RETURN NEW;
+  END IF;
+
+  SELECT capacity INTO event_capacity FROM events WHERE id = NEW.event_id FOR UPDATE;
+  IF event_capacity IS NOT NULL
+     AND seats_taken(NEW.event_id, NULL, NULL, NEW.id) + NEW.quantity > event_capacity THEN
+    RAISE EXCEPTION 'event_full';
+  END IF;
+
+  IF NEW.tier_id IS NOT NULL THEN
+    SELECT capacity INTO tier_capacity FROM ticket_tiers WHERE id = NEW.tier_id FOR UPDATE;
+    IF tier_capacity IS NOT NULL
+       AND seats_taken(NEW.event_id, NEW.tier_id, NULL, NEW.id) + NEW.quantity > tier_capacity THEN
+      RAISE EXCEPTION 'tier_sold_out';
+    END IF;
+  END IF;
+
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql SECURITY DEFINER;
+
+DROP TRIGGER IF EXISTS seat_holds_capacity_guard ON seat_holds;
+CREATE TRIGGER seat_holds_capacity_guard
+  BEFORE INSERT ON seat_holds
+  FOR EACH ROW EXECUTE FUNCTION enforce_hold_capacity();
+
+-- Confirm a hold into a registration in one transaction. The hold stops
+-- counting at the same moment the registration starts to, so the seats
+-- are neither double counted nor briefly released.
+CREATE OR REPLACE FUNCTION confirm_seat_hold(p_hold_id UUID, p_notes TEXT DEFAULT NULL)
+RETURNS SETOF registrations AS $$
+DECLARE
+  hold seat_holds;
+  confirmed registrations;
+BEGIN
+  PERFORM 1 FROM events WHERE id = (SELECT event_id FROM seat_holds WHERE id = p_hold_id) FOR UPDATE;
+
+  SELECT * INTO hold FROM seat_holds WHERE id = p_hold_id FOR UPDATE;
+  IF hold.id IS NULL OR hold.status <> 'active' OR hold.expires_at <= NOW() THEN
+    RAISE EXCEPTION 'hold_expired';
+  END IF;
+
+  UPDATE seat_holds SET status = 'confirmed' WHERE id = hold.id;
+
+  INSERT INTO registrations (event_id, user_id, tier_id, quantity, notes, status)
+  VALUES (hold.event_id, hold.user_id, hold.tier_id, hold.quantity, p_notes, 'confirmed')
+  RETURNING * INTO confirmed;
+
+  UPDATE seat_holds SET registration_id = confirmed.id WHERE id = hold.id;
+
+  RETURN NEXT confirmed;
+END;
+$$ LANGUAGE plpgsql SECURITY DEFINER;
+
+-- =====================================================
+-- Group bookings
+-- =====================================================
+
+-- One registration books quantity seats; attendees optionally names the
+-- person for each seat and is copied onto the matching ticket
+ALTER TABLE registrations ADD COLUMN IF NOT EXISTS attendees JSONB NOT NULL DEFAULT '[]'::jsonb;
+ALTER TABLE tickets ADD COLUMN IF NOT EXISTS attendee_name TEXT;
+ALTER TABLE tickets ADD COLUMN IF NOT EXISTS attendee_email TEXT;
+
+-- Confirming a hold can now name its attendees
+DROP FUNCTION IF EXISTS confirm_seat_hold(UUID, TEXT);
+
+CREATE OR REPLACE FUNCTION confirm_seat_hold(p_hold_id UUID, p_notes TEXT DEFAULT NULL, p_attendees JSONB DEFAULT '[]'::jsonb)
+RETURNS SETOF registrations AS $$
+DECLARE
+  hold seat_holds;
+  confirmed registrations;
+BEGIN
+  PERFORM 1 FROM events WHERE id = (SELECT event_id FROM seat_holds WHERE id = p_hold_id) FOR UPDATE;
+
+  SELECT * INTO hold FROM seat_holds WHERE id = p_hold_id FOR UPDATE;
+  IF hold.id IS NULL OR hold.status <> 'active' OR hold.expires_at <= NOW() THEN
+    RAISE EXCEPTION 'hold_expired';
+  END IF;
+
+  UPDATE seat_holds SET status = 'confirmed' WHERE id = hold.id;
+
+  INSERT INTO registrations (event_id, user_id, tier_id, quantity, attendees, notes, status)
+  VALUES (hold.event_id, hold.user_id, hold.tier_id, hold.quantity, COALESCE(p_attendees, '[]'::jsonb), p_notes, 'confirmed')
+  RETURNING * INTO confirmed;
+
+  UPDATE seat_holds SET registration_id = confirmed.id WHERE id = hold.id;
+
+  RETURN NEXT confirmed;
+END;
+$$ LANGUAGE plpgsql SECURITY DEFINER;
+
+-- =====================================================
+-- Payments
+-- =====================================================
+
+-- Booking details given with a paid order, applied when its hold is confirmed
+ALTER TABLE seat_holds ADD COLUMN IF NOT EXISTS notes TEXT;
+ALTER TABLE seat_holds ADD COLUMN IF NOT EXISTS attendees JSONB NOT NULL DEFAULT '[]'::jsonb;
+
+-- One row per payment intent created with the payment provider
+CREATE TABLE IF NOT EXISTS payments (
+  id UUID DEFAULT uuid_generate_v4() PRIMARY KEY,
+  provider TEXT NOT NULL,
+  intent_id TEXT NOT NULL UNIQUE,
+  user_id UUID REFERENCES auth.users(id) ON DELETE CASCADE,
+  event_id UUID REFERENCES events(id) ON DELETE CASCADE,
+  hold_id UUID REFERENCES seat_holds(id) ON DELETE SET NULL,
+  registration_id UUID REFERENCES registrations(id) ON DELETE SET NULL,
+  amount DECIMAL(10,2) NOT NULL CHECK (amount > 0),
+  currency TEXT NOT NULL DEFAULT 'INR',
+  status TEXT DEFAULT 'pending'
+    CHECK (status IN ('pending', 'authorized', 'captured', 'failed', 'cancelled', 'refunded', 'partially_refunded')),
+  failure_reason TEXT,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+ALTER TABLE payments ENABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS "Users can view own payments" ON payments;
+CREATE POLICY "Users can view own payments" ON payments
+  FOR SELECT USING (auth.uid() = user_id);
+
+CREATE INDEX IF NOT EXISTS idx_payments_hold ON payments(hold_id);
+CREATE INDEX IF NOT EXISTS idx_payments_registration ON payments(registration_id);
+
+-- Confirming a hold falls back to the notes and attendees stored with it
+DROP FUNCTION IF EXISTS confirm_seat_hold(UUID, TEXT, JSONB);
+
+CREATE OR REPLACE FUNCTION confirm_seat_hold(p_hold_id UUID, p_notes TEXT DEFAULT NULL, p_attendees JSONB DEFAULT '[]'::jsonb)
+RETURNS SETOF registrations AS $$
+DECLARE
+  hold seat_holds;
+  confirmed registrations;
+BEGIN
+  PERFORM 1 FROM events WHERE id = (SELECT event_id FROM seat_holds WHERE id = p_hold_id) FOR UPDATE;
+
+  SELECT * INTO hold FROM seat_holds WHERE id = p_hold_id FOR UPDATE;
+  IF hold.id IS NULL OR hold.status <> 'active' OR hold.expires_at <= NOW() THEN
+    RAISE EXCEPTION 'hold_expired';
+  END IF;
+
+  UPDATE seat_holds SET status = 'confirmed' WHERE id = hold.id;
+
+  INSERT INTO registrations (event_id, user_id, tier_id, quantity, attendees, notes, status)
+  VALUES (
+    hold.event_id, hold.user_id, hold.tier_id, hold.quantity,
+    CASE WHEN jsonb_array_length(COALESCE(p_attendees, '[]'::jsonb)) > 0 THEN p_attendees ELSE hold.attendees END,
+    COALESCE(NULLIF(p_notes, ''), hold.notes),
+    'confirmed'
+  )
+  RETURNING * INTO confirmed;
+
+  UPDATE seat_holds SET registration_id = confirmed.id WHERE id = hold.id;
+
+  RETURN NEXT confirmed;
+END;
+$$ LANGUAGE plpgsql SECURITY DEFINER;
+
+-- =====================================================
+-- Refund policies
+-- =====================================================
+
+-- How much a cancellation refunds, e.g.
+-- {"full_refund_days": 14, "partial_refund_days": 3, "partial_refund_percent": 50}
+ALTER TABLE events ADD COLUMN IF NOT EXISTS refund_policy JSONB;
+
+-- What each ticket got back when its registration was cancelled
+ALTER TABLE tickets ADD COLUMN IF NOT EXISTS refund_amount DECIMAL(10,2);
+ALTER TABLE tickets ADD COLUMN IF NOT EXISTS refunded_at TIMESTAMP WITH TIME ZONE;
+
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS amount_refunded DECIMAL(10,2) NOT NULL DEFAULT 0;
+
+-- =====================================================
+-- Promo codes
+-- =====================================================
+
+CREATE TABLE IF NOT EXISTS promo_codes (
+  id UUID DEFAULT uuid_generate_v4() PRIMARY KEY,
+  event_id UUID REFERENCES events(id) ON DELETE CASCADE,
+  code TEXT NOT NULL,
+  discount_type TEXT NOT NULL CHECK (discount_type IN ('percent', 'fixed')),
+  discount_value DECIMAL(10,2) NOT NULL CHECK (discount_value > 0),
+  max_redemptions INTEGER CHECK (max_redemptions IS NULL OR max_redemptions > 0),
+  per_user_limit INTEGER NOT NULL DEFAULT 0 CHECK (per_user_limit >= 0),
+  valid_from TIMESTAMP WITH TIME ZONE,
+  valid_until TIMESTAMP WITH TIME ZONE,
+  tier_ids UUID[] NOT NULL DEFAULT '{}',
+  active BOOLEAN NOT NULL DEFAULT TRUE,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+  UNIQUE(event_id, code)
+);
+
+-- Codes are looked up by the server only; buyers never list them
+ALTER TABLE promo_codes ENABLE ROW LEVEL SECURITY;
+
+ALTER TABLE registrations ADD COLUMN IF NOT EXISTS promo_code_id UUID REFERENCES promo_codes(id) ON DELETE SET NULL;
+ALTER TABLE registrations ADD COLUMN IF NOT EXISTS discount DECIMAL(10,2) NOT NULL DEFAULT 0;
+ALTER TABLE seat_holds ADD COLUMN IF NOT EXISTS promo_code_id UUID REFERENCES promo_codes(id) ON DELETE SET NULL;
+ALTER TABLE seat_holds ADD COLUMN IF NOT EXISTS discount DECIMAL(10,2) NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_registrations_promo ON registrations(promo_code_id);
+CREATE INDEX IF NOT EXISTS idx_seat_holds_promo ON seat_holds(promo_code_id);
+
+-- Reject registrations and holds beyond a code's limits. Live redemptions are
+-- confirmed or waitlisted registrations plus active holds, and a buyer's
+-- own redemptions leave out cancelled registrations too. Locking the code
+-- row serializes concurrent redemptions of the same code.
+CREATE OR REPLACE FUNCTION enforce_promo_redemptions()
+RETURNS TRIGGER AS $$
+DECLARE
+  promo promo_codes;
+  used INTEGER;
+  used_by_user INTEGER;
+BEGIN
+  IF NEW.promo_code_id IS NULL THEN
+    RETURN NEW;
+  END IF;
+
+  SELECT * INTO promo FROM promo_codes WHERE id = NEW.promo_code_id FOR UPDATE;
+
+  IF promo.max_redemptions IS NOT NULL THEN
+    SELECT
+      (SELECT COUNT(*) FROM registrations
+        WHERE promo_code_id = promo.id AND status IN ('confirmed', 'waitlisted')) +
+      (SELECT COUNT(*) FROM seat_holds
+        WHERE promo_code_id = promo.id AND status = 'active' AND expires_at > NOW())
+    INTO used;
+
+    IF used >= promo.max_redemptions THEN
+      RAISE EXCEPTION 'promo_exhausted';
+    END IF;
+  END IF;
+
+  IF promo.per_user_limit > 0 THEN
+    SELECT
+      (SELECT COUNT(*) FROM registrations
+        WHERE promo_code_id = promo.id AND user_id = NEW.user_id AND status <> 'cancelled') +
+      (SELECT COUNT(*) FROM seat_holds
+        WHERE promo_code_id = promo.id AND user_id = NEW.user_id AND status = 'active' AND expires_at > NOW())
+    INTO used_by_user;
+
+    IF used_by_user >= promo.per_user_limit THEN
+      RAISE EXCEPTION 'promo_user_limit';
+    END IF;
+  END IF;
+
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS enforce_promo_redemptions ON registrations;
+CREATE TRIGGER enforce_promo_redemptions
+  BEFORE INSERT ON registrations
+  FOR EACH ROW EXECUTE FUNCTION enforce_promo_redemptions();
+
+DROP TRIGGER IF EXISTS enforce_promo_redemptions ON seat_holds;
+CREATE TRIGGER enforce_promo_redemptions
+  BEFORE INSERT ON seat_holds
+  FOR EACH ROW EXECUTE FUNCTION enforce_promo_redemptions();
+
+-- Confirming a hold carries its promo code and discount to the registration.
+-- The hold stops counting before the registration is inserted, so the
+-- confirmation does not use up a second redemption.
+CREATE OR REPLACE FUNCTION confirm_seat_hold(p_hold_id UUID, p_notes TEXT DEFAULT NULL, p_attendees JSONB DEFAULT '[]'::jsonb)
+RETURNS SETOF registrations AS $$
+DECLARE
+  hold seat_holds;
+  confirmed registrations;
+BEGIN
+  PERFORM 1 FROM events WHERE id = (SELECT event_id FROM seat_holds WHERE id = p_hold_id) FOR UPDATE;
+
+  SELECT * INTO hold FROM seat_holds WHERE id = p_hold_id FOR UPDATE;
+  IF hold.id IS NULL OR hold.status <> 'active' OR hold.expires_at <= NOW() THEN
+    RAISE EXCEPTION 'hold_expired';
+  END IF;
+
+  UPDATE seat_holds SET status = 'confirmed' WHERE id = hold.id;
+
+  INSERT INTO registrations (event_id, user_id, tier_id, quantity, attendees, notes, promo_code_id, discount, status)
+  VALUES (
+    hold.event_id, hold.user_id, hold.tier_id, hold.quantity,
+    CASE WHEN jsonb_array_length(COALESCE(p_attendees, '[]'::jsonb)) > 0 THEN p_attendees ELSE hold.attendees END,
+    COALESCE(NULLIF(p_notes, ''), hold.notes),
+    hold.promo_code_id, hold.discount,
+    'confirmed'
+  )
+  RETURNING * INTO confirmed;
+
+  UPDATE seat_holds SET registration_id = confirmed.id WHERE id = hold.id;
+
+  RETURN NEXT confirmed;
+END;
+$$ LANGUAGE plpgsql SECURITY DEFINER;
+
+-- =====================================================
+-- GST invoices
+-- =====================================================
+
+-- GST registration each organizer invoices under
+CREATE TABLE IF NOT EXISTS organizer_tax_profiles (
+  organizer_id UUID PRIMARY KEY REFERENCES auth.users(id) ON DELETE CASCADE,
+  legal_name TEXT NOT NULL,
+  gstin TEXT,
+  state_code TEXT NOT NULL,
+  address TEXT NOT NULL DEFAULT '',
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+ALTER TABLE organizer_tax_profiles ENABLE ROW LEVEL SECURITY;
+
+-- Buyer's invoicing details given with a paid order
+ALTER TABLE seat_holds ADD COLUMN IF NOT EXISTS billing JSONB;
+
+-- Last invoice number used per organizer and financial year
+CREATE TABLE IF NOT EXISTS invoice_sequences (
+  organizer_id UUID REFERENCES auth.users(id) ON DELETE CASCADE,
+  financial_year TEXT NOT NULL,
+  last_sequence INTEGER NOT NULL DEFAULT 0,
+  PRIMARY KEY (organizer_id, financial_year)
+);
+
+ALTER TABLE invoice_sequences ENABLE ROW LEVEL SECURITY;
+
+CREATE TABLE IF NOT EXISTS invoices (
+  id UUID DEFAULT uuid_generate_v4() PRIMARY KEY,
+  invoice_number TEXT NOT NULL,
+  sequence INTEGER NOT NULL,
+  financial_year TEXT NOT NULL,
+  organizer_id UUID REFERENCES auth.users(id) ON DELETE RESTRICT,
+  event_id UUID REFERENCES events(id) ON DELETE SET NULL,
+  registration_id UUID UNIQUE REFERENCES registrations(id) ON DELETE SET NULL,
+  payment_id UUID REFERENCES payments(id) ON DELETE SET NULL,
+  user_id UUID REFERENCES auth.users(id) ON DELETE SET NULL,
+  seller JSONB NOT NULL,
+  buyer JSONB NOT NULL,
+  place_of_supply TEXT,
+  lines JSONB NOT NULL DEFAULT '[]'::jsonb,
+  gst_rate DECIMAL(5,2) NOT NULL,
+  taxable_value DECIMAL(10,2) NOT NULL,
+  cgst DECIMAL(10,2) NOT NULL DEFAULT 0,
+  sgst DECIMAL(10,2) NOT NULL DEFAULT 0,
+  igst DECIMAL(10,2) NOT NULL DEFAULT 0,
+  total DECIMAL(10,2) NOT NULL,
+  currency TEXT NOT NULL DEFAULT 'INR',
+  issued_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+  UNIQUE(organizer_id, financial_year, sequence)
+);
+
+-- Organizers without a GSTIN issue bills of supply instead of tax invoices
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS document_type TEXT NOT NULL DEFAULT 'tax_invoice'
+  CHECK (document_type IN ('tax_invoice', 'bill_of_supply'));
+
+ALTER TABLE invoices ENABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS "Buyers and organizers can view invoices" ON invoices;
+CREATE POLICY "Buyers and organizers can view invoices" ON invoices
+  FOR SELECT USING (auth.uid() = user_id OR auth.uid() = organizer_id);
+
+CREATE INDEX IF NOT EXISTS idx_invoices_user ON invoices(user_id);
+CREATE INDEX IF NOT EXISTS idx_invoices_event ON invoices(event_id);
+
+-- Number and store an invoice in one transaction. The counter row stays
+-- locked until the invoice is committed, so concurrent orders for the same
+-- organizer are numbered one after another and a failed insert rolls the
+-- counter back, leaving no gaps. An order that already has an invoice
+-- returns it instead.
+CREATE OR REPLACE FUNCTION create_invoice(p_invoice JSONB)
+RETURNS SETOF invoices AS $$
+DECLARE
+  next_sequence INTEGER;
+  created invoices;
+BEGIN
+  INSERT INTO invoice_sequences (organizer_id, financial_year, last_sequence)
+  VALUES ((p_invoice->>'organizer_id')::uuid, p_invoice->>'financial_year', 0)
+  ON CONFLICT (organizer_id, financial_year) DO NOTHING;
+
+  SELECT last_sequence + 1 INTO next_sequence FROM invoice_sequences
+  WHERE organizer_id = (p_invoice->>'organizer_id')::uuid
+    AND financial_year = p_invoice->>'financial_year'
+  FOR UPDATE;
+
+  SELECT * INTO created FROM invoices WHERE registration_id = (p_invoice->>'registration_id')::uuid;
+  IF created.id IS NOT NULL THEN
+    RETURN NEXT created;
+    RETURN;
+  END IF;
+
+  UPDATE invoice_sequences SET last_sequence = next_sequence
+  WHERE organizer_id = (p_invoice->>'organizer_id')::uuid
+    AND financial_year = p_invoice->>'financial_year';
+
+  INSERT INTO invoices (
+    document_type, invoice_number, sequence, financial_year, organizer_id, event_id, registration_id,
+    payment_id, user_id, seller, buyer, place_of_supply, lines, gst_rate,
+    taxable_value, cgst, sgst, igst, total, currency, issued_at
+  )
+  VALUES (
+    COALESCE(p_invoice->>'document_type', 'tax_invoice'),
+    (p_invoice->>'financial_year') || '/' || lpad(next_sequence::text, 6, '0'),
+    next_sequence,
+    p_invoice->>'financial_year',
+    (p_invoice->>'organizer_id')::uuid,
+    (p_invoice->>'event_id')::uuid,
+    (p_invoice->>'registration_id')::uuid,
+    NULLIF(p_invoice->>'payment_id', '')::uuid,
+    (p_invoice->>'user_id')::uuid,
+    p_invoice->'seller',
+    p_invoice->'buyer',
+    p_invoice->>'place_of_supply',
+    p_invoice->'lines',
+    (p_invoice->>'gst_rate')::decimal,
+    (p_invoice->>'taxable_value')::decimal,
+    (p_invoice->>'cgst')::decimal,
+    (p_invoice->>'sgst')::decimal,
+    (p_invoice->>'igst')::decimal,
+    (p_invoice->>'total')::decimal,
+    p_invoice->>'currency',
+    (p_invoice->>'issued_at')::timestamptz
+  )
+  RETURNING * INTO created;
+
+  RETURN NEXT created;
+END;
+$$ LANGUAGE plpgsql SECURITY DEFINER;
+
+-- =====================================================
+-- Organizer ledger
+-- =====================================================
+
+-- One row per posted transaction; the reference (sale:<payment>,
+-- refund:<provider refund>, payout:<payout>) keeps it from being posted twice
+CREATE TABLE IF NOT EXISTS ledger_transactions (
+  id UUID DEFAULT uuid_generate_v4() PRIMARY KEY,
+  reference_id TEXT NOT NULL UNIQUE,
+  organizer_id UUID REFERENCES auth.users(id) ON DELETE RESTRICT,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Double-entry lines: every transaction's debits equal its credits.
+-- Accounts are cash, organizer_payable and platform_revenue.
+CREATE TABLE IF NOT EXISTS ledger_entries (
+  id UUID DEFAULT uuid_generate_v4() PRIMARY KEY,
+  transaction_id UUID NOT NULL REFERENCES ledger_transactions(id) ON DELETE RESTRICT,
+  reference_id TEXT NOT NULL,
+  organizer_id UUID REFERENCES auth.users(id) ON DELETE RESTRICT,
+  event_id UUID REFERENCES events(id) ON DELETE SET NULL,
+  account TEXT NOT NULL CHECK (account IN ('cash', 'organizer_payable', 'platform_revenue')),
+  kind TEXT NOT NULL CHECK (kind IN ('sale', 'platform_fee', 'refund', 'payout')),
+  debit DECIMAL(12,2) NOT NULL DEFAULT 0 CHECK (debit >= 0),
+  credit DECIMAL(12,2) NOT NULL DEFAULT 0 CHECK (credit >= 0),
+  description TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+ALTER TABLE ledger_transactions ENABLE ROW LEVEL SECURITY;
+ALTER TABLE ledger_entries ENABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS "Organizers can view own ledger" ON ledger_entries;
+CREATE POLICY "Organizers can view own ledger" ON ledger_entries
+  FOR SELECT USING (auth.uid() = organizer_id);
+
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_organizer ON ledger_entries(organizer_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_event ON ledger_entries(event_id);
+
+CREATE TABLE IF NOT EXISTS payouts (
+  id UUID DEFAULT uuid_generate_v4() PRIMARY KEY,
+  organizer_id UUID REFERENCES auth.users(id) ON DELETE RESTRICT,
+  amount DECIMAL(12,2) NOT NULL CHECK (amount > 0),
+  currency TEXT NOT NULL DEFAULT 'INR',
+  status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'paid', 'failed')),
+  settled_up_to TIMESTAMP WITH TIME ZONE NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+ALTER TABLE payouts ENABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS "Organizers can view own payouts" ON payouts;
+CREATE POLICY "Organizers can view own payouts" ON payouts
+  FOR SELECT USING (auth.uid() = organizer_id);
+
+-- Post a balanced transaction. Returns false if the reference was already posted.
+CREATE OR REPLACE FUNCTION post_ledger_transaction(p_reference_id TEXT, p_organizer_id UUID, p_entries JSONB)
+RETURNS BOOLEAN AS $$
+DECLARE
+  tx_id UUID;
+BEGIN
+  IF (SELECT SUM((e->>'debit')::decimal) - SUM((e->>'credit')::decimal) FROM jsonb_array_elements(p_entries) e) <> 0 THEN
+    RAISE EXCEPTION 'ledger transaction is not balanced';
+  END IF;
+
+  INSERT INTO ledger_transactions (reference_id, organizer_id)
+  VALUES (p_reference_id, p_organizer_id)
+  ON CONFLICT (reference_id) DO NOTHING
+  RETURNING id INTO tx_id;
+
+  IF tx_id IS NULL THEN
+    RETURN FALSE;
+  END IF;
+
+  INSERT INTO ledger_entries (transaction_id, reference_id, organizer_id, event_id, account, kind, debit, credit, description)
+  SELECT tx_id, p_reference_id, p_organizer_id, NULLIF(e->>'event_id', '')::uuid,
+         e->>'account', e->>'kind', (e->>'debit')::decimal, (e->>'credit')::decimal, COALESCE(e->>'description', '')
+  FROM jsonb_array_elements(p_entries) e;
+
+  RETURN TRUE;
+END;
+$$ LANGUAGE plpgsql SECURITY DEFINER;
+
+-- Transactions whose posting failed after the money moved, retried before
+-- each settlement
+CREATE TABLE IF NOT EXISTS ledger_queue (
+  reference_id TEXT PRIMARY KEY,
+  organizer_id UUID REFERENCES auth.users(id) ON DELETE RESTRICT,
+  event_id UUID REFERENCES events(id) ON DELETE SET NULL,
+  entries JSONB NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+ALTER TABLE ledger_queue ENABLE ROW LEVEL SECURITY;
+
+-- Queue a transaction for retry. Queueing a reference twice keeps the first.
+CREATE OR REPLACE FUNCTION queue_ledger_transaction(p_reference_id TEXT, p_organizer_id UUID, p_event_id UUID, p_entries JSONB)
+RETURNS VOID AS $$
+BEGIN
+  INSERT INTO ledger_queue (reference_id, organizer_id, event_id, entries)
+  VALUES (p_reference_id, p_organizer_id, p_event_id, p_entries)
+  ON CONFLICT (reference_id) DO NOTHING;
+END;
+$$ LANGUAGE plpgsql SECURITY DEFINER;
+
+-- What the platform owes an organizer. Entries up to p_cutoff, less every
+-- payout so far, are available to settle.
+CREATE OR REPLACE FUNCTION organizer_ledger_balance(p_organizer_id UUID, p_cutoff TIMESTAMP WITH TIME ZONE)
+RETURNS TABLE (
+  organizer_id UUID, sales DECIMAL, platform_fees DECIMAL, refunds DECIMAL,
+  paid_out DECIMAL, balance DECIMAL, available DECIMAL, pending DECIMAL
+) AS $$
+  WITH totals AS (
+    SELECT
+      COALESCE(SUM(credit - debit) FILTER (WHERE kind = 'sale'), 0) AS sales,
+      COALESCE(SUM(debit - credit) FILTER (WHERE kind = 'platform_fee'), 0) AS platform_fees,
+      COALESCE(SUM(debit - credit) FILTER (WHERE kind = 'refund'), 0) AS refunds,
+      COALESCE(SUM(debit - credit) FILTER (WHERE kind = 'payout'), 0) AS paid_out,
+      COALESCE(SUM(credit - debit), 0) AS balance,
+      COALESCE(SUM(credit - debit) FILTER (WHERE kind <> 'payout' AND created_at <= p_cutoff), 0) AS settled
+    FROM ledger_entries
+    WHERE ledger_entries.organizer_id = p_organizer_id AND account = 'organizer_payable'
+  ), figures AS (
+    SELECT *, GREATEST(LEAST(settled - paid_out, balance), 0) AS available FROM totals
+  )
+  SELECT p_organizer_id, sales, platform_fees, refunds, paid_out, balance, available, balance - available
+  FROM figures;
+$$ LANGUAGE sql STABLE SECURITY DEFINER;
+
+-- Create a payout for every organizer whose available balance reaches
+-- p_minimum and post it to the ledger. The advisory lock keeps two
+-- settlement runs from paying the same balance twice.
+CREATE OR REPLACE FUNCTION settle_organizer_balances(p_cutoff TIMESTAMP WITH TIME ZONE, p_minimum DECIMAL)
+RETURNS SETOF payouts AS $$
+DECLARE
+  organizer UUID;
+  owed DECIMAL;
+  payout payouts;
+  tx_id UUID;
+BEGIN
+  PERFORM pg_advisory_xact_lock(hashtext('settle_organizer_balances'));
+
+  FOR organizer IN SELECT DISTINCT organizer_id FROM ledger_entries WHERE organizer_id IS NOT NULL LOOP
+    SELECT available INTO owed FROM organizer_ledger_balance(organizer, p_cutoff);
+    IF owed <= 0 OR owed < p_minimum THEN
+      CONTINUE;
+    END IF;
+
+    INSERT INTO payouts (organizer_id, amount, settled_up_to)
+    VALUES (organizer, owed, p_cutoff)
+    RETURNING * INTO payout;
+
+    INSERT INTO ledger_transactions (reference_id, organizer_id)
+    VALUES ('payout:' || payout.id, organizer)
+    RETURNING id INTO tx_id;
+
+    INSERT INTO ledger_entries (transaction_id, reference_id, organizer_id, account, kind, debit, credit, description)
+    VALUES
+      (tx_id, 'payout:' || payout.id, organizer, 'organizer_payable', 'payout', owed, 0, 'Payout ' || payout.id),
+      (tx_id, 'payout:' || payout.id, organizer, 'cash', 'payout', 0, owed, 'Payout ' || payout.id);
+
+    RETURN NEXT payout;
+  END LOOP;
+END;
+$$ LANGUAGE plpgsql SECURITY DEFINER;
+
+-- =====================================================
+-- Roles
+-- =====================================================
+
+-- Admins manage events and account roles
+ALTER TABLE profiles DROP CONSTRAINT IF EXISTS profiles_account_type_check;
+ALTER TABLE profiles ADD CONSTRAINT profiles_account_type_check
+  CHECK (account_type IN ('attendee', 'organizer', 'vendor', 'admin'));
+
+-- Users may create and edit their own profile, but only the API (service
+-- role) or the SQL editor may give it a role other than attendee
+CREATE OR REPLACE FUNCTION protect_account_type()
+RETURNS TRIGGER AS $$
+BEGIN
+  IF COALESCE(auth.role(), '') <> 'authenticated' THEN
+    RETURN NEW;
+  END IF;
+
+  IF TG_OP = 'INSERT' AND COALESCE(NEW.account_type, 'attendee') <> 'attendee' THEN
+    RAISE EXCEPTION 'account_type can only be changed by an admin';
+  END IF;
+  IF TG_OP = 'UPDATE' AND NEW.account_type IS DISTINCT FROM OLD.account_type THEN
+    RAISE EXCEPTION 'account_type can only be changed by an admin';
+  END IF;
+
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS protect_account_type ON profiles;
+CREATE TRIGGER protect_account_type
+  BEFORE INSERT OR UPDATE ON profiles
+  FOR EACH ROW EXECUTE FUNCTION protect_account_type();
+
+-- =====================================================
+-- Event teams
+-- =====================================================
+
+-- Users who help run an event. The organizer is its owner and has no row;
+-- everyone else is a co-organizer, check-in staff or a viewer.
+CREATE TABLE IF NOT EXISTS event_members (
+  event_id UUID REFERENCES events(id) ON DELETE CASCADE,
+  user_id UUID REFERENCES auth.users(id) ON DELETE CASCADE,
+  role TEXT NOT NULL CHECK (role IN ('co_organizer', 'checkin_staff', 'viewer')),
+  added_by UUID REFERENCES auth.users(id),
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+  PRIMARY KEY (event_id, user_id)
+);
+
+-- Managed by the API with the service role only
+ALTER TABLE event_members ENABLE ROW LEVEL SECURITY;
+
+CREATE INDEX IF NOT EXISTS idx_event_members_user ON event_members(user_id);
+
+-- Check-in staff are now members with the checkin_staff role
+INSERT INTO event_members (event_id, user_id, role, added_by, created_at)
+SELECT event_id, user_id, 'checkin_staff', added_by, created_at FROM event_staff
+ON CONFLICT (event_id, user_id) DO NOTHING;
+
+DROP TABLE IF EXISTS event_staff;
+
+-- =====================================================
+-- Organizer API keys
+-- =====================================================
+
+-- Keys organizers' own systems call the API with. Only a SHA-256 hash of
+-- each key is kept; the key itself is shown once when it is created.
+CREATE TABLE IF NOT EXISTS api_keys (
+  id UUID DEFAULT uuid_generate_v4() PRIMARY KEY,
+  organizer_id UUID REFERENCES auth.users(id) ON DELETE CASCADE NOT NULL,
+  name TEXT NOT NULL,
+  prefix TEXT NOT NULL,
+  key_hash TEXT NOT NULL UNIQUE,
+  scopes TEXT[] NOT NULL
+    CHECK (cardinality(scopes) > 0 AND scopes <@ ARRAY['events:write', 'registrations:read', 'checkin:write']),
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+  last_used_at TIMESTAMP WITH TIME ZONE,
+  revoked_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Managed by the API with the service role only
+ALTER TABLE api_keys ENABLE ROW LEVEL SECURITY;
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_organizer ON api_keys(organizer_id, created_at DESC);
+
+-- =====================================================
+-- Sessions and refresh tokens
+-- =====================================================
+
+-- One row per sign-in. Access tokens carry the session ID in their sid
+-- claim and stop working once the session is revoked or expires.
+CREATE TABLE IF NOT EXISTS sessions (
+  id UUID DEFAULT uuid_generate_v4() PRIMARY KEY,
+  user_id UUID REFERENCES auth.users(id) ON DELETE CASCADE NOT NULL,
+  device TEXT NOT NULL DEFAULT '',
+  user_agent TEXT NOT NULL DEFAULT '',
+  ip_address TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+  last_seen_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+  expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  revoked_at TIMESTAMP WITH TIME ZONE,
+  revoked_reason TEXT
+);
+
+-- SHA-256 hashes of every refresh token a session was given. Rotated
+-- tokens are kept so presenting one again can be recognised as reuse.
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+  token_hash TEXT PRIMARY KEY,
+  session_id UUID REFERENCES sessions(id) ON DELETE CASCADE NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+  rotated_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Managed by the API with the service role only
+ALTER TABLE sessions ENABLE ROW LEVEL SECURITY;
+ALTER TABLE refresh_tokens ENABLE ROW LEVEL SECURITY;
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id, last_seen_at DESC) WHERE revoked_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_session ON refresh_tokens(session_id);
+
+-- Swap a refresh token for a new one. Returns {"status": "rotated"} with
+-- the session, {"status": "reused"} after revoking the session when the
+-- token was already rotated, or {"status": "invalid"}.
+CREATE OR REPLACE FUNCTION rotate_refresh_token(
+  p_old_hash TEXT,
+  p_new_hash TEXT,
+  p_expires_at TIMESTAMP WITH TIME ZONE,
+  p_ip_address TEXT
+)
+RETURNS JSONB AS $$
+DECLARE
+  token refresh_tokens%ROWTYPE;
+  session sessions%ROWTYPE;
+BEGIN
+  SELECT * INTO token FROM refresh_tokens WHERE token_hash = p_old_hash FOR UPDATE;
+  IF NOT FOUND THEN
+    RETURN jsonb_build_object('status', 'invalid');
+  END IF;
+
+  SELECT * INTO session FROM sessions WHERE id = token.session_id FOR UPDATE;
+  IF NOT FOUND OR session.revoked_at IS NOT NULL OR session.expires_at <= NOW() THEN
+    RETURN jsonb_build_object('status', 'invalid');
+  END IF;
+
+  IF token.rotated_at IS NOT NULL THEN
+    UPDATE sessions SET revoked_at = NOW(), revoked_reason = 'refresh_token_reuse'
+    WHERE id = session.id
+    RETURNING * INTO session;
+    RETURN jsonb_build_object('status', 'reused', 'session', to_jsonb(session));
+  END IF;
+
+  UPDATE refresh_tokens SET rotated_at = NOW() WHERE token_hash = p_old_hash;
+  INSERT INTO refresh_tokens (token_hash, session_id) VALUES (p_new_hash, session.id);
+
+  UPDATE sessions SET expires_at = p_expires_at, last_seen_at = NOW(), ip_address = p_ip_address
+  WHERE id = session.id
+  RETURNING * INTO session;
+
+  RETURN jsonb_build_object('status', 'rotated', 'session', to_jsonb(session));
+END;
+$$ LANGUAGE plpgsql SECURITY DEFINER;
+
+-- =====================================================
+-- Two-factor authentication
+-- =====================================================
+
+-- TOTP secrets. The secret has to be readable to check codes, so the table
+-- is only reachable with the service role. Enrollment stays pending
+-- (enabled = false) until the first code is confirmed.
+CREATE TABLE IF NOT EXISTS user_two_factor (
+  user_id UUID PRIMARY KEY REFERENCES auth.users(id) ON DELETE CASCADE,
+  secret TEXT NOT NULL,
+  enabled BOOLEAN NOT NULL DEFAULT FALSE,
+  enabled_at TIMESTAMP WITH TIME ZONE,
+  last_used_step BIGINT,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- SHA-256 hashes of single-use recovery codes
+CREATE TABLE IF NOT EXISTS two_factor_recovery_codes (
+  user_id UUID REFERENCES auth.users(id) ON DELETE CASCADE NOT NULL,
+  code_hash TEXT NOT NULL,
+  used_at TIMESTAMP WITH TIME ZONE,
+  PRIMARY KEY (user_id, code_hash)
+);
+
+-- Platform-wide settings admins change through the API, such as
+-- require_organizer_2fa
+CREATE TABLE IF NOT EXISTS platform_settings (
+  key TEXT PRIMARY KEY,
+  value JSONB NOT NULL,
+  updated_by UUID REFERENCES auth.users(id) ON DELETE SET NULL,
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Managed by the API with the service role only
+ALTER TABLE user_two_factor ENABLE ROW LEVEL SECURITY;
+ALTER TABLE two_factor_recovery_codes ENABLE ROW LEVEL SECURITY;
+ALTER TABLE platform_settings ENABLE ROW LEVEL SECURITY;
+
+-- =====================================================
+-- Failed login tracking
+-- =====================================================
+
+-- Failed logins in a row per account (account:<email>) and per IP address
+-- (ip:<address>), with any lockout they caused
+CREATE TABLE IF NOT EXISTS login_throttles (
+  key TEXT PRIMARY KEY,
+  failures INTEGER NOT NULL DEFAULT 0,
+  last_failure_at TIMESTAMP WITH TIME ZONE,
+  locked_until TIMESTAMP WITH TIME ZONE
+);
+
+-- Managed by the API with the service role only
+ALTER TABLE login_throttles ENABLE ROW LEVEL SECURITY;
+
+DROP FUNCTION IF EXISTS record_login_failure(TEXT, INTEGER, INTEGER, INTEGER);
+
+-- Count a login attempt before its credentials are checked, so parallel
+-- guesses cannot all pass the limit. The row lock serializes attempts on a
+-- key: one made while the key is locked out, or backing off after failures,
+-- is refused and not counted. Otherwise the count starts over after
+-- p_window_seconds without an attempt, and reaching p_threshold locks the
+-- key; newly_locked tells the API to notify the owner if the attempt fails.
+CREATE OR REPLACE FUNCTION reserve_login_attempt(
+  p_key TEXT,
+  p_threshold INTEGER,
+  p_lockout_seconds INTEGER,
+  p_window_seconds INTEGER
+)
+RETURNS JSONB AS $$
+DECLARE
+  throttle login_throttles%ROWTYPE;
+  free_attempts INTEGER := GREATEST(p_threshold / 4, 1);
+  backoff INTERVAL;
+  newly_locked BOOLEAN := FALSE;
+  previous_failure_at TIMESTAMP WITH TIME ZONE;
+BEGIN
+  INSERT INTO login_throttles (key) VALUES (p_key) ON CONFLICT (key) DO NOTHING;
+  SELECT * INTO throttle FROM login_throttles WHERE key = p_key FOR UPDATE;
+
+  IF throttle.locked_until IS NOT NULL AND throttle.locked_until > NOW() THEN
+    RETURN jsonb_build_object('throttle', to_jsonb(throttle), 'allowed', FALSE, 'newly_locked', FALSE);
+  END IF;
+
+  IF throttle.last_failure_at IS NULL
+     OR throttle.last_failure_at < NOW() - make_interval(secs => p_window_seconds) THEN
+    throttle.failures := 0;
+  ELSIF throttle.failures > free_attempts THEN
+    -- Wait 1s, then twice as long after each further failure, up to a lockout
+    backoff := LEAST(
+      make_interval(secs => power(2, LEAST(throttle.failures - free_attempts - 1, 20))),
+      make_interval(secs => p_lockout_seconds)
+    );
+    IF throttle.last_failure_at + backoff > NOW() THEN
+      RETURN jsonb_build_object('throttle', to_jsonb(throttle), 'allowed', FALSE, 'newly_locked', FALSE);
+    END IF;
+  END IF;
+
+  previous_failure_at := throttle.last_failure_at;
+  throttle.failures := throttle.failures + 1;
+  IF throttle.failures >= p_threshold THEN
+    throttle.locked_until := NOW() + make_interval(secs => p_lockout_seconds);
+    newly_locked := TRUE;
+  END IF;
+
+  UPDATE login_throttles
+  SET failures = throttle.failures, last_failure_at = NOW(), locked_until = throttle.locked_until
+  WHERE key = p_key
+  RETURNING * INTO throttle;
+
+  RETURN jsonb_build_object('throttle', to_jsonb(throttle), 'allowed', TRUE, 'newly_locked', newly_locked,
+                            'previous_failure_at', previous_failure_at);
+END;
+$$ LANGUAGE plpgsql SECURITY DEFINER;
+
+DROP FUNCTION IF EXISTS release_login_attempt(TEXT, TIMESTAMP WITH TIME ZONE);
+
+-- Uncount an attempt reserved by reserve_login_attempt whose credentials
+-- were right, lifting the lockout it started (p_locked_until), if any, and
+-- putting back the failure time from before it (p_failed_at is the time it
+-- set) unless a later attempt has failed since
+CREATE OR REPLACE FUNCTION release_login_attempt(
+  p_key TEXT,
+  p_locked_until TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+  p_failed_at TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+  p_previous_failure_at TIMESTAMP WITH TIME ZONE DEFAULT NULL
+)
+RETURNS VOID AS $$
+BEGIN
+  UPDATE login_throttles
+  SET failures = GREATEST(failures - 1, 0),
+      locked_until = CASE WHEN locked_until = p_locked_until THEN NULL ELSE locked_until END,
+      last_failure_at = CASE WHEN last_failure_at = p_failed_at THEN p_previous_failure_at ELSE last_failure_at END
+  WHERE key = p_key;
+END;
+$$ LANGUAGE plpgsql SECURITY DEFINER;
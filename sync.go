@@ -0,0 +1,430 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSyncRecords bounds the size of a single check-in upload
+const maxSyncRecords = 1000
+
+// ManifestEntry is what a scanner needs to validate a ticket offline.
+// Hashes let the device match a scanned QR payload or a typed ticket
+// number without holding the raw values.
+type ManifestEntry struct {
+	TicketID     string `json:"ticket_id"`
+	PayloadHash  string `json:"payload_hash,omitempty"`
+	NumberHash   string `json:"number_hash"`
+	Status       string `json:"status"`
+	CheckedInAt  string `json:"checked_in_at,omitempty"`
+	Version      int64  `json:"version"`
+	HolderUserID string `json:"holder_user_id"`
+}
+
+// CheckinScan is a check-in recorded by a scanner, possibly while offline
+type CheckinScan struct {
+	StaffID   string
+	DeviceID  string
+	ScannedAt string
+}
+
+// SyncRecord is one offline scan uploaded by a device
+type SyncRecord struct {
+	TicketID  string `json:"ticket_id"`
+	ScannedAt string `json:"scanned_at"`
+}
+
+// SyncRequest is a batch of offline scans from one device
+type SyncRequest struct {
+	DeviceID string       `json:"device_id"`
+	Records  []SyncRecord `json:"records"`
+}
+
+// SyncResult reports how one uploaded record was reconciled
+type SyncResult struct {
+	Index    int    `json:"index"`
+	TicketID string `json:"ticket_id"`
+	Result   string `json:"result"`
+	Message  string `json:"message,omitempty"`
+
+	// The check-in that stands for the ticket after reconciliation
+	CheckedInAt     string `json:"checked_in_at,omitempty"`
+	CheckedInBy     string `json:"checked_in_by,omitempty"`
+	CheckedInDevice string `json:"checked_in_device,omitempty"`
+
+	// Set when this record replaced a later check-in already on the server
+	Superseded *SyncResult `json:"superseded,omitempty"`
+}
+
+// Sync results
+const (
+	syncAccepted  = "accepted"
+	syncDuplicate = "duplicate"
+	syncConflict  = "conflict"
+	syncRejected  = "rejected"
+)
+
+// hashValue returns the hex SHA-256 of a manifest value
+func hashValue(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// =====================================================
+// Scanner Sync Handlers
+// =====================================================
+
+// handleEventManifest returns the event's tickets for offline scanning.
+// With ?since=<version> only tickets changed after that version are sent.
+func handleEventManifest(w http.ResponseWriter, r *http.Request, eventID string) {
+	if r.Method != http.MethodGet {
+		sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "Only GET method is allowed")
+		return
+	}
+
+	event, count, ok := authorizeScanner(w, r, eventID)
+	if !ok {
+		return
+	}
+
+	var since int64
+	if value := r.URL.Query().Get("since"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 0 {
+			sendError(w, http.StatusBadRequest, "Validation error", "since must be a non-negative version")
+			return
+		}
+		since = parsed
+	}
+
+	tickets, err := ticketStore.GetEventTickets(eventID, since)
+	if err != nil {
+		fmt.Printf("Error fetching event tickets: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to fetch manifest")
+		return
+	}
+
+	version := since
+	entries := make([]ManifestEntry, 0, len(tickets))
+	for _, ticket := range tickets {
+		entry := ManifestEntry{
+			TicketID:     ticket.ID,
+			NumberHash:   hashValue(ticket.TicketNumber),
+			Status:       ticket.Status,
+			CheckedInAt:  ticket.CheckedInAt,
+			Version:      ticket.Version,
+			HolderUserID: ticket.UserID,
+		}
+		if ticket.QRCode != "" {
+			entry.PayloadHash = hashValue(ticket.QRCode)
+		}
+		entries = append(entries, entry)
+
+		if ticket.Version > version {
+			version = ticket.Version
+		}
+	}
+
+	sendJSON(w, http.StatusOK, map[string]interface{}{
+		"event":              event,
+		"registration_count": count,
+		"tickets":            entries,
+		"count":              len(entries),
+		"full":               since == 0,
+		"version":            version,
+	})
+}
+
+// handleEventSync applies a batch of offline scans. Records are applied in
+// scan order and the earliest scan of a ticket always wins, with ties going
+// to the lower device ID, so the outcome does not depend on which device
+// uploads first.
+func handleEventSync(w http.ResponseWriter, r *http.Request, eventID string) {
+	if r.Method != http.MethodPost {
+		sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "Only POST method is allowed")
+		return
+	}
+
+	if _, _, ok := authorizeScanner(w, r, eventID); !ok {
+		return
+	}
+	auth := authFromRequest(r)
+
+	var req SyncRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, "Invalid request", "Invalid JSON format")
+		return
+	}
+
+	req.DeviceID = strings.TrimSpace(req.DeviceID)
+	if req.DeviceID == "" {
+		sendError(w, http.StatusBadRequest, "Validation error", "device_id is required")
+		return
+	}
+	if len(req.Records) > maxSyncRecords {
+		sendError(w, http.StatusBadRequest, "Validation error", fmt.Sprintf("A sync batch can hold at most %d records", maxSyncRecords))
+		return
+	}
+
+	results := make([]SyncResult, len(req.Records))
+	order := make([]int, 0, len(req.Records))
+	scannedAt := make([]time.Time, len(req.Records))
+
+	for i, record := range req.Records {
+		results[i] = SyncResult{Index: i, TicketID: record.TicketID}
+
+		parsed, err := time.Parse(time.RFC3339, record.ScannedAt)
+		switch {
+		case record.TicketID == "":
+			results[i].Result, results[i].Message = syncRejected, "ticket_id is required"
+		case err != nil:
+			results[i].Result, results[i].Message = syncRejected, "scanned_at must be an RFC 3339 timestamp"
+		default:
+			scannedAt[i] = parsed.UTC()
+			order = append(order, i)
+		}
+	}
+
+	sort.SliceStable(order, func(a, b int) bool {
+		return scannedAt[order[a]].Before(scannedAt[order[b]])
+	})
+
+	err := reservationLedger.WithEvent(eventID, func() error {
+		for _, i := range order {
+			scan := CheckinScan{
+				StaffID:   auth.UserID,
+				DeviceID:  req.DeviceID,
+				ScannedAt: scannedAt[i].Format(time.RFC3339),
+			}
+			if err := reconcileScan(eventID, &results[i], scan); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("Error syncing check-ins: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to sync check-ins")
+		return
+	}
+
+	conflicts := []SyncResult{}
+	accepted := 0
+	for _, result := range results {
+		if result.Result == syncAccepted {
+			accepted++
+		}
+		if result.Result == syncConflict || result.Superseded != nil {
+			conflicts = append(conflicts, result)
+		}
+	}
+
+	sendJSON(w, http.StatusOK, map[string]interface{}{
+		"device_id": req.DeviceID,
+		"results":   results,
+		"accepted":  accepted,
+		"conflicts": conflicts,
+	})
+}
+
+// reconcileScan applies one offline scan and fills in its result
+func reconcileScan(eventID string, result *SyncResult, scan CheckinScan) error {
+	previous, err := ticketStore.GetTicketByID(result.TicketID)
+	if err != nil || previous.EventID != eventID {
+		result.Result, result.Message = syncRejected, "ticket not found for this event"
+		return nil
+	}
+
+	ticket, err := ticketStore.SyncCheckIn(result.TicketID, scan)
+	if err != nil && !errors.Is(err, errTicketNotActive) {
+		return err
+	}
+
+	result.CheckedInAt = ticket.CheckedInAt
+	result.CheckedInBy = ticket.CheckedInBy
+	result.CheckedInDevice = ticket.CheckedInDevice
+
+	switch {
+	case err == nil:
+		result.Result = syncAccepted
+		if previous.Status == "used" {
+			result.Superseded = &SyncResult{
+				Index:           -1,
+				TicketID:        previous.ID,
+				Result:          syncConflict,
+				Message:         "a later check-in was replaced by this earlier scan",
+				CheckedInAt:     previous.CheckedInAt,
+				CheckedInBy:     previous.CheckedInBy,
+				CheckedInDevice: previous.CheckedInDevice,
+			}
+		}
+	case ticket.Status != "used":
+		result.Result, result.Message = syncRejected, fmt.Sprintf("ticket is %s", ticket.Status)
+	case ticket.CheckedInDevice == scan.DeviceID && sameInstant(ticket.CheckedInAt, scan.ScannedAt):
+		result.Result = syncDuplicate
+	default:
+		result.Result, result.Message = syncConflict, "ticket was already checked in by an earlier scan"
+	}
+
+	return nil
+}
+
+// authorizeScanner loads the event and checks the caller may scan for it,
+// writing the error response when they may not
+func authorizeScanner(w http.ResponseWriter, r *http.Request, eventID string) (*Event, int, bool) {
+	auth := authFromRequest(r)
+
+	event, count, err := getEventWithCount(eventID)
+	if err != nil {
+		sendError(w, http.StatusNotFound, "Not found", "Event not found")
+		return nil, 0, false
+	}
+
+	allowed, err := canCheckIn(event, auth)
+	if err != nil {
+		fmt.Printf("Error checking event membership: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to verify permissions")
+		return nil, 0, false
+	}
+	if !allowed {
+		sendError(w, http.StatusForbidden, "Forbidden", "Only the event organizer or check-in staff can sync scanners")
+		return nil, 0, false
+	}
+
+	return event, count, true
+}
+
+// sameInstant compares two timestamps that may be formatted differently
+func sameInstant(a, b string) bool {
+	ta, errA := time.Parse(time.RFC3339, a)
+	tb, errB := time.Parse(time.RFC3339, b)
+	return errA == nil && errB == nil && ta.Equal(tb)
+}
+
+// scanWins reports whether a scan takes precedence over the ticket's
+// current check-in: earlier scans win, and ties go to the lower device ID
+func scanWins(ticket *Ticket, scan CheckinScan) bool {
+	if ticket.Status == "active" {
+		return true
+	}
+	if ticket.Status != "used" {
+		return false
+	}
+
+	current, err := time.Parse(time.RFC3339, ticket.CheckedInAt)
+	if err != nil {
+		return false
+	}
+	scanned, err := time.Parse(time.RFC3339, scan.ScannedAt)
+	if err != nil {
+		return false
+	}
+
+	return scanned.Before(current) || (scanned.Equal(current) && scan.DeviceID < ticket.CheckedInDevice)
+}
+
+// =====================================================
+// Supabase Scanner Sync Functions
+// =====================================================
+
+// GetEventTickets returns an event's tickets changed after sinceVersion, oldest change first
+func (c *SupabaseClient) GetEventTickets(eventID string, sinceVersion int64) ([]Ticket, error) {
+	path := fmt.Sprintf("/rest/v1/tickets?event_id=eq.%s&version=gt.%d&order=version.asc", eventID, sinceVersion)
+
+	var tickets []Ticket
+	if err := c.doREST("GET", path, "", nil, &tickets); err != nil {
+		return nil, err
+	}
+
+	return tickets, nil
+}
+
+// SyncCheckIn records an offline scan if it wins over the ticket's current
+// state. The precedence rule is expressed as a filter so the update stays a
+// single conditional statement; when the scan loses, errTicketNotActive is
+// returned with the ticket as it stands.
+func (c *SupabaseClient) SyncCheckIn(ticketID string, scan CheckinScan) (*Ticket, error) {
+	scannedAt := url.QueryEscape(scan.ScannedAt)
+	device := url.QueryEscape(scan.DeviceID)
+	path := fmt.Sprintf("/rest/v1/tickets?id=eq.%s&or=(status.eq.active,and(status.eq.used,checked_in_at.gt.%s),and(status.eq.used,checked_in_at.eq.%s,checked_in_device.gt.%s))",
+		ticketID, scannedAt, scannedAt, device)
+
+	payload := map[string]interface{}{
+		"status":            "used",
+		"checked_in_at":     scan.ScannedAt,
+		"checked_in_by":     scan.StaffID,
+		"checked_in_device": scan.DeviceID,
+	}
+
+	var tickets []Ticket
+	if err := c.doREST("PATCH", path, "", payload, &tickets); err != nil {
+		return nil, err
+	}
+
+	if len(tickets) == 0 {
+		current, err := c.GetTicketByID(ticketID)
+		if err != nil {
+			return nil, err
+		}
+		return current, errTicketNotActive
+	}
+
+	return &tickets[0], nil
+}
+
+// =====================================================
+// In-memory Scanner Sync Functions
+// =====================================================
+
+// GetEventTickets returns an event's tickets changed after sinceVersion, oldest change first
+func (m *MemoryStore) GetEventTickets(eventID string, sinceVersion int64) ([]Ticket, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	tickets := []Ticket{}
+	for _, ticket := range m.tickets {
+		if ticket.EventID == eventID && ticket.Version > sinceVersion {
+			tickets = append(tickets, *ticket)
+		}
+	}
+
+	sort.Slice(tickets, func(i, j int) bool {
+		return tickets[i].Version < tickets[j].Version
+	})
+
+	return tickets, nil
+}
+
+// SyncCheckIn records an offline scan if it wins over the ticket's current state
+func (m *MemoryStore) SyncCheckIn(ticketID string, scan CheckinScan) (*Ticket, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ticket, exists := m.tickets[ticketID]
+	if !exists {
+		return nil, fmt.Errorf("ticket not found")
+	}
+
+	if !scanWins(ticket, scan) {
+		current := *ticket
+		return &current, errTicketNotActive
+	}
+
+	ticket.Status = "used"
+	ticket.CheckedInAt = scan.ScannedAt
+	ticket.CheckedInBy = scan.StaffID
+	ticket.CheckedInDevice = scan.DeviceID
+	m.touchTicketLocked(ticket)
+
+	checkedIn := *ticket
+	return &checkedIn, nil
+}
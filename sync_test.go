@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// manifestResponse is the body of a scanner manifest
+type manifestResponse struct {
+	Tickets []ManifestEntry `json:"tickets"`
+	Full    bool            `json:"full"`
+	Version int64           `json:"version"`
+}
+
+// syncResponse is the body of a scanner sync
+type syncResponse struct {
+	Results   []SyncResult `json:"results"`
+	Accepted  int          `json:"accepted"`
+	Conflicts []SyncResult `json:"conflicts"`
+}
+
+// fetchManifest downloads an event's scanner manifest
+func fetchManifest(t *testing.T, token, eventID, query string) manifestResponse {
+	t.Helper()
+
+	rec := serveAuthenticated(handleEventDetail, http.MethodGet, "/api/events/"+eventID+"/manifest"+query, token, nil)
+	expectStatus(t, rec, http.StatusOK)
+
+	var resp manifestResponse
+	decodeBody(t, rec, &resp)
+	return resp
+}
+
+// syncScans uploads a batch of offline scans
+func syncScans(t *testing.T, token, eventID string, req SyncRequest) syncResponse {
+	t.Helper()
+
+	rec := serveAuthenticated(handleEventDetail, http.MethodPost, "/api/events/"+eventID+"/sync", token, req)
+	expectStatus(t, rec, http.StatusOK)
+
+	var resp syncResponse
+	decodeBody(t, rec, &resp)
+	return resp
+}
+
+func TestScannerManifest(t *testing.T) {
+	store := newTestStore(t)
+	organizerID, organizerToken := newTestUser(t, store, "organizer@example.com", roleOrganizer)
+	_, attendeeToken := newTestUser(t, store, "attendee@example.com", roleAttendee)
+
+	event := newTestEvent(t, store, organizerID, CreateEventRequest{})
+	tickets := registerForEvent(t, attendeeToken, EventRegistrationRequest{EventID: event.ID, Quantity: 3}).Tickets
+
+	full := fetchManifest(t, organizerToken, event.ID, "")
+	if !full.Full || len(full.Tickets) != 3 {
+		t.Fatalf("expected a full manifest of 3 tickets, got %+v", full)
+	}
+	byID := make(map[string]ManifestEntry)
+	for _, entry := range full.Tickets {
+		byID[entry.TicketID] = entry
+	}
+	for _, ticket := range tickets {
+		entry := byID[ticket.ID]
+		if entry.NumberHash != hashValue(ticket.TicketNumber) || entry.PayloadHash != hashValue(ticket.QRCode) || entry.Status != "active" {
+			t.Fatalf("manifest entry does not match ticket %s: %+v", ticket.ID, entry)
+		}
+		if entry.Version > full.Version {
+			t.Fatalf("manifest version %d is behind entry version %d", full.Version, entry.Version)
+		}
+	}
+
+	since := fmt.Sprintf("?since=%d", full.Version)
+	if delta := fetchManifest(t, organizerToken, event.ID, since); delta.Full || len(delta.Tickets) != 0 || delta.Version != full.Version {
+		t.Fatalf("expected an empty delta, got %+v", delta)
+	}
+
+	expectStatus(t, checkIn(organizerToken, event.ID, CheckinRequest{Payload: tickets[1].QRCode}), http.StatusOK)
+
+	delta := fetchManifest(t, organizerToken, event.ID, since)
+	if len(delta.Tickets) != 1 || delta.Tickets[0].TicketID != tickets[1].ID || delta.Tickets[0].Status != "used" || delta.Version <= full.Version {
+		t.Fatalf("expected only the checked-in ticket in the delta, got %+v", delta)
+	}
+
+	rec := serveAuthenticated(handleEventDetail, http.MethodGet, "/api/events/"+event.ID+"/manifest?since=-1", organizerToken, nil)
+	expectStatus(t, rec, http.StatusBadRequest)
+
+	rec = serveAuthenticated(handleEventDetail, http.MethodGet, "/api/events/"+event.ID+"/manifest", attendeeToken, nil)
+	expectStatus(t, rec, http.StatusForbidden)
+}
+
+func TestScannerSync(t *testing.T) {
+	store := newTestStore(t)
+	organizerID, organizerToken := newTestUser(t, store, "organizer@example.com", roleOrganizer)
+	staffID, staffToken := newTestUser(t, store, "staff@example.com", roleAttendee)
+	_, attendeeToken := newTestUser(t, store, "attendee@example.com", roleAttendee)
+
+	event := newTestEvent(t, store, organizerID, CreateEventRequest{})
+	otherEvent := newTestEvent(t, store, organizerID, CreateEventRequest{Title: "Other event"})
+	addTestMember(t, store, event.ID, staffID, memberCheckinStaff)
+
+	tickets := registerForEvent(t, attendeeToken, EventRegistrationRequest{EventID: event.ID, Quantity: 4}).Tickets
+	otherTicket := registerForEvent(t, attendeeToken, EventRegistrationRequest{EventID: otherEvent.ID}).Tickets[0]
+
+	t.Run("the earliest scan wins whoever uploads first", func(t *testing.T) {
+		late := syncScans(t, staffToken, event.ID, SyncRequest{
+			DeviceID: "device-b",
+			Records:  []SyncRecord{{TicketID: tickets[0].ID, ScannedAt: "2030-01-01T10:05:00Z"}},
+		})
+		if late.Accepted != 1 || late.Results[0].Result != syncAccepted {
+			t.Fatalf("expected the first upload to be accepted, got %+v", late.Results)
+		}
+
+		early := syncScans(t, organizerToken, event.ID, SyncRequest{
+			DeviceID: "device-a",
+			Records:  []SyncRecord{{TicketID: tickets[0].ID, ScannedAt: "2030-01-01T11:00:00+01:00"}},
+		})
+		result := early.Results[0]
+		if result.Result != syncAccepted || result.CheckedInDevice != "device-a" || result.CheckedInBy != organizerID {
+			t.Fatalf("expected the earlier scan to replace the later one, got %+v", result)
+		}
+		if result.Superseded == nil || result.Superseded.CheckedInDevice != "device-b" || len(early.Conflicts) != 1 {
+			t.Fatalf("expected the replaced check-in to be reported, got %+v", early)
+		}
+
+		ticket, _ := store.GetTicketByID(tickets[0].ID)
+		if ticket.CheckedInDevice != "device-a" || !sameInstant(ticket.CheckedInAt, "2030-01-01T10:00:00Z") {
+			t.Fatalf("expected device-a's 10:00 scan to stand, got %+v", ticket)
+		}
+
+		// Replaying either upload changes nothing
+		again := syncScans(t, organizerToken, event.ID, SyncRequest{
+			DeviceID: "device-a",
+			Records:  []SyncRecord{{TicketID: tickets[0].ID, ScannedAt: "2030-01-01T10:00:00Z"}},
+		})
+		if again.Results[0].Result != syncDuplicate {
+			t.Fatalf("expected a replayed scan to be a duplicate, got %+v", again.Results[0])
+		}
+		again = syncScans(t, staffToken, event.ID, SyncRequest{
+			DeviceID: "device-b",
+			Records:  []SyncRecord{{TicketID: tickets[0].ID, ScannedAt: "2030-01-01T10:05:00Z"}},
+		})
+		if again.Results[0].Result != syncConflict {
+			t.Fatalf("expected the losing scan to conflict, got %+v", again.Results[0])
+		}
+	})
+
+	t.Run("a batch is applied in scan order", func(t *testing.T) {
+		resp := syncScans(t, staffToken, event.ID, SyncRequest{
+			DeviceID: "device-c",
+			Records: []SyncRecord{
+				{TicketID: tickets[1].ID, ScannedAt: "2030-01-01T10:10:00Z"},
+				{TicketID: tickets[1].ID, ScannedAt: "2030-01-01T10:01:00Z"},
+			},
+		})
+		if resp.Results[1].Result != syncAccepted || resp.Results[0].Result != syncConflict {
+			t.Fatalf("expected the 10:01 scan to win, got %+v", resp.Results)
+		}
+	})
+
+	t.Run("ties go to the lower device ID", func(t *testing.T) {
+		scannedAt := "2030-01-01T10:20:00Z"
+		syncScans(t, staffToken, event.ID, SyncRequest{DeviceID: "device-z", Records: []SyncRecord{{TicketID: tickets[2].ID, ScannedAt: scannedAt}}})
+		resp := syncScans(t, staffToken, event.ID, SyncRequest{DeviceID: "device-m", Records: []SyncRecord{{TicketID: tickets[2].ID, ScannedAt: scannedAt}}})
+		if resp.Results[0].Result != syncAccepted || resp.Results[0].CheckedInDevice != "device-m" {
+			t.Fatalf("expected device-m to win the tie, got %+v", resp.Results[0])
+		}
+
+		resp = syncScans(t, staffToken, event.ID, SyncRequest{DeviceID: "device-z", Records: []SyncRecord{{TicketID: tickets[2].ID, ScannedAt: scannedAt}}})
+		if resp.Results[0].Result != syncConflict {
+			t.Fatalf("expected device-z to lose the tie, got %+v", resp.Results[0])
+		}
+	})
+
+	t.Run("invalid records are rejected individually", func(t *testing.T) {
+		if err := store.CancelRegistrationTickets(tickets[3].RegistrationID); err != nil {
+			t.Fatal(err)
+		}
+
+		resp := syncScans(t, staffToken, event.ID, SyncRequest{
+			DeviceID: "device-d",
+			Records: []SyncRecord{
+				{TicketID: "", ScannedAt: "2030-01-01T10:00:00Z"},
+				{TicketID: tickets[3].ID, ScannedAt: "yesterday"},
+				{TicketID: otherTicket.ID, ScannedAt: "2030-01-01T10:00:00Z"},
+				{TicketID: tickets[3].ID, ScannedAt: "2030-01-01T10:00:00Z"},
+			},
+		})
+		for i, result := range resp.Results {
+			if result.Result != syncRejected {
+				t.Fatalf("record %d: expected rejected, got %+v", i, result)
+			}
+		}
+		if ticket, _ := store.GetTicketByID(otherTicket.ID); ticket.Status != "active" {
+			t.Fatalf("expected the other event's ticket to be untouched, got %s", ticket.Status)
+		}
+	})
+
+	t.Run("requests are validated", func(t *testing.T) {
+		target := "/api/events/" + event.ID + "/sync"
+
+		rec := serveAuthenticated(handleEventDetail, http.MethodPost, target, staffToken, SyncRequest{Records: []SyncRecord{}})
+		expectStatus(t, rec, http.StatusBadRequest)
+
+		rec = serveAuthenticated(handleEventDetail, http.MethodPost, target, staffToken, SyncRequest{DeviceID: "device-e", Records: make([]SyncRecord, maxSyncRecords+1)})
+		expectStatus(t, rec, http.StatusBadRequest)
+
+		rec = serveAuthenticated(handleEventDetail, http.MethodPost, target, attendeeToken, SyncRequest{DeviceID: "device-e"})
+		expectStatus(t, rec, http.StatusForbidden)
+	})
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/your-username/go-ticket-api/ticketsig"
+)
+
+// Ticket payload signing, configured by newTicketSignerFromEnv
+var (
+	ticketSigner   ticketsig.Signer
+	ticketVerifier ticketsig.Verifier
+)
+
+// newTicketSignerFromEnv builds the ticket payload signer:
+//
+//	TICKET_SIGNING_ALGORITHM  ed25519 (default) or hmac
+//	TICKET_SIGNING_KEY        base64 Ed25519 seed (32 bytes)
+//	TICKET_SIGNING_SECRET     HMAC secret
+//	TICKET_SIGNING_KEY_ID     kid embedded in payloads (default "t1")
+func newTicketSignerFromEnv() (ticketsig.Signer, ticketsig.Verifier, error) {
+	keyID := envOrDefault("TICKET_SIGNING_KEY_ID", "t1")
+
+	switch algorithm := strings.ToLower(envOrDefault("TICKET_SIGNING_ALGORITHM", "ed25519")); algorithm {
+	case "ed25519":
+		var privateKey ed25519.PrivateKey
+
+		if encoded := os.Getenv("TICKET_SIGNING_KEY"); encoded != "" {
+			seed, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil || len(seed) != ed25519.SeedSize {
+				return nil, nil, fmt.Errorf("TICKET_SIGNING_KEY must be a base64 encoded %d byte Ed25519 seed", ed25519.SeedSize)
+			}
+			privateKey = ed25519.NewKeyFromSeed(seed)
+		} else {
+			// Payloads signed with a random key cannot be verified after a restart
+			fmt.Println("Warning: TICKET_SIGNING_KEY is not set, using a random key for this process")
+			_, generated, err := ed25519.GenerateKey(rand.Reader)
+			if err != nil {
+				return nil, nil, err
+			}
+			privateKey = generated
+		}
+
+		signer := ticketsig.NewEd25519Signer(keyID, privateKey)
+		verifier := ticketsig.NewEd25519Verifier(map[string]ed25519.PublicKey{keyID: signer.PublicKey()})
+		return signer, verifier, nil
+	case "hmac":
+		secret := os.Getenv("TICKET_SIGNING_SECRET")
+		if secret == "" {
+			return nil, nil, fmt.Errorf("TICKET_SIGNING_SECRET must be set for hmac ticket signing")
+		}
+
+		signer := ticketsig.NewHMACSigner(keyID, []byte(secret))
+		return signer, signer, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported TICKET_SIGNING_ALGORITHM %q (expected ed25519 or hmac)", algorithm)
+	}
+}
+
+// signTicket returns the signed verification payload for a ticket
+func signTicket(ticket *Ticket) (string, error) {
+	return ticketSigner.Sign(ticketsig.Payload{
+		EventID:  ticket.EventID,
+		TicketID: ticket.ID,
+		Holder:   ticket.UserID,
+		IssuedAt: time.Now().Unix(),
+	})
+}
+
+// ensureTicketPayload signs and stores a payload for tickets issued before
+// signing existed
+func ensureTicketPayload(ticket *Ticket) error {
+	if ticket.QRCode != "" {
+		return nil
+	}
+
+	payload, err := signTicket(ticket)
+	if err != nil {
+		return err
+	}
+
+	if err := ticketStore.SetTicketQRCode(ticket.ID, payload); err != nil {
+		return err
+	}
+	ticket.QRCode = payload
+
+	return nil
+}
+
+// handleTicketPayload returns the signed payload for a ticket the caller owns
+func handleTicketPayload(w http.ResponseWriter, r *http.Request, ticket *Ticket) {
+	if err := ensureTicketPayload(ticket); err != nil {
+		fmt.Printf("Error signing ticket: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to sign ticket")
+		return
+	}
+
+	sendJSON(w, http.StatusOK, map[string]interface{}{
+		"ticket_id": ticket.ID,
+		"payload":   ticket.QRCode,
+		"key_id":    ticketSigner.KeyID(),
+		"algorithm": ticketSigner.Algorithm(),
+	})
+}
+
+// handleTicketKeys publishes the public key scanners use to verify payloads offline
+func handleTicketKeys(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "Only GET method is allowed")
+		return
+	}
+
+	keys := []map[string]string{}
+	if signer, ok := ticketSigner.(*ticketsig.Ed25519Signer); ok {
+		keys = append(keys, map[string]string{
+			"key_id":     signer.KeyID(),
+			"algorithm":  signer.Algorithm(),
+			"public_key": base64.StdEncoding.EncodeToString(signer.PublicKey()),
+		})
+	}
+
+	sendJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": keys,
+	})
+}
+
+// =====================================================
+// Ticket Payload Storage
+// =====================================================
+
+// SetTicketQRCode stores the signed payload in tickets.qr_code
+func (c *SupabaseClient) SetTicketQRCode(ticketID, qrCode string) error {
+	return c.doREST("PATCH", fmt.Sprintf("/rest/v1/tickets?id=eq.%s", ticketID), "", map[string]interface{}{"qr_code": qrCode}, nil)
+}
+
+// SetTicketQRCode stores the signed payload on the ticket
+func (m *MemoryStore) SetTicketQRCode(ticketID, qrCode string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ticket, exists := m.tickets[ticketID]
+	if !exists {
+		return fmt.Errorf("ticket not found")
+	}
+
+	ticket.QRCode = qrCode
+	m.touchTicketLocked(ticket)
+	return nil
+}
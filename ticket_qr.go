@@ -0,0 +1,187 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/your-username/go-ticket-api/qrcode"
+)
+
+// QR code rendering options
+const (
+	defaultQRSize    = 256
+	minQRSize        = 64
+	maxQRSize        = 2048
+	defaultQRLevel   = "M"
+	qrCacheEntries   = 1024
+	qrCacheMaxAgeSec = 3600
+)
+
+// ticketQRCache holds rendered QR images, initialized in setup
+var ticketQRCache *QRCache
+
+// QRImage is a rendered QR code ready to be served
+type QRImage struct {
+	ContentType string
+	Data        []byte
+	ETag        string
+}
+
+// QRCache is a bounded least-recently-used cache of rendered QR images.
+// Keys include the ticket's payload, so re-signing a ticket never serves a
+// stale image.
+type QRCache struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	order    *list.List
+}
+
+type qrCacheEntry struct {
+	key   string
+	image *QRImage
+}
+
+// NewQRCache creates a cache holding at most capacity images
+func NewQRCache(capacity int) *QRCache {
+	return &QRCache{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// Get returns a cached image and marks it as recently used
+func (c *QRCache) Get(key string) (*QRImage, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, exists := c.entries[key]
+	if !exists {
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+	return element.Value.(*qrCacheEntry).image, true
+}
+
+// Put stores an image, evicting the least recently used one when full
+func (c *QRCache) Put(key string, image *QRImage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, exists := c.entries[key]; exists {
+		element.Value.(*qrCacheEntry).image = image
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&qrCacheEntry{key: key, image: image})
+
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*qrCacheEntry).key)
+	}
+}
+
+// renderTicketQR encodes a payload and renders it in the requested format
+func renderTicketQR(payload, format string, size int, level qrcode.Level) (*QRImage, error) {
+	code, err := qrcode.Encode([]byte(payload), level)
+	if err != nil {
+		return nil, err
+	}
+
+	image := &QRImage{}
+	switch format {
+	case "svg":
+		image.ContentType = "image/svg+xml"
+		image.Data = code.SVG(size)
+	default:
+		image.ContentType = "image/png"
+		image.Data, err = code.PNG(code.Scale(size))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sum := sha256.Sum256(image.Data)
+	image.ETag = `"` + hex.EncodeToString(sum[:8]) + `"`
+
+	return image, nil
+}
+
+// =====================================================
+// Ticket QR Handler
+// =====================================================
+
+// handleTicketQR serves the ticket's verification payload as a QR code.
+// Query parameters: format (png or svg), size (pixels) and ecc (L, M, Q or H).
+func handleTicketQR(w http.ResponseWriter, r *http.Request, ticket *Ticket) {
+	query := r.URL.Query()
+
+	format := strings.ToLower(query.Get("format"))
+	if format == "" {
+		format = "png"
+	}
+	if format != "png" && format != "svg" {
+		sendError(w, http.StatusBadRequest, "Validation error", "format must be png or svg")
+		return
+	}
+
+	size := defaultQRSize
+	if value := query.Get("size"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < minQRSize || parsed > maxQRSize {
+			sendError(w, http.StatusBadRequest, "Validation error", fmt.Sprintf("size must be between %d and %d pixels", minQRSize, maxQRSize))
+			return
+		}
+		size = parsed
+	}
+
+	levelName := query.Get("ecc")
+	if levelName == "" {
+		levelName = defaultQRLevel
+	}
+	level, err := qrcode.ParseLevel(levelName)
+	if err != nil {
+		sendError(w, http.StatusBadRequest, "Validation error", "ecc must be L, M, Q or H")
+		return
+	}
+
+	if err := ensureTicketPayload(ticket); err != nil {
+		fmt.Printf("Error signing ticket: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to sign ticket")
+		return
+	}
+
+	key := fmt.Sprintf("%s|%s|%d|%s|%s", ticket.ID, format, size, level, ticket.QRCode)
+	image, cached := ticketQRCache.Get(key)
+	if !cached {
+		image, err = renderTicketQR(ticket.QRCode, format, size, level)
+		if err != nil {
+			fmt.Printf("Error rendering ticket QR code: %v\n", err)
+			sendError(w, http.StatusInternalServerError, "Server error", "Unable to render QR code")
+			return
+		}
+		ticketQRCache.Put(key, image)
+	}
+
+	w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", qrCacheMaxAgeSec))
+	w.Header().Set("ETag", image.ETag)
+	if r.Header.Get("If-None-Match") == image.ETag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", image.ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(image.Data)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(image.Data)
+}
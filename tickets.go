@@ -0,0 +1,370 @@
+package main
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Ticket represents an admission ticket for a confirmed registration
+type Ticket struct {
+	ID             string  `json:"id"`
+	EventID        string  `json:"event_id"`
+	UserID         string  `json:"user_id"`
+	RegistrationID string  `json:"registration_id"`
+	TicketNumber   string  `json:"ticket_number"`
+	PurchaseDate   string  `json:"purchase_date"`
+	PricePaid      float64 `json:"price_paid"`
+	Status         string  `json:"status"`
+	QRCode         string  `json:"qr_code,omitempty"`
+	CreatedAt      string  `json:"created_at"`
+	TierID         string  `json:"tier_id,omitempty"`
+
+	// Named attendee for group bookings; the registering user holds the ticket
+	AttendeeName  string `json:"attendee_name,omitempty"`
+	AttendeeEmail string `json:"attendee_email,omitempty"`
+
+	// Set when the ticket is scanned at the door
+	CheckedInAt     string `json:"checked_in_at,omitempty"`
+	CheckedInBy     string `json:"checked_in_by,omitempty"`
+	CheckedInDevice string `json:"checked_in_device,omitempty"`
+
+	// Set when a cancellation refunds the ticket
+	RefundAmount float64 `json:"refund_amount,omitempty"`
+	RefundedAt   string  `json:"refunded_at,omitempty"`
+
+	// Version increases on every change, for scanner manifest sync
+	Version int64 `json:"version"`
+}
+
+// errDuplicateTicketNumber is returned when a generated ticket number is already taken
+var errDuplicateTicketNumber = errors.New("duplicate ticket number")
+
+// ticketNumberAlphabet is Crockford's base32, which avoids I, L, O and U so
+// numbers can be read out over the phone or typed at the door
+const ticketNumberAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// maxTicketNumberAttempts bounds retries when a generated number collides
+const maxTicketNumberAttempts = 5
+
+// newTicketNumber returns a random ticket number such as GT-7KQ4-M2XP
+func newTicketNumber() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("GT-")
+	for i, v := range b {
+		if i == 4 {
+			sb.WriteByte('-')
+		}
+		sb.WriteByte(ticketNumberAlphabet[int(v)%len(ticketNumberAlphabet)])
+	}
+
+	return sb.String()
+}
+
+// issueTicket creates the ticket for one seat of a confirmed registration
+// with its signed verification payload, retrying with a fresh number if
+// the generated one is already taken
+func issueTicket(registration *Registration, seat int, pricePaid float64) (*Ticket, error) {
+	ticket := Ticket{
+		ID:             newID(),
+		EventID:        registration.EventID,
+		UserID:         registration.UserID,
+		RegistrationID: registration.ID,
+		TierID:         registration.TierID,
+		PricePaid:      pricePaid,
+		Status:         "active",
+	}
+	if seat < len(registration.Attendees) {
+		ticket.AttendeeName = registration.Attendees[seat].Name
+		ticket.AttendeeEmail = registration.Attendees[seat].Email
+	}
+
+	payload, err := signTicket(&ticket)
+	if err != nil {
+		return nil, err
+	}
+	ticket.QRCode = payload
+
+	for attempt := 0; attempt < maxTicketNumberAttempts; attempt++ {
+		ticket.TicketNumber = newTicketNumber()
+
+		created, err := ticketStore.CreateTicket(ticket)
+		if err == nil {
+			return created, nil
+		}
+		if !errors.Is(err, errDuplicateTicketNumber) && !strings.Contains(err.Error(), "ticket_number") {
+			return nil, err
+		}
+	}
+
+	return nil, fmt.Errorf("failed to generate a unique ticket number")
+}
+
+// issueTicketsForRegistration issues one ticket per seat at the tier or
+// event price, logging instead of failing because the registration itself
+// is already confirmed
+func issueTicketsForRegistration(registration *Registration, event *Event) []Ticket {
+	prices := seatPrices(registrationPrice(registration, event), registration.Seats(), registration.Discount)
+
+	tickets := []Ticket{}
+	for seat, price := range prices {
+		ticket, err := issueTicket(registration, seat, price)
+		if err != nil {
+			fmt.Printf("Error issuing ticket %d for registration %s: %v\n", seat+1, registration.ID, err)
+			continue
+		}
+		tickets = append(tickets, *ticket)
+	}
+	return tickets
+}
+
+// registrationTickets returns the tickets issued for a registration
+func registrationTickets(registration *Registration) []Ticket {
+	tickets, err := ticketStore.GetUserTickets(registration.UserID, "")
+	if err != nil {
+		fmt.Printf("Error fetching tickets for registration %s: %v\n", registration.ID, err)
+		return []Ticket{}
+	}
+
+	issued := []Ticket{}
+	for _, ticket := range tickets {
+		if ticket.RegistrationID == registration.ID {
+			issued = append(issued, ticket)
+		}
+	}
+	return issued
+}
+
+// =====================================================
+// Ticket Handlers
+// =====================================================
+
+func handleTickets(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "Only GET method is allowed")
+		return
+	}
+
+	auth := authFromRequest(r)
+
+	// Optional status filter
+	status := r.URL.Query().Get("status")
+
+	tickets, err := ticketStore.GetUserTickets(auth.UserID, status)
+	if err != nil {
+		fmt.Printf("Error fetching tickets: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to fetch tickets")
+		return
+	}
+
+	sendJSON(w, http.StatusOK, map[string]interface{}{
+		"tickets": tickets,
+		"count":   len(tickets),
+	})
+}
+
+func handleTicketDetail(w http.ResponseWriter, r *http.Request) {
+	// Extract ticket ID from URL path: /api/tickets/{id} or /api/tickets/{id}/{resource}
+	path := strings.TrimPrefix(r.URL.Path, "/api/tickets/")
+	ticketID, resource, _ := strings.Cut(strings.TrimSpace(path), "/")
+
+	if ticketID == "" {
+		sendError(w, http.StatusBadRequest, "Invalid request", "Ticket ID is required")
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "Only GET method is allowed")
+		return
+	}
+
+	auth := authFromRequest(r)
+
+	ticket, err := ticketStore.GetTicketByID(ticketID)
+	if err != nil || ticket.UserID != auth.UserID {
+		sendError(w, http.StatusNotFound, "Not found", "Ticket not found")
+		return
+	}
+
+	switch resource {
+	case "payload":
+		handleTicketPayload(w, r, ticket)
+	case "qr":
+		handleTicketQR(w, r, ticket)
+	case "":
+		event, err := eventStore.GetEventByID(ticket.EventID)
+		if err != nil {
+			fmt.Printf("Error fetching event for ticket: %v\n", err)
+		}
+
+		sendJSON(w, http.StatusOK, map[string]interface{}{
+			"ticket": ticket,
+			"event":  event,
+		})
+	default:
+		sendError(w, http.StatusNotFound, "Not found", "Unknown ticket resource")
+	}
+}
+
+// =====================================================
+// Supabase Ticket Functions
+// =====================================================
+
+// CreateTicket inserts a ticket using the service role, since tickets may be
+// issued on behalf of another user (e.g. on waitlist promotion)
+func (c *SupabaseClient) CreateTicket(ticket Ticket) (*Ticket, error) {
+	payload := map[string]interface{}{
+		"id":              ticket.ID,
+		"event_id":        ticket.EventID,
+		"user_id":         ticket.UserID,
+		"registration_id": ticket.RegistrationID,
+		"ticket_number":   ticket.TicketNumber,
+		"price_paid":      ticket.PricePaid,
+		"status":          ticket.Status,
+		"qr_code":         ticket.QRCode,
+		"tier_id":         nullIfEmpty(ticket.TierID),
+		"attendee_name":   nullIfEmpty(ticket.AttendeeName),
+		"attendee_email":  nullIfEmpty(ticket.AttendeeEmail),
+	}
+
+	var tickets []Ticket
+	if err := c.doREST("POST", "/rest/v1/tickets", "", payload, &tickets); err != nil {
+		return nil, err
+	}
+
+	if len(tickets) == 0 {
+		return nil, fmt.Errorf("ticket created but no data returned")
+	}
+
+	return &tickets[0], nil
+}
+
+// GetUserTickets fetches a user's tickets, newest first
+func (c *SupabaseClient) GetUserTickets(userID, status string) ([]Ticket, error) {
+	path := fmt.Sprintf("/rest/v1/tickets?user_id=eq.%s", userID)
+	if status != "" {
+		path += fmt.Sprintf("&status=eq.%s", status)
+	}
+	path += "&order=created_at.desc"
+
+	var tickets []Ticket
+	if err := c.doREST("GET", path, "", nil, &tickets); err != nil {
+		return nil, err
+	}
+
+	return tickets, nil
+}
+
+// GetTicketByID fetches a single ticket
+func (c *SupabaseClient) GetTicketByID(ticketID string) (*Ticket, error) {
+	var tickets []Ticket
+	if err := c.doREST("GET", fmt.Sprintf("/rest/v1/tickets?id=eq.%s", ticketID), "", nil, &tickets); err != nil {
+		return nil, err
+	}
+
+	if len(tickets) == 0 {
+		return nil, fmt.Errorf("ticket not found")
+	}
+
+	return &tickets[0], nil
+}
+
+// CancelRegistrationTickets cancels the active tickets of a registration
+func (c *SupabaseClient) CancelRegistrationTickets(registrationID string) error {
+	path := fmt.Sprintf("/rest/v1/tickets?registration_id=eq.%s&status=eq.active", registrationID)
+	return c.doREST("PATCH", path, "", map[string]interface{}{"status": "cancelled"}, nil)
+}
+
+// =====================================================
+// In-memory Ticket Functions
+// =====================================================
+
+// touchTicketLocked gives a changed ticket the next version. The caller must hold m.mu.
+func (m *MemoryStore) touchTicketLocked(ticket *Ticket) {
+	m.ticketVersion++
+	ticket.Version = m.ticketVersion
+}
+
+// CreateTicket stores a ticket, enforcing unique ticket numbers
+func (m *MemoryStore) CreateTicket(ticket Ticket) (*Ticket, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.tickets {
+		if existing.TicketNumber == ticket.TicketNumber {
+			return nil, errDuplicateTicketNumber
+		}
+	}
+
+	now := nowTimestamp()
+	if ticket.ID == "" {
+		ticket.ID = newID()
+	}
+	ticket.PurchaseDate = now
+	ticket.CreatedAt = now
+	m.touchTicketLocked(&ticket)
+	m.tickets[ticket.ID] = &ticket
+
+	created := ticket
+	return &created, nil
+}
+
+// GetUserTickets returns a user's tickets, newest first
+func (m *MemoryStore) GetUserTickets(userID, status string) ([]Ticket, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	tickets := []Ticket{}
+	for _, ticket := range m.tickets {
+		if ticket.UserID != userID {
+			continue
+		}
+		if status != "" && ticket.Status != status {
+			continue
+		}
+		tickets = append(tickets, *ticket)
+	}
+
+	sort.Slice(tickets, func(i, j int) bool {
+		return tickets[i].CreatedAt > tickets[j].CreatedAt
+	})
+
+	return tickets, nil
+}
+
+// GetTicketByID returns a single ticket
+func (m *MemoryStore) GetTicketByID(ticketID string) (*Ticket, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ticket, exists := m.tickets[ticketID]
+	if !exists {
+		return nil, fmt.Errorf("ticket not found")
+	}
+
+	found := *ticket
+	return &found, nil
+}
+
+// CancelRegistrationTickets cancels the active tickets of a registration
+func (m *MemoryStore) CancelRegistrationTickets(registrationID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, ticket := range m.tickets {
+		if ticket.RegistrationID == registrationID && ticket.Status == "active" {
+			ticket.Status = "cancelled"
+			m.touchTicketLocked(ticket)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"testing"
+)
+
+var ticketNumberPattern = regexp.MustCompile(`^GT-[0-9A-HJKMNP-TV-Z]{4}-[0-9A-HJKMNP-TV-Z]{4}$`)
+
+func TestNewTicketNumber(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		number := newTicketNumber()
+		if !ticketNumberPattern.MatchString(number) {
+			t.Fatalf("ticket number %q is not GT-XXXX-XXXX in Crockford base32", number)
+		}
+		if seen[number] {
+			t.Fatalf("ticket number %q generated twice", number)
+		}
+		seen[number] = true
+	}
+}
+
+func TestMemoryStoreRejectsDuplicateTicketNumbers(t *testing.T) {
+	store := newTestStore(t)
+
+	if _, err := store.CreateTicket(Ticket{TicketNumber: "GT-AAAA-BBBB", Status: "active"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.CreateTicket(Ticket{TicketNumber: "GT-AAAA-BBBB", Status: "active"}); err != errDuplicateTicketNumber {
+		t.Fatalf("expected errDuplicateTicketNumber, got %v", err)
+	}
+}
+
+func TestTicketIssuance(t *testing.T) {
+	store := newTestStore(t)
+	organizerID, _ := newTestUser(t, store, "organizer@example.com", roleOrganizer)
+	userID, token := newTestUser(t, store, "attendee@example.com", roleAttendee)
+	_, otherToken := newTestUser(t, store, "other@example.com", roleAttendee)
+
+	event := newTestEvent(t, store, organizerID, CreateEventRequest{})
+	resp := registerForEvent(t, token, EventRegistrationRequest{EventID: event.ID})
+
+	if len(resp.Tickets) != 1 {
+		t.Fatalf("expected one ticket for a confirmed registration, got %d", len(resp.Tickets))
+	}
+	ticket := resp.Tickets[0]
+	if ticket.RegistrationID != resp.Registration.ID || ticket.EventID != event.ID || ticket.UserID != userID {
+		t.Fatalf("ticket not linked to its registration: %+v", ticket)
+	}
+	if ticket.Status != "active" || ticket.QRCode == "" || !ticketNumberPattern.MatchString(ticket.TicketNumber) {
+		t.Fatalf("expected an active, signed ticket with a valid number, got %+v", ticket)
+	}
+
+	t.Run("listed for its holder only", func(t *testing.T) {
+		rec := serveAuthenticated(handleTickets, http.MethodGet, "/api/tickets", token, nil)
+		expectStatus(t, rec, http.StatusOK)
+
+		var list struct {
+			Tickets []Ticket `json:"tickets"`
+		}
+		decodeBody(t, rec, &list)
+		if len(list.Tickets) != 1 || list.Tickets[0].ID != ticket.ID {
+			t.Fatalf("expected the holder to see their ticket, got %+v", list.Tickets)
+		}
+
+		rec = serveAuthenticated(handleTickets, http.MethodGet, "/api/tickets", otherToken, nil)
+		decodeBody(t, rec, &list)
+		if len(list.Tickets) != 0 {
+			t.Fatalf("expected another user to see no tickets, got %+v", list.Tickets)
+		}
+
+		rec = serveAuthenticated(handleTicketDetail, http.MethodGet, "/api/tickets/"+ticket.ID, token, nil)
+		expectStatus(t, rec, http.StatusOK)
+
+		rec = serveAuthenticated(handleTicketDetail, http.MethodGet, "/api/tickets/"+ticket.ID, otherToken, nil)
+		expectStatus(t, rec, http.StatusNotFound)
+	})
+
+	t.Run("cancelled with the registration", func(t *testing.T) {
+		cancelRegistration(t, token, resp.Registration.ID)
+
+		active, err := store.GetUserTickets(userID, "active")
+		if err != nil {
+			t.Fatal(err)
+		}
+		cancelled, err := store.GetUserTickets(userID, "cancelled")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(active) != 0 || len(cancelled) != 1 {
+			t.Fatalf("expected the ticket to be cancelled, got %d active and %d cancelled", len(active), len(cancelled))
+		}
+	})
+}
@@ -0,0 +1,237 @@
+// Package ticketsig signs and verifies the compact payloads encoded in
+// ticket QR codes, so a door scanner holding only the public key (Ed25519)
+// or the shared secret (HMAC) can validate tickets without network access.
+//
+// An encoded payload looks like
+//
+//	GT1.<kid>.<base64url claims>.<base64url signature>
+//
+// where the signature covers everything before the last dot.
+package ticketsig
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Version is the prefix of every encoded payload
+const Version = "GT1"
+
+// Supported signing algorithms
+const (
+	AlgorithmEd25519 = "Ed25519"
+	AlgorithmHMAC    = "HS256"
+)
+
+// Verification errors
+var (
+	ErrMalformed    = errors.New("ticketsig: malformed payload")
+	ErrUnknownKey   = errors.New("ticketsig: unknown key")
+	ErrBadSignature = errors.New("ticketsig: invalid signature")
+)
+
+// Payload is the data carried by a ticket's QR code. Field names are kept
+// short to keep the QR code small.
+type Payload struct {
+	EventID  string `json:"e"`
+	TicketID string `json:"t"`
+	Holder   string `json:"h"`
+	IssuedAt int64  `json:"i"`
+}
+
+// IssuedTime returns the issue time as a time.Time
+func (p Payload) IssuedTime() time.Time {
+	return time.Unix(p.IssuedAt, 0)
+}
+
+// Signer produces encoded, signed payloads
+type Signer interface {
+	KeyID() string
+	Algorithm() string
+	Sign(p Payload) (string, error)
+}
+
+// Verifier checks encoded payloads and returns their contents
+type Verifier interface {
+	Verify(encoded string) (*Payload, error)
+}
+
+// =====================================================
+// Ed25519
+// =====================================================
+
+// Ed25519Signer signs payloads with an Ed25519 private key
+type Ed25519Signer struct {
+	kid string
+	key ed25519.PrivateKey
+}
+
+// NewEd25519Signer creates a signer identified by kid
+func NewEd25519Signer(kid string, key ed25519.PrivateKey) *Ed25519Signer {
+	return &Ed25519Signer{kid: kid, key: key}
+}
+
+// KeyID returns the signer's key ID
+func (s *Ed25519Signer) KeyID() string { return s.kid }
+
+// Algorithm returns AlgorithmEd25519
+func (s *Ed25519Signer) Algorithm() string { return AlgorithmEd25519 }
+
+// PublicKey returns the key scanners need to verify payloads
+func (s *Ed25519Signer) PublicKey() ed25519.PublicKey {
+	return s.key.Public().(ed25519.PublicKey)
+}
+
+// Sign encodes and signs a payload
+func (s *Ed25519Signer) Sign(p Payload) (string, error) {
+	signingInput, err := encode(s.kid, p)
+	if err != nil {
+		return "", err
+	}
+
+	signature := ed25519.Sign(s.key, []byte(signingInput))
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// Ed25519Verifier verifies payloads against a set of public keys by kid
+type Ed25519Verifier struct {
+	keys map[string]ed25519.PublicKey
+}
+
+// NewEd25519Verifier creates a verifier for the given public keys
+func NewEd25519Verifier(keys map[string]ed25519.PublicKey) *Ed25519Verifier {
+	return &Ed25519Verifier{keys: keys}
+}
+
+// Verify checks the signature and returns the payload
+func (v *Ed25519Verifier) Verify(encoded string) (*Payload, error) {
+	kid, signingInput, signature, err := split(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	key, exists := v.keys[kid]
+	if !exists {
+		return nil, ErrUnknownKey
+	}
+
+	if !ed25519.Verify(key, []byte(signingInput), signature) {
+		return nil, ErrBadSignature
+	}
+
+	return decode(signingInput)
+}
+
+// =====================================================
+// HMAC
+// =====================================================
+
+// HMACSigner signs and verifies payloads with a shared secret. Scanners
+// must hold the secret, so prefer Ed25519 when devices are not trusted.
+type HMACSigner struct {
+	kid    string
+	secret []byte
+}
+
+// NewHMACSigner creates an HMAC-SHA256 signer identified by kid
+func NewHMACSigner(kid string, secret []byte) *HMACSigner {
+	return &HMACSigner{kid: kid, secret: secret}
+}
+
+// KeyID returns the signer's key ID
+func (s *HMACSigner) KeyID() string { return s.kid }
+
+// Algorithm returns AlgorithmHMAC
+func (s *HMACSigner) Algorithm() string { return AlgorithmHMAC }
+
+// Sign encodes and signs a payload
+func (s *HMACSigner) Sign(p Payload) (string, error) {
+	signingInput, err := encode(s.kid, p)
+	if err != nil {
+		return "", err
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(s.mac(signingInput)), nil
+}
+
+// Verify checks the signature and returns the payload
+func (s *HMACSigner) Verify(encoded string) (*Payload, error) {
+	kid, signingInput, signature, err := split(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	if kid != s.kid {
+		return nil, ErrUnknownKey
+	}
+
+	if !hmac.Equal(s.mac(signingInput), signature) {
+		return nil, ErrBadSignature
+	}
+
+	return decode(signingInput)
+}
+
+func (s *HMACSigner) mac(signingInput string) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(signingInput))
+	return mac.Sum(nil)
+}
+
+// =====================================================
+// Encoding
+// =====================================================
+
+func encode(kid string, p Payload) (string, error) {
+	if strings.Contains(kid, ".") {
+		return "", errors.New("ticketsig: key ID must not contain '.'")
+	}
+
+	claims, err := json.Marshal(p)
+	if err != nil {
+		return "", err
+	}
+
+	return Version + "." + kid + "." + base64.RawURLEncoding.EncodeToString(claims), nil
+}
+
+// split returns the key ID, the signed portion and the raw signature
+func split(encoded string) (string, string, []byte, error) {
+	parts := strings.Split(encoded, ".")
+	if len(parts) != 4 || parts[0] != Version || parts[1] == "" {
+		return "", "", nil, ErrMalformed
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[3])
+	if err != nil {
+		return "", "", nil, ErrMalformed
+	}
+
+	return parts[1], strings.Join(parts[:3], "."), signature, nil
+}
+
+func decode(signingInput string) (*Payload, error) {
+	parts := strings.Split(signingInput, ".")
+
+	claims, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+
+	var p Payload
+	if err := json.Unmarshal(claims, &p); err != nil {
+		return nil, ErrMalformed
+	}
+
+	if p.EventID == "" || p.TicketID == "" {
+		return nil, ErrMalformed
+	}
+
+	return &p, nil
+}
@@ -0,0 +1,163 @@
+package ticketsig
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+var testPayload = Payload{EventID: "event-1", TicketID: "ticket-1", Holder: "Ada Lovelace", IssuedAt: 1700000000}
+
+// testSigners returns an Ed25519 and an HMAC signer with their verifiers
+func testSigners(t *testing.T) map[string]struct {
+	signer   Signer
+	verifier Verifier
+} {
+	t.Helper()
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hmacSigner := NewHMACSigner("hmac-1", []byte("shared-secret"))
+
+	return map[string]struct {
+		signer   Signer
+		verifier Verifier
+	}{
+		AlgorithmEd25519: {NewEd25519Signer("ed-1", private), NewEd25519Verifier(map[string]ed25519.PublicKey{"ed-1": public})},
+		AlgorithmHMAC:    {hmacSigner, hmacSigner},
+	}
+}
+
+// reencodeClaims swaps the claims of an encoded payload, keeping its signature
+func reencodeClaims(t *testing.T, encoded string, p Payload) string {
+	t.Helper()
+
+	claims, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(encoded, ".")
+	parts[2] = base64.RawURLEncoding.EncodeToString(claims)
+	return strings.Join(parts, ".")
+}
+
+func TestSignAndVerify(t *testing.T) {
+	for algorithm, pair := range testSigners(t) {
+		t.Run(algorithm, func(t *testing.T) {
+			if pair.signer.Algorithm() != algorithm {
+				t.Fatalf("expected algorithm %s, got %s", algorithm, pair.signer.Algorithm())
+			}
+
+			encoded, err := pair.signer.Sign(testPayload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(encoded, Version+"."+pair.signer.KeyID()+".") {
+				t.Fatalf("unexpected encoding %q", encoded)
+			}
+
+			payload, err := pair.verifier.Verify(encoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *payload != testPayload {
+				t.Fatalf("expected %+v, got %+v", testPayload, *payload)
+			}
+			if !payload.IssuedTime().Equal(testPayload.IssuedTime()) || payload.IssuedTime().Unix() != 1700000000 {
+				t.Fatalf("unexpected issue time %v", payload.IssuedTime())
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsTampering(t *testing.T) {
+	for algorithm, pair := range testSigners(t) {
+		t.Run(algorithm, func(t *testing.T) {
+			encoded, err := pair.signer.Sign(testPayload)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			forged := testPayload
+			forged.TicketID = "ticket-2"
+
+			signature := encoded[strings.LastIndex(encoded, ".")+1:]
+			flipped := []byte(signature)
+			if flipped[0] == 'A' {
+				flipped[0] = 'B'
+			} else {
+				flipped[0] = 'A'
+			}
+
+			tests := []struct {
+				name    string
+				encoded string
+				want    error
+			}{
+				{"changed claims", reencodeClaims(t, encoded, forged), ErrBadSignature},
+				{"changed signature", strings.TrimSuffix(encoded, signature) + string(flipped), ErrBadSignature},
+				{"no signature", strings.TrimSuffix(encoded, signature), ErrBadSignature},
+				{"unknown kid", strings.Replace(encoded, "."+pair.signer.KeyID()+".", ".other.", 1), ErrUnknownKey},
+				{"wrong version", "GT2" + strings.TrimPrefix(encoded, Version), ErrMalformed},
+				{"missing part", encoded[:strings.LastIndex(encoded, ".")], ErrMalformed},
+				{"garbage", "not a ticket", ErrMalformed},
+			}
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					if _, err := pair.verifier.Verify(tt.encoded); !errors.Is(err, tt.want) {
+						t.Fatalf("expected %v, got %v", tt.want, err)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsOtherKeys(t *testing.T) {
+	_, private, _ := ed25519.GenerateKey(rand.Reader)
+	otherPublic, _, _ := ed25519.GenerateKey(rand.Reader)
+
+	encoded, err := NewEd25519Signer("ed-1", private).Sign(testPayload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Same kid, different key: a scanner with a stale or forged key set
+	verifier := NewEd25519Verifier(map[string]ed25519.PublicKey{"ed-1": otherPublic})
+	if _, err := verifier.Verify(encoded); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("expected ErrBadSignature, got %v", err)
+	}
+
+	hmacEncoded, err := NewHMACSigner("hmac-1", []byte("shared-secret")).Sign(testPayload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewHMACSigner("hmac-1", []byte("other-secret")).Verify(hmacEncoded); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("expected ErrBadSignature, got %v", err)
+	}
+}
+
+func TestVerifyRejectsIncompletePayloads(t *testing.T) {
+	signer := NewHMACSigner("hmac-1", []byte("shared-secret"))
+
+	// A validly signed payload must still name its event and ticket
+	encoded, err := signer.Sign(Payload{EventID: "event-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := signer.Verify(encoded); !errors.Is(err, ErrMalformed) {
+		t.Fatalf("expected ErrMalformed, got %v", err)
+	}
+}
+
+func TestKeyIDMustNotContainDot(t *testing.T) {
+	if _, err := NewHMACSigner("key.1", []byte("shared-secret")).Sign(testPayload); err == nil {
+		t.Fatal("expected a key ID with '.' to be rejected")
+	}
+}
@@ -0,0 +1,555 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TicketTier is a ticket type sold for an event (e.g. General, VIP, Student)
+// with its own price, capacity, sale window and per-order limit
+type TicketTier struct {
+	ID          string  `json:"id"`
+	EventID     string  `json:"event_id"`
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Price       float64 `json:"price"`
+	Capacity    *int    `json:"capacity"`
+	SalesStart  string  `json:"sales_start,omitempty"`
+	SalesEnd    string  `json:"sales_end,omitempty"`
+	MaxPerOrder int     `json:"max_per_order"`
+	CreatedAt   string  `json:"created_at"`
+}
+
+// TierAvailability is a tier as shown to buyers, with live availability
+type TierAvailability struct {
+	TicketTier
+	Sold      int  `json:"sold"`
+	Remaining *int `json:"remaining"`
+	OnSale    bool `json:"on_sale"`
+}
+
+// TierRequest represents ticket tier input, on event creation or on its own
+type TierRequest struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Price       float64 `json:"price"`
+	Capacity    *int    `json:"capacity"`
+	SalesStart  string  `json:"sales_start"`
+	SalesEnd    string  `json:"sales_end"`
+	MaxPerOrder int     `json:"max_per_order"`
+}
+
+// errTierSoldOut is returned when a tier has no seats left
+var errTierSoldOut = errors.New("tier sold out")
+
+// validateTierRequest checks tier input before it is stored
+func validateTierRequest(req TierRequest) error {
+	if strings.TrimSpace(req.Name) == "" {
+		return fmt.Errorf("tier name is required")
+	}
+	if req.Price < 0 {
+		return fmt.Errorf("tier price cannot be negative")
+	}
+	if req.Capacity != nil && *req.Capacity < 0 {
+		return fmt.Errorf("tier capacity cannot be negative")
+	}
+	if req.MaxPerOrder < 0 {
+		return fmt.Errorf("max_per_order cannot be negative")
+	}
+
+	var start, end time.Time
+	var err error
+	if req.SalesStart != "" {
+		if start, err = time.Parse(time.RFC3339, req.SalesStart); err != nil {
+			return fmt.Errorf("sales_start must be an RFC 3339 timestamp")
+		}
+	}
+	if req.SalesEnd != "" {
+		if end, err = time.Parse(time.RFC3339, req.SalesEnd); err != nil {
+			return fmt.Errorf("sales_end must be an RFC 3339 timestamp")
+		}
+	}
+	if req.SalesStart != "" && req.SalesEnd != "" && !end.After(start) {
+		return fmt.Errorf("sales_end must be after sales_start")
+	}
+
+	return nil
+}
+
+// newTierFromRequest builds a tier for an event from validated input
+func newTierFromRequest(eventID string, req TierRequest) TicketTier {
+	return TicketTier{
+		EventID:     eventID,
+		Name:        strings.TrimSpace(req.Name),
+		Description: req.Description,
+		Price:       req.Price,
+		Capacity:    req.Capacity,
+		SalesStart:  req.SalesStart,
+		SalesEnd:    req.SalesEnd,
+		MaxPerOrder: req.MaxPerOrder,
+	}
+}
+
+// tierOnSale reports whether now falls inside the tier's sale window
+func tierOnSale(tier *TicketTier, now time.Time) bool {
+	if start, err := time.Parse(time.RFC3339, tier.SalesStart); err == nil && now.Before(start) {
+		return false
+	}
+	if end, err := time.Parse(time.RFC3339, tier.SalesEnd); err == nil && !now.Before(end) {
+		return false
+	}
+	return true
+}
+
+// checkTierOrder validates an order of quantity seats against the tier's
+// sale window and per-order limit
+func checkTierOrder(tier *TicketTier, quantity int, now time.Time) error {
+	if !tierOnSale(tier, now) {
+		return fmt.Errorf("%s tickets are not on sale right now", tier.Name)
+	}
+	if tier.MaxPerOrder > 0 && quantity > tier.MaxPerOrder {
+		return fmt.Errorf("at most %d %s tickets can be booked per order", tier.MaxPerOrder, tier.Name)
+	}
+	return nil
+}
+
+// selectTier resolves the tier chosen for a registration from the event's
+// tiers. Events without tiers return nil; events with a single tier use it
+// by default.
+func selectTier(tiers []TicketTier, tierID string) (*TicketTier, error) {
+	if len(tiers) == 0 {
+		if tierID != "" {
+			return nil, fmt.Errorf("this event has no ticket tiers")
+		}
+		return nil, nil
+	}
+
+	if tierID == "" {
+		if len(tiers) == 1 {
+			return &tiers[0], nil
+		}
+		return nil, fmt.Errorf("tier_id is required for this event")
+	}
+
+	for i := range tiers {
+		if tiers[i].ID == tierID {
+			return &tiers[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown tier for this event")
+}
+
+// ensureTierHasRoom returns errTierSoldOut if the tier cannot take quantity
+// more seats. Callers must hold the event's reservation lock.
+func ensureTierHasRoom(tier *TicketTier, quantity int) error {
+	if tier == nil || tier.Capacity == nil {
+		return nil
+	}
+
+	sold, err := tierStore.GetTierSoldCounts(tier.EventID)
+	if err != nil {
+		return err
+	}
+
+	if sold[tier.ID]+quantity > *tier.Capacity {
+		return errTierSoldOut
+	}
+
+	return nil
+}
+
+// getTierAvailability lists an event's tiers with seats sold and remaining
+func getTierAvailability(eventID string) ([]TierAvailability, error) {
+	tiers, err := tierStore.GetEventTiers(eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	sold, err := tierStore.GetTierSoldCounts(eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	availability := make([]TierAvailability, 0, len(tiers))
+	for i := range tiers {
+		entry := TierAvailability{
+			TicketTier: tiers[i],
+			Sold:       sold[tiers[i].ID],
+			OnSale:     tierOnSale(&tiers[i], now),
+		}
+		if tiers[i].Capacity != nil {
+			remaining := *tiers[i].Capacity - entry.Sold
+			if remaining < 0 {
+				remaining = 0
+			}
+			entry.Remaining = &remaining
+		}
+		availability = append(availability, entry)
+	}
+
+	return availability, nil
+}
+
+// registrationPrice returns the price of one seat for a registration
+func registrationPrice(registration *Registration, event *Event) float64 {
+	if registration.TierID == "" {
+		return event.Price
+	}
+
+	tier, err := tierStore.GetTierByID(registration.TierID)
+	if err != nil {
+		fmt.Printf("Error fetching tier %s, using event price: %v\n", registration.TierID, err)
+		return event.Price
+	}
+
+	return tier.Price
+}
+
+// nullIfEmpty maps an empty string to a SQL NULL for optional UUID and timestamp columns
+func nullIfEmpty(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+// =====================================================
+// Ticket Tier Handlers
+// =====================================================
+
+// handleEventTiers lists tiers publicly; creating, updating and deleting
+// them is limited to the event organizer
+func handleEventTiers(w http.ResponseWriter, r *http.Request, eventID string) {
+	if r.Method == http.MethodGet {
+		if _, err := eventStore.GetEventByID(eventID); err != nil {
+			sendError(w, http.StatusNotFound, "Not found", "Event not found")
+			return
+		}
+
+		tiers, err := getTierAvailability(eventID)
+		if err != nil {
+			fmt.Printf("Error fetching tiers: %v\n", err)
+			sendError(w, http.StatusInternalServerError, "Server error", "Unable to fetch ticket tiers")
+			return
+		}
+
+		sendJSON(w, http.StatusOK, map[string]interface{}{
+			"tiers": tiers,
+			"count": len(tiers),
+		})
+		return
+	}
+
+	authenticate(func(w http.ResponseWriter, r *http.Request) {
+		handleManageEventTiers(w, r, eventID)
+	})(w, r)
+}
+
+func handleManageEventTiers(w http.ResponseWriter, r *http.Request, eventID string) {
+	auth := authFromRequest(r)
+
+	event, err := eventStore.GetEventByID(eventID)
+	if err != nil {
+		sendError(w, http.StatusNotFound, "Not found", "Event not found")
+		return
+	}
+
+	if !authorizeEvent(w, auth, event, eventManage, "Only the event organizer can manage ticket tiers") {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		var req TierRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			sendError(w, http.StatusBadRequest, "Invalid request", "Invalid JSON format")
+			return
+		}
+
+		if err := validateTierRequest(req); err != nil {
+			sendError(w, http.StatusBadRequest, "Validation error", err.Error())
+			return
+		}
+
+		tier, err := tierStore.CreateTier(newTierFromRequest(eventID, req))
+		if err != nil {
+			fmt.Printf("Error creating tier: %v\n", err)
+			sendError(w, http.StatusInternalServerError, "Server error", "Unable to create ticket tier")
+			return
+		}
+
+		sendJSON(w, http.StatusCreated, map[string]interface{}{
+			"tier":    tier,
+			"message": "Ticket tier created successfully",
+		})
+	case http.MethodPut:
+		tier, ok := eventTierFromQuery(w, r, eventID)
+		if !ok {
+			return
+		}
+
+		var req TierRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			sendError(w, http.StatusBadRequest, "Invalid request", "Invalid JSON format")
+			return
+		}
+
+		if err := validateTierRequest(req); err != nil {
+			sendError(w, http.StatusBadRequest, "Validation error", err.Error())
+			return
+		}
+
+		updated := newTierFromRequest(eventID, req)
+		updated.ID = tier.ID
+		if err := tierStore.UpdateTier(updated); err != nil {
+			fmt.Printf("Error updating tier: %v\n", err)
+			sendError(w, http.StatusInternalServerError, "Server error", "Unable to update ticket tier")
+			return
+		}
+
+		tier, _ = tierStore.GetTierByID(tier.ID)
+
+		sendJSON(w, http.StatusOK, map[string]interface{}{
+			"tier":    tier,
+			"message": "Ticket tier updated successfully",
+		})
+	case http.MethodDelete:
+		tier, ok := eventTierFromQuery(w, r, eventID)
+		if !ok {
+			return
+		}
+
+		sold, err := tierStore.GetTierSoldCounts(eventID)
+		if err != nil {
+			fmt.Printf("Error counting tier registrations: %v\n", err)
+			sendError(w, http.StatusInternalServerError, "Server error", "Unable to delete ticket tier")
+			return
+		}
+		if sold[tier.ID] > 0 {
+			sendError(w, http.StatusConflict, "Tier in use", "Tickets have already been sold in this tier")
+			return
+		}
+
+		if err := tierStore.DeleteTier(tier.ID); err != nil {
+			fmt.Printf("Error deleting tier: %v\n", err)
+			sendError(w, http.StatusInternalServerError, "Server error", "Unable to delete ticket tier")
+			return
+		}
+
+		sendJSON(w, http.StatusOK, map[string]interface{}{
+			"message": "Ticket tier deleted successfully",
+		})
+	default:
+		sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "Only GET, POST, PUT, and DELETE methods are allowed")
+	}
+}
+
+// eventTierFromQuery loads the tier named by ?tier_id= and checks it belongs to the event
+func eventTierFromQuery(w http.ResponseWriter, r *http.Request, eventID string) (*TicketTier, bool) {
+	tierID := r.URL.Query().Get("tier_id")
+	if tierID == "" {
+		sendError(w, http.StatusBadRequest, "Validation error", "tier_id query parameter is required")
+		return nil, false
+	}
+
+	tier, err := tierStore.GetTierByID(tierID)
+	if err != nil || tier.EventID != eventID {
+		sendError(w, http.StatusNotFound, "Not found", "Ticket tier not found")
+		return nil, false
+	}
+
+	return tier, true
+}
+
+// =====================================================
+// Supabase Ticket Tier Functions
+// =====================================================
+
+func tierPayload(tier TicketTier) map[string]interface{} {
+	return map[string]interface{}{
+		"event_id":      tier.EventID,
+		"name":          tier.Name,
+		"description":   tier.Description,
+		"price":         tier.Price,
+		"capacity":      tier.Capacity,
+		"sales_start":   nullIfEmpty(tier.SalesStart),
+		"sales_end":     nullIfEmpty(tier.SalesEnd),
+		"max_per_order": tier.MaxPerOrder,
+	}
+}
+
+// GetEventTiers returns an event's tiers, cheapest first
+func (c *SupabaseClient) GetEventTiers(eventID string) ([]TicketTier, error) {
+	var tiers []TicketTier
+	if err := c.doREST("GET", fmt.Sprintf("/rest/v1/ticket_tiers?event_id=eq.%s&order=price.asc,created_at.asc", eventID), "", nil, &tiers); err != nil {
+		return nil, err
+	}
+
+	return tiers, nil
+}
+
+// GetTierByID fetches a single tier
+func (c *SupabaseClient) GetTierByID(tierID string) (*TicketTier, error) {
+	var tiers []TicketTier
+	if err := c.doREST("GET", fmt.Sprintf("/rest/v1/ticket_tiers?id=eq.%s", tierID), "", nil, &tiers); err != nil {
+		return nil, err
+	}
+
+	if len(tiers) == 0 {
+		return nil, fmt.Errorf("tier not found")
+	}
+
+	return &tiers[0], nil
+}
+
+// CreateTier inserts a tier
+func (c *SupabaseClient) CreateTier(tier TicketTier) (*TicketTier, error) {
+	var tiers []TicketTier
+	if err := c.doREST("POST", "/rest/v1/ticket_tiers", "", tierPayload(tier), &tiers); err != nil {
+		return nil, err
+	}
+
+	if len(tiers) == 0 {
+		return nil, fmt.Errorf("tier created but no data returned")
+	}
+
+	return &tiers[0], nil
+}
+
+// UpdateTier replaces a tier's settings
+func (c *SupabaseClient) UpdateTier(tier TicketTier) error {
+	return c.doREST("PATCH", fmt.Sprintf("/rest/v1/ticket_tiers?id=eq.%s", tier.ID), "", tierPayload(tier), nil)
+}
+
+// DeleteTier removes a tier
+func (c *SupabaseClient) DeleteTier(tierID string) error {
+	return c.doREST("DELETE", fmt.Sprintf("/rest/v1/ticket_tiers?id=eq.%s", tierID), "", nil, nil)
+}
+
+// GetTierSoldCounts returns the seats taken per tier for an event,
+// counting confirmed registrations and active seat holds
+func (c *SupabaseClient) GetTierSoldCounts(eventID string) (map[string]int, error) {
+	path := fmt.Sprintf("/rest/v1/registrations?event_id=eq.%s&status=eq.confirmed&tier_id=not.is.null&select=tier_id,quantity", eventID)
+
+	var rows []Registration
+	if err := c.doREST("GET", path, "", nil, &rows); err != nil {
+		return nil, err
+	}
+
+	_, counts, err := c.heldSeats(eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range rows {
+		counts[rows[i].TierID] += rows[i].Seats()
+	}
+
+	return counts, nil
+}
+
+// =====================================================
+// In-memory Ticket Tier Functions
+// =====================================================
+
+// GetEventTiers returns an event's tiers, cheapest first
+func (m *MemoryStore) GetEventTiers(eventID string) ([]TicketTier, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	tiers := []TicketTier{}
+	for _, tier := range m.tiers {
+		if tier.EventID == eventID {
+			tiers = append(tiers, *tier)
+		}
+	}
+
+	sort.Slice(tiers, func(i, j int) bool {
+		if tiers[i].Price != tiers[j].Price {
+			return tiers[i].Price < tiers[j].Price
+		}
+		return tiers[i].CreatedAt < tiers[j].CreatedAt
+	})
+
+	return tiers, nil
+}
+
+// GetTierByID returns a single tier
+func (m *MemoryStore) GetTierByID(tierID string) (*TicketTier, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	tier, exists := m.tiers[tierID]
+	if !exists {
+		return nil, fmt.Errorf("tier not found")
+	}
+
+	found := *tier
+	return &found, nil
+}
+
+// CreateTier stores a tier
+func (m *MemoryStore) CreateTier(tier TicketTier) (*TicketTier, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.events[tier.EventID]; !exists {
+		return nil, fmt.Errorf("failed to create tier: event not found")
+	}
+
+	tier.ID = newID()
+	tier.CreatedAt = nowTimestamp()
+	m.tiers[tier.ID] = &tier
+
+	created := tier
+	return &created, nil
+}
+
+// UpdateTier replaces a tier's settings
+func (m *MemoryStore) UpdateTier(tier TicketTier) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, exists := m.tiers[tier.ID]
+	if !exists {
+		return fmt.Errorf("tier not found")
+	}
+
+	tier.EventID = existing.EventID
+	tier.CreatedAt = existing.CreatedAt
+	*existing = tier
+
+	return nil
+}
+
+// DeleteTier removes a tier
+func (m *MemoryStore) DeleteTier(tierID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.tiers, tierID)
+	return nil
+}
+
+// GetTierSoldCounts returns the seats taken per tier for an event,
+// counting confirmed registrations and active seat holds
+func (m *MemoryStore) GetTierSoldCounts(eventID string) (map[string]int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, counts := m.heldSeatsLocked(eventID)
+	for _, reg := range m.registrations {
+		if reg.EventID == eventID && reg.Status == "confirmed" && reg.TierID != "" {
+			counts[reg.TierID] += reg.Seats()
+		}
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestValidateTierRequest(t *testing.T) {
+	negative := -1
+	tests := []struct {
+		name  string
+		req   TierRequest
+		valid bool
+	}{
+		{"minimal", TierRequest{Name: "General"}, true},
+		{"full", TierRequest{Name: "VIP", Price: 50, SalesStart: "2030-01-01T00:00:00Z", SalesEnd: "2030-02-01T00:00:00Z", MaxPerOrder: 4}, true},
+		{"no name", TierRequest{Name: "  "}, false},
+		{"negative price", TierRequest{Name: "General", Price: -1}, false},
+		{"negative capacity", TierRequest{Name: "General", Capacity: &negative}, false},
+		{"negative limit", TierRequest{Name: "General", MaxPerOrder: -1}, false},
+		{"bad start", TierRequest{Name: "General", SalesStart: "tomorrow"}, false},
+		{"end before start", TierRequest{Name: "General", SalesStart: "2030-02-01T00:00:00Z", SalesEnd: "2030-01-01T00:00:00Z"}, false},
+		{"empty window", TierRequest{Name: "General", SalesStart: "2030-01-01T00:00:00Z", SalesEnd: "2030-01-01T00:00:00Z"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateTierRequest(tt.req); (err == nil) != tt.valid {
+				t.Fatalf("expected valid=%v, got %v", tt.valid, err)
+			}
+		})
+	}
+}
+
+func TestTierSaleWindowAndLimits(t *testing.T) {
+	start := time.Date(2030, 1, 1, 9, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+	tier := &TicketTier{Name: "Early bird", SalesStart: start.Format(time.RFC3339), SalesEnd: end.Format(time.RFC3339), MaxPerOrder: 2}
+
+	tests := []struct {
+		at     time.Time
+		onSale bool
+	}{
+		{start.Add(-time.Second), false},
+		{start, true},
+		{end.Add(-time.Second), true},
+		{end, false},
+	}
+	for _, tt := range tests {
+		if got := tierOnSale(tier, tt.at); got != tt.onSale {
+			t.Fatalf("at %v: expected on sale %v, got %v", tt.at, tt.onSale, got)
+		}
+	}
+
+	if err := checkTierOrder(tier, 2, start); err != nil {
+		t.Fatalf("expected 2 seats to be allowed, got %v", err)
+	}
+	if err := checkTierOrder(tier, 3, start); err == nil {
+		t.Fatal("expected 3 seats to exceed max_per_order")
+	}
+	if err := checkTierOrder(tier, 1, end); err == nil {
+		t.Fatal("expected an order after the sale window to be refused")
+	}
+	if !tierOnSale(&TicketTier{}, start) {
+		t.Fatal("expected a tier without a window to always be on sale")
+	}
+}
+
+func TestSelectTier(t *testing.T) {
+	general := TicketTier{ID: "general", Name: "General"}
+	vip := TicketTier{ID: "vip", Name: "VIP"}
+
+	if tier, err := selectTier(nil, ""); tier != nil || err != nil {
+		t.Fatalf("expected no tier for an event without tiers, got %v, %v", tier, err)
+	}
+	if _, err := selectTier(nil, "vip"); err == nil {
+		t.Fatal("expected a tier_id to be refused for an event without tiers")
+	}
+	if tier, err := selectTier([]TicketTier{general}, ""); err != nil || tier.ID != "general" {
+		t.Fatalf("expected a single tier to be the default, got %v, %v", tier, err)
+	}
+	if _, err := selectTier([]TicketTier{general, vip}, ""); err == nil {
+		t.Fatal("expected tier_id to be required with several tiers")
+	}
+	if tier, err := selectTier([]TicketTier{general, vip}, "vip"); err != nil || tier.ID != "vip" {
+		t.Fatalf("expected the chosen tier, got %v, %v", tier, err)
+	}
+	if _, err := selectTier([]TicketTier{general, vip}, "student"); err == nil {
+		t.Fatal("expected an unknown tier to be refused")
+	}
+}
+
+func TestRegistrationPrice(t *testing.T) {
+	store := newTestStore(t)
+	organizerID, _ := newTestUser(t, store, "organizer@example.com", roleOrganizer)
+	event := newTestEvent(t, store, organizerID, CreateEventRequest{Price: 20})
+	tier, err := store.CreateTier(TicketTier{EventID: event.ID, Name: "VIP", Price: 75})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if price := registrationPrice(&Registration{}, event); price != 20 {
+		t.Fatalf("expected the event price without a tier, got %v", price)
+	}
+	if price := registrationPrice(&Registration{TierID: tier.ID}, event); price != 75 {
+		t.Fatalf("expected the tier price, got %v", price)
+	}
+}
+
+func TestTierCapacity(t *testing.T) {
+	store := newTestStore(t)
+	organizerID, organizerToken := newTestUser(t, store, "organizer@example.com", roleOrganizer)
+
+	eventCapacity := 20
+	event := newTestEvent(t, store, organizerID, CreateEventRequest{Capacity: &eventCapacity})
+	target := "/api/events/" + event.ID + "/tiers"
+
+	limited := 5
+	rec := serveAuthenticated(handleEventDetail, http.MethodPost, target, organizerToken, TierRequest{Name: "Front row", Capacity: &limited})
+	expectStatus(t, rec, http.StatusCreated)
+	var created struct {
+		Tier TicketTier `json:"tier"`
+	}
+	decodeBody(t, rec, &created)
+	frontRow := created.Tier
+
+	general, err := store.CreateTier(TicketTier{EventID: event.ID, Name: "General"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokens := make([]string, 12)
+	for i := range tokens {
+		_, tokens[i] = newTestUser(t, store, fmt.Sprintf("attendee-%d@example.com", i), roleAttendee)
+	}
+
+	t.Run("concurrent orders never oversell a tier", func(t *testing.T) {
+		var wg sync.WaitGroup
+		statuses := make([]int, 10)
+		for i := range statuses {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				rec := serveAuthenticated(handleRegistrations, http.MethodPost, "/api/registrations", tokens[i], EventRegistrationRequest{EventID: event.ID, TierID: frontRow.ID})
+				statuses[i] = rec.Code
+			}(i)
+		}
+		wg.Wait()
+
+		created := 0
+		for _, status := range statuses {
+			switch status {
+			case http.StatusCreated:
+				created++
+			case http.StatusConflict:
+			default:
+				t.Fatalf("unexpected status %d", status)
+			}
+		}
+		if created != limited {
+			t.Fatalf("expected %d front row seats sold, got %d", limited, created)
+		}
+	})
+
+	t.Run("other tiers keep selling", func(t *testing.T) {
+		resp := registerForEvent(t, tokens[10], EventRegistrationRequest{EventID: event.ID, TierID: general.ID, Quantity: 3})
+		if resp.Registration.TierID != general.ID || len(resp.Tickets) != 3 || resp.Tickets[0].TierID != general.ID {
+			t.Fatalf("expected 3 general tickets, got %+v", resp)
+		}
+
+		rec := serveAuthenticated(handleRegistrations, http.MethodPost, "/api/registrations", tokens[11], EventRegistrationRequest{EventID: event.ID})
+		expectStatus(t, rec, http.StatusBadRequest)
+	})
+
+	t.Run("availability", func(t *testing.T) {
+		// Anyone may see what is left, without signing in
+		rec := httptest.NewRecorder()
+		handleEventDetail(rec, newTestRequest(http.MethodGet, target, nil))
+		expectStatus(t, rec, http.StatusOK)
+
+		var resp struct {
+			Tiers []TierAvailability `json:"tiers"`
+		}
+		decodeBody(t, rec, &resp)
+		for _, tier := range resp.Tiers {
+			switch tier.ID {
+			case frontRow.ID:
+				if tier.Sold != 5 || tier.Remaining == nil || *tier.Remaining != 0 {
+					t.Fatalf("expected the front row to be sold out, got %+v", tier)
+				}
+			case general.ID:
+				if tier.Sold != 3 || tier.Remaining != nil || !tier.OnSale {
+					t.Fatalf("expected 3 general seats sold with no limit, got %+v", tier)
+				}
+			}
+		}
+	})
+
+	t.Run("tiers with sales cannot be deleted", func(t *testing.T) {
+		rec := serveAuthenticated(handleEventDetail, http.MethodDelete, target+"?tier_id="+frontRow.ID, organizerToken, nil)
+		expectStatus(t, rec, http.StatusConflict)
+
+		unused, err := store.CreateTier(TicketTier{EventID: event.ID, Name: "Balcony"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec = serveAuthenticated(handleEventDetail, http.MethodDelete, target+"?tier_id="+unused.ID, organizerToken, nil)
+		expectStatus(t, rec, http.StatusOK)
+
+		rec = serveAuthenticated(handleEventDetail, http.MethodPost, target, tokens[0], TierRequest{Name: "Sneaky"})
+		expectStatus(t, rec, http.StatusForbidden)
+	})
+}
@@ -0,0 +1,965 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TOTP parameters (RFC 6238), the defaults authenticator apps expect
+const (
+	totpIssuer = "GoTicket"
+	totpPeriod = 30
+	totpDigits = 6
+	// totpSkew is how many 30 second steps of clock drift are accepted
+	// either side of the current one
+	totpSkew = 1
+)
+
+// Two-factor settings
+const (
+	recoveryCodeCount     = 10
+	twoFactorChallengeTTL = 5 * time.Minute
+
+	// settingRequireOrganizerTwoFactor is the platform setting admins use
+	// to require two-factor authentication for organizer accounts
+	settingRequireOrganizerTwoFactor = "require_organizer_2fa"
+)
+
+// errNoTwoFactor is returned when an account has no pending enrollment
+var errNoTwoFactor = errors.New("two-factor authentication is not set up")
+
+// twoFactorBase32 encodes TOTP secrets and recovery codes
+var twoFactorBase32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// twoFactorExemptPaths stay open to organizers who must still enroll
+var twoFactorExemptPaths = []string{"/api/2fa", "/api/profile", "/api/sessions"}
+
+// TwoFactor is an account's TOTP secret. It is pending until the first
+// code is confirmed, and the last step used is kept so codes work once.
+type TwoFactor struct {
+	UserID       string `json:"user_id"`
+	Secret       string `json:"secret"`
+	Enabled      bool   `json:"enabled"`
+	EnabledAt    string `json:"enabled_at"`
+	LastUsedStep int64  `json:"last_used_step"`
+	CreatedAt    string `json:"created_at"`
+}
+
+// TwoFactorCodeRequest carries a code from the authenticator app, or one of
+// the recovery codes instead
+type TwoFactorCodeRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// LoginTwoFactorRequest finishes signing in to an account with two-factor
+// authentication
+type LoginTwoFactorRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recovery_code"`
+}
+
+// TwoFactorPolicyRequest represents an admin changing the two-factor policy
+type TwoFactorPolicyRequest struct {
+	RequireForOrganizers *bool `json:"require_for_organizers"`
+}
+
+// generateTOTPSecret returns a new random 160-bit secret in base32
+func generateTOTPSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return twoFactorBase32.EncodeToString(b), nil
+}
+
+// totpCode computes the code for a time step
+func totpCode(key []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// matchTOTP returns the time step a code belongs to, allowing for clock
+// drift, and whether it matched at all
+func matchTOTP(secret, code string, now time.Time) (int64, bool) {
+	key, err := twoFactorBase32.DecodeString(secret)
+	code = strings.ReplaceAll(code, " ", "")
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// otpauthURI is the provisioning URI authenticator apps scan as a QR code
+func otpauthURI(secret, account string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", totpIssuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", strconv.Itoa(totpDigits))
+	query.Set("period", strconv.Itoa(totpPeriod))
+
+	return "otpauth://totp/" + url.PathEscape(totpIssuer+":"+account) + "?" + query.Encode()
+}
+
+// generateRecoveryCodes returns new recovery codes, formatted as
+// xxxxx-xxxxx, along with the hashes to store
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+
+		code := strings.ToLower(twoFactorBase32.EncodeToString(b))[:10]
+		codes = append(codes, code[:5]+"-"+code[5:])
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode hashes a recovery code, ignoring case, spaces and dashes
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	return hashAPIKey(code)
+}
+
+// verifySecondFactor checks a code from the authenticator app, which may
+// only be used once, or uses up one of the recovery codes
+func verifySecondFactor(twoFactor *TwoFactor, code, recoveryCode string) (bool, error) {
+	if code != "" {
+		step, ok := matchTOTP(twoFactor.Secret, code, time.Now())
+		if !ok {
+			return false, nil
+		}
+		return twoFactorStore.UseTwoFactorStep(twoFactor.UserID, step)
+	}
+
+	if recoveryCode != "" {
+		return twoFactorStore.UseRecoveryCode(twoFactor.UserID, hashRecoveryCode(recoveryCode))
+	}
+
+	return false, nil
+}
+
+// twoFactorEnabled reports whether an account signs in with a second factor
+func twoFactorEnabled(userID string) (bool, error) {
+	twoFactor, err := twoFactorStore.GetTwoFactor(userID)
+	if err != nil {
+		return false, err
+	}
+	return twoFactor != nil && twoFactor.Enabled, nil
+}
+
+// issueTwoFactorChallenge signs the short-lived token that carries a login
+// from the password step to the code step
+func issueTwoFactorChallenge(userID string) (string, error) {
+	now := time.Now()
+
+	return jwtIssuer.Sign(Claims{
+		Subject:   userID,
+		Issuer:    jwtIssuer.Issuer,
+		Audience:  twoFactorAudience(),
+		IssuedAt:  now.Unix(),
+		NotBefore: now.Unix(),
+		ExpiresAt: now.Add(twoFactorChallengeTTL).Unix(),
+		ID:        newID(),
+	})
+}
+
+// twoFactorAudience is the audience of login challenge tokens, so they
+// cannot be used as access tokens
+func twoFactorAudience() string {
+	return jwtIssuer.Audience + ":2fa"
+}
+
+// twoFactorPolicyCache remembers the organizer two-factor policy for a
+// short time, so authenticating does not always need a settings lookup
+type twoFactorPolicyCache struct {
+	mu       sync.Mutex
+	required bool
+	loadedAt time.Time
+}
+
+// organizerTwoFactorPolicy caches whether organizers must use two-factor
+// authentication
+var organizerTwoFactorPolicy twoFactorPolicyCache
+
+// Required returns the policy, reloading it once it is older than
+// roleCacheTTL. If it cannot be loaded the last known value is kept.
+func (c *twoFactorPolicyCache) Required() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.loadedAt) < roleCacheTTL {
+		return c.required
+	}
+
+	required, err := twoFactorStore.GetOrganizerTwoFactorPolicy()
+	if err != nil {
+		fmt.Printf("Error loading two-factor policy: %v\n", err)
+		return c.required
+	}
+
+	c.required = required
+	c.loadedAt = time.Now()
+	return required
+}
+
+// Set records a policy change made on this instance
+func (c *twoFactorPolicyCache) Set(required bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.required = required
+	c.loadedAt = time.Now()
+}
+
+// twoFactorSetupRequired reports whether an organizer must enroll before
+// using their account, because admins require two-factor authentication
+func twoFactorSetupRequired(userID, role string) (bool, error) {
+	if role != roleOrganizer || !organizerTwoFactorPolicy.Required() {
+		return false, nil
+	}
+
+	enabled, err := twoFactorEnabled(userID)
+	if err != nil {
+		return false, err
+	}
+	return !enabled, nil
+}
+
+// enforceTwoFactor keeps organizers who have yet to enroll, while admins
+// require it, to the enrollment, profile and session endpoints. It runs in
+// authenticate once the role is loaded.
+func enforceTwoFactor(w http.ResponseWriter, r *http.Request, info *AuthInfo) bool {
+	// Tokens not issued at sign-in here, such as Supabase's, never passed
+	// the login challenge, so accounts with two-factor authentication only
+	// accept them with proof of a second factor
+	if info.SessionID == "" && !info.SecondFactor {
+		enabled, err := twoFactorEnabled(info.UserID)
+		if err != nil {
+			fmt.Printf("Error checking two-factor authentication: %v\n", err)
+			sendError(w, http.StatusInternalServerError, "Server error", "Unable to check two-factor authentication")
+			return false
+		}
+		if enabled {
+			sendError(w, http.StatusUnauthorized, "Two-factor authentication required", "This account uses two-factor authentication; sign in through /api/login")
+			return false
+		}
+	}
+
+	for _, path := range twoFactorExemptPaths {
+		if r.URL.Path == path || strings.HasPrefix(r.URL.Path, path+"/") {
+			return true
+		}
+	}
+
+	required, err := twoFactorSetupRequired(info.UserID, info.Role)
+	if err != nil {
+		fmt.Printf("Error checking two-factor enrollment: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to check two-factor authentication")
+		return false
+	}
+	if required {
+		sendError(w, http.StatusForbidden, "Two-factor authentication required", "Organizer accounts must set up two-factor authentication at /api/2fa/enroll before continuing")
+		return false
+	}
+
+	return true
+}
+
+// =====================================================
+// Two-Factor Handlers
+// =====================================================
+
+// handleLoginTwoFactor finishes a login that handleLogin answered with a
+// challenge token, by checking the code from the authenticator app or a
+// recovery code
+func handleLoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "Only POST method is allowed")
+		return
+	}
+
+	var req LoginTwoFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, "Invalid request", "Invalid JSON format")
+		return
+	}
+
+	if req.ChallengeToken == "" || (req.Code == "" && req.RecoveryCode == "") {
+		sendError(w, http.StatusBadRequest, "Missing fields", "challenge_token and code or recovery_code are required")
+		return
+	}
+
+	claims, err := jwtIssuer.VerifyAudience(req.ChallengeToken, twoFactorAudience())
+	if err != nil {
+		sendError(w, http.StatusUnauthorized, "Unauthorized", "Sign-in challenge is invalid or has expired; sign in again")
+		return
+	}
+
+	twoFactor, err := twoFactorStore.GetTwoFactor(claims.Subject)
+	if err != nil {
+		fmt.Printf("Error fetching two-factor settings: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to verify code")
+		return
+	}
+	if twoFactor == nil || !twoFactor.Enabled {
+		sendError(w, http.StatusUnauthorized, "Unauthorized", "Sign-in challenge is invalid or has expired; sign in again")
+		return
+	}
+
+	user, err := userStore.GetUserByID(claims.Subject)
+	if err != nil {
+		fmt.Printf("Error fetching user: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to sign in")
+		return
+	}
+
+	// Wrong codes count as failed logins, like wrong passwords
+	attempt, ok := beginLoginAttempt(w, user.Email, getClientIP(r))
+	if !ok {
+		return
+	}
+
+	ok, err = verifySecondFactor(twoFactor, req.Code, req.RecoveryCode)
+	if err != nil {
+		attempt.release()
+		fmt.Printf("Error verifying two-factor code: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to verify code")
+		return
+	}
+	if !ok {
+		attempt.failed()
+		sendError(w, http.StatusUnauthorized, "Invalid code", "The two-factor code is incorrect or was already used")
+		return
+	}
+	attempt.release()
+	clearLoginFailures(user.Email)
+
+	response, err := startSession(r, user)
+	if err != nil {
+		fmt.Printf("Error starting session: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Token error", "Failed to generate authentication token")
+		return
+	}
+
+	if req.Code == "" {
+		remaining, err := twoFactorStore.CountRecoveryCodes(user.ID)
+		if err != nil {
+			fmt.Printf("Error counting recovery codes: %v\n", err)
+		}
+		fmt.Printf("User %s signed in with a recovery code, %d left\n", user.ID, remaining)
+		response["recovery_codes_remaining"] = remaining
+	}
+
+	response["user"] = user
+	response["message"] = "Login successful"
+	sendJSON(w, http.StatusOK, response)
+}
+
+// beginCodeAttempt counts a signed-in user's two-factor code check against
+// their account's failed-login counter, like a code given at sign-in, so a
+// stolen session cannot guess codes any faster
+func beginCodeAttempt(w http.ResponseWriter, r *http.Request, userID string) (*loginAttempt, bool) {
+	user, err := userStore.GetUserByID(userID)
+	if err != nil {
+		fmt.Printf("Error fetching user: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to verify code")
+		return nil, false
+	}
+
+	return beginLoginAttempt(w, user.Email, getClientIP(r))
+}
+
+// handleTwoFactor serves /api/2fa, where users see whether two-factor
+// authentication is on and turn it off
+func handleTwoFactor(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		handleGetTwoFactor(w, r)
+	case http.MethodDelete:
+		handleDisableTwoFactor(w, r)
+	default:
+		sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "Only GET and DELETE methods are allowed")
+	}
+}
+
+func handleGetTwoFactor(w http.ResponseWriter, r *http.Request) {
+	auth := authFromRequest(r)
+
+	twoFactor, err := twoFactorStore.GetTwoFactor(auth.UserID)
+	if err != nil {
+		fmt.Printf("Error fetching two-factor settings: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to fetch two-factor settings")
+		return
+	}
+
+	enabled := twoFactor != nil && twoFactor.Enabled
+	response := map[string]interface{}{
+		"enabled":  enabled,
+		"required": auth.Role == roleOrganizer && organizerTwoFactorPolicy.Required(),
+	}
+
+	if enabled {
+		remaining, err := twoFactorStore.CountRecoveryCodes(auth.UserID)
+		if err != nil {
+			fmt.Printf("Error counting recovery codes: %v\n", err)
+			sendError(w, http.StatusInternalServerError, "Server error", "Unable to fetch two-factor settings")
+			return
+		}
+		response["enabled_at"] = twoFactor.EnabledAt
+		response["recovery_codes_remaining"] = remaining
+	}
+
+	sendJSON(w, http.StatusOK, response)
+}
+
+func handleDisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	auth := authFromRequest(r)
+
+	var req TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, "Invalid request", "Invalid JSON format")
+		return
+	}
+
+	if req.Code == "" && req.RecoveryCode == "" {
+		sendError(w, http.StatusBadRequest, "Missing fields", "code or recovery_code is required")
+		return
+	}
+
+	if auth.Role == roleOrganizer && organizerTwoFactorPolicy.Required() {
+		sendError(w, http.StatusForbidden, "Forbidden", "Two-factor authentication is required for organizer accounts")
+		return
+	}
+
+	twoFactor, err := twoFactorStore.GetTwoFactor(auth.UserID)
+	if err != nil {
+		fmt.Printf("Error fetching two-factor settings: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to disable two-factor authentication")
+		return
+	}
+	if twoFactor == nil || !twoFactor.Enabled {
+		sendError(w, http.StatusNotFound, "Not found", "Two-factor authentication is not enabled")
+		return
+	}
+
+	attempt, ok := beginCodeAttempt(w, r, auth.UserID)
+	if !ok {
+		return
+	}
+
+	ok, err = verifySecondFactor(twoFactor, req.Code, req.RecoveryCode)
+	if err != nil {
+		attempt.release()
+		fmt.Printf("Error verifying two-factor code: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to verify code")
+		return
+	}
+	if !ok {
+		attempt.failed()
+		sendError(w, http.StatusUnauthorized, "Invalid code", "The two-factor code is incorrect or was already used")
+		return
+	}
+	attempt.release()
+
+	if err := twoFactorStore.DeleteTwoFactor(auth.UserID); err != nil {
+		fmt.Printf("Error disabling two-factor authentication: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to disable two-factor authentication")
+		return
+	}
+
+	fmt.Printf("User %s disabled two-factor authentication\n", auth.UserID)
+
+	sendJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+// handleTwoFactorEnroll starts enrollment with a new secret and recovery
+// codes. Nothing changes at login until the first code is confirmed.
+func handleTwoFactorEnroll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "Only POST method is allowed")
+		return
+	}
+
+	auth := authFromRequest(r)
+
+	enabled, err := twoFactorEnabled(auth.UserID)
+	if err != nil {
+		fmt.Printf("Error fetching two-factor settings: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to start enrollment")
+		return
+	}
+	if enabled {
+		sendError(w, http.StatusConflict, "Already enabled", "Two-factor authentication is already enabled; disable it before enrolling a new device")
+		return
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		sendError(w, http.StatusInternalServerError, "Server error", "Failed to generate secret")
+		return
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		sendError(w, http.StatusInternalServerError, "Server error", "Failed to generate recovery codes")
+		return
+	}
+
+	if err := twoFactorStore.SaveTwoFactorEnrollment(auth.UserID, secret, hashes); err != nil {
+		fmt.Printf("Error saving two-factor enrollment: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to start enrollment")
+		return
+	}
+
+	// Authenticator apps show the account name next to the codes
+	account := auth.UserID
+	if user, err := userStore.GetUserByID(auth.UserID); err == nil && user.Email != "" {
+		account = user.Email
+	}
+
+	sendJSON(w, http.StatusOK, map[string]interface{}{
+		"secret":         secret,
+		"otpauth_uri":    otpauthURI(secret, account),
+		"recovery_codes": codes,
+		"message":        "Scan the URI with an authenticator app, then confirm a code at /api/2fa/confirm. Store the recovery codes somewhere safe; they are shown only once.",
+	})
+}
+
+// handleTwoFactorConfirm turns two-factor authentication on once the user
+// shows their authenticator app produces the right codes
+func handleTwoFactorConfirm(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "Only POST method is allowed")
+		return
+	}
+
+	auth := authFromRequest(r)
+
+	var req TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, "Invalid request", "Invalid JSON format")
+		return
+	}
+
+	if req.Code == "" {
+		sendError(w, http.StatusBadRequest, "Missing fields", "code is required")
+		return
+	}
+
+	twoFactor, err := twoFactorStore.GetTwoFactor(auth.UserID)
+	if err != nil {
+		fmt.Printf("Error fetching two-factor settings: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to confirm enrollment")
+		return
+	}
+	if twoFactor == nil {
+		sendError(w, http.StatusNotFound, "Not found", "Start enrollment at /api/2fa/enroll first")
+		return
+	}
+	if twoFactor.Enabled {
+		sendError(w, http.StatusConflict, "Already enabled", "Two-factor authentication is already enabled")
+		return
+	}
+
+	attempt, ok := beginCodeAttempt(w, r, auth.UserID)
+	if !ok {
+		return
+	}
+
+	ok, err = verifySecondFactor(twoFactor, req.Code, "")
+	if err != nil {
+		attempt.release()
+		fmt.Printf("Error verifying two-factor code: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to verify code")
+		return
+	}
+	if !ok {
+		attempt.failed()
+		sendError(w, http.StatusBadRequest, "Invalid code", "The code does not match; check the time on your device and try again")
+		return
+	}
+	attempt.release()
+
+	err = twoFactorStore.EnableTwoFactor(auth.UserID)
+	if err == errNoTwoFactor {
+		sendError(w, http.StatusConflict, "Conflict", "Enrollment changed; start again at /api/2fa/enroll")
+		return
+	}
+	if err != nil {
+		fmt.Printf("Error enabling two-factor authentication: %v\n", err)
+		sendError(w, http.StatusInternalServerError, "Server error", "Unable to confirm enrollment")
+		return
+	}
+
+	fmt.Printf("User %s enabled two-factor authentication\n", auth.UserID)
+
+	sendJSON(w, http.StatusOK, map[string]interface{}{
+		"enabled": true,
+		"message": "Two-factor authentication enabled",
+	})
+}
+
+// handleTwoFactorPolicy serves /api/admin/settings/two-factor, where admins
+// require two-factor authentication for every organizer account
+func handleTwoFactorPolicy(w http.ResponseWriter, r *http.Request) {
+	auth := authFromRequest(r)
+
+	switch r.Method {
+	case http.MethodGet:
+		required, err := twoFactorStore.GetOrganizerTwoFactorPolicy()
+		if err != nil {
+			fmt.Printf("Error loading two-factor policy: %v\n", err)
+			sendError(w, http.StatusInternalServerError, "Server error", "Unable to load two-factor policy")
+			return
+		}
+
+		sendJSON(w, http.StatusOK, map[string]interface{}{
+			"require_for_organizers": required,
+		})
+	case http.MethodPut:
+		var req TwoFactorPolicyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			sendError(w, http.StatusBadRequest, "Invalid request", "Invalid JSON format")
+			return
+		}
+
+		if req.RequireForOrganizers == nil {
+			sendError(w, http.StatusBadRequest, "Validation error", "require_for_organizers is required")
+			return
+		}
+
+		if err := twoFactorStore.SetOrganizerTwoFactorPolicy(*req.RequireForOrganizers, auth.UserID); err != nil {
+			fmt.Printf("Error saving two-factor policy: %v\n", err)
+			sendError(w, http.StatusInternalServerError, "Server error", "Unable to save two-factor policy")
+			return
+		}
+		organizerTwoFactorPolicy.Set(*req.RequireForOrganizers)
+
+		fmt.Printf("Admin %s set organizer two-factor requirement to %t\n", auth.UserID, *req.RequireForOrganizers)
+
+		sendJSON(w, http.StatusOK, map[string]interface{}{
+			"require_for_organizers": *req.RequireForOrganizers,
+			"message":                "Two-factor policy updated",
+		})
+	default:
+		sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "Only GET and PUT methods are allowed")
+	}
+}
+
+// =====================================================
+// Supabase Two-Factor Functions
+// =====================================================
+
+// GetTwoFactor returns an account's TOTP settings, or nil if it has none
+func (c *SupabaseClient) GetTwoFactor(userID string) (*TwoFactor, error) {
+	var settings []TwoFactor
+	if err := c.doREST("GET", fmt.Sprintf("/rest/v1/user_two_factor?user_id=eq.%s", userID), "", nil, &settings); err != nil {
+		return nil, err
+	}
+
+	if len(settings) == 0 {
+		return nil, nil
+	}
+
+	return &settings[0], nil
+}
+
+// SaveTwoFactorEnrollment replaces a pending enrollment's secret and
+// recovery codes
+func (c *SupabaseClient) SaveTwoFactorEnrollment(userID, secret string, recoveryHashes []string) error {
+	payload := map[string]interface{}{
+		"secret":         secret,
+		"enabled":        false,
+		"enabled_at":     nil,
+		"last_used_step": nil,
+		"created_at":     nowTimestamp(),
+	}
+
+	var saved []TwoFactor
+	path := fmt.Sprintf("/rest/v1/user_two_factor?user_id=eq.%s&enabled=is.false", userID)
+	if err := c.doREST("PATCH", path, "", payload, &saved); err != nil {
+		return err
+	}
+
+	if len(saved) == 0 {
+		payload["user_id"] = userID
+		if err := c.doREST("POST", "/rest/v1/user_two_factor", "", payload, nil); err != nil {
+			return err
+		}
+	}
+
+	if err := c.doREST("DELETE", fmt.Sprintf("/rest/v1/two_factor_recovery_codes?user_id=eq.%s", userID), "", nil, nil); err != nil {
+		return err
+	}
+
+	codes := make([]map[string]interface{}, 0, len(recoveryHashes))
+	for _, hash := range recoveryHashes {
+		codes = append(codes, map[string]interface{}{"user_id": userID, "code_hash": hash})
+	}
+	return c.doREST("POST", "/rest/v1/two_factor_recovery_codes", "", codes, nil)
+}
+
+// EnableTwoFactor turns on a pending enrollment
+func (c *SupabaseClient) EnableTwoFactor(userID string) error {
+	var enabled []TwoFactor
+	path := fmt.Sprintf("/rest/v1/user_two_factor?user_id=eq.%s&enabled=is.false", userID)
+	payload := map[string]interface{}{"enabled": true, "enabled_at": nowTimestamp()}
+	if err := c.doREST("PATCH", path, "", payload, &enabled); err != nil {
+		return err
+	}
+
+	if len(enabled) == 0 {
+		return errNoTwoFactor
+	}
+
+	return nil
+}
+
+// DeleteTwoFactor turns two-factor authentication off and drops the
+// recovery codes
+func (c *SupabaseClient) DeleteTwoFactor(userID string) error {
+	if err := c.doREST("DELETE", fmt.Sprintf("/rest/v1/two_factor_recovery_codes?user_id=eq.%s", userID), "", nil, nil); err != nil {
+		return err
+	}
+	return c.doREST("DELETE", fmt.Sprintf("/rest/v1/user_two_factor?user_id=eq.%s", userID), "", nil, nil)
+}
+
+// UseTwoFactorStep records a code's time step, reporting false if that
+// step or a later one was already used
+func (c *SupabaseClient) UseTwoFactorStep(userID string, step int64) (bool, error) {
+	var used []TwoFactor
+	path := fmt.Sprintf("/rest/v1/user_two_factor?user_id=eq.%s&or=(last_used_step.is.null,last_used_step.lt.%d)", userID, step)
+	if err := c.doREST("PATCH", path, "", map[string]interface{}{"last_used_step": step}, &used); err != nil {
+		return false, err
+	}
+
+	return len(used) > 0, nil
+}
+
+// UseRecoveryCode uses up a recovery code, reporting false if it is
+// unknown or was already used
+func (c *SupabaseClient) UseRecoveryCode(userID, codeHash string) (bool, error) {
+	var used []map[string]interface{}
+	path := fmt.Sprintf("/rest/v1/two_factor_recovery_codes?user_id=eq.%s&code_hash=eq.%s&used_at=is.null", userID, codeHash)
+	if err := c.doREST("PATCH", path, "", map[string]interface{}{"used_at": nowTimestamp()}, &used); err != nil {
+		return false, err
+	}
+
+	return len(used) > 0, nil
+}
+
+// CountRecoveryCodes returns how many recovery codes an account has left
+func (c *SupabaseClient) CountRecoveryCodes(userID string) (int, error) {
+	var codes []map[string]interface{}
+	path := fmt.Sprintf("/rest/v1/two_factor_recovery_codes?user_id=eq.%s&used_at=is.null&select=code_hash", userID)
+	if err := c.doREST("GET", path, "", nil, &codes); err != nil {
+		return 0, err
+	}
+
+	return len(codes), nil
+}
+
+// GetOrganizerTwoFactorPolicy reports whether admins require two-factor
+// authentication for organizers
+func (c *SupabaseClient) GetOrganizerTwoFactorPolicy() (bool, error) {
+	var settings []struct {
+		Value bool `json:"value"`
+	}
+	path := fmt.Sprintf("/rest/v1/platform_settings?key=eq.%s&select=value", settingRequireOrganizerTwoFactor)
+	if err := c.doREST("GET", path, "", nil, &settings); err != nil {
+		return false, err
+	}
+
+	return len(settings) > 0 && settings[0].Value, nil
+}
+
+// SetOrganizerTwoFactorPolicy saves whether organizers must use two-factor
+// authentication
+func (c *SupabaseClient) SetOrganizerTwoFactorPolicy(required bool, adminID string) error {
+	payload := map[string]interface{}{
+		"value":      required,
+		"updated_by": adminID,
+		"updated_at": nowTimestamp(),
+	}
+
+	var saved []map[string]interface{}
+	path := fmt.Sprintf("/rest/v1/platform_settings?key=eq.%s", settingRequireOrganizerTwoFactor)
+	if err := c.doREST("PATCH", path, "", payload, &saved); err != nil {
+		return err
+	}
+
+	if len(saved) == 0 {
+		payload["key"] = settingRequireOrganizerTwoFactor
+		return c.doREST("POST", "/rest/v1/platform_settings", "", payload, nil)
+	}
+
+	return nil
+}
+
+// =====================================================
+// In-memory Two-Factor Functions
+// =====================================================
+
+// GetTwoFactor returns an account's TOTP settings, or nil if it has none
+func (m *MemoryStore) GetTwoFactor(userID string) (*TwoFactor, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	twoFactor, exists := m.twoFactors[userID]
+	if !exists {
+		return nil, nil
+	}
+
+	found := *twoFactor
+	return &found, nil
+}
+
+// SaveTwoFactorEnrollment replaces a pending enrollment's secret and
+// recovery codes
+func (m *MemoryStore) SaveTwoFactorEnrollment(userID, secret string, recoveryHashes []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if existing, exists := m.twoFactors[userID]; exists && existing.Enabled {
+		return fmt.Errorf("two-factor authentication is already enabled")
+	}
+
+	m.twoFactors[userID] = &TwoFactor{UserID: userID, Secret: secret, CreatedAt: nowTimestamp()}
+
+	codes := make(map[string]bool, len(recoveryHashes))
+	for _, hash := range recoveryHashes {
+		codes[hash] = false
+	}
+	m.recoveryCodes[userID] = codes
+
+	return nil
+}
+
+// EnableTwoFactor turns on a pending enrollment
+func (m *MemoryStore) EnableTwoFactor(userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	twoFactor, exists := m.twoFactors[userID]
+	if !exists || twoFactor.Enabled {
+		return errNoTwoFactor
+	}
+
+	twoFactor.Enabled = true
+	twoFactor.EnabledAt = nowTimestamp()
+	return nil
+}
+
+// DeleteTwoFactor turns two-factor authentication off and drops the
+// recovery codes
+func (m *MemoryStore) DeleteTwoFactor(userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.twoFactors, userID)
+	delete(m.recoveryCodes, userID)
+	return nil
+}
+
+// UseTwoFactorStep records a code's time step, reporting false if that
+// step or a later one was already used
+func (m *MemoryStore) UseTwoFactorStep(userID string, step int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	twoFactor, exists := m.twoFactors[userID]
+	if !exists || step <= twoFactor.LastUsedStep {
+		return false, nil
+	}
+
+	twoFactor.LastUsedStep = step
+	return true, nil
+}
+
+// UseRecoveryCode uses up a recovery code, reporting false if it is
+// unknown or was already used
+func (m *MemoryStore) UseRecoveryCode(userID, codeHash string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	used, exists := m.recoveryCodes[userID][codeHash]
+	if !exists || used {
+		return false, nil
+	}
+
+	m.recoveryCodes[userID][codeHash] = true
+	return true, nil
+}
+
+// CountRecoveryCodes returns how many recovery codes an account has left
+func (m *MemoryStore) CountRecoveryCodes(userID string) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	remaining := 0
+	for _, used := range m.recoveryCodes[userID] {
+		if !used {
+			remaining++
+		}
+	}
+
+	return remaining, nil
+}
+
+// GetOrganizerTwoFactorPolicy reports whether admins require two-factor
+// authentication for organizers
+func (m *MemoryStore) GetOrganizerTwoFactorPolicy() (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.requireOrganizerTwoFactor, nil
+}
+
+// SetOrganizerTwoFactorPolicy saves whether organizers must use two-factor
+// authentication
+func (m *MemoryStore) SetOrganizerTwoFactorPolicy(required bool, adminID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requireOrganizerTwoFactor = required
+	return nil
+}
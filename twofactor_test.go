@@ -0,0 +1,360 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// totpAt returns the code for the time step offset steps from now
+func totpAt(t *testing.T, secret string, offset int64) string {
+	t.Helper()
+
+	key, err := twoFactorBase32.DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return totpCode(key, time.Now().Unix()/totpPeriod+offset)
+}
+
+// loginChallenge signs in to an account with two-factor authentication and
+// returns the challenge token for the code step
+func loginChallenge(t *testing.T, email string) string {
+	t.Helper()
+
+	rec := login(email, testPassword)
+	expectStatus(t, rec, http.StatusOK)
+
+	var resp struct {
+		TwoFactorRequired bool   `json:"two_factor_required"`
+		ChallengeToken    string `json:"challenge_token"`
+	}
+	decodeBody(t, rec, &resp)
+	if !resp.TwoFactorRequired || resp.ChallengeToken == "" {
+		t.Fatalf("expected a two-factor challenge, got %s", rec.Body.String())
+	}
+	return resp.ChallengeToken
+}
+
+// loginSecondFactor finishes a challenged sign-in
+func loginSecondFactor(challenge, code, recoveryCode string) *httptest.ResponseRecorder {
+	return servePublic(handleLoginTwoFactor, http.MethodPost, "/api/login/2fa", LoginTwoFactorRequest{ChallengeToken: challenge, Code: code, RecoveryCode: recoveryCode})
+}
+
+// forgetLoginFailures resets the failure counters that deliberate wrong
+// codes leave on an account and the test client's address, standing in for
+// waiting out the backoff
+func forgetLoginFailures(t *testing.T, email string) {
+	t.Helper()
+
+	for _, key := range []string{accountThrottleKey(email), ipThrottleKey("192.0.2.1")} {
+		if _, err := loginThrottleStore.ClearLoginThrottle(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// enrollTwoFactor turns on two-factor authentication for the holder of
+// token, returning the secret and recovery codes
+func enrollTwoFactor(t *testing.T, token string) (string, []string) {
+	t.Helper()
+
+	rec := serveAuthenticated(handleTwoFactorEnroll, http.MethodPost, "/api/2fa/enroll", token, nil)
+	expectStatus(t, rec, http.StatusOK)
+
+	var resp struct {
+		Secret        string   `json:"secret"`
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	decodeBody(t, rec, &resp)
+
+	rec = serveAuthenticated(handleTwoFactorConfirm, http.MethodPost, "/api/2fa/confirm", token, TwoFactorCodeRequest{Code: totpAt(t, resp.Secret, 0)})
+	expectStatus(t, rec, http.StatusOK)
+
+	return resp.Secret, resp.RecoveryCodes
+}
+
+func TestTOTPVectors(t *testing.T) {
+	// RFC 6238 appendix B, SHA-1; six-digit codes are the last six digits
+	key := []byte("12345678901234567890")
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, v := range vectors {
+		if code := totpCode(key, v.unix/totpPeriod); code != v.code {
+			t.Errorf("T=%d: expected %s, got %s", v.unix, v.code, code)
+		}
+	}
+
+	secret := twoFactorBase32.EncodeToString(key)
+	now := time.Unix(1111111111, 0)
+	matches := []struct {
+		name  string
+		code  string
+		step  int64
+		match bool
+	}{
+		{"current step", "050471", 37037037, true},
+		{"previous step, allowing for drift", "081804", 37037036, true},
+		{"spaces are ignored", "050 471", 37037037, true},
+		{"two steps old", totpCode(key, 37037035), 0, false},
+		{"two steps ahead", totpCode(key, 37037039), 0, false},
+		{"wrong length", "05047", 0, false},
+	}
+	for _, tt := range matches {
+		step, ok := matchTOTP(secret, tt.code, now)
+		if ok != tt.match || step != tt.step {
+			t.Errorf("%s: expected step %d match=%v, got %d %v", tt.name, tt.step, tt.match, step, ok)
+		}
+	}
+	if _, ok := matchTOTP("not base32!", "050471", now); ok {
+		t.Fatal("expected a malformed secret never to match")
+	}
+}
+
+func TestOTPAuthURI(t *testing.T) {
+	uri, err := url.Parse(otpauthURI("JBSWY3DPEHPK3PXP", "ada@example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := uri.Query()
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/GoTicket:ada@example.com" {
+		t.Fatalf("unexpected URI %s", uri)
+	}
+	if query.Get("secret") != "JBSWY3DPEHPK3PXP" || query.Get("issuer") != "GoTicket" || query.Get("digits") != "6" || query.Get("period") != "30" {
+		t.Fatalf("unexpected parameters %v", query)
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil || len(codes) != recoveryCodeCount || len(hashes) != recoveryCodeCount {
+		t.Fatalf("expected %d recovery codes, got %v (%v)", recoveryCodeCount, codes, err)
+	}
+	typed := strings.ToUpper(strings.ReplaceAll(codes[0], "-", " "))
+	if hashRecoveryCode(typed) != hashes[0] {
+		t.Fatalf("expected %q to match the recovery code %q", typed, codes[0])
+	}
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	store := newTestStore(t)
+	_, memoryToken := newTestUser(t, store, "secure@example.com", roleAttendee)
+
+	session := signIn(t, "secure@example.com", "curl/8.5.0")
+
+	t.Run("a pending enrollment changes nothing", func(t *testing.T) {
+		rec := serveAuthenticated(handleTwoFactorEnroll, http.MethodPost, "/api/2fa/enroll", session.Token, nil)
+		expectStatus(t, rec, http.StatusOK)
+
+		rec = serveAuthenticated(handleTwoFactorConfirm, http.MethodPost, "/api/2fa/confirm", session.Token, TwoFactorCodeRequest{Code: "000000"})
+		expectStatus(t, rec, http.StatusBadRequest)
+
+		signIn(t, "secure@example.com", "curl/8.5.0")
+	})
+
+	secret, recoveryCodes := enrollTwoFactor(t, session.Token)
+
+	t.Run("enrolling twice", func(t *testing.T) {
+		rec := serveAuthenticated(handleTwoFactorEnroll, http.MethodPost, "/api/2fa/enroll", session.Token, nil)
+		expectStatus(t, rec, http.StatusConflict)
+	})
+
+	t.Run("codes work once", func(t *testing.T) {
+		challenge := loginChallenge(t, "secure@example.com")
+
+		// The code that confirmed enrollment was used up then
+		expectStatus(t, loginSecondFactor(challenge, totpAt(t, secret, 0), ""), http.StatusUnauthorized)
+		expectStatus(t, loginSecondFactor(challenge, "12345", ""), http.StatusUnauthorized)
+
+		// Wrong codes count as failed logins
+		expectStatus(t, loginSecondFactor(challenge, totpAt(t, secret, 1), ""), http.StatusTooManyRequests)
+		forgetLoginFailures(t, "secure@example.com")
+
+		next := totpAt(t, secret, 1)
+		expectStatus(t, loginSecondFactor(challenge, next, ""), http.StatusOK)
+		expectStatus(t, loginSecondFactor(challenge, next, ""), http.StatusUnauthorized)
+
+		// An older step is no good once a later one was used
+		expectStatus(t, loginSecondFactor(challenge, totpAt(t, secret, 0), ""), http.StatusUnauthorized)
+		forgetLoginFailures(t, "secure@example.com")
+	})
+
+	t.Run("recovery codes work once", func(t *testing.T) {
+		challenge := loginChallenge(t, "secure@example.com")
+		typed := strings.ToUpper(strings.ReplaceAll(recoveryCodes[0], "-", ""))
+
+		rec := loginSecondFactor(challenge, "", typed)
+		expectStatus(t, rec, http.StatusOK)
+		var resp struct {
+			Remaining int `json:"recovery_codes_remaining"`
+		}
+		decodeBody(t, rec, &resp)
+		if resp.Remaining != recoveryCodeCount-1 {
+			t.Fatalf("expected %d recovery codes left, got %d", recoveryCodeCount-1, resp.Remaining)
+		}
+
+		expectStatus(t, loginSecondFactor(challenge, "", recoveryCodes[0]), http.StatusUnauthorized)
+		forgetLoginFailures(t, "secure@example.com")
+	})
+
+	t.Run("challenges are not access tokens", func(t *testing.T) {
+		challenge := loginChallenge(t, "secure@example.com")
+		if profileStatus(challenge) != http.StatusUnauthorized {
+			t.Fatal("expected a challenge token to be refused as an access token")
+		}
+		expectStatus(t, loginSecondFactor(session.Token, totpAt(t, secret, 1), ""), http.StatusUnauthorized)
+	})
+
+	t.Run("tokens from outside a session need a second factor", func(t *testing.T) {
+		if profileStatus(memoryToken) != http.StatusUnauthorized {
+			t.Fatal("expected a token that skipped the challenge to be refused")
+		}
+		if profileStatus(session.Token) != http.StatusOK {
+			t.Fatal("expected a session started before enrollment to keep working")
+		}
+	})
+
+	t.Run("disabling", func(t *testing.T) {
+		rec := serveAuthenticated(handleTwoFactor, http.MethodDelete, "/api/2fa", session.Token, TwoFactorCodeRequest{RecoveryCode: recoveryCodes[0]})
+		expectStatus(t, rec, http.StatusUnauthorized)
+
+		rec = serveAuthenticated(handleTwoFactor, http.MethodDelete, "/api/2fa", session.Token, TwoFactorCodeRequest{RecoveryCode: recoveryCodes[1]})
+		expectStatus(t, rec, http.StatusOK)
+
+		if profileStatus(memoryToken) != http.StatusOK {
+			t.Fatal("expected the token to work again without two-factor authentication")
+		}
+		signIn(t, "secure@example.com", "curl/8.5.0")
+	})
+}
+
+func TestTwoFactorCodeChecksAreThrottled(t *testing.T) {
+	store := newTestStore(t)
+	userID, _ := newTestUser(t, store, "secure@example.com", roleAttendee)
+	session := signIn(t, "secure@example.com", "curl/8.5.0")
+
+	// guessUntilLocked sends wrong codes until the account is throttled
+	guessUntilLocked := func(t *testing.T, guess func() int, wrong int) {
+		t.Helper()
+		for i := 0; i < loginLockout.AccountThreshold; i++ {
+			switch status := guess(); status {
+			case wrong:
+			case http.StatusTooManyRequests:
+				return
+			default:
+				t.Fatalf("expected %d or 429, got %d", wrong, status)
+			}
+		}
+		t.Fatal("expected wrong codes to be throttled")
+	}
+
+	t.Run("confirming enrollment", func(t *testing.T) {
+		rec := serveAuthenticated(handleTwoFactorEnroll, http.MethodPost, "/api/2fa/enroll", session.Token, nil)
+		expectStatus(t, rec, http.StatusOK)
+		var resp struct {
+			Secret string `json:"secret"`
+		}
+		decodeBody(t, rec, &resp)
+
+		confirm := func(code string) int {
+			return serveAuthenticated(handleTwoFactorConfirm, http.MethodPost, "/api/2fa/confirm", session.Token, TwoFactorCodeRequest{Code: code}).Code
+		}
+		guessUntilLocked(t, func() int { return confirm("000000") }, http.StatusBadRequest)
+
+		// Even the right code waits out the throttle
+		expectStatus(t, serveAuthenticated(handleTwoFactorConfirm, http.MethodPost, "/api/2fa/confirm", session.Token, TwoFactorCodeRequest{Code: totpAt(t, resp.Secret, 0)}), http.StatusTooManyRequests)
+		forgetLoginFailures(t, "secure@example.com")
+		if status := confirm(totpAt(t, resp.Secret, 0)); status != http.StatusOK {
+			t.Fatalf("expected the right code to confirm, got %d", status)
+		}
+	})
+
+	t.Run("disabling", func(t *testing.T) {
+		disable := func(code string) int {
+			return serveAuthenticated(handleTwoFactor, http.MethodDelete, "/api/2fa", session.Token, TwoFactorCodeRequest{Code: code}).Code
+		}
+		guessUntilLocked(t, func() int { return disable("000000") }, http.StatusUnauthorized)
+
+		// The guesses count against signing in too
+		rec := servePublic(handleLogin, http.MethodPost, "/api/login", map[string]string{"email": "secure@example.com", "password": testPassword})
+		expectStatus(t, rec, http.StatusTooManyRequests)
+
+		if enabled, _ := twoFactorEnabled(userID); !enabled {
+			t.Fatal("expected two-factor authentication to stay on")
+		}
+	})
+}
+
+func TestTwoFactorSupabaseTokens(t *testing.T) {
+	store := newTestStore(t)
+	if err := store.SaveTwoFactorEnrollment("supabase-user", "JBSWY3DPEHPK3PXP", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.EnableTwoFactor("supabase-user"); err != nil {
+		t.Fatal(err)
+	}
+
+	secret := []byte("project-jwt-secret")
+	previousVerifier := supabaseVerifier
+	t.Cleanup(func() { supabaseVerifier = previousVerifier })
+	supabaseVerifier = NewSupabaseTokenVerifier(testSupabaseIssuer, "authenticated", secret, "", 0)
+
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		sendJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	}
+
+	claims := supabaseTestClaims()
+	rec := serveAuthenticated(ok, http.MethodGet, "/api/registrations", signSupabaseToken(t, "", secret, claims), nil)
+	expectStatus(t, rec, http.StatusUnauthorized)
+
+	claims["aal"] = "aal2"
+	rec = serveAuthenticated(ok, http.MethodGet, "/api/registrations", signSupabaseToken(t, "", secret, claims), nil)
+	expectStatus(t, rec, http.StatusOK)
+}
+
+func TestOrganizerTwoFactorPolicy(t *testing.T) {
+	store := newTestStore(t)
+	_, adminToken := newTestUser(t, store, "admin@example.com", roleAdmin)
+	_, attendeeToken := newTestUser(t, store, "attendee@example.com", roleAttendee)
+	newTestUser(t, store, "organizer@example.com", roleOrganizer)
+	organizer := signIn(t, "organizer@example.com", "curl/8.5.0")
+
+	policy := requirePermission(permManageSecurity, handleTwoFactorPolicy)
+	balance := requirePermission(permOrganizerTools, handleOrganizerBalance)
+	required := true
+
+	expectStatus(t, serveAuthenticated(policy, http.MethodPut, "/api/admin/settings/two-factor", organizer.Token, TwoFactorPolicyRequest{RequireForOrganizers: &required}), http.StatusForbidden)
+	expectStatus(t, serveAuthenticated(policy, http.MethodPut, "/api/admin/settings/two-factor", adminToken, TwoFactorPolicyRequest{RequireForOrganizers: &required}), http.StatusOK)
+
+	// Organizers are held to enrollment; other accounts are not
+	expectStatus(t, serveAuthenticated(balance, http.MethodGet, "/api/organizer/balance", organizer.Token, nil), http.StatusForbidden)
+	expectStatus(t, serveAuthenticated(handleProfile, http.MethodGet, "/api/profile", organizer.Token, nil), http.StatusOK)
+	expectStatus(t, serveAuthenticated(handleRegistrations, http.MethodGet, "/api/registrations", attendeeToken, nil), http.StatusOK)
+
+	rec := login("organizer@example.com", testPassword)
+	expectStatus(t, rec, http.StatusOK)
+	var resp struct {
+		SetupRequired bool `json:"two_factor_setup_required"`
+	}
+	decodeBody(t, rec, &resp)
+	if !resp.SetupRequired {
+		t.Fatal("expected the login to ask for enrollment")
+	}
+
+	secret, _ := enrollTwoFactor(t, organizer.Token)
+	expectStatus(t, serveAuthenticated(balance, http.MethodGet, "/api/organizer/balance", organizer.Token, nil), http.StatusOK)
+
+	rec = serveAuthenticated(handleTwoFactor, http.MethodDelete, "/api/2fa", organizer.Token, TwoFactorCodeRequest{Code: totpAt(t, secret, 1)})
+	expectStatus(t, rec, http.StatusForbidden)
+}
@@ -0,0 +1,442 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// ReorderWaitlistRequest represents a new waitlist order set by the organizer
+type ReorderWaitlistRequest struct {
+	RegistrationIDs []string `json:"registration_ids"`
+}
+
+// =====================================================
+// Waitlist Handlers
+// =====================================================
+
+func handleEventWaitlist(w http.ResponseWriter, r *http.Request, eventID string) {
+	auth := authFromRequest(r)
+
+	event, err := eventStore.GetEventByID(eventID)
+	if err != nil {
+		sendError(w, http.StatusNotFound, "Not found", "Event not found")
+		return
+	}
+
+	// Every team member may see the waitlist; co-organizers and up reorder it
+	action := eventManage
+	if r.Method == http.MethodGet {
+		action = eventView
+	}
+	if !authorizeEvent(w, auth, event, action, "Only the event organizer can manage the waitlist") {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		waitlist, err := registrationStore.GetWaitlist(eventID)
+		if err != nil {
+			fmt.Printf("Error fetching waitlist: %v\n", err)
+			sendError(w, http.StatusInternalServerError, "Server error", "Unable to fetch waitlist")
+			return
+		}
+
+		sendJSON(w, http.StatusOK, map[string]interface{}{
+			"waitlist": waitlist,
+			"count":    len(waitlist),
+		})
+	case http.MethodPut:
+		var req ReorderWaitlistRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			sendError(w, http.StatusBadRequest, "Invalid request", "Invalid JSON format")
+			return
+		}
+
+		var waitlist []Registration
+		err := reservationLedger.WithEvent(eventID, func() error {
+			current, err := registrationStore.GetWaitlist(eventID)
+			if err != nil {
+				return err
+			}
+			if !sameRegistrationSet(current, req.RegistrationIDs) {
+				return errInvalidWaitlistOrder
+			}
+			if err := registrationStore.ReorderWaitlist(eventID, req.RegistrationIDs); err != nil {
+				return err
+			}
+			waitlist, err = registrationStore.GetWaitlist(eventID)
+			return err
+		})
+		if err == errInvalidWaitlistOrder {
+			sendError(w, http.StatusBadRequest, "Validation error", "registration_ids must list every waitlisted registration exactly once")
+			return
+		}
+		if err != nil {
+			fmt.Printf("Error reordering waitlist: %v\n", err)
+			sendError(w, http.StatusInternalServerError, "Server error", "Unable to reorder waitlist")
+			return
+		}
+
+		sendJSON(w, http.StatusOK, map[string]interface{}{
+			"waitlist": waitlist,
+			"message":  "Waitlist reordered successfully",
+		})
+	default:
+		sendError(w, http.StatusMethodNotAllowed, "Method not allowed", "Only GET and PUT methods are allowed")
+	}
+}
+
+// errInvalidWaitlistOrder is returned when a reorder does not match the current waitlist
+var errInvalidWaitlistOrder = errors.New("waitlist order does not match current waitlist")
+
+// sameRegistrationSet reports whether ids lists every registration exactly once
+func sameRegistrationSet(registrations []Registration, ids []string) bool {
+	if len(registrations) != len(ids) {
+		return false
+	}
+
+	remaining := make(map[string]bool, len(registrations))
+	for _, reg := range registrations {
+		remaining[reg.ID] = true
+	}
+	for _, id := range ids {
+		if !remaining[id] {
+			return false
+		}
+		delete(remaining, id)
+	}
+
+	return true
+}
+
+// promoteFromWaitlist confirms the first waitlisted registration whose
+// seats all fit in the event and its tier, and issues its tickets.
+// Callers must hold the event's reservation lock.
+func promoteFromWaitlist(eventID string) (*Registration, error) {
+	event, err := eventStore.GetEventByID(eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	full, err := eventIsFull(eventID, event.Capacity)
+	if err != nil || full {
+		return nil, err
+	}
+
+	candidateID, err := nextPromotableRegistration(eventID, event.Capacity)
+	if err != nil || candidateID == "" {
+		return nil, err
+	}
+
+	promoted, err := registrationStore.PromoteFromWaitlist(eventID, candidateID)
+	if err != nil || promoted == nil {
+		return nil, err
+	}
+
+	issueTicketsForRegistration(promoted, event)
+	return promoted, nil
+}
+
+// fillFromWaitlist promotes waitlisted registrations until the event is
+// full or the waitlist is exhausted. Callers must hold the event's
+// reservation lock.
+func fillFromWaitlist(eventID string) error {
+	for {
+		promoted, err := promoteFromWaitlist(eventID)
+		if err != nil || promoted == nil {
+			return err
+		}
+		fmt.Printf("Promoted registration %s from waitlist\n", promoted.ID)
+	}
+}
+
+// nextPromotableRegistration returns the first waitlisted registration
+// whose seats fit within the event's capacity and its tier's, or "" if
+// there is none. A group that does not fit is skipped rather than split.
+func nextPromotableRegistration(eventID string, capacity *int) (string, error) {
+	waitlist, err := registrationStore.GetWaitlist(eventID)
+	if err != nil || len(waitlist) == 0 {
+		return "", err
+	}
+
+	taken := 0
+	if capacity != nil {
+		taken, err = registrationStore.GetEventRegistrationCount(eventID)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	tiers, err := tierStore.GetEventTiers(eventID)
+	if err != nil {
+		return "", err
+	}
+
+	sold := map[string]int{}
+	if len(tiers) > 0 {
+		sold, err = tierStore.GetTierSoldCounts(eventID)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	tierCapacities := make(map[string]*int, len(tiers))
+	for _, tier := range tiers {
+		tierCapacities[tier.ID] = tier.Capacity
+	}
+
+	for _, reg := range waitlist {
+		seats := reg.Seats()
+		if capacity != nil && taken+seats > *capacity {
+			continue
+		}
+		if tierCapacity := tierCapacities[reg.TierID]; tierCapacity != nil && sold[reg.TierID]+seats > *tierCapacity {
+			continue
+		}
+		return reg.ID, nil
+	}
+
+	return "", nil
+}
+
+// =====================================================
+// Supabase Waitlist Functions
+// =====================================================
+
+// GetRegistrationByID fetches a single registration
+func (c *SupabaseClient) GetRegistrationByID(token, registrationID string) (*Registration, error) {
+	var registrations []Registration
+	if err := c.doREST("GET", fmt.Sprintf("/rest/v1/registrations?id=eq.%s", registrationID), token, nil, &registrations); err != nil {
+		return nil, err
+	}
+
+	if len(registrations) == 0 {
+		return nil, fmt.Errorf("registration not found")
+	}
+
+	return &registrations[0], nil
+}
+
+// AddToWaitlist inserts a waitlisted registration; the database trigger assigns its position
+func (c *SupabaseClient) AddToWaitlist(token string, registration Registration) (*Registration, error) {
+	payload := map[string]interface{}{
+		"event_id":  registration.EventID,
+		"user_id":   registration.UserID,
+		"status":    "waitlisted",
+		"notes":     registration.Notes,
+		"tier_id":   nullIfEmpty(registration.TierID),
+		"quantity":  registration.Seats(),
+		"attendees": attendeesOrEmpty(registration.Attendees),
+
+		"promo_code_id": nullIfEmpty(registration.PromoCodeID),
+		"discount":      registration.Discount,
+	}
+
+	var registrations []Registration
+	if err := c.doREST("POST", "/rest/v1/registrations", token, payload, &registrations); err != nil {
+		return nil, err
+	}
+
+	if len(registrations) == 0 {
+		return nil, fmt.Errorf("registration created but no data returned")
+	}
+
+	return &registrations[0], nil
+}
+
+// GetWaitlist returns an event's waitlisted registrations in queue order
+func (c *SupabaseClient) GetWaitlist(eventID string) ([]Registration, error) {
+	path := fmt.Sprintf("/rest/v1/registrations?event_id=eq.%s&status=eq.waitlisted&order=waitlist_position.asc", eventID)
+
+	var registrations []Registration
+	if err := c.doREST("GET", path, "", nil, &registrations); err != nil {
+		return nil, err
+	}
+
+	return registrations, nil
+}
+
+// PromoteFromWaitlist confirms a waitlisted registration (the first one if
+// registrationID is empty) in a single transaction
+func (c *SupabaseClient) PromoteFromWaitlist(eventID, registrationID string) (*Registration, error) {
+	payload := map[string]interface{}{
+		"p_event_id":        eventID,
+		"p_registration_id": nullIfEmpty(registrationID),
+	}
+
+	var registrations []Registration
+	if err := c.doREST("POST", "/rest/v1/rpc/promote_waitlist", "", payload, &registrations); err != nil {
+		return nil, err
+	}
+
+	if len(registrations) == 0 {
+		return nil, nil
+	}
+
+	return &registrations[0], nil
+}
+
+// ReorderWaitlist assigns positions following the order of registrationIDs
+func (c *SupabaseClient) ReorderWaitlist(eventID string, registrationIDs []string) error {
+	return c.doREST("POST", "/rest/v1/rpc/reorder_waitlist", "", map[string]interface{}{
+		"p_event_id":         eventID,
+		"p_registration_ids": registrationIDs,
+	}, nil)
+}
+
+// CompactWaitlist renumbers waitlist positions from 1 without gaps
+func (c *SupabaseClient) CompactWaitlist(eventID string) error {
+	return c.doREST("POST", "/rest/v1/rpc/compact_waitlist", "", map[string]interface{}{"p_event_id": eventID}, nil)
+}
+
+// =====================================================
+// In-memory Waitlist Functions
+// =====================================================
+
+// GetRegistrationByID returns a single registration
+func (m *MemoryStore) GetRegistrationByID(token, registrationID string) (*Registration, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	reg, exists := m.registrations[registrationID]
+	if !exists {
+		return nil, fmt.Errorf("registration not found")
+	}
+
+	registration := *reg
+	return &registration, nil
+}
+
+// AddToWaitlist stores a waitlisted registration at the end of the queue
+func (m *MemoryStore) AddToWaitlist(token string, registration Registration) (*Registration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.events[registration.EventID]; !exists {
+		return nil, fmt.Errorf("failed to create registration: event not found")
+	}
+
+	for _, reg := range m.registrations {
+		if reg.EventID == registration.EventID && reg.UserID == registration.UserID {
+			return nil, errAlreadyRegistered
+		}
+	}
+
+	position := len(m.waitlistLocked(registration.EventID)) + 1
+	now := nowTimestamp()
+	reg := &Registration{
+		ID:               newID(),
+		EventID:          registration.EventID,
+		UserID:           registration.UserID,
+		RegistrationDate: now,
+		Status:           "waitlisted",
+		Notes:            registration.Notes,
+		CreatedAt:        now,
+		WaitlistPosition: &position,
+		TierID:           registration.TierID,
+		Quantity:         registration.Seats(),
+		Attendees:        registration.Attendees,
+		PromoCodeID:      registration.PromoCodeID,
+		Discount:         registration.Discount,
+	}
+	m.registrations[reg.ID] = reg
+
+	created := *reg
+	return &created, nil
+}
+
+// waitlistLocked returns an event's waitlisted registrations in queue order.
+// The caller must hold m.mu.
+func (m *MemoryStore) waitlistLocked(eventID string) []*Registration {
+	var waitlist []*Registration
+	for _, reg := range m.registrations {
+		if reg.EventID == eventID && reg.Status == "waitlisted" {
+			waitlist = append(waitlist, reg)
+		}
+	}
+
+	sort.Slice(waitlist, func(i, j int) bool {
+		return *waitlist[i].WaitlistPosition < *waitlist[j].WaitlistPosition
+	})
+
+	return waitlist
+}
+
+// renumberLocked assigns contiguous positions in the given order. The caller must hold m.mu.
+func renumberLocked(waitlist []*Registration) {
+	for i, reg := range waitlist {
+		position := i + 1
+		reg.WaitlistPosition = &position
+	}
+}
+
+// GetWaitlist returns an event's waitlisted registrations in queue order
+func (m *MemoryStore) GetWaitlist(eventID string) ([]Registration, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	waitlist := []Registration{}
+	for _, reg := range m.waitlistLocked(eventID) {
+		waitlist = append(waitlist, *reg)
+	}
+
+	return waitlist, nil
+}
+
+// PromoteFromWaitlist confirms a waitlisted registration (the first one if
+// registrationID is empty)
+func (m *MemoryStore) PromoteFromWaitlist(eventID, registrationID string) (*Registration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	waitlist := m.waitlistLocked(eventID)
+
+	index := -1
+	for i, reg := range waitlist {
+		if registrationID == "" || reg.ID == registrationID {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil, nil
+	}
+
+	promoted := waitlist[index]
+	promoted.Status = "confirmed"
+	promoted.WaitlistPosition = nil
+	renumberLocked(append(waitlist[:index:index], waitlist[index+1:]...))
+
+	registration := *promoted
+	return &registration, nil
+}
+
+// ReorderWaitlist assigns positions following the order of registrationIDs
+func (m *MemoryStore) ReorderWaitlist(eventID string, registrationIDs []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var ordered []*Registration
+	for _, id := range registrationIDs {
+		reg, exists := m.registrations[id]
+		if !exists || reg.EventID != eventID || reg.Status != "waitlisted" {
+			return fmt.Errorf("registration %s is not on the waitlist", id)
+		}
+		ordered = append(ordered, reg)
+	}
+
+	renumberLocked(ordered)
+	return nil
+}
+
+// CompactWaitlist renumbers waitlist positions from 1 without gaps
+func (m *MemoryStore) CompactWaitlist(eventID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	renumberLocked(m.waitlistLocked(eventID))
+	return nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// waitlistPositions returns the event's waitlisted registration IDs in order
+// along with their positions
+func waitlistPositions(t *testing.T, store *MemoryStore, eventID string) ([]string, []int) {
+	t.Helper()
+
+	waitlist, err := store.GetWaitlist(eventID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := make([]string, len(waitlist))
+	positions := make([]int, len(waitlist))
+	for i, reg := range waitlist {
+		ids[i] = reg.ID
+		positions[i] = *reg.WaitlistPosition
+	}
+	return ids, positions
+}
+
+func TestWaitlist(t *testing.T) {
+	store := newTestStore(t)
+	organizerID, organizerToken := newTestUser(t, store, "organizer@example.com", roleOrganizer)
+
+	capacity := 2
+	event := newTestEvent(t, store, organizerID, CreateEventRequest{Capacity: &capacity, WaitlistEnabled: true})
+
+	tokens := make([]string, 5)
+	registrations := make([]Registration, len(tokens))
+	for i := range tokens {
+		_, tokens[i] = newTestUser(t, store, fmt.Sprintf("attendee-%d@example.com", i), roleAttendee)
+		resp := registerForEvent(t, tokens[i], EventRegistrationRequest{EventID: event.ID})
+		registrations[i] = resp.Registration
+
+		if i < capacity {
+			if resp.Registration.Status != "confirmed" || len(resp.Tickets) != 1 {
+				t.Fatalf("registration %d: expected confirmed with a ticket, got %s with %d tickets", i, resp.Registration.Status, len(resp.Tickets))
+			}
+			continue
+		}
+		if resp.Registration.Status != "waitlisted" || len(resp.Tickets) != 0 {
+			t.Fatalf("registration %d: expected waitlisted without tickets, got %s with %d tickets", i, resp.Registration.Status, len(resp.Tickets))
+		}
+		if got := *resp.Registration.WaitlistPosition; got != i-capacity+1 {
+			t.Fatalf("registration %d: expected waitlist position %d, got %d", i, i-capacity+1, got)
+		}
+	}
+
+	t.Run("team can list it", func(t *testing.T) {
+		rec := serveAuthenticated(handleEventDetail, http.MethodGet, "/api/events/"+event.ID+"/waitlist", organizerToken, nil)
+		expectStatus(t, rec, http.StatusOK)
+
+		var resp struct {
+			Count int `json:"count"`
+		}
+		decodeBody(t, rec, &resp)
+		if resp.Count != 3 {
+			t.Fatalf("expected 3 waitlisted, got %d", resp.Count)
+		}
+
+		rec = serveAuthenticated(handleEventDetail, http.MethodGet, "/api/events/"+event.ID+"/waitlist", tokens[0], nil)
+		expectStatus(t, rec, http.StatusForbidden)
+	})
+
+	t.Run("reorder must list every registration once", func(t *testing.T) {
+		target := "/api/events/" + event.ID + "/waitlist"
+
+		rec := serveAuthenticated(handleEventDetail, http.MethodPut, target, organizerToken, ReorderWaitlistRequest{
+			RegistrationIDs: []string{registrations[4].ID, registrations[3].ID},
+		})
+		expectStatus(t, rec, http.StatusBadRequest)
+
+		rec = serveAuthenticated(handleEventDetail, http.MethodPut, target, organizerToken, ReorderWaitlistRequest{
+			RegistrationIDs: []string{registrations[4].ID, registrations[2].ID, registrations[3].ID},
+		})
+		expectStatus(t, rec, http.StatusOK)
+
+		ids, positions := waitlistPositions(t, store, event.ID)
+		if fmt.Sprint(ids) != fmt.Sprint([]string{registrations[4].ID, registrations[2].ID, registrations[3].ID}) {
+			t.Fatalf("unexpected waitlist order %v", ids)
+		}
+		if fmt.Sprint(positions) != "[1 2 3]" {
+			t.Fatalf("expected positions [1 2 3], got %v", positions)
+		}
+	})
+
+	t.Run("leaving the waitlist compacts positions", func(t *testing.T) {
+		cancelRegistration(t, tokens[2], registrations[2].ID)
+
+		ids, positions := waitlistPositions(t, store, event.ID)
+		if fmt.Sprint(ids) != fmt.Sprint([]string{registrations[4].ID, registrations[3].ID}) || fmt.Sprint(positions) != "[1 2]" {
+			t.Fatalf("expected the waitlist to close the gap, got %v at %v", ids, positions)
+		}
+	})
+
+	t.Run("a cancellation promotes the head of the waitlist", func(t *testing.T) {
+		cancelRegistration(t, tokens[0], registrations[0].ID)
+
+		promoted, err := store.GetRegistrationByID("", registrations[4].ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if promoted.Status != "confirmed" || promoted.WaitlistPosition != nil {
+			t.Fatalf("expected the head of the waitlist to be confirmed, got %+v", promoted)
+		}
+
+		tickets, err := store.GetUserTickets(promoted.UserID, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tickets) != 1 || tickets[0].RegistrationID != promoted.ID {
+			t.Fatalf("expected the promoted registration to get its ticket, got %+v", tickets)
+		}
+
+		ids, positions := waitlistPositions(t, store, event.ID)
+		if fmt.Sprint(ids) != fmt.Sprint([]string{registrations[3].ID}) || fmt.Sprint(positions) != "[1]" {
+			t.Fatalf("expected one registration left at position 1, got %v at %v", ids, positions)
+		}
+	})
+}
+
+func TestFullEventWithoutWaitlist(t *testing.T) {
+	store := newTestStore(t)
+	organizerID, _ := newTestUser(t, store, "organizer@example.com", roleOrganizer)
+
+	capacity := 1
+	event := newTestEvent(t, store, organizerID, CreateEventRequest{Capacity: &capacity})
+
+	_, first := newTestUser(t, store, "first@example.com", roleAttendee)
+	_, second := newTestUser(t, store, "second@example.com", roleAttendee)
+
+	registerForEvent(t, first, EventRegistrationRequest{EventID: event.ID})
+
+	rec := serveAuthenticated(handleRegistrations, http.MethodPost, "/api/registrations", second, EventRegistrationRequest{EventID: event.ID})
+	expectStatus(t, rec, http.StatusConflict)
+}